@@ -9,6 +9,8 @@ require (
 	github.com/aws/aws-sdk-go v1.50.12
 	github.com/cenkalti/backoff/v4 v4.2.1
 	github.com/docker/docker v25.0.3+incompatible
+	github.com/eclipse/paho.golang v0.20.0
+	github.com/eclipse/paho.mqtt.golang v1.4.3
 	github.com/go-errors/errors v1.5.1
 	github.com/go-redis/redis v6.15.9+incompatible
 	github.com/goccy/go-json v0.10.2
@@ -22,6 +24,7 @@ require (
 	github.com/jackc/pglogrepl v0.0.0-20230810221841-d0818e1fbef7
 	github.com/jackc/pgx/v5 v5.5.3
 	github.com/nats-io/nats.go v1.32.0
+	github.com/rabbitmq/amqp091-go v1.9.0
 	github.com/samber/do v1.6.0
 	github.com/samber/lo v1.39.0
 	github.com/segmentio/stats/v4 v4.1.0
@@ -62,6 +65,7 @@ require (
 	github.com/google/go-cmp v0.6.0 // indirect
 	github.com/google/uuid v1.4.0 // indirect
 	github.com/gookit/gsr v0.1.0 // indirect
+	github.com/gorilla/websocket v1.5.0 // indirect
 	github.com/hashicorp/errwrap v1.1.0 // indirect
 	github.com/hashicorp/go-multierror v1.1.1 // indirect
 	github.com/jackc/pgpassfile v1.0.0 // indirect
@@ -24,6 +24,7 @@ import (
 	"github.com/go-errors/errors"
 	"github.com/jackc/pglogrepl"
 	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/eventfiltering"
+	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
 	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
 	"github.com/noctarius/timescaledb-event-streamer/internal/stats"
 	"github.com/noctarius/timescaledb-event-streamer/spi/config"
@@ -31,10 +32,13 @@ import (
 	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
 	"github.com/noctarius/timescaledb-event-streamer/spi/replicationcontext"
 	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/noctarius/timescaledb-event-streamer/spi/statestorage"
 	"github.com/noctarius/timescaledb-event-streamer/spi/stream"
 	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
 	"github.com/noctarius/timescaledb-event-streamer/spi/task"
 	"github.com/samber/lo"
+	"sync/atomic"
 	"time"
 )
 
@@ -52,10 +56,14 @@ type eventEmitterStats struct {
 		time  time.Duration `metric:"runtime" type:"histogram"`
 		retry uint          `metric:"retry" type:"histogram"`
 	} `metric:"emitted"`
+	deadLetters struct {
+		count uint64 `metric:"count" type:"counter"`
+	} `metric:"deadletters"`
 }
 
 func (ees *eventEmitterStats) reset() {
 	ees.calls.count = 0
+	ees.deadLetters.count = 0
 }
 
 type EventEmitter struct {
@@ -64,17 +72,21 @@ type EventEmitter struct {
 	typeManager        pgtypes.TypeManager
 	taskManager        task.TaskManager
 	streamManager      stream.Manager
+	sinkManager        sink.Manager
+	deadLetterHandler  *sinkimpl.DeadLetterHandler
 	statsReporter      *stats.Reporter
 	backOff            backoff.BackOff
 	logger             *logging.Logger
 
+	transactionInFlight atomic.Bool
+
 	stats *eventEmitterStats
 }
 
 func NewEventEmitterFromConfig(
 	c *config.Config, replicationContext replicationcontext.ReplicationContext,
-	streamManager stream.Manager, typeManager pgtypes.TypeManager,
-	taskManager task.TaskManager, statsService *stats.Service,
+	streamManager stream.Manager, sinkManager sink.Manager, typeManager pgtypes.TypeManager,
+	taskManager task.TaskManager, statsService *stats.Service, stateStorageManager statestorage.Manager,
 ) (*EventEmitter, error) {
 
 	filters, err := eventfiltering.NewEventFilter(c.Sink.Filters)
@@ -82,13 +94,21 @@ func NewEventEmitterFromConfig(
 		return nil, err
 	}
 
-	return NewEventEmitter(replicationContext, streamManager, typeManager, taskManager, statsService, filters)
+	deadLetterHandler, err := sinkimpl.NewDeadLetterHandlerFromConfig(c, stateStorageManager)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewEventEmitter(
+		replicationContext, streamManager, sinkManager, typeManager,
+		taskManager, statsService, filters, deadLetterHandler,
+	)
 }
 
 func NewEventEmitter(
 	replicationContext replicationcontext.ReplicationContext, streamManager stream.Manager,
-	typeManager pgtypes.TypeManager, taskManager task.TaskManager, statsService *stats.Service,
-	filter eventfiltering.EventFilter,
+	sinkManager sink.Manager, typeManager pgtypes.TypeManager, taskManager task.TaskManager, statsService *stats.Service,
+	filter eventfiltering.EventFilter, deadLetterHandler *sinkimpl.DeadLetterHandler,
 ) (*EventEmitter, error) {
 
 	logger, err := logging.NewLogger("EventEmitter")
@@ -96,11 +116,19 @@ func NewEventEmitter(
 		return nil, err
 	}
 
+	// Batched events fail detached from the event being emitted,
+	// the sink manager parks them in the dead-letter target itself
+	if deadLetterAware, ok := sinkManager.(sinkimpl.DeadLetterAware); ok && deadLetterHandler != nil {
+		deadLetterAware.SetDeadLetterHandler(deadLetterHandler)
+	}
+
 	return &EventEmitter{
 		replicationContext: replicationContext,
 		typeManager:        typeManager,
 		taskManager:        taskManager,
 		streamManager:      streamManager,
+		sinkManager:        sinkManager,
+		deadLetterHandler:  deadLetterHandler,
 		filter:             filter,
 		logger:             logger,
 		statsReporter:      statsService.NewReporter("streamer_eventemitter"),
@@ -115,11 +143,56 @@ func (ee *EventEmitter) PostConstruct() error {
 }
 
 func (ee *EventEmitter) Start() error {
-	return ee.streamManager.Start()
+	if ee.deadLetterHandler != nil {
+		if err := ee.deadLetterHandler.Start(); err != nil {
+			return err
+		}
+	}
+	if err := ee.streamManager.Start(); err != nil {
+		return err
+	}
+
+	// Sinks storing the committed LSN with the events know best where
+	// the replication has to resume, their offset replaces the stored one
+	lsn, found, err := ee.sinkManager.CommittedLSN()
+	if err != nil {
+		return err
+	}
+	if found {
+		ee.logger.Infof("Resuming replication from LSN %s committed by the sink", lsn)
+		return ee.replicationContext.AcknowledgeProcessed(pgtypes.XLogData{
+			XLogData: pglogrepl.XLogData{ServerTime: time.Now()},
+		}, &lsn)
+	}
+	return nil
+}
+
+// RegisterTables registers the given tables with the sink upfront,
+// if the sink asks for it, instead of before their first event
+func (ee *EventEmitter) RegisterTables(
+	tables []schema.TableAlike,
+) error {
+
+	if !ee.sinkManager.EagerTableRegistration() {
+		return nil
+	}
+
+	for _, table := range tables {
+		if err := ee.streamManager.GetOrCreateStream(table).Register(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (ee *EventEmitter) Stop() error {
-	return ee.streamManager.Stop()
+	err := ee.streamManager.Stop()
+	if ee.deadLetterHandler != nil {
+		if stopErr := ee.deadLetterHandler.Stop(); err == nil {
+			err = stopErr
+		}
+	}
+	return err
 }
 
 func (ee *EventEmitter) Stop1() error {
@@ -144,23 +217,57 @@ func (ee *EventEmitter) emit(
 	// Retryable operation
 	operation := func() error {
 		ee.logger.Tracef("Publishing event: %+v", value)
-		return stream.Emit(key, value)
+		if err := stream.Emit(key, value); err != nil {
+			// Permanent errors won't go away by retrying
+			if sink.IsPermanentError(err) {
+				return backoff.Permanent(err)
+			}
+			return err
+		}
+		return nil
 	}
 
 	// Run with backoff (it'll automatically reset before starting)
+	ee.stats.reset()
 	if err := backoff.RetryNotify(operation, ee.backOff, func(_ error, _ time.Duration) {
 		retries++
 	}); err != nil {
-		return err
+		// Without a dead-letter target the error stops the replication,
+		// otherwise the event is parked there and replication continues
+		if ee.deadLetterHandler == nil || !ee.deadLetterHandler.Handles(err) {
+			return err
+		}
+		if dlErr := ee.deadLetterHandler.Emit(time.Now(), stream.TopicName(), key, value, err); dlErr != nil {
+			ee.logger.Errorf("Failed to park event in dead-letter target: %+v", dlErr)
+			return err
+		}
+		ee.stats.deadLetters.count++
+	} else {
+		ee.stats.calls.count++
 	}
 
-	ee.stats.reset()
-	ee.stats.calls.count++
 	ee.stats.calls.time = time.Since(start)
 	ee.stats.calls.retry = retries
 	ee.statsReporter.Report(ee.stats)
 
-	return ee.replicationContext.AcknowledgeProcessed(xld, nil)
+	return ee.acknowledge(xld)
+}
+
+func (ee *EventEmitter) acknowledge(
+	xld pgtypes.XLogData,
+) error {
+
+	// Events of a source transaction handled by a transaction aware sink
+	// are acknowledged as a whole, after the sink committed the transaction.
+	// Otherwise, a restart would resume in the middle of the transaction.
+	if ee.transactionInFlight.Load() {
+		return nil
+	}
+
+	// Events are tracked in the order they're emitted, async and batching
+	// sinks may acknowledge them later, and out of order. The replication
+	// context only advances the LSN over contiguously acknowledged events.
+	return ee.sinkManager.Acknowledge(ee.replicationContext.TrackInFlight(xld, nil))
 }
 
 type eventEmitterEventHandler struct {
@@ -322,9 +429,14 @@ func (e *eventEmitterEventHandler) OnRelationEvent(
 }
 
 func (e *eventEmitterEventHandler) OnBeginEvent(
-	_ pgtypes.XLogData, _ *pgtypes.BeginMessage,
+	_ pgtypes.XLogData, msg *pgtypes.BeginMessage,
 ) error {
-	return nil
+
+	sinkManager := e.eventEmitter.sinkManager
+	if sinkManager.TransactionAware() {
+		e.eventEmitter.transactionInFlight.Store(true)
+	}
+	return sinkManager.BeginTransaction(msg.Xid, msg.CommitTime)
 }
 
 func (e *eventEmitterEventHandler) OnCommitEvent(
@@ -349,11 +461,20 @@ func (e *eventEmitterEventHandler) OnTransactionFinishedEvent(
 	xld pgtypes.XLogData, msg *pgtypes.CommitMessage,
 ) error {
 
+	// Transaction aware sinks may only apply the transaction's events on
+	// commit, the transaction must not be acknowledged before that happened
+	transactionEndLSN := pgtypes.LSN(msg.TransactionEndLSN)
+	if err := e.eventEmitter.sinkManager.CommitTransaction(xld.Xid, transactionEndLSN); err != nil {
+		return err
+	}
+	e.eventEmitter.transactionInFlight.Store(false)
+
 	e.eventEmitter.logger.Debugf(
 		"Transaction xid=%d (LSN: %s) marked as processed", xld.Xid, msg.TransactionEndLSN,
 	)
-	transactionEndLSN := pgtypes.LSN(msg.TransactionEndLSN)
-	return e.eventEmitter.replicationContext.AcknowledgeProcessed(xld, &transactionEndLSN)
+	return e.eventEmitter.sinkManager.Acknowledge(
+		e.eventEmitter.replicationContext.TrackInFlight(xld, &transactionEndLSN),
+	)
 }
 
 func (e *eventEmitterEventHandler) emit(
@@ -399,7 +520,7 @@ func (e *eventEmitterEventHandler) emit0(
 
 	// If unsuccessful we'll discard the event and not send it to the sink
 	if !success {
-		return e.eventEmitter.replicationContext.AcknowledgeProcessed(xld, nil)
+		return e.eventEmitter.acknowledge(xld)
 	}
 
 	return e.eventEmitter.emit(xld, selectedStream, key, value)
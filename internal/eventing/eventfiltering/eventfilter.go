@@ -128,11 +128,17 @@ func (f *eventFilter) evaluate(
 	key, value schema.Struct,
 ) (bool, error) {
 
+	// Events without key (like truncates) have no key payload
+	keyPayload, _ := key[schema.FieldNamePayload].(schema.Struct)
+	keySchema, _ := key[schema.FieldNameSchema].(schema.Struct)
+	valuePayload, _ := value[schema.FieldNamePayload].(schema.Struct)
+	valueSchema, _ := value[schema.FieldNameSchema].(schema.Struct)
+
 	env := map[string]schema.Struct{
-		"key":         key[schema.FieldNamePayload].(schema.Struct),
-		"keySchema":   key[schema.FieldNameSchema].(schema.Struct),
-		"value":       value[schema.FieldNamePayload].(schema.Struct),
-		"valueSchema": value[schema.FieldNameSchema].(schema.Struct),
+		"key":         keyPayload,
+		"keySchema":   keySchema,
+		"value":       valuePayload,
+		"valueSchema": valueSchema,
 	}
 
 	result, err := f.vm.Run(f.prog, env)
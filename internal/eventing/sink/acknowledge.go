@@ -0,0 +1,36 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sink
+
+// SharedAcknowledgement returns a function which calls the given
+// acknowledgement when it was called for the given number of times,
+// e.g. once by each buffer holding events to be acknowledged. It
+// isn't safe for concurrent use, calls have to be synchronized.
+func SharedAcknowledgement(
+	count int, acknowledge func() error,
+) func() error {
+
+	remaining := count
+	return func() error {
+		remaining--
+		if remaining != 0 {
+			return nil
+		}
+		return acknowledge()
+	}
+}
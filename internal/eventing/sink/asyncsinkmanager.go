@@ -0,0 +1,148 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sink
+
+import (
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/noctarius/timescaledb-event-streamer/spi/statestorage"
+	"sync"
+	"time"
+)
+
+// pendingCompletion is an event handed to the async sink, which
+// isn't completed yet, with the acknowledgements waiting for it
+type pendingCompletion struct {
+	completed    bool
+	acknowledges []func() error
+}
+
+// asyncSinkManager hands events to an async sink without waiting for
+// them to be confirmed. Functions passed to Acknowledge are deferred
+// until the event emitted last is completed, the replication context
+// keeps the LSN from passing events which are still in flight.
+type asyncSinkManager struct {
+	*sinkManager
+	mutex     sync.Mutex
+	logger    *logging.Logger
+	asyncSink sink.AsyncSink
+	last      *pendingCompletion
+	failure   error
+}
+
+func newAsyncSinkManager(
+	stateStorageManager statestorage.Manager, stateName string, s sink.Sink, asyncSink sink.AsyncSink,
+) (sink.Manager, error) {
+
+	logger, err := logging.NewLogger("AsyncSinkManager")
+	if err != nil {
+		return nil, err
+	}
+
+	return &asyncSinkManager{
+		sinkManager: newSinkManager(stateStorageManager, stateName, s),
+		logger:      logger,
+		asyncSink:   asyncSink,
+	}, nil
+}
+
+func (asm *asyncSinkManager) Emit(
+	timestamp time.Time, topicName string, key, envelope schema.Struct,
+) error {
+
+	if err := asm.precedingFailure(); err != nil {
+		return err
+	}
+
+	pending := &pendingCompletion{}
+	if err := asm.asyncSink.EmitAsync(
+		asm.sinkContext, timestamp, topicName, key, envelope,
+		func(err error) {
+			asm.complete(pending, err)
+		},
+	); err != nil {
+		return classifyError(asm.sink, err)
+	}
+
+	asm.mutex.Lock()
+	defer asm.mutex.Unlock()
+	asm.last = pending
+	return nil
+}
+
+func (asm *asyncSinkManager) Acknowledge(
+	acknowledge func() error,
+) error {
+
+	asm.mutex.Lock()
+	if asm.failure != nil {
+		asm.mutex.Unlock()
+		return &precedingEventsError{err: asm.failure}
+	}
+
+	if asm.last == nil || asm.last.completed {
+		asm.mutex.Unlock()
+		return acknowledge()
+	}
+
+	asm.last.acknowledges = append(asm.last.acknowledges, acknowledge)
+	asm.mutex.Unlock()
+	return nil
+}
+
+func (asm *asyncSinkManager) complete(
+	pending *pendingCompletion, err error,
+) {
+
+	asm.mutex.Lock()
+	pending.completed = true
+
+	// A failed event is never acknowledged, the watermark stays
+	// in front of it, and the replication is stopped with the next
+	// event to restart from the watermark
+	if err != nil {
+		if asm.failure == nil {
+			asm.failure = classifyError(asm.sink, err)
+		}
+		pending.acknowledges = nil
+		asm.mutex.Unlock()
+		asm.logger.Errorf("Failed to emit event: %+v", err)
+		return
+	}
+
+	acknowledges := pending.acknowledges
+	pending.acknowledges = nil
+	asm.mutex.Unlock()
+
+	for _, acknowledge := range acknowledges {
+		if err := acknowledge(); err != nil {
+			asm.logger.Warnf("Failed to acknowledge event: %+v", err)
+		}
+	}
+}
+
+func (asm *asyncSinkManager) precedingFailure() error {
+	asm.mutex.Lock()
+	defer asm.mutex.Unlock()
+
+	if asm.failure != nil {
+		return &precedingEventsError{err: asm.failure}
+	}
+	return nil
+}
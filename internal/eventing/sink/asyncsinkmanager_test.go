@@ -0,0 +1,108 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sink
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type recordingAsyncSink struct {
+	recordingSink
+	completions []sink.Completion
+}
+
+func (r *recordingAsyncSink) EmitAsync(
+	_ sink.Context, _ time.Time, _ string, _, _ schema.Struct, completion sink.Completion,
+) error {
+
+	r.completions = append(r.completions, completion)
+	return nil
+}
+
+func Test_Async_Acknowledges_On_Completion(
+	t *testing.T,
+) {
+
+	asyncSink := &recordingAsyncSink{}
+	manager := newTestAsyncSinkManager(t, asyncSink)
+
+	acknowledged := make([]int, 0)
+	for i := 0; i < 2; i++ {
+		event := i
+		assert.NoError(t, manager.Emit(time.Now(), "timescaledb.public.metrics", testKey(), testEnvelope("c")))
+		assert.NoError(t, manager.Acknowledge(func() error {
+			acknowledged = append(acknowledged, event)
+			return nil
+		}))
+	}
+	assert.Len(t, acknowledged, 0)
+
+	// Completions may happen out of order
+	asyncSink.completions[1](nil)
+	asyncSink.completions[0](nil)
+	assert.Equal(t, []int{1, 0}, acknowledged)
+
+	// Without events in flight, acknowledgements happen immediately
+	assert.NoError(t, manager.Acknowledge(func() error {
+		acknowledged = append(acknowledged, 2)
+		return nil
+	}))
+	assert.Equal(t, []int{1, 0, 2}, acknowledged)
+}
+
+func Test_Async_Failure_Stops_Emitting(
+	t *testing.T,
+) {
+
+	asyncSink := &recordingAsyncSink{}
+	manager := newTestAsyncSinkManager(t, asyncSink)
+
+	acknowledged := false
+	assert.NoError(t, manager.Emit(time.Now(), "timescaledb.public.metrics", testKey(), testEnvelope("c")))
+	assert.NoError(t, manager.Acknowledge(func() error {
+		acknowledged = true
+		return nil
+	}))
+
+	asyncSink.completions[0](errors.Errorf("failed to publish"))
+	assert.False(t, acknowledged)
+
+	err := manager.Emit(time.Now(), "timescaledb.public.metrics", testKey(), testEnvelope("c"))
+	assert.ErrorContains(t, err, "failed to publish")
+	assert.False(t, (&DeadLetterHandler{}).Handles(err))
+	assert.Len(t, asyncSink.completions, 1)
+}
+
+func newTestAsyncSinkManager(
+	t *testing.T, asyncSink *recordingAsyncSink,
+) *asyncSinkManager {
+
+	return &asyncSinkManager{
+		sinkManager: &sinkManager{
+			sinkContext: newSinkContext(),
+			sink:        asyncSink,
+		},
+		logger:    testLogger(t),
+		asyncSink: asyncSink,
+	}
+}
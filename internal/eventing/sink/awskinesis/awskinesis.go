@@ -32,6 +32,11 @@ import (
 	"time"
 )
 
+const (
+	maxPutRecordsCount = 500
+	maxPutRecordsBytes = 5 * 1024 * 1024
+)
+
 func init() {
 	sinkimpl.RegisterSink(config.AwsKinesis, newAwsKinesisSink)
 }
@@ -149,3 +154,60 @@ func (a *awsKinesisSink) Emit(
 
 	return nil
 }
+
+func (a *awsKinesisSink) EmitBatch(
+	_ sink.Context, events []sink.Event,
+) error {
+
+	// PutRecords accepts up to 500 records and 5 MB per request,
+	// larger batches are split into multiple requests
+	records := make([]*kinesis.PutRecordsRequestEntry, 0, len(events))
+	size := 0
+	for _, event := range events {
+		recordSize := len(event.EnvelopeData) + len(event.TopicName)
+		if len(records) == maxPutRecordsCount || (len(records) > 0 && size+recordSize > maxPutRecordsBytes) {
+			if err := a.putRecords(records); err != nil {
+				return err
+			}
+			records = make([]*kinesis.PutRecordsRequestEntry, 0, len(events))
+			size = 0
+		}
+
+		records = append(records, &kinesis.PutRecordsRequestEntry{
+			PartitionKey: aws.String(event.TopicName),
+			Data:         event.EnvelopeData,
+		})
+		size += recordSize
+	}
+	return a.putRecords(records)
+}
+
+func (a *awsKinesisSink) putRecords(
+	records []*kinesis.PutRecordsRequestEntry,
+) error {
+
+	if len(records) == 0 {
+		return nil
+	}
+
+	output, err := a.awsKinesis.PutRecords(&kinesis.PutRecordsInput{
+		StreamName: a.streamName,
+		Records:    records,
+	})
+	if err != nil {
+		return err
+	}
+
+	if output.FailedRecordCount != nil && *output.FailedRecordCount > 0 {
+		for _, record := range output.Records {
+			if record.ErrorCode != nil {
+				return errors.Errorf(
+					"AWS Kinesis rejected %d of %d records: %s (%s)", *output.FailedRecordCount,
+					len(records), aws.StringValue(record.ErrorMessage), *record.ErrorCode,
+				)
+			}
+		}
+		return errors.Errorf("AWS Kinesis rejected %d of %d records", *output.FailedRecordCount, len(records))
+	}
+	return nil
+}
@@ -0,0 +1,377 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package awss3
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/cenkalti/backoff/v4"
+	"github.com/go-errors/errors"
+	"github.com/inhies/go-bytesize"
+	"github.com/jackc/pglogrepl"
+	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/internal/waiting"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultKeyTemplate = "{topic}/{yyyy}/{mm}/{dd}/{hh}/{firstLsn}-{lastLsn}.ndjson.gz"
+
+func init() {
+	sinkimpl.RegisterSink(config.AwsS3, newAwsS3Sink)
+}
+
+type awsS3Sink struct {
+	mutex           sync.Mutex
+	logger          *logging.Logger
+	awsS3           *s3.S3
+	encoder         *encoding.JsonEncoder
+	bucketName      string
+	keyTemplate     string
+	compress        bool
+	maxSize         int
+	maxDuration     time.Duration
+	inTransaction   bool
+	buffers         map[string]*buffer
+	ticker          *time.Ticker
+	shutdownAwaiter *waiting.ShutdownAwaiter
+	backOff         backoff.BackOff
+}
+
+func newAwsS3Sink(
+	c *config.Config,
+) (sink.Sink, error) {
+
+	logger, err := logging.NewLogger("AwsS3Sink")
+	if err != nil {
+		return nil, err
+	}
+
+	bucketName := config.GetOrDefault[*string](c, config.PropertyS3BucketName, nil)
+	if bucketName == nil || *bucketName == "" {
+		return nil, errors.Errorf("AWS S3 sink needs the bucket name to be configured")
+	}
+
+	maxSizeProperty := config.GetOrDefault(c, config.PropertyS3ObjectMaxSize, "16MB")
+	maxSize, err := bytesize.Parse(maxSizeProperty)
+	if err != nil {
+		return nil, errors.Errorf("Failed to parse max size property '%s' => %s", maxSizeProperty, err.Error())
+	}
+
+	awsRegion := config.GetOrDefault[*string](c, config.PropertyS3AwsRegion, nil)
+	endpoint := config.GetOrDefault(c, config.PropertyS3AwsEndpoint, "")
+	accessKeyId := config.GetOrDefault(c, config.PropertyS3AwsAccessKeyId, "")
+	secretAccessKey := config.GetOrDefault(c, config.PropertyS3AwsSecretAccessKey, "")
+	sessionToken := config.GetOrDefault(c, config.PropertyS3AwsSessionToken, "")
+
+	// S3-compatible storages, like MinIO, commonly require path-style bucket addressing
+	awsConfig := aws.NewConfig().
+		WithEndpoint(endpoint).
+		WithS3ForcePathStyle(config.GetOrDefault(c, config.PropertyS3BucketForcePathStyle, false))
+
+	if accessKeyId != "" && secretAccessKey != "" {
+		awsConfig = awsConfig.WithCredentials(
+			credentials.NewStaticCredentials(accessKeyId, secretAccessKey, sessionToken),
+		)
+	}
+
+	if awsRegion != nil {
+		awsConfig = awsConfig.WithRegion(*awsRegion)
+	}
+
+	awsSession, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	keyTemplate := config.GetOrDefault(c, config.PropertyS3ObjectKeyTemplate, defaultKeyTemplate)
+
+	return &awsS3Sink{
+		logger:      logger,
+		awsS3:       s3.New(awsSession),
+		encoder:     encoding.NewJsonEncoderWithConfig(c),
+		bucketName:  *bucketName,
+		keyTemplate: keyTemplate,
+		compress:    strings.HasSuffix(keyTemplate, ".gz"),
+		maxSize:     int(maxSize),
+		maxDuration: time.Duration(
+			config.GetOrDefault(c, config.PropertyS3ObjectMaxDuration, 60),
+		) * time.Second,
+		buffers:         make(map[string]*buffer),
+		shutdownAwaiter: waiting.NewShutdownAwaiter(),
+		backOff:         backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 8),
+	}, nil
+}
+
+func (a *awsS3Sink) Start() error {
+	a.logger.Infof("Starting AwsS3Sink for bucket %s", a.bucketName)
+	if a.ticker == nil && a.maxDuration > 0 {
+		a.ticker = time.NewTicker(time.Second)
+		go a.flushHandler()
+	}
+	return nil
+}
+
+func (a *awsS3Sink) Stop() error {
+	a.logger.Infof("Stopping AwsS3Sink for bucket %s", a.bucketName)
+	if a.ticker != nil {
+		a.shutdownAwaiter.SignalShutdown()
+		if err := a.shutdownAwaiter.AwaitDone(); err != nil {
+			a.logger.Warnln("Failed to shutdown flush handler in time")
+		}
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	var lastErr error
+	for topicName, b := range a.buffers {
+		if b.pending != nil {
+			// The source transaction wasn't acknowledged, and will be
+			// replicated again when the streamer is restarted
+			a.logger.Warnf(
+				"Discarding %d events of unfinished transaction for topic %s", b.pending.events, topicName,
+			)
+		}
+		if err := a.flush(topicName, b); err != nil {
+			a.logger.Warnf("Failed to flush object of topic %s: %+v", topicName, err)
+			lastErr = err
+		}
+	}
+	a.buffers = make(map[string]*buffer)
+	return lastErr
+}
+
+func (a *awsS3Sink) BeginTransaction(
+	_ sink.Context, _ uint32, _ time.Time,
+) error {
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.inTransaction = true
+	return nil
+}
+
+func (a *awsS3Sink) CommitTransaction(
+	_ sink.Context, xid uint32, _ pgtypes.LSN,
+) error {
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.inTransaction = false
+	for topicName, b := range a.buffers {
+		b.commit()
+		if !a.needsFlush(b) {
+			continue
+		}
+
+		// Commits aren't retried by the event emitter
+		if err := backoff.RetryNotify(func() error {
+			return a.flush(topicName, b)
+		}, a.backOff, func(err error, _ time.Duration) {
+			a.logger.Warnf("Failed to flush object of topic %s after transaction xid=%d, retrying: %+v",
+				topicName, xid, err,
+			)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *awsS3Sink) Emit(
+	_ sink.Context, timestamp time.Time, topicName string, _, envelope schema.Struct,
+) error {
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	data, err := a.encoder.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	var lsn pglogrepl.LSN
+	if payload, ok := envelope[schema.FieldNamePayload].(schema.Struct); ok {
+		if source, ok := payload[schema.FieldNameSource].(schema.Struct); ok {
+			if l, ok := source[schema.FieldNameLSN].(string); ok && l != "" {
+				if lsn, err = pglogrepl.ParseLSN(l); err != nil {
+					return errors.Wrap(err, 0)
+				}
+			}
+		}
+	}
+
+	b, present := a.buffers[topicName]
+	if !present {
+		b = &buffer{}
+		a.buffers[topicName] = b
+	}
+
+	// Events of a source transaction are kept aside until the transaction
+	// commits, to never write objects containing a partial transaction
+	if a.inTransaction {
+		b.append(true, data, lsn, timestamp)
+		return nil
+	}
+
+	// Events outside a source transaction (snapshots) are transaction
+	// boundaries by themselves. A full object is flushed before the event
+	// is added, when the flush fails the event is retried without duplication
+	if a.needsFlush(b) {
+		if err := a.flush(topicName, b); err != nil {
+			return err
+		}
+	}
+	b.append(false, data, lsn, timestamp)
+	return nil
+}
+
+// Acknowledge defers the acknowledgement until all objects holding
+// previously emitted events were written, since Emit only buffers them
+func (a *awsS3Sink) Acknowledge(
+	_ sink.Context, acknowledge func() error,
+) error {
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	objects := make([]*object, 0, len(a.buffers))
+	for _, b := range a.buffers {
+		if b.committed != nil && b.committed.events > 0 {
+			objects = append(objects, b.committed)
+		}
+	}
+	if len(objects) == 0 {
+		return acknowledge()
+	}
+
+	// The acknowledgement is shared by the objects of all
+	// topics, it's called after the last of them was written
+	shared := sinkimpl.SharedAcknowledgement(len(objects), acknowledge)
+	for _, o := range objects {
+		o.acknowledges = append(o.acknowledges, shared)
+	}
+	return nil
+}
+
+func (a *awsS3Sink) flushHandler() {
+	for {
+		select {
+		case <-a.shutdownAwaiter.AwaitShutdownChan():
+			a.ticker.Stop()
+			a.shutdownAwaiter.SignalDone()
+			return
+		case <-a.ticker.C:
+			a.mutex.Lock()
+			for topicName, b := range a.buffers {
+				if b.committed == nil || time.Since(b.committed.openedAt) < a.maxDuration {
+					continue
+				}
+				if err := a.flush(topicName, b); err != nil {
+					a.logger.Warnf("Failed to flush object of topic %s, retrying: %+v", topicName, err)
+				}
+			}
+			a.mutex.Unlock()
+		}
+	}
+}
+
+func (a *awsS3Sink) needsFlush(
+	b *buffer,
+) bool {
+
+	if b.committed == nil {
+		return false
+	}
+	if b.committed.data.Len() >= a.maxSize {
+		return true
+	}
+	return a.maxDuration > 0 && time.Since(b.committed.openedAt) >= a.maxDuration
+}
+
+func (a *awsS3Sink) flush(
+	topicName string, b *buffer,
+) error {
+
+	o := b.committed
+	if o == nil || o.events == 0 {
+		return nil
+	}
+
+	body := o.data.Bytes()
+	contentType := "application/x-ndjson"
+	if a.compress {
+		compressed := &bytes.Buffer{}
+		writer := gzip.NewWriter(compressed)
+		if _, err := writer.Write(body); err != nil {
+			return errors.Wrap(err, 0)
+		}
+		if err := writer.Close(); err != nil {
+			return errors.Wrap(err, 0)
+		}
+		body = compressed.Bytes()
+		contentType = "application/gzip"
+	}
+
+	key := objectKey(a.keyTemplate, topicName, o)
+	if _, err := a.awsS3.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(a.bucketName),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String(contentType),
+	}); err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	a.logger.Verbosef("Flushed object %s with %d events", key, o.events)
+	b.committed = nil
+	return o.acknowledge()
+}
+
+func objectKey(
+	keyTemplate, topicName string, o *object,
+) string {
+
+	timestamp := o.timestamp.UTC()
+	return strings.NewReplacer(
+		"{topic}", topicName,
+		"{yyyy}", fmt.Sprintf("%04d", timestamp.Year()),
+		"{mm}", fmt.Sprintf("%02d", timestamp.Month()),
+		"{dd}", fmt.Sprintf("%02d", timestamp.Day()),
+		"{hh}", fmt.Sprintf("%02d", timestamp.Hour()),
+		// LSNs are formatted as fixed length hex strings, to sort
+		// lexicographically and not contain the LSN's slash
+		"{firstLsn}", fmt.Sprintf("%016X", uint64(o.firstLsn)),
+		"{lastLsn}", fmt.Sprintf("%016X", uint64(o.lastLsn)),
+	).Replace(keyTemplate)
+}
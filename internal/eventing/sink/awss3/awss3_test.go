@@ -0,0 +1,109 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package awss3
+
+import (
+	"github.com/jackc/pglogrepl"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_Object_Key_Template(
+	t *testing.T,
+) {
+
+	o := &object{}
+	timestamp := time.Date(2023, 3, 25, 7, 12, 0, 0, time.UTC)
+	o.append([]byte("{}"), pglogrepl.LSN(0x16B3748), timestamp)
+	o.append([]byte("{}"), pglogrepl.LSN(0x1000016B3800), timestamp.Add(time.Hour))
+
+	assert.Equal(t,
+		"timescaledb.public.metrics/2023/03/25/07/00000000016B3748-00001000016B3800.ndjson.gz",
+		objectKey(defaultKeyTemplate, "timescaledb.public.metrics", o),
+	)
+}
+
+func Test_Buffer_Holds_Back_Pending_Transaction(
+	t *testing.T,
+) {
+
+	b := &buffer{}
+	timestamp := time.Now()
+	b.append(false, []byte(`{"a":1}`), pglogrepl.LSN(10), timestamp)
+	b.append(true, []byte(`{"a":2}`), pglogrepl.LSN(20), timestamp)
+	b.append(true, []byte(`{"a":3}`), pglogrepl.LSN(30), timestamp)
+
+	assert.Equal(t, 1, b.committed.events)
+	assert.Equal(t, "{\"a\":1}\n", b.committed.data.String())
+	assert.Equal(t, 2, b.pending.events)
+
+	b.commit()
+	assert.Nil(t, b.pending)
+	assert.Equal(t, 3, b.committed.events)
+	assert.Equal(t, pglogrepl.LSN(10), b.committed.firstLsn)
+	assert.Equal(t, pglogrepl.LSN(30), b.committed.lastLsn)
+	assert.Equal(t, "{\"a\":1}\n{\"a\":2}\n{\"a\":3}\n", b.committed.data.String())
+}
+
+func Test_Buffer_Commit_Without_Committed_Object(
+	t *testing.T,
+) {
+
+	b := &buffer{}
+	b.commit()
+	assert.Nil(t, b.committed)
+
+	b.append(true, []byte(`{}`), pglogrepl.LSN(20), time.Now())
+	b.commit()
+	assert.Equal(t, 1, b.committed.events)
+	assert.Equal(t, pglogrepl.LSN(20), b.committed.firstLsn)
+}
+
+func Test_Acknowledge_Deferred_Until_Objects_Written(
+	t *testing.T,
+) {
+
+	a := &awsS3Sink{buffers: make(map[string]*buffer)}
+
+	acknowledged := 0
+	acknowledge := func() error {
+		acknowledged++
+		return nil
+	}
+
+	// Without buffered events, acknowledgements happen immediately
+	assert.NoError(t, a.Acknowledge(nil, acknowledge))
+	assert.Equal(t, 1, acknowledged)
+
+	first := &buffer{}
+	first.append(false, []byte(`{}`), pglogrepl.LSN(10), time.Now())
+	second := &buffer{}
+	second.append(false, []byte(`{}`), pglogrepl.LSN(20), time.Now())
+	a.buffers["first"] = first
+	a.buffers["second"] = second
+
+	assert.NoError(t, a.Acknowledge(nil, acknowledge))
+	assert.Equal(t, 1, acknowledged)
+
+	assert.NoError(t, first.committed.acknowledge())
+	assert.Equal(t, 1, acknowledged)
+
+	assert.NoError(t, second.committed.acknowledge())
+	assert.Equal(t, 2, acknowledged)
+}
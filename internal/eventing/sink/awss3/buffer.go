@@ -0,0 +1,113 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package awss3
+
+import (
+	"bytes"
+	"github.com/jackc/pglogrepl"
+	"time"
+)
+
+type object struct {
+	data         bytes.Buffer
+	events       int
+	firstLsn     pglogrepl.LSN
+	lastLsn      pglogrepl.LSN
+	timestamp    time.Time
+	openedAt     time.Time
+	acknowledges []func() error
+}
+
+func (o *object) append(
+	data []byte, lsn pglogrepl.LSN, timestamp time.Time,
+) {
+
+	if o.events == 0 {
+		o.firstLsn = lsn
+		o.timestamp = timestamp
+		o.openedAt = time.Now()
+	}
+	o.data.Write(data)
+	o.data.WriteByte('\n')
+	o.lastLsn = lsn
+	o.events++
+}
+
+func (o *object) merge(
+	other *object,
+) {
+
+	if o.events == 0 {
+		o.firstLsn = other.firstLsn
+		o.timestamp = other.timestamp
+		o.openedAt = other.openedAt
+	}
+	o.data.Write(other.data.Bytes())
+	o.lastLsn = other.lastLsn
+	o.events += other.events
+	o.acknowledges = append(o.acknowledges, other.acknowledges...)
+}
+
+// acknowledge calls the acknowledgements deferred
+// until the object was written
+func (o *object) acknowledge() error {
+	var err error
+	acknowledges := o.acknowledges
+	o.acknowledges = nil
+	for _, acknowledge := range acknowledges {
+		if ackErr := acknowledge(); ackErr != nil && err == nil {
+			err = ackErr
+		}
+	}
+	return err
+}
+
+// buffer collects the events of a topic. Events of committed
+// transactions are collected in the committed object, which is
+// eventually written, while events of the currently running
+// transaction are held back in the pending object.
+type buffer struct {
+	committed *object
+	pending   *object
+}
+
+func (b *buffer) append(
+	pending bool, data []byte, lsn pglogrepl.LSN, timestamp time.Time,
+) {
+
+	target := &b.committed
+	if pending {
+		target = &b.pending
+	}
+	if *target == nil {
+		*target = &object{}
+	}
+	(*target).append(data, lsn, timestamp)
+}
+
+func (b *buffer) commit() {
+	if b.pending == nil {
+		return
+	}
+	if b.committed == nil {
+		b.committed = b.pending
+	} else {
+		b.committed.merge(b.pending)
+	}
+	b.pending = nil
+}
@@ -0,0 +1,159 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package awssns
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/go-errors/errors"
+	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"strings"
+	"time"
+)
+
+func init() {
+	sinkimpl.RegisterSink(config.AwsSNS, newAwsSnsSink)
+}
+
+type awsSnsSink struct {
+	logger   *logging.Logger
+	topicArn string
+	perTable bool
+	awsSns   *sns.SNS
+	encoder  *encoding.JsonEncoder
+}
+
+func newAwsSnsSink(
+	c *config.Config,
+) (sink.Sink, error) {
+
+	logger, err := logging.NewLogger("AwsSnsSink")
+	if err != nil {
+		return nil, err
+	}
+
+	topicArn := config.GetOrDefault[*string](c, config.PropertySnsTopicArn, nil)
+	if topicArn == nil || *topicArn == "" {
+		return nil, errors.Errorf("AWS SNS sink needs the topic arn to be configured")
+	}
+
+	awsRegion := config.GetOrDefault[*string](c, config.PropertySnsAwsRegion, nil)
+	endpoint := config.GetOrDefault(c, config.PropertySnsAwsEndpoint, "")
+	accessKeyId := config.GetOrDefault(c, config.PropertySnsAwsAccessKeyId, "")
+	secretAccessKey := config.GetOrDefault(c, config.PropertySnsAwsSecretAccessKey, "")
+	sessionToken := config.GetOrDefault(c, config.PropertySnsAwsSessionToken, "")
+
+	awsConfig := aws.NewConfig().WithEndpoint(endpoint)
+	if accessKeyId != "" && secretAccessKey != "" {
+		awsConfig = awsConfig.WithCredentials(
+			credentials.NewStaticCredentials(accessKeyId, secretAccessKey, sessionToken),
+		)
+	}
+
+	if awsRegion != nil {
+		awsConfig = awsConfig.WithRegion(*awsRegion)
+	}
+
+	awsSession, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &awsSnsSink{
+		logger:   logger,
+		topicArn: *topicArn,
+		perTable: strings.Contains(*topicArn, "{schema}") || strings.Contains(*topicArn, "{table}"),
+		awsSns:   sns.New(awsSession),
+		encoder:  encoding.NewJsonEncoderWithConfig(c),
+	}, nil
+}
+
+func (a *awsSnsSink) Start() error {
+	return nil
+}
+
+func (a *awsSnsSink) Stop() error {
+	return nil
+}
+
+func (a *awsSnsSink) Emit(
+	_ sink.Context, _ time.Time, topicName string, _, envelope schema.Struct,
+) error {
+
+	envelopeData, err := a.encoder.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	payload := envelope[schema.FieldNamePayload].(schema.Struct)
+	source, _ := payload[schema.FieldNameSource].(schema.Struct)
+	operation, _ := payload[schema.FieldNameOperation].(string)
+	schemaName, _ := source[schema.FieldNameSchema].(string)
+	tableName, _ := source[schema.FieldNameTable].(string)
+	lsn, _ := source[schema.FieldNameLSN].(string)
+
+	topicArn := a.topicArn
+	if a.perTable {
+		if schemaName == "" || tableName == "" {
+			a.logger.Debugf("Ignoring event without table information on topic %s", topicName)
+			return nil
+		}
+		topicArn = strings.NewReplacer("{schema}", schemaName, "{table}", tableName).Replace(topicArn)
+	}
+
+	// Message attributes are used by subscription filter policies,
+	// SNS doesn't accept attributes with empty values though
+	attributes := make(map[string]*sns.MessageAttributeValue)
+	for name, value := range map[string]string{
+		"topic":  topicName,
+		"schema": schemaName,
+		"table":  tableName,
+		"op":     operation,
+		"lsn":    lsn,
+	} {
+		if value == "" {
+			continue
+		}
+		attributes[name] = &sns.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(value),
+		}
+	}
+
+	input := &sns.PublishInput{
+		TopicArn:          aws.String(topicArn),
+		Message:           aws.String(string(envelopeData)),
+		MessageAttributes: attributes,
+	}
+
+	// FIFO topics require a message group and deduplication id
+	if strings.HasSuffix(topicArn, ".fifo") {
+		input.MessageGroupId = aws.String(topicName)
+		input.MessageDeduplicationId = aws.String(sinkimpl.MessageDeduplicationId(envelope, envelopeData))
+	}
+
+	_, err = a.awsSns.Publish(input)
+	return err
+}
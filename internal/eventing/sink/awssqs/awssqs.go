@@ -18,9 +18,8 @@
 package awssqs
 
 import (
-	"crypto/sha256"
-	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sqs"
@@ -30,9 +29,15 @@ import (
 	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
 	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
 	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"strconv"
 	"time"
 )
 
+const (
+	maxSendMessageBatchCount = 10
+	maxSendMessageBatchBytes = 256 * 1024
+)
+
 func init() {
 	sinkimpl.RegisterSink(config.AwsSQS, newAwsSqsSink)
 }
@@ -98,28 +103,90 @@ func (a *awsSqsSink) Emit(
 		return err
 	}
 
-	payload := envelope[schema.FieldNamePayload].(schema.Struct)
-	source := payload[schema.FieldNameSource].(schema.Struct)
-	lsn := source[schema.FieldNameLSN].(string)
-	txId, present := source[schema.FieldNameTxId]
-
-	var msgDeduplicationIdContent string
-	if present {
-		msgDeduplicationIdContent = fmt.Sprintf("%s-%d-%s", lsn, *(txId.(*uint32)), envelopeData)
-	} else {
-		msgDeduplicationIdContent = fmt.Sprintf("%s-%s", lsn, envelopeData)
-	}
-
-	hash := sha256.New()
-	hash.Write([]byte(msgDeduplicationIdContent))
-	msgDeduplicationId := fmt.Sprintf("%X", hash.Sum(nil))
-
 	_, err = a.awsSqs.SendMessage(&sqs.SendMessageInput{
 		DelaySeconds:           aws.Int64(0),
 		MessageBody:            aws.String(string(envelopeData)),
 		MessageGroupId:         aws.String(topicName),
-		MessageDeduplicationId: aws.String(msgDeduplicationId),
+		MessageDeduplicationId: aws.String(sinkimpl.MessageDeduplicationId(envelope, envelopeData)),
 		QueueUrl:               a.queueUrl,
 	})
 	return err
 }
+
+func (a *awsSqsSink) EmitBatch(
+	_ sink.Context, events []sink.Event,
+) error {
+
+	// SendMessageBatch accepts up to 10 messages and 256 KB per
+	// request, larger batches are split into multiple requests
+	entries := make([]*sqs.SendMessageBatchRequestEntry, 0, maxSendMessageBatchCount)
+	size := 0
+	for i, event := range events {
+		if len(entries) == maxSendMessageBatchCount ||
+			(len(entries) > 0 && size+len(event.EnvelopeData) > maxSendMessageBatchBytes) {
+
+			if err := a.sendMessageBatch(entries); err != nil {
+				return err
+			}
+			entries = make([]*sqs.SendMessageBatchRequestEntry, 0, maxSendMessageBatchCount)
+			size = 0
+		}
+
+		entries = append(entries, &sqs.SendMessageBatchRequestEntry{
+			Id:                     aws.String(strconv.Itoa(i)),
+			DelaySeconds:           aws.Int64(0),
+			MessageBody:            aws.String(string(event.EnvelopeData)),
+			MessageGroupId:         aws.String(event.TopicName),
+			MessageDeduplicationId: aws.String(sinkimpl.MessageDeduplicationId(event.Envelope, event.EnvelopeData)),
+		})
+		size += len(event.EnvelopeData)
+	}
+	return a.sendMessageBatch(entries)
+}
+
+func (a *awsSqsSink) sendMessageBatch(
+	entries []*sqs.SendMessageBatchRequestEntry,
+) error {
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	output, err := a.awsSqs.SendMessageBatch(&sqs.SendMessageBatchInput{
+		Entries:  entries,
+		QueueUrl: a.queueUrl,
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(output.Failed) > 0 {
+		failed := output.Failed[0]
+		err := errors.Errorf(
+			"AWS SQS rejected %d of %d messages: %s (%s)", len(output.Failed), len(entries),
+			aws.StringValue(failed.Message), aws.StringValue(failed.Code),
+		)
+		// Sender faults, like oversized messages, won't succeed on retry
+		if aws.BoolValue(failed.SenderFault) {
+			return sink.NewPermanentError(err)
+		}
+		return err
+	}
+	return nil
+}
+
+func (a *awsSqsSink) IsPermanentError(
+	err error,
+) bool {
+
+	// Oversized or otherwise invalid messages are rejected
+	// by SQS, no matter how often they're retried
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		switch awsErr.Code() {
+		case "InvalidParameterValue", sqs.ErrCodeInvalidMessageContents:
+			return true
+		}
+	}
+	return false
+}
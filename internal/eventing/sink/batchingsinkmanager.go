@@ -0,0 +1,315 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sink
+
+import (
+	"github.com/cenkalti/backoff/v4"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/internal/waiting"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/noctarius/timescaledb-event-streamer/spi/statestorage"
+	"sync"
+	"time"
+)
+
+// batchingSinkManager buffers the emitted events and hands them to the
+// batch sink when the batch is full, or the linger time passed. Functions
+// passed to Acknowledge are deferred until all previously emitted events
+// are flushed successfully. If a dead-letter target is configured, a batch
+// failing permanently is split up and its failing events are parked.
+type batchingSinkManager struct {
+	*sinkManager
+	mutex             sync.Mutex
+	logger            *logging.Logger
+	batchSink         sink.BatchSink
+	encoder           *encoding.JsonEncoder
+	maxSize           int
+	maxBytes          int
+	linger            time.Duration
+	events            []sink.Event
+	bytes             int
+	acknowledges      []func() error
+	ticker            *time.Ticker
+	shutdownAwaiter   *waiting.ShutdownAwaiter
+	backOff           backoff.BackOff
+	deadLetterHandler *DeadLetterHandler
+}
+
+func newBatchingSinkManager(
+	c *config.Config, stateStorageManager statestorage.Manager, stateName string,
+	s sink.Sink, batchSink sink.BatchSink,
+) (sink.Manager, error) {
+
+	logger, err := logging.NewLogger("BatchingSinkManager")
+	if err != nil {
+		return nil, err
+	}
+
+	maxSize := config.GetOrDefault(c, config.PropertySinkBatchSize, 500)
+	if maxSize < 1 {
+		return nil, errors.Errorf("Sink batch size must be at least 1, but was %d", maxSize)
+	}
+
+	maxBytes := config.GetOrDefault(c, config.PropertySinkBatchBytes, 1048576)
+	if maxBytes < 1 {
+		return nil, errors.Errorf("Sink batch bytes must be at least 1, but was %d", maxBytes)
+	}
+
+	return &batchingSinkManager{
+		sinkManager:     newSinkManager(stateStorageManager, stateName, s),
+		logger:          logger,
+		batchSink:       batchSink,
+		encoder:         encoding.NewJsonEncoderWithConfig(c),
+		maxSize:         maxSize,
+		maxBytes:        maxBytes,
+		linger:          time.Duration(config.GetOrDefault(c, config.PropertySinkBatchLinger, 100)) * time.Millisecond,
+		events:          make([]sink.Event, 0, maxSize),
+		shutdownAwaiter: waiting.NewShutdownAwaiter(),
+		backOff:         backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 8),
+	}, nil
+}
+
+func (bsm *batchingSinkManager) Start() error {
+	if err := bsm.sinkManager.Start(); err != nil {
+		return err
+	}
+	if bsm.ticker == nil && bsm.linger > 0 {
+		bsm.ticker = time.NewTicker(bsm.linger)
+		go bsm.lingerHandler()
+	}
+	return nil
+}
+
+func (bsm *batchingSinkManager) Stop() error {
+	if bsm.ticker != nil {
+		bsm.shutdownAwaiter.SignalShutdown()
+		if err := bsm.shutdownAwaiter.AwaitDone(); err != nil {
+			bsm.logger.Warnln("Failed to shutdown linger handler in time")
+		}
+	}
+
+	bsm.mutex.Lock()
+	err := bsm.flushWithRetry()
+	bsm.mutex.Unlock()
+	if err != nil {
+		bsm.logger.Errorf("Failed to flush %d events on shutdown: %+v", len(bsm.events), err)
+	}
+
+	if stopErr := bsm.sinkManager.Stop(); err == nil {
+		err = stopErr
+	}
+	return err
+}
+
+func (bsm *batchingSinkManager) Emit(
+	timestamp time.Time, topicName string, key, envelope schema.Struct,
+) error {
+
+	keyData, err := bsm.encoder.Marshal(key)
+	if err != nil {
+		return err
+	}
+	envelopeData, err := bsm.encoder.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	size := len(keyData) + len(envelopeData)
+
+	bsm.mutex.Lock()
+	defer bsm.mutex.Unlock()
+
+	// A full batch is flushed before the new event is added, when
+	// the flush fails the event is retried without duplicating it
+	if len(bsm.events) > 0 && (len(bsm.events) >= bsm.maxSize || bsm.bytes+size > bsm.maxBytes) {
+		if err := bsm.flush(); err != nil {
+			return &precedingEventsError{err: err}
+		}
+	}
+
+	bsm.events = append(bsm.events, sink.Event{
+		Timestamp:    timestamp,
+		TopicName:    topicName,
+		Key:          key,
+		Envelope:     envelope,
+		KeyData:      keyData,
+		EnvelopeData: envelopeData,
+	})
+	bsm.bytes += size
+
+	// The event is buffered already, if flushing the batch fails
+	// here, it's retried with the next event or the linger time
+	if len(bsm.events) >= bsm.maxSize || bsm.bytes >= bsm.maxBytes {
+		if err := bsm.flush(); err != nil {
+			bsm.logger.Warnf("Failed to flush %d events, retrying later: %+v", len(bsm.events), err)
+		}
+	}
+	return nil
+}
+
+func (bsm *batchingSinkManager) BeginTransaction(
+	xid uint32, commitTime time.Time,
+) error {
+
+	// The linger handler must not flush while the sink begins
+	// the transaction, or the batch may end up on either side
+	bsm.mutex.Lock()
+	defer bsm.mutex.Unlock()
+
+	return bsm.sinkManager.BeginTransaction(xid, commitTime)
+}
+
+func (bsm *batchingSinkManager) CommitTransaction(
+	xid uint32, transactionEndLSN pgtypes.LSN,
+) error {
+
+	// Transaction aware sinks have to receive all events of
+	// the transaction, before the transaction is committed
+	if bsm.TransactionAware() {
+		bsm.mutex.Lock()
+		err := bsm.flushWithRetry()
+		bsm.mutex.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return bsm.sinkManager.CommitTransaction(xid, transactionEndLSN)
+}
+
+func (bsm *batchingSinkManager) Acknowledge(
+	acknowledge func() error,
+) error {
+
+	bsm.mutex.Lock()
+	defer bsm.mutex.Unlock()
+
+	if len(bsm.events) == 0 {
+		return acknowledge()
+	}
+
+	bsm.acknowledges = append(bsm.acknowledges, acknowledge)
+	return nil
+}
+
+func (bsm *batchingSinkManager) SetDeadLetterHandler(
+	deadLetterHandler *DeadLetterHandler,
+) {
+
+	bsm.mutex.Lock()
+	defer bsm.mutex.Unlock()
+
+	bsm.deadLetterHandler = deadLetterHandler
+	bsm.sinkManager.SetDeadLetterHandler(deadLetterHandler)
+}
+
+func (bsm *batchingSinkManager) lingerHandler() {
+	for {
+		select {
+		case <-bsm.shutdownAwaiter.AwaitShutdownChan():
+			bsm.ticker.Stop()
+			bsm.shutdownAwaiter.SignalDone()
+			return
+		case <-bsm.ticker.C:
+			bsm.mutex.Lock()
+			if err := bsm.flush(); err != nil {
+				bsm.logger.Warnf("Failed to flush %d events, retrying later: %+v", len(bsm.events), err)
+			}
+			bsm.mutex.Unlock()
+		}
+	}
+}
+
+func (bsm *batchingSinkManager) flushWithRetry() error {
+	return backoff.RetryNotify(bsm.flush, bsm.backOff, func(err error, _ time.Duration) {
+		bsm.logger.Warnf("Failed to flush %d events, retrying: %+v", len(bsm.events), err)
+	})
+}
+
+func (bsm *batchingSinkManager) flush() error {
+	if len(bsm.events) == 0 {
+		return nil
+	}
+
+	if err := bsm.batchSink.EmitBatch(bsm.sinkContext, bsm.events); err != nil {
+		err = classifyError(bsm.sink, err)
+		if !bsm.parks(err) {
+			return err
+		}
+
+		// Retrying a permanently failing batch would never succeed, the
+		// events are emitted one by one to only park the failing ones
+		bsm.logger.Warnf("Batch of %d events failed permanently, emitting events one by one: %+v", len(bsm.events), err)
+		if err := bsm.emitOneByOne(); err != nil {
+			return err
+		}
+	}
+
+	bsm.logger.Verbosef("Flushed batch of %d events (%d bytes)", len(bsm.events), bsm.bytes)
+	bsm.events = make([]sink.Event, 0, bsm.maxSize)
+	bsm.bytes = 0
+
+	var err error
+	acknowledges := bsm.acknowledges
+	bsm.acknowledges = nil
+	for _, acknowledge := range acknowledges {
+		if ackErr := acknowledge(); ackErr != nil && err == nil {
+			err = ackErr
+		}
+	}
+	return err
+}
+
+// emitOneByOne emits the buffered events individually and parks the events
+// failing permanently. Emitted and parked events are removed from the buffer,
+// on any other failure the remaining events are retried with the next flush.
+func (bsm *batchingSinkManager) emitOneByOne() error {
+	for len(bsm.events) > 0 {
+		event := bsm.events[0]
+		if err := bsm.batchSink.EmitBatch(bsm.sinkContext, []sink.Event{event}); err != nil {
+			err = classifyError(bsm.sink, err)
+			if !bsm.parks(err) {
+				return err
+			}
+			if dlErr := bsm.deadLetterHandler.Emit(
+				event.Timestamp, event.TopicName, event.Key, event.Envelope, err,
+			); dlErr != nil {
+				bsm.logger.Errorf("Failed to park event in dead-letter target: %+v", dlErr)
+				return err
+			}
+		}
+		bsm.events = bsm.events[1:]
+		bsm.bytes -= len(event.KeyData) + len(event.EnvelopeData)
+	}
+	return nil
+}
+
+// parks returns true if events failing with the given error are
+// parked in the dead-letter target. Only permanent failures are
+// parked, since retrying the batch may resolve all others.
+func (bsm *batchingSinkManager) parks(
+	err error,
+) bool {
+
+	return bsm.deadLetterHandler != nil &&
+		sink.IsPermanentError(err) &&
+		bsm.deadLetterHandler.Handles(err)
+}
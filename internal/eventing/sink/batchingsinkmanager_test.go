@@ -0,0 +1,208 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sink
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type testBatchSink interface {
+	sink.Sink
+	sink.BatchSink
+}
+
+type recordingBatchSink struct {
+	recordingSink
+	batches  [][]sink.Event
+	failures int
+}
+
+func (r *recordingBatchSink) EmitBatch(
+	_ sink.Context, events []sink.Event,
+) error {
+
+	if r.failures > 0 {
+		r.failures--
+		return errors.Errorf("failed to emit batch")
+	}
+	r.batches = append(r.batches, events)
+	return nil
+}
+
+// poisonedBatchSink fails permanently for batches
+// containing an event with the poisoned operation
+type poisonedBatchSink struct {
+	recordingBatchSink
+	poison string
+}
+
+func (p *poisonedBatchSink) EmitBatch(
+	sinkContext sink.Context, events []sink.Event,
+) error {
+
+	for _, event := range events {
+		payload := event.Envelope[schema.FieldNamePayload].(schema.Struct)
+		if payload[schema.FieldNameOperation] == p.poison {
+			return sink.NewPermanentError(errors.Errorf("invalid event"))
+		}
+	}
+	return p.recordingBatchSink.EmitBatch(sinkContext, events)
+}
+
+func Test_Batching_Flushes_Full_Batches(
+	t *testing.T,
+) {
+
+	batchSink := &recordingBatchSink{}
+	manager := newTestBatchingSinkManager(t, batchSink, 2, 1048576)
+
+	acknowledged := 0
+	acknowledge := func() error {
+		acknowledged++
+		return nil
+	}
+
+	assert.NoError(t, manager.Emit(time.Now(), "timescaledb.public.metrics", testKey(), testEnvelope("c")))
+	assert.NoError(t, manager.Acknowledge(acknowledge))
+	assert.Len(t, batchSink.batches, 0)
+	assert.Equal(t, 0, acknowledged)
+
+	assert.NoError(t, manager.Emit(time.Now(), "timescaledb.public.metrics", testKey(), testEnvelope("c")))
+	assert.Len(t, batchSink.batches, 1)
+	assert.Len(t, batchSink.batches[0], 2)
+	assert.Equal(t, 1, acknowledged)
+
+	// Without buffered events, acknowledgements happen immediately
+	assert.NoError(t, manager.Acknowledge(acknowledge))
+	assert.Equal(t, 2, acknowledged)
+}
+
+func Test_Batching_Flushes_By_Bytes(
+	t *testing.T,
+) {
+
+	batchSink := &recordingBatchSink{}
+	manager := newTestBatchingSinkManager(t, batchSink, 100, 1)
+
+	assert.NoError(t, manager.Emit(time.Now(), "timescaledb.public.metrics", testKey(), testEnvelope("c")))
+	assert.NoError(t, manager.Emit(time.Now(), "timescaledb.public.metrics", testKey(), testEnvelope("u")))
+
+	assert.Len(t, batchSink.batches, 2)
+	assert.Equal(t, "timescaledb.public.metrics", batchSink.batches[0][0].TopicName)
+	assert.NotEmpty(t, batchSink.batches[0][0].EnvelopeData)
+}
+
+func Test_Batching_Retries_Failed_Batches(
+	t *testing.T,
+) {
+
+	batchSink := &recordingBatchSink{failures: 2}
+	manager := newTestBatchingSinkManager(t, batchSink, 1, 1048576)
+
+	acknowledged := false
+	assert.NoError(t, manager.Emit(time.Now(), "timescaledb.public.metrics", testKey(), testEnvelope("c")))
+	assert.NoError(t, manager.Acknowledge(func() error {
+		acknowledged = true
+		return nil
+	}))
+
+	// The buffered batch fails again, the new event isn't buffered
+	// and the failure must not park it in the dead-letter target
+	err := manager.Emit(time.Now(), "timescaledb.public.metrics", testKey(), testEnvelope("u"))
+	assert.Error(t, err)
+	assert.False(t, (&DeadLetterHandler{}).Handles(err))
+	assert.False(t, acknowledged)
+
+	assert.NoError(t, manager.Emit(time.Now(), "timescaledb.public.metrics", testKey(), testEnvelope("u")))
+	assert.True(t, acknowledged)
+	assert.Len(t, batchSink.batches, 2)
+	assert.Len(t, batchSink.batches[0], 1)
+	assert.Len(t, batchSink.batches[1], 1)
+}
+
+func Test_Batching_Parks_Permanently_Failing_Events(
+	t *testing.T,
+) {
+
+	batchSink := &poisonedBatchSink{poison: "d"}
+	manager := newTestBatchingSinkManager(t, batchSink, 3, 1048576)
+
+	target := &recordingSink{}
+	manager.SetDeadLetterHandler(&DeadLetterHandler{
+		logger:      testLogger(t),
+		sinkContext: newSinkContext(),
+		sink:        target,
+		topicName:   "timescaledb.deadletter",
+	})
+
+	acknowledged := false
+	assert.NoError(t, manager.Emit(time.Now(), "timescaledb.public.metrics", testKey(), testEnvelope("c")))
+	assert.NoError(t, manager.Emit(time.Now(), "timescaledb.public.metrics", testKey(), testEnvelope("d")))
+	assert.NoError(t, manager.Acknowledge(func() error {
+		acknowledged = true
+		return nil
+	}))
+	assert.NoError(t, manager.Emit(time.Now(), "timescaledb.public.metrics", testKey(), testEnvelope("u")))
+
+	// Only the failing event is parked, the batch is dropped afterward
+	assert.True(t, acknowledged)
+	assert.Empty(t, manager.events)
+	assert.Equal(t, 0, manager.bytes)
+	assert.Equal(t, []string{"timescaledb.deadletter"}, target.topics)
+	assert.Len(t, batchSink.batches, 2)
+	assert.Len(t, batchSink.batches[0], 1)
+	assert.Len(t, batchSink.batches[1], 1)
+}
+
+func Test_Batching_Keeps_Permanently_Failing_Batch_Without_Dead_Letter_Target(
+	t *testing.T,
+) {
+
+	batchSink := &poisonedBatchSink{poison: "d"}
+	manager := newTestBatchingSinkManager(t, batchSink, 1, 1048576)
+
+	assert.NoError(t, manager.Emit(time.Now(), "timescaledb.public.metrics", testKey(), testEnvelope("d")))
+
+	err := manager.Emit(time.Now(), "timescaledb.public.metrics", testKey(), testEnvelope("c"))
+	assert.True(t, sink.IsPermanentError(err))
+	assert.Len(t, manager.events, 1)
+	assert.Len(t, batchSink.batches, 0)
+}
+
+func newTestBatchingSinkManager(
+	t *testing.T, batchSink testBatchSink, maxSize, maxBytes int,
+) *batchingSinkManager {
+
+	return &batchingSinkManager{
+		sinkManager: &sinkManager{
+			sinkContext: newSinkContext(),
+			sink:        batchSink,
+		},
+		logger:    testLogger(t),
+		batchSink: batchSink,
+		encoder:   encoding.NewJsonEncoder(false),
+		maxSize:   maxSize,
+		maxBytes:  maxBytes,
+	}
+}
@@ -0,0 +1,470 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clickhouse
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"github.com/cenkalti/backoff/v4"
+	"github.com/go-errors/errors"
+	"github.com/jackc/pglogrepl"
+	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/internal/tlsconfig"
+	"github.com/noctarius/timescaledb-event-streamer/internal/waiting"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	sinkimpl.RegisterSink(config.ClickHouse, newClickHouseSink)
+}
+
+type batch struct {
+	table        string
+	rows         [][]byte
+	acknowledges []func() error
+}
+
+type clickHouseSink struct {
+	mutex           sync.Mutex
+	logger          *logging.Logger
+	client          *http.Client
+	encoder         *encoding.JsonEncoder
+	address         string
+	database        string
+	headers         http.Header
+	batchSize       int
+	batchInterval   time.Duration
+	signColumn      string
+	versionColumn   string
+	deletedColumn   string
+	batches         map[string]*batch
+	ticker          *time.Ticker
+	shutdownAwaiter *waiting.ShutdownAwaiter
+	backOff         backoff.BackOff
+}
+
+func newClickHouseSink(
+	c *config.Config,
+) (sink.Sink, error) {
+
+	logger, err := logging.NewLogger("ClickHouseSink")
+	if err != nil {
+		return nil, err
+	}
+
+	batchSize := config.GetOrDefault(c, config.PropertyClickHouseBatchSize, 10000)
+	if batchSize < 1 {
+		return nil, errors.Errorf("ClickHouse sink batch size must be at least 1, but was %d", batchSize)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	address := strings.TrimSuffix(config.GetOrDefault(c, config.PropertyClickHouseUrl, "http://localhost:8123"), "/")
+	if strings.HasPrefix(address, "https://") {
+		tlsConfig, err := tlsconfig.NewTLSConfig(c, config.PropertyClickHouseTls)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	headers := make(http.Header)
+	headers.Add("Content-Type", "application/x-ndjson")
+
+	authenticationType := config.GetOrDefault(c, config.PropertyClickHouseAuthenticationType, "none")
+	switch config.HttpAuthenticationType(authenticationType) {
+	case config.BasicAuthentication:
+		{
+			username := config.GetOrDefault(c, config.PropertyClickHouseBasicAuthenticationUsername, "")
+			password := config.GetOrDefault(c, config.PropertyClickHouseBasicAuthenticationPassword, "")
+			headers.Add("Authorization",
+				fmt.Sprintf("Basic %s",
+					base64.StdEncoding.EncodeToString([]byte(username+":"+password)),
+				),
+			)
+		}
+	case config.HeaderAuthentication:
+		{
+			headers.Add(config.GetOrDefault(c, config.PropertyClickHouseHeaderAuthenticationHeaderName, ""),
+				config.GetOrDefault(c, config.PropertyClickHouseHeaderAuthenticationHeaderValue, ""),
+			)
+		}
+	case config.NoneAuthentication:
+		{
+		}
+	default:
+		{
+			return nil, errors.Errorf("ClickHouse AuthenticationType '%s' doesn't exist", authenticationType)
+		}
+	}
+
+	return &clickHouseSink{
+		logger:    logger,
+		client:    &http.Client{Transport: transport, Timeout: time.Minute},
+		encoder:   encoding.NewJsonEncoderWithConfig(c),
+		address:   address,
+		database:  config.GetOrDefault(c, config.PropertyClickHouseDatabase, "default"),
+		headers:   headers,
+		batchSize: batchSize,
+		batchInterval: time.Duration(
+			config.GetOrDefault(c, config.PropertyClickHouseBatchInterval, 1000),
+		) * time.Millisecond,
+		signColumn:      config.GetOrDefault(c, config.PropertyClickHouseColumnsSign, ""),
+		versionColumn:   config.GetOrDefault(c, config.PropertyClickHouseColumnsVersion, ""),
+		deletedColumn:   config.GetOrDefault(c, config.PropertyClickHouseColumnsDeleted, ""),
+		batches:         make(map[string]*batch),
+		shutdownAwaiter: waiting.NewShutdownAwaiter(),
+		backOff:         backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 8),
+	}, nil
+}
+
+func (c *clickHouseSink) Start() error {
+	c.logger.Infof("Starting ClickHouseSink at %s", c.address)
+	if c.ticker == nil && c.batchInterval > 0 {
+		c.ticker = time.NewTicker(c.batchInterval)
+		go c.flushHandler()
+	}
+	return nil
+}
+
+func (c *clickHouseSink) Stop() error {
+	c.logger.Infof("Stopping ClickHouseSink at %s", c.address)
+	if c.ticker != nil {
+		c.shutdownAwaiter.SignalShutdown()
+		if err := c.shutdownAwaiter.AwaitDone(); err != nil {
+			c.logger.Warnln("Failed to shutdown flush handler in time")
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	err := c.flushAll()
+	c.client.CloseIdleConnections()
+	return err
+}
+
+func (c *clickHouseSink) BeginTransaction(
+	_ sink.Context, _ uint32, _ time.Time,
+) error {
+
+	return nil
+}
+
+func (c *clickHouseSink) CommitTransaction(
+	_ sink.Context, xid uint32, _ pgtypes.LSN,
+) error {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// Commits aren't retried by the event emitter, and the transaction
+	// is acknowledged after all batches made it into ClickHouse
+	return backoff.RetryNotify(c.flushAll, c.backOff, func(err error, _ time.Duration) {
+		c.logger.Warnf("Failed to flush batches of transaction xid=%d, retrying: %+v", xid, err)
+	})
+}
+
+func (c *clickHouseSink) Emit(
+	_ sink.Context, _ time.Time, topicName string, key, envelope schema.Struct,
+) error {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	payload, ok := envelope[schema.FieldNamePayload].(schema.Struct)
+	if !ok {
+		return nil
+	}
+
+	operation, _ := payload[schema.FieldNameOperation].(string)
+	switch schema.Operation(operation) {
+	case schema.OP_READ, schema.OP_CREATE, schema.OP_UPDATE, schema.OP_DELETE, schema.OP_TRUNCATE:
+	default:
+		// Logical replication messages and TimescaleDB
+		// events don't map to rows of a table
+		return nil
+	}
+
+	source, ok := payload[schema.FieldNameSource].(schema.Struct)
+	if !ok {
+		return errors.Errorf("ClickHouse sink received an event without source information")
+	}
+	tableName, _ := source[schema.FieldNameTable].(string)
+
+	if schema.Operation(operation) == schema.OP_TRUNCATE {
+		if err := c.flush(topicName); err != nil {
+			return err
+		}
+		return c.execute(fmt.Sprintf("TRUNCATE TABLE %s", c.identifier(tableName)), nil)
+	}
+
+	rows, err := c.rows(schema.Operation(operation), source, key, payload)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	b, present := c.batches[topicName]
+	if !present {
+		b = &batch{
+			table: tableName,
+			rows:  make([][]byte, 0, c.batchSize),
+		}
+		c.batches[topicName] = b
+	}
+
+	// A full batch is flushed before the new rows are added, when the
+	// flush fails the event is retried without duplicating its rows
+	if len(b.rows) >= c.batchSize {
+		if err := c.flush(topicName); err != nil {
+			return err
+		}
+	}
+	b.rows = append(b.rows, rows...)
+	return nil
+}
+
+// Acknowledge defers the acknowledgement until all batches holding
+// rows of previously emitted events were inserted, since Emit only
+// buffers them
+func (c *clickHouseSink) Acknowledge(
+	_ sink.Context, acknowledge func() error,
+) error {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	batches := make([]*batch, 0, len(c.batches))
+	for _, b := range c.batches {
+		if len(b.rows) > 0 {
+			batches = append(batches, b)
+		}
+	}
+	if len(batches) == 0 {
+		return acknowledge()
+	}
+
+	// The acknowledgement is shared by the batches of all
+	// tables, it's called after the last of them was inserted
+	shared := sinkimpl.SharedAcknowledgement(len(batches), acknowledge)
+	for _, b := range batches {
+		b.acknowledges = append(b.acknowledges, shared)
+	}
+	return nil
+}
+
+func (c *clickHouseSink) rows(
+	operation schema.Operation, source, key, payload schema.Struct,
+) ([][]byte, error) {
+
+	before, _ := payload[schema.FieldNameBefore].(schema.Struct)
+	after, _ := payload[schema.FieldNameAfter].(schema.Struct)
+
+	var version uint64
+	if lsn, ok := source[schema.FieldNameLSN].(string); ok && lsn != "" {
+		parsed, err := pglogrepl.ParseLSN(lsn)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		version = uint64(parsed)
+	}
+
+	switch operation {
+	case schema.OP_READ, schema.OP_CREATE:
+		return c.encodeRows(c.row(after, 1, version, false))
+
+	case schema.OP_UPDATE:
+		// CollapsingMergeTree tables need the previous state
+		// to be cancelled before the new state is inserted
+		if c.signColumn != "" && before != nil {
+			return c.encodeRows(c.row(before, -1, version, false), c.row(after, 1, version, false))
+		}
+		return c.encodeRows(c.row(after, 1, version, false))
+
+	case schema.OP_DELETE:
+		if c.signColumn == "" && c.deletedColumn == "" {
+			// Without a sign or deleted column there's nothing to map the delete to
+			return nil, nil
+		}
+		if before == nil {
+			before, _ = key[schema.FieldNamePayload].(schema.Struct)
+		}
+		return c.encodeRows(c.row(before, -1, version, true))
+	}
+	return nil, nil
+}
+
+func (c *clickHouseSink) row(
+	values schema.Struct, sign int8, version uint64, deleted bool,
+) schema.Struct {
+
+	row := make(schema.Struct, len(values)+3)
+	for column, value := range values {
+		row[column] = value
+	}
+	if c.signColumn != "" {
+		row[c.signColumn] = sign
+	}
+	if c.versionColumn != "" {
+		row[c.versionColumn] = version
+	}
+	if c.deletedColumn != "" {
+		if deleted {
+			row[c.deletedColumn] = 1
+		} else {
+			row[c.deletedColumn] = 0
+		}
+	}
+	return row
+}
+
+func (c *clickHouseSink) encodeRows(
+	rows ...schema.Struct,
+) ([][]byte, error) {
+
+	encoded := make([][]byte, 0, len(rows))
+	for _, row := range rows {
+		data, err := c.encoder.Marshal(row)
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, data)
+	}
+	return encoded, nil
+}
+
+func (c *clickHouseSink) flushHandler() {
+	for {
+		select {
+		case <-c.shutdownAwaiter.AwaitShutdownChan():
+			c.ticker.Stop()
+			c.shutdownAwaiter.SignalDone()
+			return
+		case <-c.ticker.C:
+			c.mutex.Lock()
+			if err := c.flushAll(); err != nil {
+				c.logger.Warnf("Failed to flush batches, retrying with the next interval: %+v", err)
+			}
+			c.mutex.Unlock()
+		}
+	}
+}
+
+func (c *clickHouseSink) flushAll() error {
+	for topicName := range c.batches {
+		if err := c.flush(topicName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *clickHouseSink) flush(
+	topicName string,
+) error {
+
+	b, present := c.batches[topicName]
+	if !present || len(b.rows) == 0 {
+		return nil
+	}
+
+	body := bytes.NewBuffer(make([]byte, 0, len(b.rows)*256))
+	for _, row := range b.rows {
+		body.Write(row)
+		body.WriteByte('\n')
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s FORMAT JSONEachRow", c.identifier(b.table))
+	if err := c.execute(query, body); err != nil {
+		return err
+	}
+
+	c.logger.Verbosef("Flushed %d rows of topic %s", len(b.rows), topicName)
+	b.rows = b.rows[:0]
+
+	var err error
+	acknowledges := b.acknowledges
+	b.acknowledges = nil
+	for _, acknowledge := range acknowledges {
+		if ackErr := acknowledge(); ackErr != nil && err == nil {
+			err = ackErr
+		}
+	}
+	return err
+}
+
+func (c *clickHouseSink) execute(
+	query string, body io.Reader,
+) error {
+
+	parameters := url.Values{}
+	parameters.Set("query", query)
+	parameters.Set("date_time_input_format", "best_effort")
+	parameters.Set("input_format_skip_unknown_fields", "1")
+
+	request, err := http.NewRequest("POST", c.address+"/?"+parameters.Encode(), body)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	request.Header = c.headers.Clone()
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		return errors.Errorf(
+			"ClickHouse sink failed to execute query with status %d: %s",
+			response.StatusCode, strings.TrimSpace(string(message)),
+		)
+	}
+	_, _ = io.Copy(io.Discard, response.Body)
+	return nil
+}
+
+func (c *clickHouseSink) identifier(
+	tableName string,
+) string {
+
+	return fmt.Sprintf("%s.%s", quoteIdentifier(c.database), quoteIdentifier(tableName))
+}
+
+func quoteIdentifier(
+	identifier string,
+) string {
+
+	identifier = strings.ReplaceAll(identifier, "\\", "\\\\")
+	return "`" + strings.ReplaceAll(identifier, "`", "\\`") + "`"
+}
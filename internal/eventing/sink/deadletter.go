@@ -0,0 +1,188 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sink
+
+import (
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/noctarius/timescaledb-event-streamer/spi/statestorage"
+	"sync"
+	"time"
+)
+
+const (
+	deadLetterSinkContextStateName = "SinkContextState:deadletter"
+
+	fieldNameDeadLetterTopic     = "topic"
+	fieldNameDeadLetterError     = "error"
+	fieldNameDeadLetterMessage   = "message"
+	fieldNameDeadLetterPermanent = "permanent"
+	fieldNameDeadLetterTimestamp = "timestamp"
+	fieldNameDeadLetterKey       = "key"
+	fieldNameDeadLetterValue     = "value"
+)
+
+// DeadLetterAware is implemented by sink managers and sinks which emit
+// events detached from the call to Emit (like buffered batches), and park
+// events failing permanently in the dead-letter target themselves.
+type DeadLetterAware interface {
+	SetDeadLetterHandler(
+		deadLetterHandler *DeadLetterHandler,
+	)
+}
+
+// DeadLetterHandler parks events which couldn't be emitted to the sink
+// in a separate dead-letter target, which can be any registered sink.
+// Parked events are wrapped with the error details and original topic.
+type DeadLetterHandler struct {
+	mutex               sync.Mutex
+	logger              *logging.Logger
+	stateStorageManager statestorage.Manager
+	sinkContext         *sinkContext
+	sink                sink.Sink
+	topicName           string
+	permanentOnly       bool
+}
+
+// NewDeadLetterHandlerFromConfig creates the dead-letter handler for the
+// configured dead-letter sink. If no dead-letter sink is configured, nil
+// is returned and failed events keep stopping the replication.
+func NewDeadLetterHandlerFromConfig(
+	c *config.Config, stateStorageManager statestorage.Manager,
+) (*DeadLetterHandler, error) {
+
+	deadLetterConfig := c.Sink.DeadLetter
+	if deadLetterConfig.Sink == nil || deadLetterConfig.Sink.Type == "" {
+		return nil, nil
+	}
+
+	logger, err := logging.NewLogger("DeadLetterHandler")
+	if err != nil {
+		return nil, err
+	}
+
+	// The dead-letter sink reads its settings from a copy of the
+	// configuration, with the sink section replaced by its own
+	deadLetterSinkConfig := *c
+	deadLetterSinkConfig.Sink = *deadLetterConfig.Sink
+	s, err := NewSink(deadLetterConfig.Sink.Type, &deadLetterSinkConfig)
+	if err != nil {
+		return nil, errors.Errorf("Failed to create dead-letter sink: %s", err.Error())
+	}
+
+	return &DeadLetterHandler{
+		logger:              logger,
+		stateStorageManager: stateStorageManager,
+		sinkContext:         newSinkContext(),
+		sink:                s,
+		topicName: config.GetOrDefault(
+			c, config.PropertySinkDeadLetterTopic, fmt.Sprintf("%s.deadletter", c.Topic.Prefix),
+		),
+		permanentOnly: config.GetOrDefault(c, config.PropertySinkDeadLetterPermanentOnly, true),
+	}, nil
+}
+
+func (dlh *DeadLetterHandler) Start() error {
+	if encodedSinkContextState, present := dlh.stateStorageManager.EncodedState(
+		deadLetterSinkContextStateName,
+	); present {
+		if err := dlh.sinkContext.UnmarshalBinary(encodedSinkContextState); err != nil {
+			return err
+		}
+	}
+	return dlh.sink.Start()
+}
+
+func (dlh *DeadLetterHandler) Stop() error {
+	if err := dlh.stateStorageManager.StateEncoder(
+		deadLetterSinkContextStateName, statestorage.StateEncoderFunc(dlh.sinkContext.MarshalBinary),
+	); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return dlh.sink.Stop()
+}
+
+// Handles returns true if events failing with the given error
+// are parked, instead of stopping the replication
+func (dlh *DeadLetterHandler) Handles(
+	err error,
+) bool {
+
+	// Failures of previously emitted events aren't
+	// caused by the event which is emitted now
+	var pe *precedingEventsError
+	if errors.As(err, &pe) {
+		return false
+	}
+	return !dlh.permanentOnly || sink.IsPermanentError(err)
+}
+
+// Emit parks the failed event in the dead-letter target
+func (dlh *DeadLetterHandler) Emit(
+	timestamp time.Time, topicName string, key, envelope schema.Struct, cause error,
+) error {
+
+	// Sink managers may park events from their background flushes
+	dlh.mutex.Lock()
+	defer dlh.mutex.Unlock()
+
+	permanent := sink.IsPermanentError(cause)
+	dlh.logger.Warnf(
+		"Parking event of topic %s in dead-letter topic %s (permanent: %t): %s",
+		topicName, dlh.topicName, permanent, cause.Error(),
+	)
+
+	return dlh.sink.Emit(dlh.sinkContext, timestamp, dlh.topicName, key,
+		newDeadLetterEnvelope(timestamp, topicName, key, envelope, cause),
+	)
+}
+
+// precedingEventsError is returned for events which failed, since previously
+// emitted events (like a buffered batch) couldn't be emitted. The failure isn't
+// caused by the event itself, which is why it's never parked.
+type precedingEventsError struct {
+	err error
+}
+
+func (pe *precedingEventsError) Error() string {
+	return pe.err.Error()
+}
+
+func (pe *precedingEventsError) Unwrap() error {
+	return pe.err
+}
+
+func newDeadLetterEnvelope(
+	timestamp time.Time, topicName string, key, envelope schema.Struct, cause error,
+) schema.Struct {
+
+	return schema.Struct{
+		fieldNameDeadLetterTopic: topicName,
+		fieldNameDeadLetterError: schema.Struct{
+			fieldNameDeadLetterMessage:   cause.Error(),
+			fieldNameDeadLetterPermanent: sink.IsPermanentError(cause),
+		},
+		fieldNameDeadLetterTimestamp: timestamp.UnixMilli(),
+		fieldNameDeadLetterKey:       key,
+		fieldNameDeadLetterValue:     envelope,
+	}
+}
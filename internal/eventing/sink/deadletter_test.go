@@ -0,0 +1,126 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sink
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type classifyingSink struct {
+	recordingSink
+}
+
+func (c *classifyingSink) IsPermanentError(
+	err error,
+) bool {
+
+	return err.Error() == "failed to emit"
+}
+
+func Test_Classify_Error(
+	t *testing.T,
+) {
+
+	err := errors.Errorf("failed to emit")
+
+	assert.False(t, sink.IsPermanentError(classifyError(&recordingSink{}, err)))
+	assert.True(t, sink.IsPermanentError(classifyError(&classifyingSink{}, err)))
+	assert.True(t, sink.IsPermanentError(classifyError(&recordingSink{}, sink.NewPermanentError(err))))
+}
+
+func Test_Routing_Keeps_Permanent_Errors(
+	t *testing.T,
+) {
+
+	manager := newTestRoutingSinkManager(t, map[string]*recordingSink{
+		"first": {failures: 1},
+	}, nil)
+	manager.sinks[0].manager = NewSinkManager(nil, &classifyingSink{recordingSink{failures: 1}})
+
+	err := manager.Emit(time.Now(), "timescaledb.public.metrics", testKey(), testEnvelope("c"))
+	assert.ErrorContains(t, err, "Sink 'first' failed to emit event")
+	assert.True(t, sink.IsPermanentError(err))
+}
+
+func Test_Dead_Letter_Handler(
+	t *testing.T,
+) {
+
+	target := &recordingSink{}
+	handler := &DeadLetterHandler{
+		logger:        testLogger(t),
+		sinkContext:   newSinkContext(),
+		sink:          target,
+		topicName:     "timescaledb.deadletter",
+		permanentOnly: true,
+	}
+
+	transient := errors.Errorf("connection refused")
+	permanent := sink.NewPermanentError(errors.Errorf("payload too large"))
+
+	assert.False(t, handler.Handles(transient))
+	assert.True(t, handler.Handles(permanent))
+
+	assert.NoError(t, handler.Emit(time.Now(), "timescaledb.public.metrics", testKey(), testEnvelope("c"), permanent))
+	assert.Equal(t, []string{"timescaledb.deadletter"}, target.topics)
+
+	// Parking events failing with transient errors is an explicit opt-in
+	handler.permanentOnly = false
+	assert.True(t, handler.Handles(transient))
+	assert.True(t, handler.Handles(permanent))
+}
+
+func Test_Dead_Letter_Envelope(
+	t *testing.T,
+) {
+
+	timestamp := time.UnixMilli(1679728320500)
+	key := testKey()
+	envelope := testEnvelope("c")
+
+	deadLetter := newDeadLetterEnvelope(
+		timestamp, "timescaledb.public.metrics", key, envelope,
+		sink.NewPermanentError(errors.Errorf("payload too large")),
+	)
+
+	assert.Equal(t, "timescaledb.public.metrics", deadLetter[fieldNameDeadLetterTopic])
+	assert.Equal(t, int64(1679728320500), deadLetter[fieldNameDeadLetterTimestamp])
+	assert.Equal(t, key, deadLetter[fieldNameDeadLetterKey])
+	assert.Equal(t, envelope, deadLetter[fieldNameDeadLetterValue])
+	assert.Equal(t, schema.Struct{
+		fieldNameDeadLetterMessage:   "payload too large",
+		fieldNameDeadLetterPermanent: true,
+	}, deadLetter[fieldNameDeadLetterError])
+}
+
+func testLogger(
+	t *testing.T,
+) *logging.Logger {
+
+	logger, err := logging.NewLogger("DeadLetterHandlerTest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return logger
+}
@@ -0,0 +1,49 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sink
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+)
+
+// MessageDeduplicationId derives the deduplication id of FIFO queues
+// and topics (e.g. SQS and SNS) from the LSN of the change record, the
+// transaction id and the encoded envelope, therefore a retried event
+// gets the same id, while distinct events, even of the same row in
+// the same transaction, get different ones.
+func MessageDeduplicationId(
+	envelope schema.Struct, envelopeData []byte,
+) string {
+
+	payload, _ := envelope[schema.FieldNamePayload].(schema.Struct)
+	source, _ := payload[schema.FieldNameSource].(schema.Struct)
+	lsn, _ := source[schema.FieldNameLSN].(string)
+
+	var content string
+	if txId, ok := source[schema.FieldNameTxId].(*uint32); ok && txId != nil {
+		content = fmt.Sprintf("%s-%d-%s", lsn, *txId, envelopeData)
+	} else {
+		content = fmt.Sprintf("%s-%s", lsn, envelopeData)
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(content))
+	return fmt.Sprintf("%X", hash.Sum(nil))
+}
@@ -0,0 +1,64 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sink
+
+import (
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_Message_Deduplication_Id(
+	t *testing.T,
+) {
+
+	envelope := func(
+		lsn string, txId *uint32,
+	) schema.Struct {
+
+		source := schema.Struct{
+			schema.FieldNameLSN: lsn,
+		}
+		if txId != nil {
+			source[schema.FieldNameTxId] = txId
+		}
+		return schema.Struct{
+			schema.FieldNamePayload: schema.Struct{
+				schema.FieldNameSource: source,
+			},
+		}
+	}
+
+	txId := uint32(42)
+	otherTxId := uint32(43)
+	data := []byte(`{"value":1}`)
+
+	id := MessageDeduplicationId(envelope("0/16B6C50", &txId), data)
+	assert.Len(t, id, 64)
+
+	// Retries of the same event get the same id
+	assert.Equal(t, id, MessageDeduplicationId(envelope("0/16B6C50", &txId), data))
+
+	// Same content of another change record or transaction differs
+	assert.NotEqual(t, id, MessageDeduplicationId(envelope("0/16B6D00", &txId), data))
+	assert.NotEqual(t, id, MessageDeduplicationId(envelope("0/16B6C50", &otherTxId), data))
+	assert.NotEqual(t, id, MessageDeduplicationId(envelope("0/16B6C50", nil), data))
+
+	// Events without source information don't fail
+	assert.Len(t, MessageDeduplicationId(schema.Struct{}, data), 64)
+}
@@ -0,0 +1,532 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"github.com/cenkalti/backoff/v4"
+	"github.com/go-errors/errors"
+	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/internal/tlsconfig"
+	"github.com/noctarius/timescaledb-event-streamer/internal/waiting"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	sinkimpl.RegisterSink(config.Elasticsearch, newElasticsearchSink)
+}
+
+type elasticsearchSink struct {
+	mutex             sync.Mutex
+	logger            *logging.Logger
+	client            *http.Client
+	encoder           *encoding.JsonEncoder
+	decoder           *encoding.JsonDecoder
+	address           string
+	headers           http.Header
+	batchSize         int
+	batchInterval     time.Duration
+	retries           uint64
+	items             []*item
+	acknowledges      []func() error
+	ticker            *time.Ticker
+	shutdownAwaiter   *waiting.ShutdownAwaiter
+	deadLetterHandler *sinkimpl.DeadLetterHandler
+}
+
+func newElasticsearchSink(
+	c *config.Config,
+) (sink.Sink, error) {
+
+	logger, err := logging.NewLogger("ElasticsearchSink")
+	if err != nil {
+		return nil, err
+	}
+
+	batchSize := config.GetOrDefault(c, config.PropertyElasticsearchBatchSize, 1000)
+	if batchSize < 1 {
+		return nil, errors.Errorf("Elasticsearch sink batch size must be at least 1, but was %d", batchSize)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	address := strings.TrimSuffix(config.GetOrDefault(c, config.PropertyElasticsearchUrl, "http://localhost:9200"), "/")
+	if strings.HasPrefix(address, "https://") {
+		tlsConfig, err := tlsconfig.NewTLSConfig(c, config.PropertyElasticsearchTls)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	headers := make(http.Header)
+	authenticationType := config.GetOrDefault(c, config.PropertyElasticsearchAuthenticationType, "none")
+	switch config.ElasticsearchAuthenticationType(authenticationType) {
+	case config.ElasticsearchBasicAuthentication:
+		{
+			username := config.GetOrDefault(c, config.PropertyElasticsearchBasicAuthenticationUsername, "")
+			password := config.GetOrDefault(c, config.PropertyElasticsearchBasicAuthenticationPassword, "")
+			headers.Add("Authorization",
+				fmt.Sprintf("Basic %s",
+					base64.StdEncoding.EncodeToString([]byte(username+":"+password)),
+				),
+			)
+		}
+	case config.ElasticsearchApiKeyAuthentication:
+		{
+			// The API key is expected in its encoded form, as returned by the create API key API
+			headers.Add("Authorization",
+				fmt.Sprintf("ApiKey %s", config.GetOrDefault(c, config.PropertyElasticsearchApiKeyAuthentication, "")),
+			)
+		}
+	case config.ElasticsearchNoneAuthentication:
+		{
+		}
+	default:
+		{
+			return nil, errors.Errorf("Elasticsearch AuthenticationType '%s' doesn't exist", authenticationType)
+		}
+	}
+
+	return &elasticsearchSink{
+		logger:    logger,
+		client:    &http.Client{Transport: transport, Timeout: time.Minute},
+		encoder:   encoding.NewJsonEncoderWithConfig(c),
+		decoder:   encoding.NewJsonDecoderWithConfig(c),
+		address:   address,
+		headers:   headers,
+		batchSize: batchSize,
+		batchInterval: time.Duration(
+			config.GetOrDefault(c, config.PropertyElasticsearchBatchInterval, 1000),
+		) * time.Millisecond,
+		retries:         uint64(config.GetOrDefault(c, config.PropertyElasticsearchRetries, 8)),
+		items:           make([]*item, 0, batchSize),
+		shutdownAwaiter: waiting.NewShutdownAwaiter(),
+	}, nil
+}
+
+func (e *elasticsearchSink) Start() error {
+	e.logger.Infof("Starting ElasticsearchSink at %s", e.address)
+	if e.ticker == nil && e.batchInterval > 0 {
+		e.ticker = time.NewTicker(e.batchInterval)
+		go e.flushHandler()
+	}
+	return nil
+}
+
+func (e *elasticsearchSink) Stop() error {
+	e.logger.Infof("Stopping ElasticsearchSink at %s", e.address)
+	if e.ticker != nil {
+		e.shutdownAwaiter.SignalShutdown()
+		if err := e.shutdownAwaiter.AwaitDone(); err != nil {
+			e.logger.Warnln("Failed to shutdown flush handler in time")
+		}
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	err := e.flush()
+	e.client.CloseIdleConnections()
+	return err
+}
+
+func (e *elasticsearchSink) BeginTransaction(
+	_ sink.Context, _ uint32, _ time.Time,
+) error {
+
+	return nil
+}
+
+func (e *elasticsearchSink) CommitTransaction(
+	_ sink.Context, _ uint32, _ pgtypes.LSN,
+) error {
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// The transaction is acknowledged as soon as all
+	// its bulk items were accepted by Elasticsearch
+	return e.flush()
+}
+
+// SetDeadLetterHandler enables parking bulk items which were
+// rejected by Elasticsearch in the dead-letter target
+func (e *elasticsearchSink) SetDeadLetterHandler(
+	deadLetterHandler *sinkimpl.DeadLetterHandler,
+) {
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.deadLetterHandler = deadLetterHandler
+}
+
+func (e *elasticsearchSink) Emit(
+	_ sink.Context, timestamp time.Time, topicName string, key, envelope schema.Struct,
+) error {
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	payload, ok := envelope[schema.FieldNamePayload].(schema.Struct)
+	if !ok {
+		return nil
+	}
+
+	index := indexName(topicName)
+	event := sink.Event{
+		Timestamp: timestamp,
+		TopicName: topicName,
+		Key:       key,
+		Envelope:  envelope,
+	}
+
+	operation, _ := payload[schema.FieldNameOperation].(string)
+	switch schema.Operation(operation) {
+	case schema.OP_READ, schema.OP_CREATE, schema.OP_UPDATE:
+		after, _ := payload[schema.FieldNameAfter].(schema.Struct)
+		i, err := e.newItem(actionIndex, index, documentId(key), after, event)
+		if err != nil {
+			return err
+		}
+		return e.add(i)
+
+	case schema.OP_DELETE:
+		id := documentId(key)
+		if id == "" {
+			e.logger.Debugf("Ignoring delete event without key on index %s", index)
+			return nil
+		}
+		i, err := e.newItem(actionDelete, index, id, nil, event)
+		if err != nil {
+			return err
+		}
+		return e.add(i)
+
+	case schema.OP_TRUNCATE:
+		// Pending items of the index need to be applied before all
+		// documents are removed, to not resurrect them afterward
+		if err := e.flush(); err != nil {
+			return err
+		}
+		return e.deleteByQuery(index)
+	}
+
+	// Logical replication messages and TimescaleDB
+	// events don't map to documents of an index
+	return nil
+}
+
+func (e *elasticsearchSink) add(
+	i *item,
+) error {
+
+	// A full batch is flushed before the new item is added, when the
+	// flush fails the event is retried without duplicating its item
+	if len(e.items) >= e.batchSize {
+		if err := e.flush(); err != nil {
+			return err
+		}
+	}
+	e.items = append(e.items, i)
+	return nil
+}
+
+// Acknowledge defers the acknowledgement until the buffered bulk
+// items of previously emitted events were indexed, since Emit only
+// buffers them
+func (e *elasticsearchSink) Acknowledge(
+	_ sink.Context, acknowledge func() error,
+) error {
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if len(e.items) == 0 {
+		return acknowledge()
+	}
+
+	e.acknowledges = append(e.acknowledges, acknowledge)
+	return nil
+}
+
+func (e *elasticsearchSink) flushHandler() {
+	for {
+		select {
+		case <-e.shutdownAwaiter.AwaitShutdownChan():
+			e.ticker.Stop()
+			e.shutdownAwaiter.SignalDone()
+			return
+		case <-e.ticker.C:
+			e.mutex.Lock()
+			if err := e.flush(); err != nil {
+				e.logger.Warnf("Failed to flush bulk items, retrying with the next interval: %+v", err)
+			}
+			e.mutex.Unlock()
+		}
+	}
+}
+
+func (e *elasticsearchSink) flush() error {
+	if len(e.items) == 0 {
+		return nil
+	}
+
+	rejected := make([]*item, 0)
+	operation := func() error {
+		remaining, err := e.bulk(e.items)
+		if err != nil {
+			return err
+		}
+
+		// Only the failed items are kept and retried, items which
+		// failed permanently would never succeed and are removed
+		e.items = make([]*item, 0, e.batchSize)
+		for _, i := range remaining {
+			if i.retryable {
+				e.items = append(e.items, i)
+			} else {
+				rejected = append(rejected, i)
+			}
+		}
+		if len(e.items) > 0 {
+			return e.items[0].failure
+		}
+		return nil
+	}
+
+	backOff := backoff.WithMaxRetries(backoff.NewExponentialBackOff(), e.retries)
+	err := backoff.RetryNotify(operation, backOff, func(err error, _ time.Duration) {
+		e.logger.Warnf("Failed to index %d bulk items, retrying: %+v", len(e.items), err)
+	})
+
+	// Rejected items are lost otherwise, their failure takes precedence
+	if rejectErr := e.reject(rejected); rejectErr != nil {
+		return rejectErr
+	}
+	if err != nil {
+		return err
+	}
+
+	acknowledges := e.acknowledges
+	e.acknowledges = nil
+	for _, acknowledge := range acknowledges {
+		if ackErr := acknowledge(); ackErr != nil && err == nil {
+			err = ackErr
+		}
+	}
+	return err
+}
+
+// reject parks the items which failed permanently in the dead-letter
+// target. Without a dead-letter target, the failure is reported as a
+// permanent error, which stops the replication.
+func (e *elasticsearchSink) reject(
+	items []*item,
+) error {
+
+	for index, i := range items {
+		cause := sink.NewPermanentError(i.failure)
+		if e.deadLetterHandler == nil || !e.deadLetterHandler.Handles(cause) {
+			return sink.NewPermanentError(errors.Errorf(
+				"Elasticsearch rejected %d bulk items, first failure: %s", len(items)-index, i.failure.Error(),
+			))
+		}
+
+		event := i.event
+		if err := e.deadLetterHandler.Emit(
+			event.Timestamp, event.TopicName, event.Key, event.Envelope, cause,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *elasticsearchSink) bulk(
+	items []*item,
+) ([]*item, error) {
+
+	body := bytes.NewBuffer(make([]byte, 0, len(items)*256))
+	for _, i := range items {
+		body.Write(i.action)
+		body.WriteByte('\n')
+		if i.document != nil {
+			body.Write(i.document)
+			body.WriteByte('\n')
+		}
+	}
+
+	data, err := e.execute("POST", "/_bulk", "application/x-ndjson", body)
+	if err != nil {
+		return nil, err
+	}
+
+	response := bulkResponse{}
+	if err := e.decoder.Unmarshal(data, &response); err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	if !response.Errors {
+		return items[:0], nil
+	}
+	if len(response.Items) != len(items) {
+		return nil, errors.Errorf(
+			"Elasticsearch sink received %d bulk results for %d items", len(response.Items), len(items),
+		)
+	}
+
+	// Bulk results are returned in the order of the items
+	remaining := make([]*item, 0)
+	for index, result := range response.Items {
+		i := items[index]
+		if !i.failed(result) {
+			continue
+		}
+		e.logger.Debugf("Bulk item on index %s failed: %+v", i.index, i.failure)
+		remaining = append(remaining, i)
+	}
+	return remaining, nil
+}
+
+func (e *elasticsearchSink) deleteByQuery(
+	index string,
+) error {
+
+	path := fmt.Sprintf("/%s/_delete_by_query?conflicts=proceed&ignore_unavailable=true", url.PathEscape(index))
+	body := bytes.NewBufferString(`{"query":{"match_all":{}}}`)
+	_, err := e.execute("POST", path, "application/json", body)
+	return err
+}
+
+func (e *elasticsearchSink) execute(
+	method, path, contentType string, body io.Reader,
+) ([]byte, error) {
+
+	request, err := http.NewRequest(method, e.address+path, body)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	request.Header = e.headers.Clone()
+	request.Header.Set("Content-Type", contentType)
+
+	response, err := e.client.Do(request)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	defer response.Body.Close()
+
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		if len(data) > 4096 {
+			data = data[:4096]
+		}
+		err := errors.Errorf(
+			"Elasticsearch sink request %s %s failed with status %d: %s",
+			method, path, response.StatusCode, strings.TrimSpace(string(data)),
+		)
+		// Client errors (except for too many requests) won't succeed on retry
+		if response.StatusCode != http.StatusTooManyRequests && response.StatusCode < 500 {
+			return nil, backoff.Permanent(err)
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+func (e *elasticsearchSink) newItem(
+	action, index, id string, document schema.Struct, event sink.Event,
+) (*item, error) {
+
+	metadata := map[string]string{"_index": index}
+	if id != "" {
+		metadata["_id"] = id
+	}
+
+	a, err := e.encoder.Marshal(map[string]any{action: metadata})
+	if err != nil {
+		return nil, err
+	}
+
+	i := &item{
+		action: a,
+		kind:   action,
+		index:  index,
+		event:  event,
+	}
+
+	if action == actionIndex {
+		if document == nil {
+			document = schema.Struct{}
+		}
+		if i.document, err = e.encoder.Marshal(document); err != nil {
+			return nil, err
+		}
+	}
+	return i, nil
+}
+
+func indexName(
+	topicName string,
+) string {
+
+	// Index names must be lowercase and can't start with an underscore
+	return strings.TrimLeft(strings.ToLower(topicName), "_-+")
+}
+
+func documentId(
+	key schema.Struct,
+) string {
+
+	values, _ := key[schema.FieldNamePayload].(schema.Struct)
+	if len(values) == 0 {
+		return ""
+	}
+
+	keySchema, _ := key[schema.FieldNameSchema].(schema.Struct)
+	fields, _ := keySchema[schema.FieldNameFields].([]schema.Struct)
+
+	// Fields are generated in the order of their index, composite
+	// keys are joined to have a stable document id for all events
+	parts := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if name, ok := field[schema.FieldNameName].(string); ok {
+			parts = append(parts, fmt.Sprintf("%v", values[name]))
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return strings.Join(parts, "_")
+}
@@ -0,0 +1,77 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package elasticsearch
+
+import (
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_Elasticsearch_Acknowledge_After_Bulk(
+	t *testing.T,
+) {
+
+	logger, err := logging.NewLogger("ElasticsearchSinkTest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, _ *http.Request) {
+		requests++
+		writer.Header().Set("Content-Type", "application/json")
+		_, _ = writer.Write([]byte(`{"errors":false,"items":[{"index":{"status":201}}]}`))
+	}))
+	defer server.Close()
+
+	s := &elasticsearchSink{
+		logger:    logger,
+		client:    server.Client(),
+		decoder:   encoding.NewJsonDecoder(false),
+		address:   server.URL,
+		headers:   http.Header{},
+		batchSize: 10,
+	}
+
+	acknowledged := 0
+	acknowledge := func() error {
+		acknowledged++
+		return nil
+	}
+
+	// Without buffered items, acknowledgements happen immediately
+	assert.NoError(t, s.Acknowledge(nil, acknowledge))
+	assert.Equal(t, 1, acknowledged)
+
+	assert.NoError(t, s.add(&item{
+		action:   []byte(`{"index":{"_index":"metrics","_id":"1"}}`),
+		document: []byte(`{"value":1}`),
+		kind:     actionIndex,
+		index:    "metrics",
+	}))
+	assert.NoError(t, s.Acknowledge(nil, acknowledge))
+	assert.Equal(t, 1, acknowledged)
+
+	assert.NoError(t, s.flush())
+	assert.Equal(t, 1, requests)
+	assert.Equal(t, 2, acknowledged)
+}
@@ -0,0 +1,86 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package elasticsearch
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"net/http"
+)
+
+const (
+	actionIndex  = "index"
+	actionDelete = "delete"
+)
+
+type item struct {
+	action    []byte
+	document  []byte
+	kind      string
+	index     string
+	event     sink.Event
+	failure   error
+	retryable bool
+}
+
+func (i *item) failed(
+	result map[string]bulkItemResult,
+) bool {
+
+	r, ok := result[i.kind]
+	if !ok {
+		i.failure = errors.Errorf("bulk result for %s action on index %s is missing", i.kind, i.index)
+		i.retryable = true
+		return true
+	}
+
+	// Documents that don't exist (anymore) are considered deleted
+	if i.kind == actionDelete && r.Status == http.StatusNotFound {
+		return false
+	}
+	if r.Status >= 200 && r.Status <= 299 {
+		return false
+	}
+
+	reason := ""
+	if r.Error != nil {
+		reason = r.Error.Type + ": " + r.Error.Reason
+	}
+	i.failure = errors.Errorf(
+		"%s action on index %s failed with status %d: %s", i.kind, i.index, r.Status, reason,
+	)
+	i.retryable = r.Status == http.StatusTooManyRequests || r.Status >= 500
+	return true
+}
+
+type bulkResponse struct {
+	Errors bool                        `json:"errors"`
+	Items  []map[string]bulkItemResult `json:"items"`
+}
+
+type bulkItemResult struct {
+	Index  string         `json:"_index"`
+	Id     string         `json:"_id"`
+	Status int            `json:"status"`
+	Error  *bulkItemError `json:"error"`
+}
+
+type bulkItemError struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
@@ -0,0 +1,457 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package file
+
+import (
+	"compress/gzip"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/inhies/go-bytesize"
+	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/internal/waiting"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	segmentFileExtension    = ".ndjson"
+	compressedFileExtension = ".gz"
+)
+
+func init() {
+	sinkimpl.RegisterSink(config.File, newFileSink)
+}
+
+type segment struct {
+	topicName string
+	index     uint64
+	file      *os.File
+	size      int64
+	openedAt  time.Time
+	dirty     bool
+}
+
+type fileSink struct {
+	mutex           sync.Mutex
+	logger          *logging.Logger
+	encoder         *encoding.JsonEncoder
+	path            string
+	maxSize         int64
+	maxDuration     time.Duration
+	compress        bool
+	fsyncInterval   time.Duration
+	segments        map[string]*segment
+	ticker          *time.Ticker
+	shutdownAwaiter *waiting.ShutdownAwaiter
+	compressions    sync.WaitGroup
+}
+
+func newFileSink(
+	c *config.Config,
+) (sink.Sink, error) {
+
+	logger, err := logging.NewLogger("FileSink")
+	if err != nil {
+		return nil, err
+	}
+
+	maxSizeProperty := config.GetOrDefault(c, config.PropertyFileMaxSize, "100MB")
+	maxSize, err := bytesize.Parse(maxSizeProperty)
+	if err != nil {
+		return nil, errors.Errorf("Failed to parse max size property '%s' => %s", maxSizeProperty, err.Error())
+	}
+
+	return &fileSink{
+		logger:      logger,
+		encoder:     encoding.NewJsonEncoderWithConfig(c),
+		path:        config.GetOrDefault(c, config.PropertyFilePath, "./events"),
+		maxSize:     int64(maxSize),
+		maxDuration: time.Duration(config.GetOrDefault(c, config.PropertyFileMaxDuration, 3600)) * time.Second,
+		compress:    config.GetOrDefault(c, config.PropertyFileCompress, false),
+		fsyncInterval: time.Duration(
+			config.GetOrDefault(c, config.PropertyFileFsyncInterval, 1000),
+		) * time.Millisecond,
+		segments: make(map[string]*segment),
+	}, nil
+}
+
+func (f *fileSink) Start() error {
+	f.logger.Infof("Starting FileSink at %s", f.path)
+	if err := os.MkdirAll(f.path, 0777); err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	// The ticker fsyncs dirty segments and rotates segments
+	// exceeding the max duration, even if no events arrive
+	if f.ticker == nil && (f.fsyncInterval > 0 || f.maxDuration > 0) {
+		interval := f.fsyncInterval
+		if interval == 0 {
+			interval = time.Second
+		}
+		f.ticker = time.NewTicker(interval)
+		f.shutdownAwaiter = waiting.NewShutdownAwaiter()
+		go f.tickHandler(f.ticker, f.shutdownAwaiter)
+	}
+	return nil
+}
+
+func (f *fileSink) Stop() error {
+	f.logger.Infof("Stopping FileSink at %s", f.path)
+	if f.ticker != nil {
+		f.shutdownAwaiter.SignalShutdown()
+		if err := f.shutdownAwaiter.AwaitDone(); err != nil {
+			f.logger.Warnln("Failed to shutdown tick handler in time")
+		}
+		f.ticker = nil
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	// Active segments are only closed, not compressed,
+	// to be able to resume them after a restart
+	var lastErr error
+	for topicName, s := range f.segments {
+		if s.file == nil {
+			continue
+		}
+		if err := s.close(); err != nil {
+			f.logger.Warnf("Failed to close segment of topic %s: %+v", topicName, err)
+			lastErr = err
+		}
+	}
+	f.segments = make(map[string]*segment)
+
+	f.compressions.Wait()
+	return lastErr
+}
+
+func (f *fileSink) Emit(
+	context sink.Context, _ time.Time, topicName string, _, envelope schema.Struct,
+) error {
+
+	data, err := f.encoder.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	s, present := f.segments[topicName]
+	if !present {
+		if s, err = f.resumeSegment(context, topicName); err != nil {
+			return err
+		}
+		f.segments[topicName] = s
+	} else if s.file == nil {
+		// The segment was rotated by the tick handler
+		if s, err = f.openSegment(context, topicName, s.index+1, time.Now()); err != nil {
+			return err
+		}
+		f.segments[topicName] = s
+	}
+
+	if f.needsRotation(s, int64(len(data))) {
+		if s, err = f.rotateSegment(context, s); err != nil {
+			return err
+		}
+		f.segments[topicName] = s
+	}
+
+	n, err := s.file.Write(data)
+	s.size += int64(n)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	if f.fsyncInterval == 0 {
+		return s.file.Sync()
+	}
+	s.dirty = true
+	return nil
+}
+
+func (f *fileSink) tickHandler(
+	ticker *time.Ticker, shutdownAwaiter *waiting.ShutdownAwaiter,
+) {
+
+	for {
+		select {
+		case <-shutdownAwaiter.AwaitShutdownChan():
+			ticker.Stop()
+			shutdownAwaiter.SignalDone()
+			return
+		case <-ticker.C:
+			f.mutex.Lock()
+			for topicName, s := range f.segments {
+				if s.file == nil {
+					continue
+				}
+
+				// Segments of idle topics are closed when they exceed the
+				// max duration, the next event opens the following segment
+				if f.needsRotation(s, 0) {
+					if err := f.closeSegment(s); err != nil {
+						f.logger.Warnf("Failed to rotate segment of topic %s: %+v", topicName, err)
+					}
+					continue
+				}
+
+				if !s.dirty {
+					continue
+				}
+				if err := s.file.Sync(); err != nil {
+					f.logger.Warnf("Failed to fsync segment of topic %s: %+v", topicName, err)
+					continue
+				}
+				s.dirty = false
+			}
+			f.mutex.Unlock()
+		}
+	}
+}
+
+func (f *fileSink) needsRotation(
+	s *segment, length int64,
+) bool {
+
+	if s.size == 0 {
+		return false
+	}
+	if f.maxSize > 0 && s.size+length > f.maxSize {
+		return true
+	}
+	return f.maxDuration > 0 && time.Since(s.openedAt) >= f.maxDuration
+}
+
+func (f *fileSink) resumeSegment(
+	context sink.Context, topicName string,
+) (*segment, error) {
+
+	if err := os.MkdirAll(f.path, 0777); err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	index := uint64(0)
+	openedAt := time.Now()
+	if value, present := context.Attribute(segmentIndexAttribute(topicName)); present {
+		if i, err := strconv.ParseUint(value, 10, 64); err == nil {
+			index = i
+		}
+	}
+	if value, present := context.Attribute(segmentOpenedAttribute(topicName)); present {
+		if millis, err := strconv.ParseInt(value, 10, 64); err == nil {
+			openedAt = time.UnixMilli(millis)
+		}
+	}
+
+	// The context state is only stored on shutdown, after a crash
+	// segments on disk may be further ahead than the stored index
+	highestIndex, err := f.highestSegmentIndex(topicName)
+	if err != nil {
+		return nil, err
+	}
+	if highestIndex > index {
+		index = highestIndex
+		openedAt = time.Now()
+	}
+
+	// Compressed segments are closed and cannot be appended to
+	if _, err := os.Stat(f.segmentFileName(topicName, index) + compressedFileExtension); err == nil {
+		index++
+		openedAt = time.Now()
+	}
+
+	return f.openSegment(context, topicName, index, openedAt)
+}
+
+func (f *fileSink) rotateSegment(
+	context sink.Context, s *segment,
+) (*segment, error) {
+
+	if err := f.closeSegment(s); err != nil {
+		return nil, err
+	}
+	return f.openSegment(context, s.topicName, s.index+1, time.Now())
+}
+
+// closeSegment closes the segment for good and compresses it, if enabled
+func (f *fileSink) closeSegment(
+	s *segment,
+) error {
+
+	err := s.close()
+	s.file = nil
+	s.dirty = false
+	if err != nil {
+		return err
+	}
+
+	if f.compress {
+		fileName := f.segmentFileName(s.topicName, s.index)
+		f.compressions.Add(1)
+		go func() {
+			defer f.compressions.Done()
+			if err := compressSegment(fileName); err != nil {
+				f.logger.Warnf("Failed to compress segment %s: %+v", fileName, err)
+			}
+		}()
+	}
+	return nil
+}
+
+func (f *fileSink) openSegment(
+	context sink.Context, topicName string, index uint64, openedAt time.Time,
+) (*segment, error) {
+
+	fileName := f.segmentFileName(topicName, index)
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, errors.Wrap(err, 0)
+	}
+
+	context.SetAttribute(segmentIndexAttribute(topicName), strconv.FormatUint(index, 10))
+	context.SetAttribute(segmentOpenedAttribute(topicName), strconv.FormatInt(openedAt.UnixMilli(), 10))
+
+	return &segment{
+		topicName: topicName,
+		index:     index,
+		file:      file,
+		size:      fi.Size(),
+		openedAt:  openedAt,
+	}, nil
+}
+
+func (f *fileSink) highestSegmentIndex(
+	topicName string,
+) (uint64, error) {
+
+	entries, err := os.ReadDir(f.path)
+	if err != nil {
+		return 0, errors.Wrap(err, 0)
+	}
+
+	highestIndex := uint64(0)
+	prefix := topicName + "-"
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		name = strings.TrimSuffix(strings.TrimPrefix(name, prefix), compressedFileExtension)
+		if !strings.HasSuffix(name, segmentFileExtension) {
+			continue
+		}
+		index, err := strconv.ParseUint(strings.TrimSuffix(name, segmentFileExtension), 10, 64)
+		if err != nil {
+			continue
+		}
+		if index > highestIndex {
+			highestIndex = index
+		}
+	}
+	return highestIndex, nil
+}
+
+func (f *fileSink) segmentFileName(
+	topicName string, index uint64,
+) string {
+
+	return filepath.Join(f.path, fmt.Sprintf("%s-%06d%s", topicName, index, segmentFileExtension))
+}
+
+func (s *segment) close() error {
+	if err := s.file.Sync(); err != nil {
+		s.file.Close()
+		return errors.Wrap(err, 0)
+	}
+	return s.file.Close()
+}
+
+func compressSegment(
+	fileName string,
+) error {
+
+	source, err := os.Open(fileName)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	defer source.Close()
+
+	// Compress into a temporary file first, a crash must
+	// never leave a partially written segment behind
+	tempFileName := fileName + compressedFileExtension + ".tmp"
+	target, err := os.OpenFile(tempFileName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	writer := gzip.NewWriter(target)
+	if _, err := io.Copy(writer, source); err != nil {
+		target.Close()
+		return errors.Wrap(err, 0)
+	}
+	if err := writer.Close(); err != nil {
+		target.Close()
+		return errors.Wrap(err, 0)
+	}
+	if err := target.Sync(); err != nil {
+		target.Close()
+		return errors.Wrap(err, 0)
+	}
+	if err := target.Close(); err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	if err := os.Rename(tempFileName, fileName+compressedFileExtension); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return os.Remove(fileName)
+}
+
+func segmentIndexAttribute(
+	topicName string,
+) string {
+
+	return fmt.Sprintf("file.%s.segment", topicName)
+}
+
+func segmentOpenedAttribute(
+	topicName string,
+) string {
+
+	return fmt.Sprintf("file.%s.opened", topicName)
+}
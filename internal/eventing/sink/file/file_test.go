@@ -0,0 +1,295 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package file
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testTopicName = "timescaledb.public.metrics"
+
+type testContext struct {
+	attributes map[string]string
+}
+
+func (t *testContext) SetTransientAttribute(
+	key string, value string,
+) {
+
+	t.attributes[key] = value
+}
+
+func (t *testContext) TransientAttribute(
+	key string,
+) (value string, present bool) {
+
+	value, present = t.attributes[key]
+	return
+}
+
+func (t *testContext) SetAttribute(
+	key string, value string,
+) {
+
+	t.attributes[key] = value
+}
+
+func (t *testContext) Attribute(
+	key string,
+) (value string, present bool) {
+
+	value, present = t.attributes[key]
+	return
+}
+
+func Test_File_Sink_Rotation_And_Resume(
+	t *testing.T,
+) {
+
+	directory := t.TempDir()
+	config := &spiconfig.Config{
+		Sink: spiconfig.SinkConfig{
+			Type: spiconfig.File,
+			File: spiconfig.FileConfig{
+				Path:          directory,
+				MaxSize:       lo.ToPtr("1KB"),
+				MaxDuration:   lo.ToPtr(0),
+				Compress:      lo.ToPtr(true),
+				FsyncInterval: lo.ToPtr(0),
+			},
+		},
+	}
+	context := &testContext{attributes: make(map[string]string)}
+
+	emitEvents(t, config, context, 1, 30)
+
+	fileNames := segmentFileNames(t, directory)
+	assert.True(t, len(fileNames) > 2)
+	for _, fileName := range fileNames[:len(fileNames)-1] {
+		assert.True(t, strings.HasSuffix(fileName, ".ndjson.gz"))
+	}
+	lastFileName := fileNames[len(fileNames)-1]
+	assert.True(t, strings.HasSuffix(lastFileName, ".ndjson"))
+
+	segmentIndex, present := context.Attribute(segmentIndexAttribute(testTopicName))
+	assert.True(t, present)
+	index, err := strconv.ParseUint(segmentIndex, 10, 64)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%s-%06d.ndjson", testTopicName, index), lastFileName)
+
+	// A restarted sink must append to the last active segment
+	emitEvents(t, config, context, 31, 31)
+
+	resumedSegmentIndex, _ := context.Attribute(segmentIndexAttribute(testTopicName))
+	assert.Equal(t, segmentIndex, resumedSegmentIndex)
+
+	values := make([]int, 0)
+	for _, fileName := range segmentFileNames(t, directory) {
+		values = append(values, readValues(t, filepath.Join(directory, fileName))...)
+	}
+	assert.Equal(t, 31, len(values))
+	for i, value := range values {
+		assert.Equal(t, i+1, value)
+	}
+}
+
+func Test_File_Sink_Rotates_Idle_Segments(
+	t *testing.T,
+) {
+
+	directory := t.TempDir()
+	config := &spiconfig.Config{
+		Sink: spiconfig.SinkConfig{
+			Type: spiconfig.File,
+			File: spiconfig.FileConfig{
+				Path:     directory,
+				Compress: lo.ToPtr(true),
+			},
+		},
+	}
+	context := &testContext{attributes: make(map[string]string)}
+
+	s, err := newFileSink(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := s.(*fileSink)
+	f.maxDuration = time.Millisecond * 50
+	f.fsyncInterval = time.Millisecond * 10
+
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	if err := s.Emit(context, time.Now(), testTopicName, schema.Struct{}, testEnvelope(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	// No further events arrive, the segment is rotated by the ticker
+	assert.Eventually(t, func() bool {
+		fileNames := segmentFileNames(t, directory)
+		return len(fileNames) == 1 && strings.HasSuffix(fileNames[0], ".ndjson.gz")
+	}, time.Second*5, time.Millisecond*10)
+
+	if err := s.Emit(context, time.Now(), testTopicName, schema.Struct{}, testEnvelope(2)); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{
+		fmt.Sprintf("%s-%06d.ndjson.gz", testTopicName, 0),
+		fmt.Sprintf("%s-%06d.ndjson", testTopicName, 1),
+	}, segmentFileNames(t, directory))
+}
+
+func Test_File_Sink_Restart_Restarts_Ticker(
+	t *testing.T,
+) {
+
+	config := &spiconfig.Config{
+		Sink: spiconfig.SinkConfig{
+			Type: spiconfig.File,
+			File: spiconfig.FileConfig{
+				Path: t.TempDir(),
+			},
+		},
+	}
+
+	s, err := newFileSink(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := s.(*fileSink)
+
+	for i := 0; i < 2; i++ {
+		if err := s.Start(); err != nil {
+			t.Fatal(err)
+		}
+		assert.NotNil(t, f.ticker)
+		if err := s.Stop(); err != nil {
+			t.Fatal(err)
+		}
+		assert.Nil(t, f.ticker)
+	}
+}
+
+func emitEvents(
+	t *testing.T, config *spiconfig.Config, context *testContext, from, to int,
+) {
+
+	s, err := newFileSink(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := from; i <= to; i++ {
+		if err := s.Emit(context, time.Now(), testTopicName, schema.Struct{}, testEnvelope(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.Stop(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testEnvelope(
+	value int,
+) schema.Struct {
+
+	return schema.Struct{
+		schema.FieldNamePayload: schema.Struct{
+			schema.FieldNameAfter: schema.Struct{
+				"val":  value,
+				"text": strings.Repeat("x", 100),
+			},
+		},
+	}
+}
+
+func segmentFileNames(
+	t *testing.T, directory string,
+) []string {
+
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fileNames := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		fileNames = append(fileNames, entry.Name())
+	}
+	sort.Strings(fileNames)
+	return fileNames
+}
+
+func readValues(
+	t *testing.T, fileName string,
+) []int {
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if strings.HasSuffix(fileName, ".gz") {
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+
+	values := make([]int, 0)
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		envelope := struct {
+			Payload struct {
+				After struct {
+					Val int `json:"val"`
+				} `json:"after"`
+			} `json:"payload"`
+		}{}
+		if err := json.Unmarshal(scanner.Bytes(), &envelope); err != nil {
+			t.Fatal(err)
+		}
+		values = append(values, envelope.Payload.After.Val)
+	}
+	return values
+}
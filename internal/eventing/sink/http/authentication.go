@@ -0,0 +1,210 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package http
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/go-errors/errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenExpiryMargin defines how long before its expiry
+// an OAuth2 access token is refreshed
+const tokenExpiryMargin = 30 * time.Second
+
+// authenticator adds per-request authentication to the requests,
+// static credentials, like basic auth, are sent as regular headers
+type authenticator interface {
+	// authenticate is called for every attempt of a request,
+	// body is the payload as sent, after compression
+	authenticate(request *http.Request, body []byte) error
+	// invalidate is called when the endpoint rejected the
+	// credentials and returns true if they may be renewed
+	invalidate() bool
+}
+
+// hmacAuthenticator signs the request body with HMAC-SHA256. The
+// signed content is the unix timestamp and the body, separated by
+// a dot, which enables receivers to reject replayed requests
+type hmacAuthenticator struct {
+	secret          []byte
+	header          string
+	timestampHeader string
+	now             func() time.Time
+}
+
+func newHmacAuthenticator(
+	secret, header, timestampHeader string,
+) (*hmacAuthenticator, error) {
+
+	if secret == "" {
+		return nil, errors.Errorf("http HMAC authentication requires a secret")
+	}
+
+	return &hmacAuthenticator{
+		secret:          []byte(secret),
+		header:          header,
+		timestampHeader: timestampHeader,
+		now:             time.Now,
+	}, nil
+}
+
+func (h *hmacAuthenticator) authenticate(
+	request *http.Request, body []byte,
+) error {
+
+	timestamp := strconv.FormatInt(h.now().Unix(), 10)
+	request.Header.Set(h.timestampHeader, timestamp)
+	request.Header.Set(h.header, "sha256="+signature(h.secret, timestamp, body))
+	return nil
+}
+
+func (h *hmacAuthenticator) invalidate() bool {
+	return false
+}
+
+func signature(
+	secret []byte, timestamp string, body []byte,
+) string {
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// oauth2Authenticator requests access tokens using the OAuth2 client
+// credentials grant, tokens are cached until shortly before expiry
+type oauth2Authenticator struct {
+	client       *http.Client
+	tokenUrl     string
+	clientId     string
+	clientSecret string
+	scope        string
+	now          func() time.Time
+
+	mutex       sync.Mutex
+	accessToken string
+	expiry      time.Time
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func newOAuth2Authenticator(
+	client *http.Client, tokenUrl, clientId, clientSecret, scope string,
+) (*oauth2Authenticator, error) {
+
+	if tokenUrl == "" || clientId == "" {
+		return nil, errors.Errorf("http OAuth2 authentication requires a token url and client id")
+	}
+
+	return &oauth2Authenticator{
+		client:       client,
+		tokenUrl:     tokenUrl,
+		clientId:     clientId,
+		clientSecret: clientSecret,
+		scope:        scope,
+		now:          time.Now,
+	}, nil
+}
+
+func (o *oauth2Authenticator) authenticate(
+	request *http.Request, _ []byte,
+) error {
+
+	accessToken, err := o.token()
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+accessToken)
+	return nil
+}
+
+func (o *oauth2Authenticator) invalidate() bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.accessToken = ""
+	return true
+}
+
+func (o *oauth2Authenticator) token() (string, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	// Tokens without expiry are kept until the endpoint rejects them
+	if o.accessToken != "" && (o.expiry.IsZero() || o.now().Before(o.expiry.Add(-tokenExpiryMargin))) {
+		return o.accessToken, nil
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	if o.scope != "" {
+		form.Set("scope", o.scope)
+	}
+
+	request, err := http.NewRequest(http.MethodPost, o.tokenUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", errors.Wrap(err, 0)
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	request.SetBasicAuth(url.QueryEscape(o.clientId), url.QueryEscape(o.clientSecret))
+
+	response, err := o.client.Do(request)
+	if err != nil {
+		return "", errors.Wrap(err, 0)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorMessageSize))
+		return "", errors.Errorf(
+			"HTTP sink failed to request an access token with status %d: %s",
+			response.StatusCode, strings.TrimSpace(string(message)),
+		)
+	}
+
+	token := tokenResponse{}
+	if err := json.NewDecoder(response.Body).Decode(&token); err != nil {
+		return "", errors.Wrap(err, 0)
+	}
+	if token.AccessToken == "" {
+		return "", errors.Errorf("HTTP sink received a token response without access token")
+	}
+
+	o.accessToken = token.AccessToken
+	o.expiry = time.Time{}
+	if token.ExpiresIn > 0 {
+		o.expiry = o.now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return o.accessToken, nil
+}
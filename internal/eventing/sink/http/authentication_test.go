@@ -0,0 +1,207 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type tokenServer struct {
+	*httptest.Server
+	mutex     sync.Mutex
+	issued    int
+	expiresIn int64
+	grants    []string
+	scopes    []string
+}
+
+func newTokenServer(
+	expiresIn int64,
+) *tokenServer {
+
+	server := &tokenServer{expiresIn: expiresIn}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.mutex.Lock()
+		defer server.mutex.Unlock()
+
+		clientId, clientSecret, ok := r.BasicAuth()
+		if !ok || clientId != "client" || clientSecret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		_ = r.ParseForm()
+		server.grants = append(server.grants, r.PostForm.Get("grant_type"))
+		server.scopes = append(server.scopes, r.PostForm.Get("scope"))
+		server.issued++
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(tokenResponse{
+			AccessToken: fmt.Sprintf("token-%d", server.issued),
+			TokenType:   "Bearer",
+			ExpiresIn:   server.expiresIn,
+		})
+	}))
+	return server
+}
+
+func Test_Http_Sink_Hmac_Authentication(
+	t *testing.T,
+) {
+
+	server := newRecordingServer()
+	defer server.Close()
+
+	s := newTestSink(t, server.URL, func(c *spiconfig.Config) {
+		c.Sink.Http.Authentication.Type = spiconfig.HmacAuthentication
+		c.Sink.Http.Authentication.Hmac.Secret = "shared-secret"
+	})
+
+	assert.NoError(t, s.Emit(nil, time.Now(), "ts.public.metrics", nil, newEnvelope("public", "metrics", 1)))
+	assert.Len(t, server.requests, 1)
+
+	request := server.requests[0]
+	timestamp := request.headers.Get("X-Timestamp")
+	assert.NotEmpty(t, timestamp)
+	assert.Equal(t,
+		"sha256="+signature([]byte("shared-secret"), timestamp, []byte(request.body)),
+		request.headers.Get("X-Signature"),
+	)
+}
+
+func Test_Http_Sink_Hmac_Authentication_Requires_Secret(
+	t *testing.T,
+) {
+
+	_, err := newHttpSink(&spiconfig.Config{
+		Sink: spiconfig.SinkConfig{
+			Http: spiconfig.HttpConfig{
+				Authentication: spiconfig.HttpAuthenticationConfig{
+					Type: spiconfig.HmacAuthentication,
+				},
+			},
+		},
+	})
+	assert.Error(t, err)
+}
+
+func Test_Http_Sink_OAuth2_Authentication_Caches_Token(
+	t *testing.T,
+) {
+
+	tokens := newTokenServer(3600)
+	defer tokens.Close()
+
+	server := newRecordingServer()
+	defer server.Close()
+
+	s := newTestSink(t, server.URL, func(c *spiconfig.Config) {
+		c.Sink.Http.Authentication.Type = spiconfig.OAuth2Authentication
+		c.Sink.Http.Authentication.OAuth2 = spiconfig.HttpOAuth2AuthenticationConfig{
+			TokenUrl:     tokens.URL,
+			ClientId:     "client",
+			ClientSecret: "secret",
+			Scope:        "events:write",
+		}
+	})
+
+	assert.NoError(t, s.Emit(nil, time.Now(), "ts.public.metrics", nil, newEnvelope("public", "metrics", 1)))
+	assert.NoError(t, s.Emit(nil, time.Now(), "ts.public.metrics", nil, newEnvelope("public", "metrics", 2)))
+
+	assert.Equal(t, 1, tokens.issued)
+	assert.Equal(t, []string{"client_credentials"}, tokens.grants)
+	assert.Equal(t, []string{"events:write"}, tokens.scopes)
+	assert.Len(t, server.requests, 2)
+	assert.Equal(t, "Bearer token-1", server.requests[0].headers.Get("Authorization"))
+	assert.Equal(t, "Bearer token-1", server.requests[1].headers.Get("Authorization"))
+}
+
+func Test_Http_Sink_OAuth2_Authentication_Refreshes_Token(
+	t *testing.T,
+) {
+
+	tokens := newTokenServer(3600)
+	defer tokens.Close()
+
+	server := newRecordingServer()
+	defer server.Close()
+
+	s := newTestSink(t, server.URL, func(c *spiconfig.Config) {
+		c.Sink.Http.Authentication.Type = spiconfig.OAuth2Authentication
+		c.Sink.Http.Authentication.OAuth2 = spiconfig.HttpOAuth2AuthenticationConfig{
+			TokenUrl:     tokens.URL,
+			ClientId:     "client",
+			ClientSecret: "secret",
+		}
+	})
+
+	now := time.Now()
+	authenticator := s.(*httpSink).authenticator.(*oauth2Authenticator)
+	authenticator.now = func() time.Time {
+		return now
+	}
+
+	assert.NoError(t, s.Emit(nil, time.Now(), "ts.public.metrics", nil, newEnvelope("public", "metrics", 1)))
+
+	// Tokens are refreshed shortly before they expire
+	now = now.Add(time.Hour - tokenExpiryMargin)
+	assert.NoError(t, s.Emit(nil, time.Now(), "ts.public.metrics", nil, newEnvelope("public", "metrics", 2)))
+
+	assert.Equal(t, 2, tokens.issued)
+	assert.Equal(t, "Bearer token-1", server.requests[0].headers.Get("Authorization"))
+	assert.Equal(t, "Bearer token-2", server.requests[1].headers.Get("Authorization"))
+}
+
+func Test_Http_Sink_OAuth2_Authentication_Renews_Rejected_Token(
+	t *testing.T,
+) {
+
+	tokens := newTokenServer(3600)
+	defer tokens.Close()
+
+	server := newRecordingServer(http.StatusUnauthorized)
+	defer server.Close()
+
+	s := newTestSink(t, server.URL, func(c *spiconfig.Config) {
+		c.Sink.Http.Authentication.Type = spiconfig.OAuth2Authentication
+		c.Sink.Http.Authentication.OAuth2 = spiconfig.HttpOAuth2AuthenticationConfig{
+			TokenUrl:     tokens.URL,
+			ClientId:     "client",
+			ClientSecret: "secret",
+		}
+	})
+
+	// The rejected token is dropped, the retried event renews it
+	err := s.Emit(nil, time.Now(), "ts.public.metrics", nil, newEnvelope("public", "metrics", 1))
+	assert.Error(t, err)
+	assert.False(t, sink.IsPermanentError(err))
+	assert.NoError(t, s.Emit(nil, time.Now(), "ts.public.metrics", nil, newEnvelope("public", "metrics", 1)))
+
+	assert.Equal(t, 2, tokens.issued)
+	assert.Len(t, server.requests, 2)
+	assert.Equal(t, "Bearer token-2", server.requests[1].headers.Get("Authorization"))
+}
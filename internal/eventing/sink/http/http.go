@@ -19,19 +19,29 @@ package http
 
 import (
 	"bytes"
-	"crypto/tls"
+	"compress/gzip"
+	"context"
 	"encoding/base64"
 	"fmt"
+	"github.com/go-errors/errors"
 	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/internal/tlsconfig"
 	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
 	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
 	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
 	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"io"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
+const maxErrorMessageSize = 4096
+
 func init() {
 	sinkimpl.RegisterSink(config.Http, newHttpSink)
 }
@@ -44,33 +54,53 @@ func basicAuth(
 }
 
 type httpSink struct {
-	client  *http.Client
-	encoder *encoding.JsonEncoder
-	address *string
-	headers *http.Header
+	logger        *logging.Logger
+	client        *http.Client
+	encoder       *encoding.JsonEncoder
+	address       string
+	headers       http.Header
+	customHeaders map[string]string
+	authenticator authenticator
+	perTable      bool
+	gzip          bool
+	maxWait       time.Duration
+	ctx           context.Context
+	cancel        context.CancelFunc
+
+	deadLetterHandler *sinkimpl.DeadLetterHandler
+}
+
+// batchingHttpSink sends batches of events as a single request per
+// resolved endpoint, either as newline delimited JSON or JSON array
+type batchingHttpSink struct {
+	*httpSink
+	format config.HttpBatchFormat
 }
 
 func newHttpSink(
 	c *config.Config,
 ) (sink.Sink, error) {
 
+	logger, err := logging.NewLogger("HttpSink")
+	if err != nil {
+		return nil, err
+	}
+
 	transport := http.DefaultTransport.(*http.Transport).Clone()
 	address := config.GetOrDefault(c, config.PropertyHttpUrl, "http://localhost:80")
 	tlsEnabled := strings.HasPrefix(address, "https://")
 	if tlsEnabled {
-		transport.TLSClientConfig = &tls.Config{
-			InsecureSkipVerify: config.GetOrDefault(
-				c, config.PropertyHttpTlsSkipVerify, false,
-			),
-			ClientAuth: config.GetOrDefault(
-				c, config.PropertyHttpTlsClientAuth, tls.NoClientCert,
-			),
+		tlsConfig, err := tlsconfig.NewTLSConfig(c, config.PropertyHttpTls)
+		if err != nil {
+			return nil, err
 		}
+		transport.TLSClientConfig = tlsConfig
 	}
 
+	client := &http.Client{Transport: transport}
 	headers := make(http.Header)
-	headers.Add("Content-Type", "application/json")
 
+	var authenticator authenticator
 	authenticationType := config.GetOrDefault(c, config.PropertyHttpAuthenticationType, "none")
 	switch config.HttpAuthenticationType(authenticationType) {
 	case config.BasicAuthentication:
@@ -89,6 +119,31 @@ func newHttpSink(
 				config.GetOrDefault(c, config.PropertyHttpHeaderAuthenticationHeaderValue, ""),
 			)
 		}
+	case config.HmacAuthentication:
+		{
+			hmacAuthenticator, err := newHmacAuthenticator(
+				config.GetOrDefault(c, config.PropertyHttpHmacAuthenticationSecret, ""),
+				config.GetOrDefault(c, config.PropertyHttpHmacAuthenticationHeader, "X-Signature"),
+				config.GetOrDefault(c, config.PropertyHttpHmacAuthenticationTimestampHeader, "X-Timestamp"),
+			)
+			if err != nil {
+				return nil, err
+			}
+			authenticator = hmacAuthenticator
+		}
+	case config.OAuth2Authentication:
+		{
+			oauth2Authenticator, err := newOAuth2Authenticator(client,
+				config.GetOrDefault(c, config.PropertyHttpOAuth2AuthenticationTokenUrl, ""),
+				config.GetOrDefault(c, config.PropertyHttpOAuth2AuthenticationClientId, ""),
+				config.GetOrDefault(c, config.PropertyHttpOAuth2AuthenticationClientSecret, ""),
+				config.GetOrDefault(c, config.PropertyHttpOAuth2AuthenticationScope, ""),
+			)
+			if err != nil {
+				return nil, err
+			}
+			authenticator = oauth2Authenticator
+		}
 	case config.NoneAuthentication:
 		{
 		}
@@ -98,36 +153,348 @@ func newHttpSink(
 		}
 	}
 
-	return &httpSink{
-		client:  &http.Client{Transport: transport},
-		encoder: encoding.NewJsonEncoderWithConfig(c),
-		address: &address,
-		headers: &headers,
-	}, nil
+	// Custom headers, like the url, may reference the topic, schema
+	// and table of the event, events without table information are
+	// skipped if any of them is bound to a table
+	customHeaders := make(map[string]string)
+	perTable := isTableTemplate(address)
+	for name, value := range c.Sink.Http.Headers {
+		customHeaders[name] = value
+		perTable = perTable || isTableTemplate(value)
+	}
+
+	httpSink := &httpSink{
+		logger:        logger,
+		client:        client,
+		encoder:       encoding.NewJsonEncoderWithConfig(c),
+		address:       address,
+		headers:       headers,
+		customHeaders: customHeaders,
+		authenticator: authenticator,
+		perTable:      perTable,
+		gzip:          config.GetOrDefault(c, config.PropertyHttpGzip, false),
+		maxWait:       time.Second * time.Duration(config.GetOrDefault(c, config.PropertyHttpRetriesMaxWait, 60)),
+	}
+
+	format := config.GetOrDefault(c, config.PropertyHttpBatchFormat, config.HttpBatchNone)
+	switch format {
+	case config.HttpBatchNone:
+		return httpSink, nil
+	case config.HttpBatchNdjson, config.HttpBatchArray:
+		return &batchingHttpSink{
+			httpSink: httpSink,
+			format:   format,
+		}, nil
+	default:
+		return nil, errors.Errorf("http batch format '%s' doesn't exist", format)
+	}
 }
 
 func (h *httpSink) Start() error {
+	// A new context per start, the context of a previous run
+	// is canceled already when the sink is restarted
+	h.ctx, h.cancel = context.WithCancel(context.Background())
 	return nil
 }
 
 func (h *httpSink) Stop() error {
+	// Aborts in-flight requests and waiting for a requested retry delay
+	if h.cancel != nil {
+		h.cancel()
+	}
 	h.client.CloseIdleConnections()
 	return nil
 }
 
+// SetDeadLetterHandler enables parking events which can't be
+// sent, since they have no table information for the endpoint
+func (h *httpSink) SetDeadLetterHandler(
+	deadLetterHandler *sinkimpl.DeadLetterHandler,
+) {
+
+	h.deadLetterHandler = deadLetterHandler
+}
+
 func (h *httpSink) Emit(
-	_ sink.Context, _ time.Time, topicName string, key, envelope schema.Struct,
+	_ sink.Context, timestamp time.Time, topicName string, key, envelope schema.Struct,
 ) error {
+
+	target, ok := h.resolve(topicName, envelope)
+	if !ok {
+		return h.skip(timestamp, topicName, key, envelope)
+	}
+
 	payload, err := h.encoder.Marshal(envelope)
 	if err != nil {
 		return err
 	}
-	req, err := http.NewRequest("POST", *h.address, bytes.NewBuffer(payload))
-	if err != nil {
+	return h.send(target, "application/json", payload)
+}
+
+func (b *batchingHttpSink) EmitBatch(
+	_ sink.Context, events []sink.Event,
+) error {
+
+	// Events are grouped by their resolved endpoint, keeping the
+	// order of the events for each of the endpoints
+	targets := make([]*endpoint, 0)
+	batches := make(map[string][][]byte)
+	for _, event := range events {
+		target, ok := b.resolve(event.TopicName, event.Envelope)
+		if !ok {
+			if err := b.skip(event.Timestamp, event.TopicName, event.Key, event.Envelope); err != nil {
+				return err
+			}
+			continue
+		}
+
+		key := target.key()
+		if _, present := batches[key]; !present {
+			targets = append(targets, target)
+		}
+		batches[key] = append(batches[key], event.EnvelopeData)
+	}
+
+	for _, target := range targets {
+		contentType, body := b.encodeBatch(batches[target.key()])
+		if err := b.send(target, contentType, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *batchingHttpSink) encodeBatch(
+	envelopes [][]byte,
+) (contentType string, body []byte) {
+
+	if b.format == config.HttpBatchNdjson {
+		buffer := &bytes.Buffer{}
+		for _, envelope := range envelopes {
+			buffer.Write(envelope)
+			buffer.WriteByte('\n')
+		}
+		return "application/x-ndjson", buffer.Bytes()
+	}
+
+	buffer := &bytes.Buffer{}
+	buffer.WriteByte('[')
+	buffer.Write(bytes.Join(envelopes, []byte{','}))
+	buffer.WriteByte(']')
+	return "application/json", buffer.Bytes()
+}
+
+// endpoint is the url and the custom headers of a request,
+// rendered for the topic and table of an event
+type endpoint struct {
+	address string
+	headers map[string]string
+}
+
+func (e *endpoint) key() string {
+	names := make([]string, 0, len(e.headers))
+	for name := range e.headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	builder := strings.Builder{}
+	builder.WriteString(e.address)
+	for _, name := range names {
+		builder.WriteString("\n" + name + ": " + e.headers[name])
+	}
+	return builder.String()
+}
+
+func (h *httpSink) resolve(
+	topicName string, envelope schema.Struct,
+) (*endpoint, bool) {
+
+	payload, _ := envelope[schema.FieldNamePayload].(schema.Struct)
+	source, _ := payload[schema.FieldNameSource].(schema.Struct)
+	schemaName, _ := source[schema.FieldNameSchema].(string)
+	tableName, _ := source[schema.FieldNameTable].(string)
+
+	if h.perTable && (schemaName == "" || tableName == "") {
+		return nil, false
+	}
+
+	// Values are escaped inside the url, but not inside the headers
+	addressReplacer := strings.NewReplacer(
+		"{topic}", url.PathEscape(topicName),
+		"{schema}", url.PathEscape(schemaName),
+		"{table}", url.PathEscape(tableName),
+	)
+	headerReplacer := strings.NewReplacer(
+		"{topic}", topicName, "{schema}", schemaName, "{table}", tableName,
+	)
+
+	headers := make(map[string]string, len(h.customHeaders))
+	for name, value := range h.customHeaders {
+		headers[name] = headerReplacer.Replace(value)
+	}
+
+	return &endpoint{
+		address: addressReplacer.Replace(h.address),
+		headers: headers,
+	}, true
+}
+
+// skip handles events without table information, which can't be sent
+// to per-table endpoints. They're parked in the dead-letter target, if
+// one is configured, otherwise they're dropped.
+func (h *httpSink) skip(
+	timestamp time.Time, topicName string, key, envelope schema.Struct,
+) error {
+
+	cause := sink.NewPermanentError(
+		errors.Errorf("Event on topic %s has no table information for the endpoint", topicName),
+	)
+	if h.deadLetterHandler == nil || !h.deadLetterHandler.Handles(cause) {
+		h.logger.Warnf("Dropping event without table information on topic %s", topicName)
+		return nil
+	}
+	return h.deadLetterHandler.Emit(timestamp, topicName, key, envelope, cause)
+}
+
+func (h *httpSink) send(
+	target *endpoint, contentType string, body []byte,
+) error {
+
+	if h.gzip {
+		compressed, err := compress(body)
+		if err != nil {
+			return err
+		}
+		body = compressed
+	}
+
+	retryAfter, err := h.post(target, contentType, body)
+	if err == nil || sink.IsPermanentError(err) || retryAfter == 0 {
 		return err
 	}
 
-	req.Header = *h.headers
-	_, err = h.client.Do(req)
+	// Failed requests are retried by the event emitter, or the batching
+	// sink manager. The delay requested by the server is awaited before
+	// the error is returned, so the retry doesn't happen too early
+	if retryAfter > h.maxWait {
+		retryAfter = h.maxWait
+	}
+	h.logger.Warnf("Failed to send request, retry requested in %s: %s", retryAfter, err.Error())
+	timer := time.NewTimer(retryAfter)
+	select {
+	case <-timer.C:
+	case <-h.ctx.Done():
+		timer.Stop()
+	}
 	return err
 }
+
+func (h *httpSink) post(
+	target *endpoint, contentType string, body []byte,
+) (time.Duration, error) {
+
+	request, err := http.NewRequestWithContext(h.ctx, http.MethodPost, target.address, bytes.NewReader(body))
+	if err != nil {
+		// An invalid url doesn't get any better by retrying
+		return 0, sink.NewPermanentError(errors.Wrap(err, 0))
+	}
+
+	request.Header = h.headers.Clone()
+	for name, value := range target.headers {
+		request.Header.Set(name, value)
+	}
+	request.Header.Set("Content-Type", contentType)
+	if h.gzip {
+		request.Header.Set("Content-Encoding", "gzip")
+	}
+	if h.authenticator != nil {
+		if err := h.authenticator.authenticate(request, body); err != nil {
+			return 0, err
+		}
+	}
+
+	response, err := h.client.Do(request)
+	if err != nil {
+		return 0, errors.Wrap(err, 0)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 200 && response.StatusCode <= 299 {
+		_, _ = io.Copy(io.Discard, response.Body)
+		return 0, nil
+	}
+
+	message, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorMessageSize))
+	err = errors.Errorf(
+		"HTTP sink request to %s failed with status %d: %s",
+		request.URL.Redacted(), response.StatusCode, strings.TrimSpace(string(message)),
+	)
+
+	// Rejected credentials are retried, if they can be renewed
+	if response.StatusCode == http.StatusUnauthorized &&
+		h.authenticator != nil && h.authenticator.invalidate() {
+
+		return 0, err
+	}
+
+	if !isRetryableStatus(response.StatusCode) {
+		return 0, sink.NewPermanentError(err)
+	}
+	return parseRetryAfter(response.Header.Get("Retry-After"), time.Now()), err
+}
+
+func isRetryableStatus(
+	statusCode int,
+) bool {
+
+	return statusCode == http.StatusRequestTimeout ||
+		statusCode == http.StatusTooManyRequests ||
+		statusCode >= 500
+}
+
+// parseRetryAfter reads the Retry-After header, which is either
+// the number of seconds to wait or the date to retry at
+func parseRetryAfter(
+	value string, now time.Time,
+) time.Duration {
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := date.Sub(now); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+func isTableTemplate(
+	value string,
+) bool {
+
+	return strings.Contains(value, "{schema}") || strings.Contains(value, "{table}")
+}
+
+func compress(
+	data []byte,
+) ([]byte, error) {
+
+	buffer := &bytes.Buffer{}
+	writer := gzip.NewWriter(buffer)
+	if _, err := writer.Write(data); err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	return buffer.Bytes(), nil
+}
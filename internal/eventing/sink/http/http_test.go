@@ -0,0 +1,330 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package http
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordedRequest struct {
+	path    string
+	headers http.Header
+	body    string
+}
+
+type recordingServer struct {
+	*httptest.Server
+	mutex      sync.Mutex
+	requests   []recordedRequest
+	statuses   []int
+	retryAfter string
+}
+
+func newRecordingServer(
+	statuses ...int,
+) *recordingServer {
+
+	server := &recordingServer{statuses: statuses}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.mutex.Lock()
+		defer server.mutex.Unlock()
+
+		reader := r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			reader, _ = gzip.NewReader(r.Body)
+		}
+		body, _ := io.ReadAll(reader)
+		server.requests = append(server.requests, recordedRequest{
+			path:    r.URL.Path,
+			headers: r.Header.Clone(),
+			body:    string(body),
+		})
+
+		status := http.StatusOK
+		if len(server.statuses) > 0 {
+			status = server.statuses[0]
+			server.statuses = server.statuses[1:]
+		}
+		if status == http.StatusTooManyRequests && server.retryAfter != "" {
+			w.Header().Set("Retry-After", server.retryAfter)
+		}
+		w.WriteHeader(status)
+	}))
+	return server
+}
+
+func newTestSink(
+	t *testing.T, address string, configurator func(c *spiconfig.Config),
+) sink.Sink {
+
+	config := &spiconfig.Config{
+		Sink: spiconfig.SinkConfig{
+			Type: spiconfig.Http,
+			Http: spiconfig.HttpConfig{
+				Url: address,
+			},
+		},
+	}
+	if configurator != nil {
+		configurator(config)
+	}
+
+	s, err := newHttpSink(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = s.Stop()
+	})
+	return s
+}
+
+func newEnvelope(
+	schemaName, tableName string, value int,
+) schema.Struct {
+
+	return schema.Struct{
+		schema.FieldNamePayload: schema.Struct{
+			schema.FieldNameSource: schema.Struct{
+				schema.FieldNameSchema: schemaName,
+				schema.FieldNameTable:  tableName,
+			},
+			"value": value,
+		},
+	}
+}
+
+func newEvent(
+	schemaName, tableName string, value int,
+) sink.Event {
+
+	envelope := newEnvelope(schemaName, tableName, value)
+	envelopeData, _ := json.Marshal(envelope)
+	return sink.Event{
+		TopicName:    "ts." + schemaName + "." + tableName,
+		Envelope:     envelope,
+		EnvelopeData: envelopeData,
+	}
+}
+
+func Test_Http_Sink_Permanent_Error(
+	t *testing.T,
+) {
+
+	server := newRecordingServer(http.StatusBadRequest)
+	defer server.Close()
+
+	s := newTestSink(t, server.URL, nil)
+	err := s.Emit(nil, time.Now(), "ts.public.metrics", nil, newEnvelope("public", "metrics", 1))
+	assert.Error(t, err)
+	assert.True(t, sink.IsPermanentError(err))
+	assert.Len(t, server.requests, 1)
+}
+
+func Test_Http_Sink_Retryable_Status(
+	t *testing.T,
+) {
+
+	server := newRecordingServer(http.StatusTooManyRequests, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	// Retryable failures are returned without retrying the request
+	// in the sink, the event emitter retries the event itself
+	s := newTestSink(t, server.URL, nil)
+	for i := 0; i < 2; i++ {
+		err := s.Emit(nil, time.Now(), "ts.public.metrics", nil, newEnvelope("public", "metrics", 1))
+		assert.Error(t, err)
+		assert.False(t, sink.IsPermanentError(err))
+	}
+	assert.NoError(t, s.Emit(nil, time.Now(), "ts.public.metrics", nil, newEnvelope("public", "metrics", 1)))
+	assert.Len(t, server.requests, 3)
+}
+
+func Test_Http_Sink_Waits_For_Retry_After(
+	t *testing.T,
+) {
+
+	server := newRecordingServer(http.StatusTooManyRequests)
+	server.retryAfter = "1"
+	defer server.Close()
+
+	s := newTestSink(t, server.URL, nil)
+
+	start := time.Now()
+	assert.Error(t, s.Emit(nil, time.Now(), "ts.public.metrics", nil, newEnvelope("public", "metrics", 1)))
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+	assert.Len(t, server.requests, 1)
+}
+
+func Test_Http_Sink_Retry_After_Max_Wait(
+	t *testing.T,
+) {
+
+	server := newRecordingServer(http.StatusTooManyRequests)
+	server.retryAfter = "3600"
+	defer server.Close()
+
+	s := newTestSink(t, server.URL, func(c *spiconfig.Config) {
+		c.Sink.Http.Retries.MaxWait = lo.ToPtr(0)
+	})
+
+	start := time.Now()
+	assert.Error(t, s.Emit(nil, time.Now(), "ts.public.metrics", nil, newEnvelope("public", "metrics", 1)))
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func Test_Http_Sink_Stop_Aborts_Retry_After(
+	t *testing.T,
+) {
+
+	server := newRecordingServer(http.StatusTooManyRequests)
+	server.retryAfter = "60"
+	defer server.Close()
+
+	s := newTestSink(t, server.URL, nil)
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		_ = s.Stop()
+	}()
+
+	start := time.Now()
+	err := s.Emit(nil, time.Now(), "ts.public.metrics", nil, newEnvelope("public", "metrics", 1))
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), time.Millisecond*250)
+	assert.Len(t, server.requests, 1)
+
+	// A restarted sink sends requests again
+	assert.NoError(t, s.Start())
+	assert.NoError(t, s.Emit(nil, time.Now(), "ts.public.metrics", nil, newEnvelope("public", "metrics", 1)))
+	assert.Len(t, server.requests, 2)
+}
+
+func Test_Http_Sink_Templated_Url_And_Headers(
+	t *testing.T,
+) {
+
+	server := newRecordingServer()
+	defer server.Close()
+
+	s := newTestSink(t, server.URL+"/hooks/{schema}/{table}", func(c *spiconfig.Config) {
+		c.Sink.Http.Headers = map[string]string{
+			"X-Topic": "{topic}",
+		}
+	})
+
+	assert.NoError(t, s.Emit(nil, time.Now(), "ts.public.metrics", nil, newEnvelope("public", "metrics", 1)))
+	assert.NoError(t, s.Emit(nil, time.Now(), "ts.public.other", nil, newEnvelope("public", "other", 2)))
+	// Events without table information can't be routed and are ignored
+	assert.NoError(t, s.Emit(nil, time.Now(), "ts.message", nil, schema.Struct{
+		schema.FieldNamePayload: schema.Struct{},
+	}))
+
+	assert.Len(t, server.requests, 2)
+	assert.Equal(t, "/hooks/public/metrics", server.requests[0].path)
+	assert.Equal(t, "ts.public.metrics", server.requests[0].headers.Get("X-Topic"))
+	assert.Equal(t, "application/json", server.requests[0].headers.Get("Content-Type"))
+	assert.Equal(t, "/hooks/public/other", server.requests[1].path)
+	assert.Equal(t, "ts.public.other", server.requests[1].headers.Get("X-Topic"))
+}
+
+func Test_Http_Sink_Batch_Ndjson_Gzip(
+	t *testing.T,
+) {
+
+	server := newRecordingServer()
+	defer server.Close()
+
+	s := newTestSink(t, server.URL+"/{table}", func(c *spiconfig.Config) {
+		c.Sink.Http.Batch.Format = spiconfig.HttpBatchNdjson
+		c.Sink.Http.Gzip = lo.ToPtr(true)
+	})
+
+	batchSink, ok := s.(sink.BatchSink)
+	assert.True(t, ok)
+
+	events := []sink.Event{
+		newEvent("public", "metrics", 1),
+		newEvent("public", "other", 2),
+		newEvent("public", "metrics", 3),
+	}
+	assert.NoError(t, batchSink.EmitBatch(nil, events))
+
+	assert.Len(t, server.requests, 2)
+	assert.Equal(t, "/metrics", server.requests[0].path)
+	assert.Equal(t, "gzip", server.requests[0].headers.Get("Content-Encoding"))
+	assert.Equal(t, "application/x-ndjson", server.requests[0].headers.Get("Content-Type"))
+	assert.Equal(t,
+		string(events[0].EnvelopeData)+"\n"+string(events[2].EnvelopeData)+"\n",
+		server.requests[0].body,
+	)
+	assert.Equal(t, "/other", server.requests[1].path)
+	assert.Equal(t, string(events[1].EnvelopeData)+"\n", server.requests[1].body)
+}
+
+func Test_Http_Sink_Batch_Array(
+	t *testing.T,
+) {
+
+	server := newRecordingServer()
+	defer server.Close()
+
+	s := newTestSink(t, server.URL, func(c *spiconfig.Config) {
+		c.Sink.Http.Batch.Format = spiconfig.HttpBatchArray
+	})
+
+	events := []sink.Event{
+		newEvent("public", "metrics", 1),
+		newEvent("public", "metrics", 2),
+	}
+	assert.NoError(t, s.(sink.BatchSink).EmitBatch(nil, events))
+
+	assert.Len(t, server.requests, 1)
+	var decoded []map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(server.requests[0].body), &decoded))
+	assert.Len(t, decoded, 2)
+	assert.True(t, strings.HasPrefix(server.requests[0].body, "["))
+}
+
+func Test_Http_Sink_Parse_Retry_After(
+	t *testing.T,
+) {
+
+	now := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Duration(0), parseRetryAfter("", now))
+	assert.Equal(t, 5*time.Second, parseRetryAfter("5", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("-1", now))
+	assert.Equal(t, 30*time.Second, parseRetryAfter("Sun, 01 Oct 2023 12:00:30 GMT", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("Sun, 01 Oct 2023 11:00:00 GMT", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("garbage", now))
+}
@@ -18,13 +18,16 @@
 package kafka
 
 import (
-	"crypto/tls"
 	"github.com/IBM/sarama"
 	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/internal/tlsconfig"
 	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
 	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
 	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
 	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+	"strconv"
+	"sync"
 	"time"
 )
 
@@ -33,8 +36,14 @@ func init() {
 }
 
 type kafkaSink struct {
-	producer sarama.SyncProducer
-	encoder  *encoding.JsonEncoder
+	producer        sarama.SyncProducer
+	admin           sarama.ClusterAdmin
+	provisioner     *topicProvisioner
+	encoder         *encoding.JsonEncoder
+	partitionerType config.KafkaPartitionerType
+	partitionColumn string
+	dimensions      map[string][]string
+	dimensionsMutex sync.RWMutex
 }
 
 func newKafkaSink(
@@ -50,6 +59,12 @@ func newKafkaSink(
 	kafkaConfig.Producer.RequiredAcks = sarama.WaitForLocal
 	kafkaConfig.Producer.Retry.Max = 10
 
+	partitionerConstructor, err := newPartitionerConstructor(c)
+	if err != nil {
+		return nil, err
+	}
+	kafkaConfig.Producer.Partitioner = partitionerConstructor
+
 	if config.GetOrDefault(c, config.PropertyKafkaSaslEnabled, false) {
 		kafkaConfig.Net.SASL.Enable = true
 		kafkaConfig.Net.SASL.User = config.GetOrDefault(
@@ -64,28 +79,58 @@ func newKafkaSink(
 	}
 
 	if config.GetOrDefault(c, config.PropertyKafkaTlsEnabled, false) {
+		tlsConfig, err := tlsconfig.NewTLSConfig(c, config.PropertyKafkaTls)
+		if err != nil {
+			return nil, err
+		}
 		kafkaConfig.Net.TLS.Enable = true
-		kafkaConfig.Net.TLS.Config = &tls.Config{
-			InsecureSkipVerify: config.GetOrDefault(
-				c, config.PropertyKafkaTlsSkipVerify, false,
-			),
-			ClientAuth: config.GetOrDefault(
-				c, config.PropertyKafkaTlsClientAuth, tls.NoClientCert,
-			),
+		kafkaConfig.Net.TLS.Config = tlsConfig
+	}
+
+	var provisioner *topicProvisioner
+	if config.GetOrDefault(c, config.PropertyKafkaProvisioningEnabled, false) {
+		if provisioner, err = newTopicProvisioner(c); err != nil {
+			return nil, err
 		}
 	}
 
-	producer, err := sarama.NewSyncProducer(
-		config.GetOrDefault(c, config.PropertyKafkaBrokers, []string{"localhost:9092"}), kafkaConfig,
-	)
+	transactionalId := config.GetOrDefault(c, config.PropertyKafkaTransactionalId, "")
+	if transactionalId != "" {
+		configureTransactionalProducer(kafkaConfig, transactionalId)
+	}
+
+	brokers := config.GetOrDefault(c, config.PropertyKafkaBrokers, []string{"localhost:9092"})
+	producer, err := sarama.NewSyncProducer(brokers, kafkaConfig)
 	if err != nil {
 		return nil, err
 	}
 
-	return &kafkaSink{
-		producer: producer,
-		encoder:  encoding.NewJsonEncoderWithConfig(c),
-	}, nil
+	// The admin client is only necessary to provision
+	// topics and to read the committed transaction LSN
+	var admin sarama.ClusterAdmin
+	if provisioner != nil || transactionalId != "" {
+		if admin, err = sarama.NewClusterAdmin(brokers, kafkaConfig); err != nil {
+			_ = producer.Close()
+			return nil, err
+		}
+	}
+
+	k := &kafkaSink{
+		producer:    producer,
+		admin:       admin,
+		provisioner: provisioner,
+		encoder:     encoding.NewJsonEncoderWithConfig(c),
+		partitionerType: config.GetOrDefault(
+			c, config.PropertyKafkaPartitionerType, config.KafkaHashPartitioner,
+		),
+		partitionColumn: config.GetOrDefault(c, config.PropertyKafkaPartitionerColumn, ""),
+		dimensions:      make(map[string][]string),
+	}
+
+	if transactionalId != "" {
+		return newTransactionalKafkaSink(c, k, transactionalId)
+	}
+	return k, nil
 }
 
 func (k *kafkaSink) Start() error {
@@ -93,29 +138,188 @@ func (k *kafkaSink) Start() error {
 }
 
 func (k *kafkaSink) Stop() error {
-	return k.producer.Close()
+	err := k.producer.Close()
+	if k.admin != nil {
+		if closeErr := k.admin.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+func (k *kafkaSink) EagerTableRegistration() bool {
+	return k.provisioner != nil && k.provisioner.eager
+}
+
+func (k *kafkaSink) RegisterTable(
+	_ sink.Context, topicName string, table schema.TableAlike,
+) error {
+
+	if k.provisioner != nil {
+		if err := k.provisioner.provision(k.admin, topicName, table); err != nil {
+			return err
+		}
+	}
+
+	if k.partitionerType != config.KafkaDimensionPartitioner {
+		return nil
+	}
+
+	dimensions := make([]string, 0)
+	for _, column := range table.TableColumns() {
+		c, ok := column.(systemcatalog.Column)
+		if ok && c.IsDimension() && c.DimensionType() != nil && *c.DimensionType() == "space" {
+			dimensions = append(dimensions, c.Name())
+		}
+	}
+
+	k.dimensionsMutex.Lock()
+	defer k.dimensionsMutex.Unlock()
+	k.dimensions[topicName] = dimensions
+	return nil
 }
 
 func (k *kafkaSink) Emit(
 	_ sink.Context, timestamp time.Time, topicName string, key, envelope schema.Struct,
 ) error {
 
-	keyData, err := k.encoder.Marshal(key)
+	msg, err := k.newMessage(timestamp, topicName, key, envelope)
 	if err != nil {
 		return err
 	}
+
+	_, _, err = k.producer.SendMessage(msg)
+	return err
+}
+
+func (k *kafkaSink) EmitBatch(
+	_ sink.Context, events []sink.Event,
+) error {
+
+	return k.producer.SendMessages(k.newBatchMessages(events))
+}
+
+func (k *kafkaSink) newMessage(
+	timestamp time.Time, topicName string, key, envelope schema.Struct,
+) (*sarama.ProducerMessage, error) {
+
+	keyData, err := k.encoder.Marshal(key)
+	if err != nil {
+		return nil, err
+	}
 	envelopeData, err := k.encoder.Marshal(envelope)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	msg := &sarama.ProducerMessage{
+	return &sarama.ProducerMessage{
 		Topic:     topicName,
 		Key:       sarama.ByteEncoder(keyData),
 		Value:     sarama.ByteEncoder(envelopeData),
+		Headers:   newHeaders(envelope),
+		Metadata:  &messageMetadata{partitionKey: k.partitionKey(topicName, key, envelope)},
 		Timestamp: timestamp,
+	}, nil
+}
+
+func (k *kafkaSink) newBatchMessages(
+	events []sink.Event,
+) []*sarama.ProducerMessage {
+
+	messages := make([]*sarama.ProducerMessage, 0, len(events))
+	for _, event := range events {
+		messages = append(messages, &sarama.ProducerMessage{
+			Topic:     event.TopicName,
+			Key:       sarama.ByteEncoder(event.KeyData),
+			Value:     sarama.ByteEncoder(event.EnvelopeData),
+			Headers:   newHeaders(event.Envelope),
+			Metadata:  &messageMetadata{partitionKey: k.partitionKey(event.TopicName, event.Key, event.Envelope)},
+			Timestamp: event.Timestamp,
+		})
 	}
+	return messages
+}
 
-	_, _, err = k.producer.SendMessage(msg)
-	return err
+// partitionKey encodes the values of the partition columns, it returns
+// nil if the partitioner isn't column based or a value is missing
+func (k *kafkaSink) partitionKey(
+	topicName string, key, envelope schema.Struct,
+) []byte {
+
+	var columns []string
+	switch k.partitionerType {
+	case config.KafkaColumnPartitioner:
+		columns = []string{k.partitionColumn}
+	case config.KafkaDimensionPartitioner:
+		k.dimensionsMutex.RLock()
+		columns = k.dimensions[topicName]
+		k.dimensionsMutex.RUnlock()
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+
+	keyPayload, _ := key[schema.FieldNamePayload].(schema.Struct)
+	payload, _ := envelope[schema.FieldNamePayload].(schema.Struct)
+	after, _ := payload[schema.FieldNameAfter].(schema.Struct)
+	before, _ := payload[schema.FieldNameBefore].(schema.Struct)
+
+	values := make([]any, 0, len(columns))
+	for _, column := range columns {
+		value, present := keyPayload[column]
+		if !present {
+			value, present = after[column]
+		}
+		if !present {
+			value, present = before[column]
+		}
+		if !present {
+			return nil
+		}
+		values = append(values, value)
+	}
+
+	partitionKey, err := k.encoder.Marshal(values)
+	if err != nil {
+		return nil
+	}
+	return partitionKey
+}
+
+// newHeaders provides the operation, origin table, LSN and transaction
+// id of the event as record headers, so consumers can route events
+// without parsing the payload. Headers without a value are omitted.
+func newHeaders(
+	envelope schema.Struct,
+) []sarama.RecordHeader {
+
+	payload, _ := envelope[schema.FieldNamePayload].(schema.Struct)
+	source, _ := payload[schema.FieldNameSource].(schema.Struct)
+	operation, _ := payload[schema.FieldNameOperation].(string)
+	schemaName, _ := source[schema.FieldNameSchema].(string)
+	tableName, _ := source[schema.FieldNameTable].(string)
+	lsn, _ := source[schema.FieldNameLSN].(string)
+
+	var txId string
+	if id, ok := source[schema.FieldNameTxId].(*uint32); ok && id != nil {
+		txId = strconv.FormatUint(uint64(*id), 10)
+	}
+
+	headers := make([]sarama.RecordHeader, 0, 5)
+	for _, header := range [][2]string{
+		{"op", operation},
+		{"schema", schemaName},
+		{"table", tableName},
+		{"lsn", lsn},
+		{"txId", txId},
+	} {
+		if header[1] == "" {
+			continue
+		}
+		headers = append(headers, sarama.RecordHeader{
+			Key:   []byte(header[0]),
+			Value: []byte(header[1]),
+		})
+	}
+	return headers
 }
@@ -0,0 +1,303 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package kafka
+
+import (
+	"github.com/IBM/sarama"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_Kafka_Headers(
+	t *testing.T,
+) {
+
+	headers := newHeaders(testEnvelope(lo.ToPtr(uint32(4711))))
+
+	assert.Equal(t, []sarama.RecordHeader{
+		{Key: []byte("op"), Value: []byte("c")},
+		{Key: []byte("schema"), Value: []byte("public")},
+		{Key: []byte("table"), Value: []byte("metrics")},
+		{Key: []byte("lsn"), Value: []byte("0/16B3748")},
+		{Key: []byte("txId"), Value: []byte("4711")},
+	}, headers)
+}
+
+func Test_Kafka_Headers_Without_Transaction(
+	t *testing.T,
+) {
+
+	headers := newHeaders(testEnvelope(nil))
+
+	assert.Len(t, headers, 4)
+	for _, header := range headers {
+		assert.NotEqual(t, "txId", string(header.Key))
+	}
+}
+
+func Test_Kafka_Partition_Key_By_Column(
+	t *testing.T,
+) {
+
+	k := &kafkaSink{
+		encoder:         encoding.NewJsonEncoder(false),
+		partitionerType: spiconfig.KafkaColumnPartitioner,
+		partitionColumn: "device",
+	}
+
+	partitionKey := k.partitionKey("timescaledb.public.metrics", testKey(), testEnvelope(nil))
+	assert.Equal(t, `["dev1"]`, string(partitionKey))
+
+	k.partitionColumn = "unknown"
+	assert.Nil(t, k.partitionKey("timescaledb.public.metrics", testKey(), testEnvelope(nil)))
+}
+
+func Test_Kafka_Partition_Key_By_Dimensions(
+	t *testing.T,
+) {
+
+	k := &kafkaSink{
+		encoder:         encoding.NewJsonEncoder(false),
+		partitionerType: spiconfig.KafkaDimensionPartitioner,
+		dimensions: map[string][]string{
+			"timescaledb.public.metrics": {"device", "location"},
+		},
+	}
+
+	partitionKey := k.partitionKey("timescaledb.public.metrics", testKey(), testEnvelope(nil))
+	assert.Equal(t, `["dev1","berlin"]`, string(partitionKey))
+	assert.Nil(t, k.partitionKey("timescaledb.public.other", testKey(), testEnvelope(nil)))
+}
+
+func Test_Kafka_Keyed_Partitioner(
+	t *testing.T,
+) {
+
+	partitioner := newKeyedPartitioner("metrics")
+	hash := sarama.NewHashPartitioner("metrics")
+
+	expected, err := hash.Partition(&sarama.ProducerMessage{Key: sarama.StringEncoder(`["dev1"]`)}, 12)
+	assert.NoError(t, err)
+
+	for _, key := range []string{`{"id":1}`, `{"id":2}`, `{"id":3}`} {
+		partition, err := partitioner.Partition(&sarama.ProducerMessage{
+			Key:      sarama.StringEncoder(key),
+			Metadata: &messageMetadata{partitionKey: []byte(`["dev1"]`)},
+		}, 12)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, partition)
+	}
+}
+
+func Test_Kafka_Explicit_Partitioner(
+	t *testing.T,
+) {
+
+	constructor := newExplicitPartitionerConstructor(map[string]int32{"metrics": 3})
+
+	partition, err := constructor("metrics").Partition(&sarama.ProducerMessage{}, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), partition)
+
+	_, err = constructor("metrics").Partition(&sarama.ProducerMessage{}, 2)
+	assert.ErrorContains(t, err, "partition 3 of topic metrics doesn't exist")
+}
+
+func Test_Kafka_Topic_Settings(
+	t *testing.T,
+) {
+
+	provisioner, err := newTopicProvisioner(&spiconfig.Config{
+		Sink: spiconfig.SinkConfig{
+			Kafka: spiconfig.KafkaConfig{
+				Provisioning: spiconfig.KafkaProvisioningConfig{
+					Partitions: lo.ToPtr(6),
+					Settings: map[string]spiconfig.KafkaTopicProvisioningConfig{
+						"audit": {
+							Topics: &spiconfig.IncludedTablesConfig{
+								Includes: []string{"timescaledb.audit.*"},
+							},
+							Retention: lo.ToPtr(604800000),
+							Compact:   lo.ToPtr(false),
+						},
+					},
+				},
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, topicSettings{
+		partitions: 6, retention: 604800000, compact: false,
+	}, provisioner.topicSettings("timescaledb.audit.logins"))
+	assert.Equal(t, topicSettings{
+		partitions: 6, compact: true,
+	}, provisioner.topicSettings("timescaledb.public.metrics"))
+}
+
+func Test_Kafka_Transactional_Begins_Transaction_On_First_Event(
+	t *testing.T,
+) {
+
+	producer := &testTransactionalProducer{}
+	k := newTestTransactionalKafkaSink(producer)
+
+	assert.NoError(t, k.BeginTransaction(nil, 4711, time.Now()))
+	assert.Empty(t, producer.calls)
+
+	assert.NoError(t, k.Emit(nil, time.Now(), "topic", testKey(), testEnvelope(lo.ToPtr(uint32(4711)))))
+	assert.NoError(t, k.Emit(nil, time.Now(), "topic", testKey(), testEnvelope(lo.ToPtr(uint32(4711)))))
+	assert.NoError(t, k.CommitTransaction(nil, 4711, pgtypes.LSN(1000)))
+
+	assert.Equal(t, []string{"begin", "send", "send", "offsets", "commit"}, producer.calls)
+	assert.Equal(t, int64(1000), producer.offsets["offsets"][0].Offset)
+	assert.Equal(t, "txid", producer.groupId)
+}
+
+func Test_Kafka_Transactional_Commit_Without_Events(
+	t *testing.T,
+) {
+
+	producer := &testTransactionalProducer{}
+	k := newTestTransactionalKafkaSink(producer)
+
+	assert.NoError(t, k.BeginTransaction(nil, 4711, time.Now()))
+	assert.NoError(t, k.CommitTransaction(nil, 4711, pgtypes.LSN(1000)))
+
+	assert.Equal(t, []string{"begin", "offsets", "commit"}, producer.calls)
+}
+
+func Test_Kafka_Transactional_Commit_Without_Begin(
+	t *testing.T,
+) {
+
+	producer := &testTransactionalProducer{}
+	k := newTestTransactionalKafkaSink(producer)
+
+	assert.NoError(t, k.CommitTransaction(nil, 4711, pgtypes.LSN(1000)))
+
+	assert.Equal(t, []string{"begin", "offsets", "commit"}, producer.calls)
+}
+
+func Test_Kafka_Transactional_Event_Outside_Of_Transaction(
+	t *testing.T,
+) {
+
+	producer := &testTransactionalProducer{}
+	k := newTestTransactionalKafkaSink(producer)
+
+	assert.NoError(t, k.Emit(nil, time.Now(), "topic", testKey(), testEnvelope(nil)))
+
+	assert.Equal(t, []string{"begin", "send", "commit"}, producer.calls)
+	assert.False(t, k.inTransaction())
+}
+
+func newTestTransactionalKafkaSink(
+	producer sarama.SyncProducer,
+) *transactionalKafkaSink {
+
+	return &transactionalKafkaSink{
+		kafkaSink: &kafkaSink{
+			producer: producer,
+			encoder:  encoding.NewJsonEncoder(false),
+		},
+		transactionalId: "txid",
+		offsetsTopic:    "offsets",
+	}
+}
+
+type testTransactionalProducer struct {
+	sarama.SyncProducer
+	status  sarama.ProducerTxnStatusFlag
+	calls   []string
+	offsets map[string][]*sarama.PartitionOffsetMetadata
+	groupId string
+}
+
+func (p *testTransactionalProducer) TxnStatus() sarama.ProducerTxnStatusFlag {
+	return p.status
+}
+
+func (p *testTransactionalProducer) BeginTxn() error {
+	p.calls = append(p.calls, "begin")
+	p.status = sarama.ProducerTxnFlagInTransaction
+	return nil
+}
+
+func (p *testTransactionalProducer) CommitTxn() error {
+	p.calls = append(p.calls, "commit")
+	p.status = sarama.ProducerTxnFlagReady
+	return nil
+}
+
+func (p *testTransactionalProducer) AbortTxn() error {
+	p.calls = append(p.calls, "abort")
+	p.status = sarama.ProducerTxnFlagReady
+	return nil
+}
+
+func (p *testTransactionalProducer) AddOffsetsToTxn(
+	offsets map[string][]*sarama.PartitionOffsetMetadata, groupId string,
+) error {
+
+	p.calls = append(p.calls, "offsets")
+	p.offsets = offsets
+	p.groupId = groupId
+	return nil
+}
+
+func (p *testTransactionalProducer) SendMessage(
+	_ *sarama.ProducerMessage,
+) (int32, int64, error) {
+
+	p.calls = append(p.calls, "send")
+	return 0, 0, nil
+}
+
+func testKey() schema.Struct {
+	return schema.Struct{
+		schema.FieldNamePayload: schema.Struct{"id": 1},
+	}
+}
+
+func testEnvelope(
+	txId *uint32,
+) schema.Struct {
+
+	return schema.Struct{
+		schema.FieldNamePayload: schema.Struct{
+			schema.FieldNameOperation: "c",
+			schema.FieldNameAfter: schema.Struct{
+				"id":       1,
+				"device":   "dev1",
+				"location": "berlin",
+			},
+			schema.FieldNameSource: schema.Struct{
+				schema.FieldNameSchema: "public",
+				schema.FieldNameTable:  "metrics",
+				schema.FieldNameLSN:    "0/16B3748",
+				schema.FieldNameTxId:   txId,
+			},
+		},
+	}
+}
@@ -0,0 +1,129 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package kafka
+
+import (
+	"github.com/IBM/sarama"
+	"github.com/go-errors/errors"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+)
+
+// messageMetadata is attached to the producer messages, to provide
+// the partitioner with the partition key of the event, if any
+type messageMetadata struct {
+	partitionKey []byte
+}
+
+func newPartitionerConstructor(
+	c *config.Config,
+) (sarama.PartitionerConstructor, error) {
+
+	partitionerType := config.GetOrDefault(c, config.PropertyKafkaPartitionerType, config.KafkaHashPartitioner)
+	switch partitionerType {
+	case config.KafkaHashPartitioner:
+		return sarama.NewHashPartitioner, nil
+	case config.KafkaRoundRobinPartitioner:
+		return sarama.NewRoundRobinPartitioner, nil
+	case config.KafkaColumnPartitioner:
+		if config.GetOrDefault(c, config.PropertyKafkaPartitionerColumn, "") == "" {
+			return nil, errors.Errorf("Kafka partitioner '%s' requires a column", partitionerType)
+		}
+		return newKeyedPartitioner, nil
+	case config.KafkaDimensionPartitioner:
+		return newKeyedPartitioner, nil
+	case config.KafkaExplicitPartitioner:
+		return newExplicitPartitionerConstructor(c.Sink.Kafka.Partitioner.Partitions), nil
+	}
+	return nil, errors.Errorf("Kafka partitioner '%s' doesn't exist", partitionerType)
+}
+
+// keyedPartitioner hashes the partition key of the message instead
+// of the full record key. Messages without a partition key (like
+// messages of tables missing the partition columns) are hashed by
+// their record key.
+type keyedPartitioner struct {
+	hash sarama.Partitioner
+}
+
+func newKeyedPartitioner(
+	topic string,
+) sarama.Partitioner {
+
+	return &keyedPartitioner{
+		hash: sarama.NewHashPartitioner(topic),
+	}
+}
+
+func (k *keyedPartitioner) Partition(
+	message *sarama.ProducerMessage, numPartitions int32,
+) (int32, error) {
+
+	if metadata, ok := message.Metadata.(*messageMetadata); ok && metadata.partitionKey != nil {
+		return k.hash.Partition(&sarama.ProducerMessage{
+			Key: sarama.ByteEncoder(metadata.partitionKey),
+		}, numPartitions)
+	}
+	return k.hash.Partition(message, numPartitions)
+}
+
+func (k *keyedPartitioner) RequiresConsistency() bool {
+	return true
+}
+
+// explicitPartitioner sends all messages of a topic to the configured
+// partition. Topics without a configured partition are hashed by key.
+type explicitPartitioner struct {
+	topic     string
+	partition int32
+	present   bool
+	hash      sarama.Partitioner
+}
+
+func newExplicitPartitionerConstructor(
+	partitions map[string]int32,
+) sarama.PartitionerConstructor {
+
+	return func(topic string) sarama.Partitioner {
+		partition, present := partitions[topic]
+		return &explicitPartitioner{
+			topic:     topic,
+			partition: partition,
+			present:   present,
+			hash:      sarama.NewHashPartitioner(topic),
+		}
+	}
+}
+
+func (e *explicitPartitioner) Partition(
+	message *sarama.ProducerMessage, numPartitions int32,
+) (int32, error) {
+
+	if !e.present {
+		return e.hash.Partition(message, numPartitions)
+	}
+	if e.partition < 0 || e.partition >= numPartitions {
+		return -1, errors.Errorf(
+			"Kafka partition %d of topic %s doesn't exist, the topic has %d partitions",
+			e.partition, e.topic, numPartitions,
+		)
+	}
+	return e.partition, nil
+}
+
+func (e *explicitPartitioner) RequiresConsistency() bool {
+	return true
+}
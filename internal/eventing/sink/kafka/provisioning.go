@@ -0,0 +1,224 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package kafka
+
+import (
+	"fmt"
+	"github.com/IBM/sarama"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/topicfiltering"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+type topicSettings struct {
+	partitions        int
+	replicationFactor int
+	retention         int
+	compact           bool
+}
+
+type namedTopicSettings struct {
+	name        string
+	topicFilter *topicfiltering.TopicFilter
+	config      config.KafkaTopicProvisioningConfig
+}
+
+// topicProvisioner creates the topics of tables before their first event
+// is emitted. The settings of a topic are taken from the first (by name)
+// matching topic settings, falling back to the global ones.
+type topicProvisioner struct {
+	mutex    sync.Mutex
+	logger   *logging.Logger
+	eager    bool
+	defaults topicSettings
+	settings []*namedTopicSettings
+	topics   map[string]bool
+}
+
+func newTopicProvisioner(
+	c *config.Config,
+) (*topicProvisioner, error) {
+
+	logger, err := logging.NewLogger("KafkaTopicProvisioner")
+	if err != nil {
+		return nil, err
+	}
+
+	settingConfigs := c.Sink.Kafka.Provisioning.Settings
+	names := make([]string, 0, len(settingConfigs))
+	for name := range settingConfigs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	settings := make([]*namedTopicSettings, 0, len(names))
+	for _, name := range names {
+		settingConfig := settingConfigs[name]
+
+		var topicFilter *topicfiltering.TopicFilter
+		if settingConfig.Topics != nil {
+			tf, err := topicfiltering.NewTopicFilter(settingConfig.Topics.Excludes, settingConfig.Topics.Includes, false)
+			if err != nil {
+				return nil, errors.Errorf("Failed to parse topic patterns of topic settings '%s': %s", name, err.Error())
+			}
+			topicFilter = tf
+		}
+
+		settings = append(settings, &namedTopicSettings{
+			name:        name,
+			topicFilter: topicFilter,
+			config:      settingConfig,
+		})
+	}
+
+	defaults := topicSettings{
+		partitions:        config.GetOrDefault(c, config.PropertyKafkaProvisioningPartitions, 1),
+		replicationFactor: config.GetOrDefault(c, config.PropertyKafkaProvisioningReplicationFactor, 0),
+		retention:         config.GetOrDefault(c, config.PropertyKafkaProvisioningRetention, 0),
+		compact:           config.GetOrDefault(c, config.PropertyKafkaProvisioningCompact, true),
+	}
+	if defaults.partitions < 1 {
+		return nil, errors.Errorf("Kafka topic partitions must be at least 1, but was %d", defaults.partitions)
+	}
+
+	return &topicProvisioner{
+		logger:   logger,
+		eager:    config.GetOrDefault(c, config.PropertyKafkaProvisioningEager, false),
+		defaults: defaults,
+		settings: settings,
+	}, nil
+}
+
+// provision creates the topic, if it doesn't exist yet. Tables with
+// a primary key get a compacted topic, if compaction is enabled.
+func (p *topicProvisioner) provision(
+	admin sarama.ClusterAdmin, topicName string, table schema.TableAlike,
+) error {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// Existing topics are only listed once, topics created
+	// in the meantime by others fail with an error below
+	if p.topics == nil {
+		topics, err := admin.ListTopics()
+		if err != nil {
+			return errors.Wrap(err, 0)
+		}
+		p.topics = make(map[string]bool, len(topics))
+		for name := range topics {
+			p.topics[name] = true
+		}
+	}
+	if p.topics[topicName] {
+		return nil
+	}
+
+	settings := p.topicSettings(topicName)
+	replicationFactor, err := resolveReplicationFactor(admin, settings.replicationFactor)
+	if err != nil {
+		return err
+	}
+
+	configEntries := make(map[string]*string)
+	if settings.compact && hasPrimaryKey(table) {
+		cleanupPolicy := "compact"
+		configEntries["cleanup.policy"] = &cleanupPolicy
+	}
+	if settings.retention > 0 {
+		retention := strconv.Itoa(settings.retention)
+		configEntries["retention.ms"] = &retention
+	}
+
+	p.logger.Infof(
+		"Creating Kafka topic %s (partitions: %d, replication factor: %d)",
+		topicName, settings.partitions, replicationFactor,
+	)
+	if err := admin.CreateTopic(topicName, &sarama.TopicDetail{
+		NumPartitions:     int32(settings.partitions),
+		ReplicationFactor: replicationFactor,
+		ConfigEntries:     configEntries,
+	}, false); err != nil && !errors.Is(err, sarama.ErrTopicAlreadyExists) {
+		return errors.WrapPrefix(err, fmt.Sprintf("Failed to create Kafka topic %s", topicName), 0)
+	}
+	p.topics[topicName] = true
+	return nil
+}
+
+func (p *topicProvisioner) topicSettings(
+	topicName string,
+) topicSettings {
+
+	settings := p.defaults
+	for _, namedSettings := range p.settings {
+		if namedSettings.topicFilter != nil && !namedSettings.topicFilter.Matches(topicName) {
+			continue
+		}
+
+		if namedSettings.config.Partitions != nil {
+			settings.partitions = *namedSettings.config.Partitions
+		}
+		if namedSettings.config.ReplicationFactor != nil {
+			settings.replicationFactor = *namedSettings.config.ReplicationFactor
+		}
+		if namedSettings.config.Retention != nil {
+			settings.retention = *namedSettings.config.Retention
+		}
+		if namedSettings.config.Compact != nil {
+			settings.compact = *namedSettings.config.Compact
+		}
+		break
+	}
+	return settings
+}
+
+// resolveReplicationFactor returns the configured replication
+// factor, or, if not configured, the number of brokers up to 3
+func resolveReplicationFactor(
+	admin sarama.ClusterAdmin, replicationFactor int,
+) (int16, error) {
+
+	if replicationFactor > 0 {
+		return int16(replicationFactor), nil
+	}
+
+	brokers, _, err := admin.DescribeCluster()
+	if err != nil {
+		return 0, errors.Wrap(err, 0)
+	}
+	if len(brokers) < 3 {
+		return int16(len(brokers)), nil
+	}
+	return 3, nil
+}
+
+func hasPrimaryKey(
+	table schema.TableAlike,
+) bool {
+
+	for _, column := range table.TableColumns() {
+		if column.IsPrimaryKey() {
+			return true
+		}
+	}
+	return false
+}
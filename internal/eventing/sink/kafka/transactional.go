@@ -0,0 +1,267 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package kafka
+
+import (
+	"fmt"
+	"github.com/IBM/sarama"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"time"
+)
+
+// defaultOffsetsTopic is shared by all streamers, since the
+// committed LSNs are stored per transactional id
+const defaultOffsetsTopic = "timescaledb-event-streamer-offsets"
+
+// transactionalKafkaSink emits the events of a source transaction
+// inside a Kafka transaction. The transaction's end LSN is committed
+// as the offset of a consumer group named after the transactional id,
+// atomically with the events, and is used to resume the replication.
+// The Kafka transaction is started lazily with the first event of
+// the source transaction, or on commit if the source transaction
+// didn't emit any event. Events outside of source transactions (like
+// snapshot reads) are emitted in Kafka transactions of their own.
+type transactionalKafkaSink struct {
+	*kafkaSink
+	logger            *logging.Logger
+	transactionalId   string
+	offsetsTopic      string
+	sourceTransaction bool
+}
+
+func newTransactionalKafkaSink(
+	c *config.Config, kafkaSink *kafkaSink, transactionalId string,
+) (sink.Sink, error) {
+
+	logger, err := logging.NewLogger("KafkaSink")
+	if err != nil {
+		_ = kafkaSink.Stop()
+		return nil, err
+	}
+
+	return &transactionalKafkaSink{
+		kafkaSink:       kafkaSink,
+		logger:          logger,
+		transactionalId: transactionalId,
+		offsetsTopic: config.GetOrDefault(
+			c, config.PropertyKafkaTransactionalOffsetsTopic, defaultOffsetsTopic,
+		),
+	}, nil
+}
+
+// configureTransactionalProducer enables transactions,
+// which require an idempotent producer
+func configureTransactionalProducer(
+	kafkaConfig *sarama.Config, transactionalId string,
+) {
+
+	kafkaConfig.Producer.Idempotent = true
+	kafkaConfig.Producer.RequiredAcks = sarama.WaitForAll
+	kafkaConfig.Producer.Transaction.ID = transactionalId
+	kafkaConfig.Net.MaxOpenRequests = 1
+}
+
+func (t *transactionalKafkaSink) Start() error {
+	return t.ensureOffsetsTopic()
+}
+
+func (t *transactionalKafkaSink) Stop() error {
+	// Events of an unfinished transaction are emitted
+	// again, when the replication resumes
+	if t.inTransaction() {
+		if err := t.producer.AbortTxn(); err != nil {
+			t.logger.Warnf("Failed to abort unfinished Kafka transaction: %+v", err)
+		}
+	}
+	return t.kafkaSink.Stop()
+}
+
+func (t *transactionalKafkaSink) Emit(
+	_ sink.Context, timestamp time.Time, topicName string, key, envelope schema.Struct,
+) error {
+
+	msg, err := t.newMessage(timestamp, topicName, key, envelope)
+	if err != nil {
+		return err
+	}
+
+	return t.transactional(func() error {
+		_, _, err := t.producer.SendMessage(msg)
+		return err
+	})
+}
+
+func (t *transactionalKafkaSink) EmitBatch(
+	_ sink.Context, events []sink.Event,
+) error {
+
+	return t.transactional(func() error {
+		return t.producer.SendMessages(t.newBatchMessages(events))
+	})
+}
+
+func (t *transactionalKafkaSink) BeginTransaction(
+	_ sink.Context, _ uint32, _ time.Time,
+) error {
+
+	t.sourceTransaction = true
+	return nil
+}
+
+func (t *transactionalKafkaSink) CommitTransaction(
+	_ sink.Context, xid uint32, transactionEndLSN pgtypes.LSN,
+) error {
+
+	t.sourceTransaction = false
+
+	// The LSN is committed, even if the source transaction didn't emit any events
+	if !t.inTransaction() {
+		if err := t.producer.BeginTxn(); err != nil {
+			return errors.WrapPrefix(
+				err, fmt.Sprintf("Failed to begin Kafka transaction of xid=%d", xid), 0,
+			)
+		}
+	}
+
+	metadata := transactionEndLSN.String()
+	if err := t.producer.AddOffsetsToTxn(map[string][]*sarama.PartitionOffsetMetadata{
+		t.offsetsTopic: {{
+			Partition: 0,
+			Offset:    int64(transactionEndLSN),
+			Metadata:  &metadata,
+		}},
+	}, t.transactionalId); err != nil {
+		return t.abort(errors.WrapPrefix(
+			err, fmt.Sprintf("Failed to store LSN of transaction xid=%d", xid), 0,
+		))
+	}
+
+	if err := t.producer.CommitTxn(); err != nil {
+		return t.abort(errors.WrapPrefix(
+			err, fmt.Sprintf("Failed to commit Kafka transaction of xid=%d", xid), 0,
+		))
+	}
+	return nil
+}
+
+func (t *transactionalKafkaSink) CommittedLSN(
+	_ sink.Context,
+) (pgtypes.LSN, bool, error) {
+
+	response, err := t.admin.ListConsumerGroupOffsets(
+		t.transactionalId, map[string][]int32{t.offsetsTopic: {0}},
+	)
+	if err != nil {
+		return 0, false, errors.Wrap(err, 0)
+	}
+	if response.Err != sarama.ErrNoError {
+		return 0, false, errors.Wrap(response.Err, 0)
+	}
+
+	block := response.GetBlock(t.offsetsTopic, 0)
+	if block == nil {
+		return 0, false, nil
+	}
+	if block.Err != sarama.ErrNoError {
+		return 0, false, errors.Wrap(block.Err, 0)
+	}
+	// No offset was committed by the transactional id yet
+	if block.Offset < 0 {
+		return 0, false, nil
+	}
+	return pgtypes.LSN(block.Offset), true, nil
+}
+
+// transactional runs fn in the Kafka transaction of the current source
+// transaction, which is started on first use, or in a transaction of its
+// own, if no source transaction is in progress
+func (t *transactionalKafkaSink) transactional(
+	fn func() error,
+) error {
+
+	if t.inTransaction() {
+		return fn()
+	}
+
+	if t.sourceTransaction {
+		if err := t.producer.BeginTxn(); err != nil {
+			return err
+		}
+		return fn()
+	}
+
+	if err := t.producer.BeginTxn(); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		return t.abort(err)
+	}
+	if err := t.producer.CommitTxn(); err != nil {
+		return t.abort(err)
+	}
+	return nil
+}
+
+func (t *transactionalKafkaSink) inTransaction() bool {
+	return t.producer.TxnStatus()&sarama.ProducerTxnFlagInTransaction != 0
+}
+
+func (t *transactionalKafkaSink) abort(
+	cause error,
+) error {
+
+	if err := t.producer.AbortTxn(); err != nil {
+		t.logger.Warnf("Failed to abort Kafka transaction: %+v", err)
+	}
+	return cause
+}
+
+// ensureOffsetsTopic creates the offsets topic, if it doesn't exist.
+// The offsets are committed against its only partition, which has
+// to exist, even though no events are ever written to it.
+func (t *transactionalKafkaSink) ensureOffsetsTopic() error {
+	topics, err := t.admin.ListTopics()
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	if _, present := topics[t.offsetsTopic]; present {
+		return nil
+	}
+
+	replicationFactor, err := resolveReplicationFactor(t.admin, 0)
+	if err != nil {
+		return err
+	}
+
+	cleanupPolicy := "compact"
+	t.logger.Infof("Creating Kafka offsets topic %s", t.offsetsTopic)
+	if err := t.admin.CreateTopic(t.offsetsTopic, &sarama.TopicDetail{
+		NumPartitions:     1,
+		ReplicationFactor: replicationFactor,
+		ConfigEntries: map[string]*string{
+			"cleanup.policy": &cleanupPolicy,
+		},
+	}, false); err != nil && !errors.Is(err, sarama.ErrTopicAlreadyExists) {
+		return errors.Wrap(err, 0)
+	}
+	return nil
+}
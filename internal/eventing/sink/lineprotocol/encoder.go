@@ -0,0 +1,349 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lineprotocol
+
+import (
+	"github.com/go-errors/errors"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	measurementEscaper = strings.NewReplacer(",", "\\,", " ", "\\ ", "\n", "\\n")
+	keyEscaper         = strings.NewReplacer(",", "\\,", "=", "\\=", " ", "\\ ", "\n", "\\n")
+	stringEscaper      = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+)
+
+type timeKind int
+
+const (
+	timeKindNone timeKind = iota
+	// timeKindText are timestamptz values, encoded as RFC3339
+	timeKindText
+	// timeKindMillis are timestamp values, encoded as epoch milliseconds
+	timeKindMillis
+	// timeKindDays are date values, encoded as epoch days
+	timeKindDays
+	// timeKindInteger are integer based time dimensions, the
+	// values are expected to be in the configured precision
+	timeKindInteger
+)
+
+// measurement describes how the rows of a table
+// are mapped to the points of a measurement
+type measurement struct {
+	name       string
+	timeColumn string
+	timeKind   timeKind
+	tags       []string
+	fields     []string
+}
+
+// newMeasurement derives the measurement of a table. The time dimension of a
+// hypertable becomes the timestamp of the points. Text columns become tags, and
+// numeric and boolean columns become fields, unless overridden by the table config.
+func newMeasurement(
+	table schema.TableAlike, tableConfig config.LineProtocolTableConfig,
+) *measurement {
+
+	m := &measurement{
+		name:     table.TableName(),
+		timeKind: timeKindNone,
+	}
+	if tableConfig.Measurement != "" {
+		m.name = tableConfig.Measurement
+	}
+
+	for _, column := range table.TableColumns() {
+		c, ok := column.(systemcatalog.Column)
+		if !ok {
+			continue
+		}
+		if c.IsDimension() && c.DimensionType() != nil && *c.DimensionType() == "time" {
+			m.timeColumn = c.Name()
+			m.timeKind = timeKindOf(c)
+		}
+	}
+
+	tags := make([]string, 0)
+	fields := make([]string, 0)
+	for _, column := range table.TableColumns() {
+		c, ok := column.(systemcatalog.Column)
+		if !ok || c.Name() == m.timeColumn || c.PgType() == nil || c.PgType().IsArray() {
+			continue
+		}
+		switch c.PgType().Category() {
+		case pgtypes.String, pgtypes.Enum:
+			{
+				tags = append(tags, c.Name())
+			}
+		case pgtypes.Numeric, pgtypes.Boolean:
+			{
+				fields = append(fields, c.Name())
+			}
+		}
+	}
+
+	// Explicitly configured tags and fields replace the derived ones,
+	// columns can't be a derived tag and an explicit field or vice versa
+	if tableConfig.Tags != nil {
+		tags = append(make([]string, 0, len(tableConfig.Tags)), tableConfig.Tags...)
+		if tableConfig.Fields == nil {
+			fields = exclude(fields, tags)
+		}
+	}
+	if tableConfig.Fields != nil {
+		fields = tableConfig.Fields
+		if tableConfig.Tags == nil {
+			tags = exclude(tags, fields)
+		}
+	}
+
+	// Tags are sorted by key, which is recommended for the write performance
+	sort.Strings(tags)
+	m.tags = tags
+	m.fields = fields
+	return m
+}
+
+// encode appends the line of a row to the buffer. Rows without
+// any field can't be represented and false is returned.
+func (m *measurement) encode(
+	builder *strings.Builder, row schema.Struct, precision time.Duration,
+) (bool, error) {
+
+	var timestamp *int64
+	if m.timeKind != timeKindNone {
+		t, err := m.timestamp(row[m.timeColumn], precision)
+		if err != nil {
+			return false, err
+		}
+		timestamp = t
+	}
+
+	fields := make([]string, 0, len(m.fields))
+	for _, field := range m.fields {
+		if value, ok := fieldValue(row[field]); ok {
+			fields = append(fields, keyEscaper.Replace(field)+"="+value)
+		}
+	}
+	if len(fields) == 0 {
+		return false, nil
+	}
+
+	builder.WriteString(measurementEscaper.Replace(m.name))
+	for _, tag := range m.tags {
+		value := tagValue(row[tag])
+		// Empty tag values aren't supported by the line protocol
+		if value == "" {
+			continue
+		}
+		builder.WriteByte(',')
+		builder.WriteString(keyEscaper.Replace(tag))
+		builder.WriteByte('=')
+		builder.WriteString(keyEscaper.Replace(value))
+	}
+	builder.WriteByte(' ')
+	builder.WriteString(strings.Join(fields, ","))
+	if timestamp != nil {
+		builder.WriteByte(' ')
+		builder.WriteString(strconv.FormatInt(*timestamp, 10))
+	}
+	builder.WriteByte('\n')
+	return true, nil
+}
+
+func (m *measurement) timestamp(
+	value any, precision time.Duration,
+) (*int64, error) {
+
+	if value == nil {
+		return nil, nil
+	}
+
+	var t time.Time
+	switch m.timeKind {
+	case timeKindText:
+		{
+			text, ok := value.(string)
+			if !ok {
+				return nil, errors.Errorf("Illegal value for time column %s: %v", m.timeColumn, value)
+			}
+			parsed, err := time.Parse(time.RFC3339Nano, text)
+			if err != nil {
+				return nil, errors.Wrap(err, 0)
+			}
+			t = parsed
+		}
+	case timeKindMillis:
+		{
+			millis, ok := integerValue(value)
+			if !ok {
+				return nil, errors.Errorf("Illegal value for time column %s: %v", m.timeColumn, value)
+			}
+			t = time.UnixMilli(millis)
+		}
+	case timeKindDays:
+		{
+			days, ok := integerValue(value)
+			if !ok {
+				return nil, errors.Errorf("Illegal value for time column %s: %v", m.timeColumn, value)
+			}
+			t = time.Unix(days*int64(24*time.Hour/time.Second), 0)
+		}
+	case timeKindInteger:
+		{
+			integer, ok := integerValue(value)
+			if !ok {
+				return nil, errors.Errorf("Illegal value for time column %s: %v", m.timeColumn, value)
+			}
+			return &integer, nil
+		}
+	}
+
+	timestamp := t.UnixNano() / int64(precision)
+	return &timestamp, nil
+}
+
+func timeKindOf(
+	column systemcatalog.Column,
+) timeKind {
+
+	if column.PgType() == nil {
+		return timeKindNone
+	}
+	switch column.PgType().Name() {
+	case "timestamptz":
+		return timeKindText
+	case "timestamp":
+		return timeKindMillis
+	case "date":
+		return timeKindDays
+	}
+	switch column.SchemaType() {
+	case schema.INT16, schema.INT32, schema.INT64:
+		return timeKindInteger
+	}
+	return timeKindNone
+}
+
+func fieldValue(
+	value any,
+) (string, bool) {
+
+	switch v := value.(type) {
+	case bool:
+		return strconv.FormatBool(v), true
+	case float32:
+		return floatValue(float64(v))
+	case float64:
+		return floatValue(v)
+	case string:
+		return "\"" + stringEscaper.Replace(v) + "\"", true
+	}
+	if integer, ok := integerValue(value); ok {
+		return strconv.FormatInt(integer, 10) + "i", true
+	}
+	return "", false
+}
+
+func floatValue(
+	value float64,
+) (string, bool) {
+
+	// NaN and infinity aren't supported by the line protocol
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return "", false
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64), true
+}
+
+func tagValue(
+	value any,
+) string {
+
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	if integer, ok := integerValue(value); ok {
+		return strconv.FormatInt(integer, 10)
+	}
+	return ""
+}
+
+func integerValue(
+	value any,
+) (int64, bool) {
+
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		if v <= math.MaxInt64 {
+			return int64(v), true
+		}
+	}
+	return 0, false
+}
+
+func exclude(
+	columns, excluded []string,
+) []string {
+
+	excludes := make(map[string]bool, len(excluded))
+	for _, column := range excluded {
+		excludes[column] = true
+	}
+	result := make([]string, 0, len(columns))
+	for _, column := range columns {
+		if !excludes[column] {
+			result = append(result, column)
+		}
+	}
+	return result
+}
@@ -0,0 +1,161 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lineprotocol
+
+import (
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testPgType struct {
+	pgtypes.PgType
+	name       string
+	category   pgtypes.PgCategory
+	schemaType schema.Type
+}
+
+func (t testPgType) Name() string {
+	return t.name
+}
+
+func (t testPgType) Category() pgtypes.PgCategory {
+	return t.category
+}
+
+func (t testPgType) IsArray() bool {
+	return false
+}
+
+func (t testPgType) SchemaType() schema.Type {
+	return t.schemaType
+}
+
+func Test_Measurement_Derived_From_Hypertable(
+	t *testing.T,
+) {
+
+	m := newMeasurement(testHypertable(), config.LineProtocolTableConfig{})
+
+	assert.Equal(t, "metrics", m.name)
+	assert.Equal(t, "ts", m.timeColumn)
+	assert.Equal(t, timeKindText, m.timeKind)
+	assert.Equal(t, []string{"device", "location"}, m.tags)
+	assert.Equal(t, []string{"value", "count", "active"}, m.fields)
+}
+
+func Test_Measurement_Overrides(
+	t *testing.T,
+) {
+
+	m := newMeasurement(testHypertable(), config.LineProtocolTableConfig{
+		Measurement: "sensors",
+		Fields:      []string{"value", "location"},
+	})
+
+	assert.Equal(t, "sensors", m.name)
+	assert.Equal(t, []string{"device"}, m.tags)
+	assert.Equal(t, []string{"value", "location"}, m.fields)
+}
+
+func Test_Encode_Line(
+	t *testing.T,
+) {
+
+	m := newMeasurement(testHypertable(), config.LineProtocolTableConfig{})
+
+	builder := &strings.Builder{}
+	encoded, err := m.encode(builder, schema.Struct{
+		"ts":       "2023-03-25T07:12:00.5Z",
+		"device":   "dev 1,a=b",
+		"location": nil,
+		"value":    1.5,
+		"count":    int32(42),
+		"active":   true,
+	}, time.Millisecond)
+
+	assert.NoError(t, err)
+	assert.True(t, encoded)
+	assert.Equal(t,
+		"metrics,device=dev\\ 1\\,a\\=b value=1.5,count=42i,active=true 1679728320500\n", builder.String(),
+	)
+}
+
+func Test_Encode_String_Field(
+	t *testing.T,
+) {
+
+	m := &measurement{name: "my metrics", fields: []string{"message"}}
+
+	builder := &strings.Builder{}
+	encoded, err := m.encode(builder, schema.Struct{"message": "say \"hi\" \\o/"}, time.Nanosecond)
+
+	assert.NoError(t, err)
+	assert.True(t, encoded)
+	assert.Equal(t, "my\\ metrics message=\"say \\\"hi\\\" \\\\o/\"\n", builder.String())
+}
+
+func Test_Encode_Without_Fields(
+	t *testing.T,
+) {
+
+	m := newMeasurement(testHypertable(), config.LineProtocolTableConfig{})
+
+	builder := &strings.Builder{}
+	encoded, err := m.encode(builder, schema.Struct{
+		"ts":     "2023-03-25T07:12:00Z",
+		"device": "dev1",
+	}, time.Nanosecond)
+
+	assert.NoError(t, err)
+	assert.False(t, encoded)
+	assert.Equal(t, "", builder.String())
+}
+
+func testHypertable() *systemcatalog.Hypertable {
+	timeDimension := "time"
+	hypertable := systemcatalog.NewHypertable(
+		1, "public", "metrics", "_timescaledb_internal", "_hyper_1", nil, 0, false, nil, nil, pgtypes.DEFAULT,
+	)
+	hypertable.ApplyTableSchema([]systemcatalog.Column{
+		systemcatalog.NewIndexColumn(
+			"ts", 1184, 0, testPgType{name: "timestamptz", category: pgtypes.DateTime, schemaType: schema.STRING},
+			false, false, nil, nil, false, nil, systemcatalog.ASC, systemcatalog.NULLS_LAST,
+			true, false, &timeDimension, nil, nil,
+		),
+		testColumn("device", testPgType{name: "text", category: pgtypes.String, schemaType: schema.STRING}),
+		testColumn("location", testPgType{name: "varchar", category: pgtypes.String, schemaType: schema.STRING}),
+		testColumn("value", testPgType{name: "float8", category: pgtypes.Numeric, schemaType: schema.FLOAT64}),
+		testColumn("count", testPgType{name: "int4", category: pgtypes.Numeric, schemaType: schema.INT32}),
+		testColumn("active", testPgType{name: "bool", category: pgtypes.Boolean, schemaType: schema.BOOLEAN}),
+		testColumn("payload", testPgType{name: "jsonb", category: pgtypes.UserDefined, schemaType: schema.STRING}),
+	})
+	return hypertable
+}
+
+func testColumn(
+	name string, pgType pgtypes.PgType,
+) systemcatalog.Column {
+
+	return systemcatalog.NewColumn(name, 0, 0, pgType, true, nil)
+}
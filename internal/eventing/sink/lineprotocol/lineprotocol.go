@@ -0,0 +1,363 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lineprotocol
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/cenkalti/backoff/v4"
+	"github.com/go-errors/errors"
+	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/internal/tlsconfig"
+	"github.com/noctarius/timescaledb-event-streamer/internal/waiting"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var precisions = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+}
+
+func init() {
+	sinkimpl.RegisterSink(config.LineProtocol, newLineProtocolSink)
+}
+
+type lineProtocolSink struct {
+	mutex           sync.Mutex
+	logger          *logging.Logger
+	writer          writer
+	address         string
+	precision       time.Duration
+	batchSize       int
+	batchInterval   time.Duration
+	tables          map[string]config.LineProtocolTableConfig
+	measurements    map[string]*measurement
+	lines           strings.Builder
+	numOfLines      int
+	acknowledges    []func() error
+	ticker          *time.Ticker
+	shutdownAwaiter *waiting.ShutdownAwaiter
+	backOff         backoff.BackOff
+}
+
+func newLineProtocolSink(
+	c *config.Config,
+) (sink.Sink, error) {
+
+	logger, err := logging.NewLogger("LineProtocolSink")
+	if err != nil {
+		return nil, err
+	}
+
+	batchSize := config.GetOrDefault(c, config.PropertyLineProtocolBatchSize, 5000)
+	if batchSize < 1 {
+		return nil, errors.Errorf("Line protocol sink batch size must be at least 1, but was %d", batchSize)
+	}
+
+	precisionProperty := config.GetOrDefault(c, config.PropertyLineProtocolPrecision, "ns")
+	precision, present := precisions[precisionProperty]
+	if !present {
+		return nil, errors.Errorf("Line protocol precision '%s' doesn't exist", precisionProperty)
+	}
+
+	address := config.GetOrDefault(c, config.PropertyLineProtocolAddress, "")
+	var w writer
+	switch {
+	case strings.HasPrefix(address, "http://"), strings.HasPrefix(address, "https://"):
+		{
+			w, err = newHttpWriter(c, address)
+			if err != nil {
+				return nil, err
+			}
+		}
+	case strings.HasPrefix(address, "tcp://"):
+		{
+			w = &socketWriter{network: "tcp", address: strings.TrimPrefix(address, "tcp://")}
+		}
+	case strings.HasPrefix(address, "udp://"):
+		{
+			w = &socketWriter{network: "udp", address: strings.TrimPrefix(address, "udp://")}
+		}
+	default:
+		{
+			return nil, errors.Errorf(
+				"Line protocol sink address '%s' must start with http://, https://, tcp:// or udp://", address,
+			)
+		}
+	}
+
+	tables := c.Sink.LineProtocol.Tables
+	if tables == nil {
+		tables = make(map[string]config.LineProtocolTableConfig)
+	}
+
+	return &lineProtocolSink{
+		logger:    logger,
+		writer:    w,
+		address:   address,
+		precision: precision,
+		batchSize: batchSize,
+		batchInterval: time.Duration(
+			config.GetOrDefault(c, config.PropertyLineProtocolBatchInterval, 1000),
+		) * time.Millisecond,
+		tables:          tables,
+		measurements:    make(map[string]*measurement),
+		shutdownAwaiter: waiting.NewShutdownAwaiter(),
+		backOff:         backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 8),
+	}, nil
+}
+
+func newHttpWriter(
+	c *config.Config, address string,
+) (writer, error) {
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if strings.HasPrefix(address, "https://") {
+		tlsConfig, err := tlsconfig.NewTLSConfig(c, config.PropertyLineProtocolTls)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	headers := make(http.Header)
+	headers.Add("Content-Type", "text/plain; charset=utf-8")
+
+	authenticationType := config.GetOrDefault(c, config.PropertyLineProtocolAuthenticationType, "none")
+	switch config.HttpAuthenticationType(authenticationType) {
+	case config.BasicAuthentication:
+		{
+			username := config.GetOrDefault(c, config.PropertyLineProtocolBasicAuthenticationUsername, "")
+			password := config.GetOrDefault(c, config.PropertyLineProtocolBasicAuthenticationPassword, "")
+			headers.Add("Authorization",
+				fmt.Sprintf("Basic %s",
+					base64.StdEncoding.EncodeToString([]byte(username+":"+password)),
+				),
+			)
+		}
+	case config.HeaderAuthentication:
+		{
+			headers.Add(config.GetOrDefault(c, config.PropertyLineProtocolHeaderAuthenticationHeaderName, ""),
+				config.GetOrDefault(c, config.PropertyLineProtocolHeaderAuthenticationHeaderValue, ""),
+			)
+		}
+	case config.NoneAuthentication:
+		{
+		}
+	default:
+		{
+			return nil, errors.Errorf("Line protocol AuthenticationType '%s' doesn't exist", authenticationType)
+		}
+	}
+
+	return &httpWriter{
+		client:  &http.Client{Transport: transport, Timeout: time.Minute},
+		address: address,
+		headers: headers,
+	}, nil
+}
+
+func (l *lineProtocolSink) Start() error {
+	l.logger.Infof("Starting LineProtocolSink at %s", l.address)
+	if l.ticker == nil && l.batchInterval > 0 {
+		l.ticker = time.NewTicker(l.batchInterval)
+		go l.flushHandler()
+	}
+	return nil
+}
+
+func (l *lineProtocolSink) Stop() error {
+	l.logger.Infof("Stopping LineProtocolSink at %s", l.address)
+	if l.ticker != nil {
+		l.shutdownAwaiter.SignalShutdown()
+		if err := l.shutdownAwaiter.AwaitDone(); err != nil {
+			l.logger.Warnln("Failed to shutdown flush handler in time")
+		}
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	err := l.flush()
+	if closeErr := l.writer.close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (l *lineProtocolSink) RegisterTable(
+	_ sink.Context, topicName string, table schema.TableAlike,
+) error {
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	m := newMeasurement(table, l.tables[fmt.Sprintf("%s.%s", table.SchemaName(), table.TableName())])
+	if m.timeKind == timeKindNone {
+		l.logger.Infof(
+			"Table %s.%s has no time dimension, points are timestamped by the receiver",
+			table.SchemaName(), table.TableName(),
+		)
+	}
+	l.measurements[topicName] = m
+	return nil
+}
+
+func (l *lineProtocolSink) BeginTransaction(
+	_ sink.Context, _ uint32, _ time.Time,
+) error {
+
+	return nil
+}
+
+func (l *lineProtocolSink) CommitTransaction(
+	_ sink.Context, xid uint32, _ pgtypes.LSN,
+) error {
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// Commits aren't retried by the event emitter, and the transaction
+	// is acknowledged as soon as all points of it were written
+	return backoff.RetryNotify(l.flush, l.backOff, func(err error, _ time.Duration) {
+		l.logger.Warnf("Failed to write points of transaction xid=%d, retrying: %+v", xid, err)
+	})
+}
+
+func (l *lineProtocolSink) Emit(
+	_ sink.Context, _ time.Time, topicName string, _, envelope schema.Struct,
+) error {
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	payload, ok := envelope[schema.FieldNamePayload].(schema.Struct)
+	if !ok {
+		return nil
+	}
+
+	// Points can only be written, deletes, truncates, logical
+	// replication messages and TimescaleDB events are ignored
+	operation, _ := payload[schema.FieldNameOperation].(string)
+	switch schema.Operation(operation) {
+	case schema.OP_READ, schema.OP_CREATE, schema.OP_UPDATE:
+	default:
+		return nil
+	}
+
+	m, present := l.measurements[topicName]
+	if !present {
+		l.logger.Debugf("Ignoring event of unknown table on topic %s", topicName)
+		return nil
+	}
+
+	after, ok := payload[schema.FieldNameAfter].(schema.Struct)
+	if !ok {
+		return nil
+	}
+
+	line := strings.Builder{}
+	encoded, err := m.encode(&line, after, l.precision)
+	if err != nil {
+		return err
+	}
+	if !encoded {
+		l.logger.Debugf("Ignoring row without field values on topic %s", topicName)
+		return nil
+	}
+
+	// A full batch is flushed before the new line is added, when
+	// the flush fails the event is retried without duplicating it
+	if l.numOfLines >= l.batchSize {
+		if err := l.flush(); err != nil {
+			return err
+		}
+	}
+	l.lines.WriteString(line.String())
+	l.numOfLines++
+	return nil
+}
+
+// Acknowledge defers the acknowledgement until the buffered lines
+// of previously emitted events were written, since Emit only
+// buffers them
+func (l *lineProtocolSink) Acknowledge(
+	_ sink.Context, acknowledge func() error,
+) error {
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.numOfLines == 0 {
+		return acknowledge()
+	}
+
+	l.acknowledges = append(l.acknowledges, acknowledge)
+	return nil
+}
+
+func (l *lineProtocolSink) flushHandler() {
+	for {
+		select {
+		case <-l.shutdownAwaiter.AwaitShutdownChan():
+			l.ticker.Stop()
+			l.shutdownAwaiter.SignalDone()
+			return
+		case <-l.ticker.C:
+			l.mutex.Lock()
+			if err := l.flush(); err != nil {
+				l.logger.Warnf("Failed to write points, retrying with the next interval: %+v", err)
+			}
+			l.mutex.Unlock()
+		}
+	}
+}
+
+func (l *lineProtocolSink) flush() error {
+	if l.numOfLines == 0 {
+		return nil
+	}
+
+	if err := l.writer.write([]byte(l.lines.String())); err != nil {
+		return err
+	}
+
+	l.logger.Verbosef("Wrote %d points", l.numOfLines)
+	l.lines.Reset()
+	l.numOfLines = 0
+
+	var err error
+	acknowledges := l.acknowledges
+	l.acknowledges = nil
+	for _, acknowledge := range acknowledges {
+		if ackErr := acknowledge(); ackErr != nil && err == nil {
+			err = ackErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,85 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lineprotocol
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type recordingWriter struct {
+	writes   []string
+	failures int
+}
+
+func (r *recordingWriter) write(
+	lines []byte,
+) error {
+
+	if r.failures > 0 {
+		r.failures--
+		return errors.Errorf("failed to write")
+	}
+	r.writes = append(r.writes, string(lines))
+	return nil
+}
+
+func (r *recordingWriter) close() error {
+	return nil
+}
+
+func Test_Line_Protocol_Acknowledge_After_Write(
+	t *testing.T,
+) {
+
+	logger, err := logging.NewLogger("LineProtocolSinkTest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writer := &recordingWriter{failures: 1}
+	s := &lineProtocolSink{
+		logger: logger,
+		writer: writer,
+	}
+
+	acknowledged := 0
+	acknowledge := func() error {
+		acknowledged++
+		return nil
+	}
+
+	// Without buffered lines, acknowledgements happen immediately
+	assert.NoError(t, s.Acknowledge(nil, acknowledge))
+	assert.Equal(t, 1, acknowledged)
+
+	s.lines.WriteString("metrics value=1\n")
+	s.numOfLines++
+	assert.NoError(t, s.Acknowledge(nil, acknowledge))
+	assert.Equal(t, 1, acknowledged)
+
+	// A failed write keeps the acknowledgement for the next flush
+	assert.Error(t, s.flush())
+	assert.Equal(t, 1, acknowledged)
+
+	assert.NoError(t, s.flush())
+	assert.Equal(t, []string{"metrics value=1\n"}, writer.writes)
+	assert.Equal(t, 2, acknowledged)
+}
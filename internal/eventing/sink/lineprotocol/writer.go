@@ -0,0 +1,147 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lineprotocol
+
+import (
+	"bytes"
+	"github.com/go-errors/errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxDatagramSize keeps UDP datagrams below the common MTU
+const maxDatagramSize = 1400
+
+// writer sends a chunk of lines to the target
+type writer interface {
+	write(
+		lines []byte,
+	) error
+	close() error
+}
+
+type httpWriter struct {
+	client  *http.Client
+	address string
+	headers http.Header
+}
+
+func (h *httpWriter) write(
+	lines []byte,
+) error {
+
+	request, err := http.NewRequest("POST", h.address, bytes.NewReader(lines))
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	request.Header = h.headers.Clone()
+
+	response, err := h.client.Do(request)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		return errors.Errorf(
+			"Line protocol sink failed to write points with status %d: %s",
+			response.StatusCode, strings.TrimSpace(string(message)),
+		)
+	}
+	_, _ = io.Copy(io.Discard, response.Body)
+	return nil
+}
+
+func (h *httpWriter) close() error {
+	h.client.CloseIdleConnections()
+	return nil
+}
+
+// socketWriter writes lines to a TCP or UDP socket. The connection
+// is (re-)established lazily, after it failed it's closed and the
+// next write opens a new connection.
+type socketWriter struct {
+	network    string
+	address    string
+	connection net.Conn
+}
+
+func (s *socketWriter) write(
+	lines []byte,
+) error {
+
+	if s.connection == nil {
+		connection, err := net.DialTimeout(s.network, s.address, 30*time.Second)
+		if err != nil {
+			return errors.Wrap(err, 0)
+		}
+		s.connection = connection
+	}
+
+	if err := s.connection.SetWriteDeadline(time.Now().Add(30 * time.Second)); err != nil {
+		return s.fail(err)
+	}
+
+	if s.network == "tcp" {
+		if _, err := s.connection.Write(lines); err != nil {
+			return s.fail(err)
+		}
+		return nil
+	}
+
+	// Datagrams contain as many complete lines as fit in,
+	// lines exceeding the size are sent on their own though
+	for len(lines) > 0 {
+		end := len(lines)
+		if end > maxDatagramSize {
+			end = bytes.LastIndexByte(lines[:maxDatagramSize], '\n') + 1
+			if end == 0 {
+				end = bytes.IndexByte(lines, '\n') + 1
+			}
+			if end == 0 {
+				end = len(lines)
+			}
+		}
+		if _, err := s.connection.Write(lines[:end]); err != nil {
+			return s.fail(err)
+		}
+		lines = lines[end:]
+	}
+	return nil
+}
+
+func (s *socketWriter) fail(
+	err error,
+) error {
+
+	_ = s.close()
+	return errors.Wrap(err, 0)
+}
+
+func (s *socketWriter) close() error {
+	if s.connection == nil {
+		return nil
+	}
+	err := s.connection.Close()
+	s.connection = nil
+	return err
+}
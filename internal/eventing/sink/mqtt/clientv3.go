@@ -0,0 +1,70 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqtt
+
+import (
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/go-errors/errors"
+	"time"
+)
+
+// v3Client publishes using the MQTT 3.1 and 3.1.1 protocol
+// versions, reconnects are handled by the client library
+type v3Client struct {
+	client  mqtt.Client
+	timeout time.Duration
+}
+
+func newV3Client(
+	options *mqtt.ClientOptions, timeout time.Duration,
+) *v3Client {
+
+	return &v3Client{
+		client:  mqtt.NewClient(options),
+		timeout: timeout,
+	}
+}
+
+func (c *v3Client) connect() error {
+	token := c.client.Connect()
+	if !token.WaitTimeout(c.timeout) {
+		return errors.Errorf("MQTT connect timed out")
+	}
+	return token.Error()
+}
+
+func (c *v3Client) isConnected() bool {
+	return c.client.IsConnectionOpen()
+}
+
+func (c *v3Client) publish(
+	topic string, qos byte, retained bool, payload []byte,
+) error {
+
+	token := c.client.Publish(topic, qos, retained, payload)
+	if !token.WaitTimeout(c.timeout) {
+		return errors.Errorf("MQTT publish to topic '%s' timed out", topic)
+	}
+	return token.Error()
+}
+
+func (c *v3Client) disconnect() {
+	if c.client.IsConnected() {
+		c.client.Disconnect(uint(c.timeout.Milliseconds()))
+	}
+}
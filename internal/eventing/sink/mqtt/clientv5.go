@@ -0,0 +1,207 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/go-errors/errors"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+var defaultPorts = map[string]string{
+	"tcp":   "1883",
+	"mqtt":  "1883",
+	"ssl":   "8883",
+	"tls":   "8883",
+	"mqtts": "8883",
+}
+
+// v5Client publishes using the MQTT 5 protocol version. The client
+// library doesn't reconnect on its own, a lost connection is dropped
+// and re-established with the next publish.
+type v5Client struct {
+	mutex     sync.Mutex
+	client    *paho.Client
+	address   string
+	useTls    bool
+	tlsConfig *tls.Config
+	clientId  string
+	username  string
+	password  string
+	timeout   time.Duration
+}
+
+func newV5Client(
+	broker, clientId, username, password string, tlsConfig *tls.Config, timeout time.Duration,
+) (*v5Client, error) {
+
+	brokerUrl, err := url.Parse(broker)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	defaultPort, present := defaultPorts[brokerUrl.Scheme]
+	if !present {
+		return nil, errors.Errorf(
+			"MQTT 5 broker url '%s' must use the tcp://, mqtt://, ssl://, tls:// or mqtts:// scheme", broker,
+		)
+	}
+
+	address := brokerUrl.Host
+	if brokerUrl.Port() == "" {
+		address = net.JoinHostPort(brokerUrl.Hostname(), defaultPort)
+	}
+
+	useTls := brokerUrl.Scheme == "ssl" || brokerUrl.Scheme == "tls" || brokerUrl.Scheme == "mqtts"
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+
+	return &v5Client{
+		address:   address,
+		useTls:    useTls,
+		tlsConfig: tlsConfig,
+		clientId:  clientId,
+		username:  username,
+		password:  password,
+		timeout:   timeout,
+	}, nil
+}
+
+func (c *v5Client) connect() error {
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+
+	var client *paho.Client
+	client = paho.NewClient(paho.ClientConfig{
+		Conn: conn,
+		OnClientError: func(_ error) {
+			c.connectionLost(client)
+		},
+		OnServerDisconnect: func(_ *paho.Disconnect) {
+			c.connectionLost(client)
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	if _, err := client.Connect(ctx, &paho.Connect{
+		ClientID:     c.clientId,
+		CleanStart:   true,
+		KeepAlive:    30,
+		Username:     c.username,
+		UsernameFlag: c.username != "",
+		Password:     []byte(c.password),
+		PasswordFlag: c.password != "",
+	}); err != nil {
+		_ = conn.Close()
+		return errors.Wrap(err, 0)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.client = client
+	return nil
+}
+
+func (c *v5Client) isConnected() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.client != nil
+}
+
+func (c *v5Client) publish(
+	topic string, qos byte, retained bool, payload []byte,
+) error {
+
+	c.mutex.Lock()
+	client := c.client
+	c.mutex.Unlock()
+
+	if client == nil {
+		return errors.Errorf("MQTT client isn't connected")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	if _, err := client.Publish(ctx, &paho.Publish{
+		Topic:   topic,
+		QoS:     qos,
+		Retain:  retained,
+		Payload: payload,
+	}); err != nil {
+		// The connection state is unknown, the next publish reconnects
+		c.connectionLost(client)
+		return errors.Wrap(err, 0)
+	}
+	return nil
+}
+
+func (c *v5Client) disconnect() {
+	c.mutex.Lock()
+	client := c.client
+	c.client = nil
+	c.mutex.Unlock()
+
+	if client != nil {
+		_ = client.Disconnect(&paho.Disconnect{ReasonCode: 0})
+	}
+}
+
+func (c *v5Client) connectionLost(
+	client *paho.Client,
+) {
+
+	c.mutex.Lock()
+	// Callbacks of a replaced client must not drop the current one
+	current := c.client == client
+	if current {
+		c.client = nil
+	}
+	c.mutex.Unlock()
+
+	if current {
+		_ = client.Disconnect(&paho.Disconnect{ReasonCode: 0})
+	}
+}
+
+func (c *v5Client) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: c.timeout}
+	if c.useTls {
+		conn, err := tls.DialWithDialer(dialer, "tcp", c.address, c.tlsConfig)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		return conn, nil
+	}
+
+	conn, err := dialer.Dial("tcp", c.address)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	return conn, nil
+}
@@ -0,0 +1,217 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqtt
+
+import (
+	"crypto/tls"
+	"fmt"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/go-errors/errors"
+	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/internal/tlsconfig"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	protocolVersion31  uint = 3
+	protocolVersion311 uint = 4
+	protocolVersion5   uint = 5
+)
+
+var topicLevelReplacer = strings.NewReplacer("/", "_", "+", "_", "#", "_")
+
+func init() {
+	sinkimpl.RegisterSink(config.Mqtt, newMqttSink)
+}
+
+// client hides the differences between the MQTT 3.1/3.1.1
+// and the MQTT 5 client libraries
+type client interface {
+	connect() error
+	isConnected() bool
+	publish(topic string, qos byte, retained bool, payload []byte) error
+	disconnect()
+}
+
+type mqttSink struct {
+	client   client
+	encoder  *encoding.JsonEncoder
+	qos      byte
+	retained bool
+}
+
+func newMqttSink(
+	c *config.Config,
+) (sink.Sink, error) {
+
+	qos := config.GetOrDefault(c, config.PropertyMqttQoS, byte(1))
+	if qos > 2 {
+		return nil, errors.Errorf("MQTT QoS level '%d' doesn't exist, valid levels are 0, 1 and 2", qos)
+	}
+
+	protocolVersion := config.GetOrDefault(c, config.PropertyMqttProtocolVersion, protocolVersion311)
+	if protocolVersion != protocolVersion31 &&
+		protocolVersion != protocolVersion311 &&
+		protocolVersion != protocolVersion5 {
+
+		return nil, errors.Errorf(
+			"MQTT protocol version '%d' isn't supported, valid versions are 3 (MQTT 3.1), 4 (MQTT 3.1.1) and 5 (MQTT 5)",
+			protocolVersion,
+		)
+	}
+
+	var tlsConfig *tls.Config
+	if config.GetOrDefault(c, config.PropertyMqttTlsEnabled, false) {
+		var err error
+		if tlsConfig, err = tlsconfig.NewTLSConfig(c, config.PropertyMqttTls); err != nil {
+			return nil, err
+		}
+	}
+
+	broker := config.GetOrDefault(c, config.PropertyMqttBroker, "tcp://localhost:1883")
+	clientId := config.GetOrDefault(c, config.PropertyMqttClientId, "timescaledb-event-streamer")
+	username := config.GetOrDefault(c, config.PropertyMqttUsername, "")
+	password := config.GetOrDefault(c, config.PropertyMqttPassword, "")
+	timeout := time.Duration(config.GetOrDefault(c, config.PropertyMqttTimeout, 30)) * time.Second
+
+	var mqttClient client
+	if protocolVersion == protocolVersion5 {
+		var err error
+		mqttClient, err = newV5Client(broker, clientId, username, password, tlsConfig, timeout)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		options := mqtt.NewClientOptions().
+			AddBroker(broker).
+			SetClientID(clientId).
+			SetProtocolVersion(protocolVersion).
+			SetUsername(username).
+			SetPassword(password).
+			SetCleanSession(true).
+			SetAutoReconnect(true).
+			SetMaxReconnectInterval(time.Second * 10)
+
+		if tlsConfig != nil {
+			options.SetTLSConfig(tlsConfig)
+		}
+		mqttClient = newV3Client(options, timeout)
+	}
+
+	return &mqttSink{
+		client:   mqttClient,
+		encoder:  encoding.NewJsonEncoderWithConfig(c),
+		qos:      qos,
+		retained: config.GetOrDefault(c, config.PropertyMqttRetained, false),
+	}, nil
+}
+
+func (m *mqttSink) Start() error {
+	return m.client.connect()
+}
+
+func (m *mqttSink) Stop() error {
+	m.client.disconnect()
+	return nil
+}
+
+func (m *mqttSink) Emit(
+	_ sink.Context, _ time.Time, topicName string, key, envelope schema.Struct,
+) error {
+
+	topic := strings.ReplaceAll(topicName, ".", "/")
+
+	// Brokers only retain the last message per topic, therefore retained
+	// messages are published to a per-key subtopic, so the broker keeps
+	// the latest row of every key. Events without a key (truncates,
+	// logical replication messages, TimescaleDB events) would overwrite
+	// each other and are published to the plain topic without retaining
+	// them. A truncate can't clear the retained rows of the keys either,
+	// since MQTT has no way to drop retained messages by wildcard.
+	retained := false
+	if m.retained {
+		if levels, ok := keyTopicLevels(key); ok {
+			topic = fmt.Sprintf("%s/%s", topic, levels)
+			retained = true
+		}
+	}
+
+	// An empty retained message makes the broker drop the retained row
+	// of the key, deleted rows aren't handed to late subscribers anymore
+	var payload []byte
+	if !retained || !isDelete(envelope) {
+		envelopeData, err := m.encoder.Marshal(envelope)
+		if err != nil {
+			return err
+		}
+		payload = envelopeData
+	}
+
+	if !m.client.isConnected() {
+		if err := m.client.connect(); err != nil {
+			return err
+		}
+	}
+
+	return m.client.publish(topic, m.qos, retained, payload)
+}
+
+func isDelete(
+	envelope schema.Struct,
+) bool {
+
+	payload, _ := envelope[schema.FieldNamePayload].(schema.Struct)
+	operation, _ := payload[schema.FieldNameOperation].(string)
+	return schema.Operation(operation) == schema.OP_DELETE
+}
+
+func keyTopicLevels(
+	key schema.Struct,
+) (string, bool) {
+
+	payload, ok := key[schema.FieldNamePayload].(schema.Struct)
+	if !ok || len(payload) == 0 {
+		return "", false
+	}
+
+	// Key columns are sorted by name to generate a stable topic
+	fieldNames := make([]string, 0, len(payload))
+	for fieldName := range payload {
+		fieldNames = append(fieldNames, fieldName)
+	}
+	sort.Strings(fieldNames)
+
+	levels := make([]string, 0, len(fieldNames))
+	for _, fieldName := range fieldNames {
+		var level string
+		switch v := payload[fieldName].(type) {
+		case time.Time:
+			level = v.UTC().Format(time.RFC3339Nano)
+		default:
+			level = fmt.Sprintf("%v", v)
+		}
+		levels = append(levels, topicLevelReplacer.Replace(level))
+	}
+	return strings.Join(levels, "/"), true
+}
@@ -19,9 +19,14 @@ package nats
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"github.com/go-errors/errors"
 	"github.com/nats-io/nats.go"
 	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/internal/tlsconfig"
 	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
 	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
 	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
@@ -34,9 +39,14 @@ func init() {
 }
 
 type natsSink struct {
+	logger           *logging.Logger
 	client           *nats.Conn
 	jetStreamContext nats.JetStreamContext
 	encoder          *encoding.JsonEncoder
+	mode             config.NatsMode
+	streamConfig     *nats.StreamConfig
+	lastLsn          string
+	occurrences      map[string]int
 }
 
 func newNatsSink(
@@ -87,6 +97,32 @@ func connectJetStreamContext(
 	c *config.Config, address string, options ...nats.Option,
 ) (sink.Sink, error) {
 
+	logger, err := logging.NewLogger("NatsSink")
+	if err != nil {
+		return nil, err
+	}
+
+	mode := config.GetOrDefault(c, config.PropertyNatsMode, config.NatsJetStreamMode)
+	if mode != config.NatsJetStreamMode && mode != config.NatsCoreMode {
+		return nil, errors.Errorf("NATS mode '%s' doesn't exist", mode)
+	}
+
+	streamConfig, err := newStreamConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	if streamConfig != nil && mode != config.NatsJetStreamMode {
+		return nil, errors.Errorf("NATS stream provisioning requires the jetstream mode")
+	}
+
+	if config.GetOrDefault(c, config.PropertyNatsTlsEnabled, false) {
+		tlsConfig, err := tlsconfig.NewTLSConfig(c, config.PropertyNatsTls)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, nats.Secure(tlsConfig))
+	}
+
 	options = append(
 		options,
 		nats.Name("event-stream-prototype"),
@@ -101,19 +137,48 @@ func connectJetStreamContext(
 		return nil, err
 	}
 
-	jetStreamContext, err := client.JetStream()
+	// Core NATS publishes fire-and-forget, without any acknowledgement
+	if mode == config.NatsCoreMode {
+		return &natsSink{
+			logger:  logger,
+			client:  client,
+			encoder: encoding.NewJsonEncoderWithConfig(c),
+			mode:    mode,
+		}, nil
+	}
+
+	// Without pending messages, events are published synchronously
+	maxPending := config.GetOrDefault(c, config.PropertyNatsAsyncMaxPending, 4000)
+
+	jetStreamOptions := make([]nats.JSOpt, 0)
+	if maxPending > 0 {
+		jetStreamOptions = append(jetStreamOptions, nats.PublishAsyncMaxPending(maxPending))
+	}
+
+	jetStreamContext, err := client.JetStream(jetStreamOptions...)
 	if err != nil {
 		return nil, err
 	}
 
-	return &natsSink{
+	s := &natsSink{
+		logger:           logger,
 		client:           client,
 		jetStreamContext: jetStreamContext,
 		encoder:          encoding.NewJsonEncoderWithConfig(c),
-	}, nil
+		mode:             mode,
+		streamConfig:     streamConfig,
+	}
+
+	if maxPending > 0 {
+		return &asyncNatsSink{natsSink: s}, nil
+	}
+	return s, nil
 }
 
 func (n *natsSink) Start() error {
+	if n.streamConfig != nil {
+		return n.ensureStream()
+	}
 	return nil
 }
 
@@ -126,25 +191,150 @@ func (n *natsSink) Emit(
 	_ sink.Context, _ time.Time, topicName string, key, envelope schema.Struct,
 ) error {
 
-	keyData, err := n.encoder.Marshal(key)
+	msg, err := n.newMessage(topicName, key, envelope)
 	if err != nil {
 		return err
 	}
+
+	if n.mode == config.NatsCoreMode {
+		return n.client.PublishMsg(msg)
+	}
+
+	_, err = n.jetStreamContext.PublishMsg(msg, nats.Context(context.Background()))
+	return err
+}
+
+func (n *natsSink) newMessage(
+	topicName string, key, envelope schema.Struct,
+) (*nats.Msg, error) {
+
+	keyData, err := n.encoder.Marshal(key)
+	if err != nil {
+		return nil, err
+	}
 	envelopeData, err := n.encoder.Marshal(envelope)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	header := nats.Header{}
 	header.Add("key", string(keyData))
+	if n.mode == config.NatsJetStreamMode {
+		if msgId := messageId(topicName, key, keyData, envelope, envelopeData); msgId != "" {
+			header.Set(nats.MsgIdHdr, n.numberMessageId(envelope, msgId))
+		}
+	}
 
-	_, err = n.jetStreamContext.PublishMsg(
-		&nats.Msg{
-			Subject: topicName,
-			Header:  header,
-			Data:    envelopeData,
-		},
-		nats.Context(context.Background()),
-	)
-	return err
+	return &nats.Msg{
+		Subject: topicName,
+		Header:  header,
+		Data:    envelopeData,
+	}, nil
+}
+
+// numberMessageId numbers repeated message ids of the same LSN. The
+// source LSN is the server's WAL end, which is shared by all records
+// sent together, hence multiple changes of the same key in a transaction
+// would end up with the same id. They're numbered in the order they are
+// emitted, which is the same when the transaction is replayed. Snapshot
+// events contain every key only once and aren't numbered.
+func (n *natsSink) numberMessageId(
+	envelope schema.Struct, msgId string,
+) string {
+
+	source := envelopeSource(envelope)
+	if snapshot, _ := source[schema.FieldNameSnapshot].(bool); snapshot {
+		return msgId
+	}
+
+	if lsn, _ := source[schema.FieldNameLSN].(string); lsn != n.lastLsn || n.occurrences == nil {
+		n.lastLsn = lsn
+		n.occurrences = make(map[string]int)
+	}
+
+	occurrence := n.occurrences[msgId]
+	n.occurrences[msgId] = occurrence + 1
+	if occurrence == 0 {
+		return msgId
+	}
+	return fmt.Sprintf("%s-%d", msgId, occurrence)
+}
+
+// messageId derives the JetStream message id from the LSN and the key
+// of the event, therefore events emitted again, i.e. after a restart,
+// are dropped by the deduplication window of the stream. Events
+// without key, which share an LSN in snapshots, use the envelope.
+func messageId(
+	topicName string, key schema.Struct, keyData []byte, envelope schema.Struct, envelopeData []byte,
+) string {
+
+	payload, _ := envelope[schema.FieldNamePayload].(schema.Struct)
+	operation, _ := payload[schema.FieldNameOperation].(string)
+	lsn, _ := envelopeSource(envelope)[schema.FieldNameLSN].(string)
+	if lsn == "" {
+		return ""
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(topicName))
+	hash.Write([]byte{0})
+	hash.Write([]byte(operation))
+	hash.Write([]byte{0})
+	if keyPayload, _ := key[schema.FieldNamePayload].(schema.Struct); len(keyPayload) > 0 {
+		hash.Write(keyData)
+	} else {
+		hash.Write(envelopeData)
+	}
+	return fmt.Sprintf("%s-%s", lsn, hex.EncodeToString(hash.Sum(nil))[:32])
+}
+
+func envelopeSource(
+	envelope schema.Struct,
+) schema.Struct {
+
+	payload, _ := envelope[schema.FieldNamePayload].(schema.Struct)
+	source, _ := payload[schema.FieldNameSource].(schema.Struct)
+	return source
+}
+
+// asyncNatsSink publishes events without waiting for the JetStream
+// acknowledgement, up to the configured number of pending messages
+type asyncNatsSink struct {
+	*natsSink
+}
+
+func (a *asyncNatsSink) Stop() error {
+	// Pending messages are given some time to be acknowledged,
+	// unacknowledged events are emitted again after a restart
+	select {
+	case <-a.jetStreamContext.PublishAsyncComplete():
+	case <-time.After(30 * time.Second):
+	}
+	return a.natsSink.Stop()
+}
+
+func (a *asyncNatsSink) EmitAsync(
+	_ sink.Context, _ time.Time, topicName string, key, envelope schema.Struct,
+	completion sink.Completion,
+) error {
+
+	msg, err := a.newMessage(topicName, key, envelope)
+	if err != nil {
+		return err
+	}
+
+	future, err := a.jetStreamContext.PublishMsgAsync(msg)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		select {
+		case <-future.Ok():
+			completion(nil)
+		case err := <-future.Err():
+			completion(err)
+		}
+	}()
+	return nil
 }
@@ -0,0 +1,168 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nats
+
+import (
+	"github.com/nats-io/nats.go"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newEnvelope(
+	operation, lsn string, value int,
+) schema.Struct {
+
+	return schema.Struct{
+		schema.FieldNamePayload: schema.Struct{
+			schema.FieldNameOperation: operation,
+			schema.FieldNameSource: schema.Struct{
+				schema.FieldNameLSN: lsn,
+			},
+			schema.FieldNameAfter: schema.Struct{
+				"value": value,
+			},
+		},
+	}
+}
+
+func Test_Nats_Message_Id(
+	t *testing.T,
+) {
+
+	key := schema.Struct{schema.FieldNamePayload: schema.Struct{"id": 1}}
+	otherKey := schema.Struct{schema.FieldNamePayload: schema.Struct{"id": 2}}
+
+	envelope := newEnvelope("c", "0/16B3748", 1)
+	msgId := messageId("ts.public.metrics", key, []byte(`{"id":1}`), envelope, []byte("1"))
+	assert.True(t, strings.HasPrefix(msgId, "0/16B3748-"))
+
+	// The same event emitted again results in the same id
+	assert.Equal(t, msgId, messageId("ts.public.metrics", key, []byte(`{"id":1}`), envelope, []byte("1")))
+
+	// Events sharing an LSN, like snapshots, are distinguished by key
+	assert.NotEqual(t, msgId, messageId("ts.public.metrics", otherKey, []byte(`{"id":2}`), envelope, []byte("1")))
+
+	// Events without key are distinguished by the envelope
+	emptyKey := schema.Struct{schema.FieldNamePayload: schema.Struct{}}
+	assert.NotEqual(t,
+		messageId("ts.public.metrics", emptyKey, []byte(`{}`), envelope, []byte("1")),
+		messageId("ts.public.metrics", emptyKey, []byte(`{}`), envelope, []byte("2")),
+	)
+
+	// Events without LSN can't be deduplicated
+	assert.Equal(t, "", messageId("ts.public.metrics", key, []byte(`{"id":1}`), schema.Struct{}, []byte("1")))
+}
+
+func Test_Nats_Message_Id_Same_Key_Updates_In_Transaction(
+	t *testing.T,
+) {
+
+	key := schema.Struct{schema.FieldNamePayload: schema.Struct{"id": 1}}
+	keyData := []byte(`{"id":1}`)
+	sink := &natsSink{}
+
+	// Both updates of the transaction were received with the same
+	// server WAL end and are numbered in the order they're emitted
+	first := newEnvelope("u", "0/16B3748", 1)
+	second := newEnvelope("u", "0/16B3748", 2)
+
+	firstId := sink.numberMessageId(first, messageId("ts.public.metrics", key, keyData, first, []byte("1")))
+	secondId := sink.numberMessageId(second, messageId("ts.public.metrics", key, keyData, second, []byte("2")))
+	assert.NotEqual(t, firstId, secondId)
+	assert.Equal(t, firstId+"-1", secondId)
+
+	// Replaying the transaction results in the same ids
+	replaySink := &natsSink{}
+	assert.Equal(t, firstId,
+		replaySink.numberMessageId(first, messageId("ts.public.metrics", key, keyData, first, []byte("1"))),
+	)
+	assert.Equal(t, secondId,
+		replaySink.numberMessageId(second, messageId("ts.public.metrics", key, keyData, second, []byte("2"))),
+	)
+
+	// The numbering starts over with the next LSN
+	third := newEnvelope("u", "0/16B37D0", 3)
+	thirdId := sink.numberMessageId(third, messageId("ts.public.metrics", key, keyData, third, []byte("3")))
+	assert.False(t, strings.HasSuffix(thirdId, "-1"))
+	assert.True(t, strings.HasPrefix(thirdId, "0/16B37D0-"))
+}
+
+func Test_Nats_Stream_Config(
+	t *testing.T,
+) {
+
+	config := &spiconfig.Config{
+		Topic: spiconfig.TopicConfig{
+			Prefix: "timescaledb",
+		},
+	}
+
+	streamConfig, err := newStreamConfig(config)
+	assert.NoError(t, err)
+	assert.Nil(t, streamConfig)
+
+	config.Sink.Nats.JetStream.Stream.Create = true
+	streamConfig, err = newStreamConfig(config)
+	assert.NoError(t, err)
+	assert.Equal(t, "timescaledb", streamConfig.Name)
+	assert.Equal(t, []string{"timescaledb.>"}, streamConfig.Subjects)
+	assert.Equal(t, nats.LimitsPolicy, streamConfig.Retention)
+	assert.Equal(t, 1, streamConfig.Replicas)
+	assert.Equal(t, time.Duration(0), streamConfig.MaxAge)
+	assert.Equal(t, 2*time.Minute, streamConfig.Duplicates)
+
+	config.Sink.Nats.JetStream.Stream = spiconfig.NatsStreamConfig{
+		Create:     true,
+		Subjects:   []string{"timescaledb.public.*"},
+		Retention:  spiconfig.NatsInterestRetention,
+		Replicas:   lo.ToPtr(3),
+		MaxAge:     lo.ToPtr(60),
+		Duplicates: lo.ToPtr(300),
+	}
+	streamConfig, err = newStreamConfig(config)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"timescaledb.public.*"}, streamConfig.Subjects)
+	assert.Equal(t, nats.InterestPolicy, streamConfig.Retention)
+	assert.Equal(t, 3, streamConfig.Replicas)
+	assert.Equal(t, time.Minute, streamConfig.MaxAge)
+	// The deduplication window is limited by the maximum age
+	assert.Equal(t, time.Minute, streamConfig.Duplicates)
+
+	config.Sink.Nats.JetStream.Stream.Retention = "unknown"
+	_, err = newStreamConfig(config)
+	assert.Error(t, err)
+}
+
+func Test_Nats_Merge_Subjects(
+	t *testing.T,
+) {
+
+	assert.Equal(t,
+		[]string{"other.>", "timescaledb.>"},
+		mergeSubjects([]string{"other.>"}, []string{"timescaledb.>"}),
+	)
+	assert.Equal(t,
+		[]string{"timescaledb.>"},
+		mergeSubjects([]string{"timescaledb.>"}, []string{"timescaledb.>"}),
+	)
+}
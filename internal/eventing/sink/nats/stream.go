@@ -0,0 +1,133 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nats
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/nats-io/nats.go"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var streamNameReplacer = strings.NewReplacer(".", "-", "*", "-", ">", "-", " ", "-")
+
+// newStreamConfig provides the configuration of the JetStream stream
+// to create or update on start, or nil if provisioning is disabled
+func newStreamConfig(
+	c *config.Config,
+) (*nats.StreamConfig, error) {
+
+	if !config.GetOrDefault(c, config.PropertyNatsJetStreamStreamCreate, false) {
+		return nil, nil
+	}
+
+	// By default, the stream captures all subjects generated
+	// for the topic prefix, including the dead letter topic
+	name := config.GetOrDefault(
+		c, config.PropertyNatsJetStreamStreamName, streamNameReplacer.Replace(c.Topic.Prefix),
+	)
+	subjects := config.GetOrDefault(
+		c, config.PropertyNatsJetStreamStreamSubjects, []string{c.Topic.Prefix + ".>"},
+	)
+
+	var retention nats.RetentionPolicy
+	policy := config.GetOrDefault(c, config.PropertyNatsJetStreamStreamRetention, config.NatsLimitsRetention)
+	switch policy {
+	case config.NatsLimitsRetention:
+		retention = nats.LimitsPolicy
+	case config.NatsInterestRetention:
+		retention = nats.InterestPolicy
+	case config.NatsWorkQueueRetention:
+		retention = nats.WorkQueuePolicy
+	default:
+		return nil, errors.Errorf("NATS retention policy '%s' doesn't exist", policy)
+	}
+
+	maxAge := time.Duration(config.GetOrDefault(c, config.PropertyNatsJetStreamStreamMaxAge, 0)) * time.Second
+	duplicates := time.Duration(config.GetOrDefault(c, config.PropertyNatsJetStreamStreamDuplicates, 120)) * time.Second
+	// The deduplication window must not exceed the maximum age
+	if maxAge > 0 && duplicates > maxAge {
+		duplicates = maxAge
+	}
+
+	return &nats.StreamConfig{
+		Name:       name,
+		Subjects:   subjects,
+		Retention:  retention,
+		Replicas:   config.GetOrDefault(c, config.PropertyNatsJetStreamStreamReplicas, 1),
+		MaxAge:     maxAge,
+		Duplicates: duplicates,
+		Storage:    nats.FileStorage,
+	}, nil
+}
+
+// ensureStream creates the stream, or updates the settings of an
+// existing one. Subjects of an existing stream are kept, since they
+// may be used by other publishers.
+func (n *natsSink) ensureStream() error {
+	info, err := n.jetStreamContext.StreamInfo(n.streamConfig.Name)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		if _, err := n.jetStreamContext.AddStream(n.streamConfig); err != nil {
+			return errors.Wrap(err, 0)
+		}
+		n.logger.Infof("Created JetStream stream %s for subjects %v", n.streamConfig.Name, n.streamConfig.Subjects)
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	streamConfig := info.Config
+	streamConfig.Subjects = mergeSubjects(info.Config.Subjects, n.streamConfig.Subjects)
+	streamConfig.Retention = n.streamConfig.Retention
+	streamConfig.Replicas = n.streamConfig.Replicas
+	streamConfig.MaxAge = n.streamConfig.MaxAge
+	streamConfig.Duplicates = n.streamConfig.Duplicates
+
+	if reflect.DeepEqual(streamConfig, info.Config) {
+		return nil
+	}
+
+	if _, err := n.jetStreamContext.UpdateStream(&streamConfig); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	n.logger.Infof("Updated JetStream stream %s for subjects %v", streamConfig.Name, streamConfig.Subjects)
+	return nil
+}
+
+func mergeSubjects(
+	existing, required []string,
+) []string {
+
+	subjects := append(make([]string, 0, len(existing)+len(required)), existing...)
+	for _, subject := range required {
+		found := false
+		for _, candidate := range subjects {
+			if candidate == subject {
+				found = true
+				break
+			}
+		}
+		if !found {
+			subjects = append(subjects, subject)
+		}
+	}
+	return subjects
+}
@@ -0,0 +1,346 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package postgresql
+
+import (
+	"context"
+	"github.com/cenkalti/backoff/v4"
+	"github.com/go-errors/errors"
+	"github.com/jackc/pgx/v5"
+	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/internal/tlsconfig"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"sync"
+	"time"
+)
+
+func init() {
+	sinkimpl.RegisterSink(config.PostgreSQL, newPostgresqlSink)
+}
+
+type transaction struct {
+	xid        uint32
+	statements []statement
+	// tx is the target transaction, only opened after the buffered
+	// statements exceeded the maximum and were applied ahead of time
+	tx  pgx.Tx
+	err error
+}
+
+func (t *transaction) empty() bool {
+	return t.tx == nil && t.err == nil && len(t.statements) == 0
+}
+
+type postgresqlSink struct {
+	mutex         sync.Mutex
+	logger        *logging.Logger
+	connConfig    *pgx.ConnConfig
+	connection    *pgx.Conn
+	schemaName    string
+	autoCreate    bool
+	hypertables   bool
+	tables        map[string]schema.TableAlike
+	targets       map[string]*target
+	transaction   *transaction
+	maxStatements int
+}
+
+func newPostgresqlSink(
+	c *config.Config,
+) (sink.Sink, error) {
+
+	logger, err := logging.NewLogger("PostgreSQLSink")
+	if err != nil {
+		return nil, err
+	}
+
+	connection := config.GetOrDefault(c, config.PropertyPostgresqlSinkConnection, "")
+	if connection == "" {
+		return nil, errors.Errorf("PostgreSQL sink requires a connection string")
+	}
+
+	connConfig, err := pgx.ParseConfig(connection)
+	if err != nil {
+		return nil, errors.Errorf("PostgreSQL sink connection string failed to parse: %s", err.Error())
+	}
+
+	if password := config.GetOrDefault(c, config.PropertyPostgresqlSinkPassword, ""); password != "" {
+		connConfig.Password = password
+	}
+
+	if config.GetOrDefault(c, config.PropertyPostgresqlSinkTlsEnabled, false) {
+		if err := tlsconfig.ConfigurePgx(c, config.PropertyPostgresqlSinkTls, connConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	return &postgresqlSink{
+		logger:      logger,
+		connConfig:  connConfig,
+		schemaName:  config.GetOrDefault(c, config.PropertyPostgresqlSinkSchema, ""),
+		autoCreate:  config.GetOrDefault(c, config.PropertyPostgresqlSinkAutoCreate, false),
+		hypertables: config.GetOrDefault(c, config.PropertyPostgresqlSinkHypertables, true),
+		tables:      make(map[string]schema.TableAlike),
+		targets:     make(map[string]*target),
+		maxStatements: config.GetOrDefault(
+			c, config.PropertyPostgresqlSinkTransactionMaxStatements, 10000,
+		),
+	}, nil
+}
+
+func (p *postgresqlSink) Start() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	_, err := p.connect()
+	return err
+}
+
+func (p *postgresqlSink) Stop() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.transaction != nil && !p.transaction.empty() {
+		// The source transaction wasn't acknowledged, and will be
+		// replicated again when the streamer is restarted
+		p.logger.Warnf("Discarding unfinished transaction xid=%d", p.transaction.xid)
+		p.discard(p.transaction)
+	}
+	p.transaction = nil
+
+	if p.connection != nil && !p.connection.IsClosed() {
+		return p.connection.Close(context.Background())
+	}
+	return nil
+}
+
+func (p *postgresqlSink) RegisterTable(
+	_ sink.Context, topicName string, table schema.TableAlike,
+) error {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.autoCreate {
+		if err := p.createTable(table); err != nil {
+			return err
+		}
+	}
+	p.tables[topicName] = table
+	delete(p.targets, topicName)
+	return nil
+}
+
+func (p *postgresqlSink) BeginTransaction(
+	_ sink.Context, xid uint32, _ time.Time,
+) error {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.transaction != nil && !p.transaction.empty() {
+		p.logger.Warnf(
+			"Transaction xid=%d started before transaction xid=%d was committed, discarding it",
+			xid, p.transaction.xid,
+		)
+		p.discard(p.transaction)
+	}
+
+	p.transaction = &transaction{
+		xid:        xid,
+		statements: make([]statement, 0),
+	}
+	return nil
+}
+
+func (p *postgresqlSink) CommitTransaction(
+	_ sink.Context, xid uint32, _ pgtypes.LSN,
+) error {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// Transactions that only change the TimescaleDB catalog (like
+	// chunk compressions) may commit without having been started
+	pending := p.transaction
+	p.transaction = nil
+	if pending == nil || pending.empty() {
+		return nil
+	}
+
+	if pending.err != nil {
+		return pending.err
+	}
+
+	if pending.xid != xid {
+		p.discard(pending)
+		return errors.Errorf(
+			"PostgreSQL sink received commit for transaction xid=%d, but transaction xid=%d is active",
+			xid, pending.xid,
+		)
+	}
+
+	// Statements of spilled transactions were partially applied to the
+	// open target transaction already and can't be replayed, failing
+	// commits leave the source transaction unacknowledged, and it is
+	// replicated again when the streamer is restarted
+	if pending.tx != nil {
+		ctx := context.Background()
+		if err := send(ctx, pending.tx, pending.statements); err != nil {
+			p.discard(pending)
+			return err
+		}
+		return errors.Wrap(pending.tx.Commit(ctx), 0)
+	}
+
+	// Commits aren't retried by the event emitter, therefore buffered
+	// statements are applied with up to 8 retries (exponential backoff)
+	backOff := backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 8)
+	return backoff.RetryNotify(func() error {
+		return p.apply(pending.statements)
+	}, backOff, func(err error, _ time.Duration) {
+		p.logger.Warnf("Failed to commit transaction xid=%d, retrying: %+v", xid, err)
+	})
+}
+
+func (p *postgresqlSink) Emit(
+	_ sink.Context, _ time.Time, topicName string, key, envelope schema.Struct,
+) error {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	statements, err := p.statements(topicName, key, envelope)
+	if err != nil {
+		return err
+	}
+	if len(statements) == 0 {
+		return nil
+	}
+
+	// Events of a source transaction are collected and applied in
+	// a single target transaction when the source transaction commits
+	if p.transaction != nil {
+		if p.transaction.err != nil {
+			return p.transaction.err
+		}
+		p.transaction.statements = append(p.transaction.statements, statements...)
+		if len(p.transaction.statements) >= p.maxStatements {
+			return p.spill(p.transaction)
+		}
+		return nil
+	}
+
+	// Events outside a source transaction (snapshots) are applied immediately
+	return p.apply(statements)
+}
+
+func (p *postgresqlSink) apply(
+	statements []statement,
+) error {
+
+	connection, err := p.connect()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	return pgx.BeginFunc(ctx, connection, func(tx pgx.Tx) error {
+		return send(ctx, tx, statements)
+	})
+}
+
+// spill applies the buffered statements of a large source transaction
+// to the target transaction ahead of the commit, to bound the memory
+// used by buffered statements
+func (p *postgresqlSink) spill(
+	pending *transaction,
+) error {
+
+	ctx := context.Background()
+	if pending.tx == nil {
+		connection, err := p.connect()
+		if err != nil {
+			return p.fail(pending, err)
+		}
+		tx, err := connection.Begin(ctx)
+		if err != nil {
+			return p.fail(pending, err)
+		}
+		pending.tx = tx
+	}
+
+	if err := send(ctx, pending.tx, pending.statements); err != nil {
+		return p.fail(pending, err)
+	}
+	pending.statements = make([]statement, 0)
+	return nil
+}
+
+// fail marks the transaction as failed, since spilled statements can't
+// be replayed, all further events of the transaction are rejected
+func (p *postgresqlSink) fail(
+	pending *transaction, err error,
+) error {
+
+	p.discard(pending)
+	pending.err = errors.Errorf(
+		"PostgreSQL sink failed to apply transaction xid=%d: %s", pending.xid, err.Error(),
+	)
+	return pending.err
+}
+
+func (p *postgresqlSink) discard(
+	pending *transaction,
+) {
+
+	if pending.tx != nil {
+		if err := pending.tx.Rollback(context.Background()); err != nil {
+			p.logger.Warnf("Failed to rollback transaction xid=%d: %+v", pending.xid, err)
+		}
+		pending.tx = nil
+	}
+	pending.statements = nil
+}
+
+func send(
+	ctx context.Context, tx pgx.Tx, statements []statement,
+) error {
+
+	batch := &pgx.Batch{}
+	for _, s := range statements {
+		batch.Queue(s.sql, s.arguments...)
+	}
+	return tx.SendBatch(ctx, batch).Close()
+}
+
+func (p *postgresqlSink) connect() (*pgx.Conn, error) {
+	if p.connection != nil && !p.connection.IsClosed() {
+		return p.connection, nil
+	}
+
+	connection, err := pgx.ConnectConfig(context.Background(), p.connConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	p.connection = connection
+	return connection, nil
+}
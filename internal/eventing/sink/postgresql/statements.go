@@ -0,0 +1,463 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package postgresql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+type statement struct {
+	sql       string
+	arguments []any
+}
+
+type target struct {
+	identifier  string
+	keyColumns  []string
+	columns     []string
+	columnTypes map[string]string
+}
+
+func (p *postgresqlSink) statements(
+	topicName string, key, envelope schema.Struct,
+) ([]statement, error) {
+
+	payload, ok := envelope[schema.FieldNamePayload].(schema.Struct)
+	if !ok {
+		return nil, nil
+	}
+
+	operation, _ := payload[schema.FieldNameOperation].(string)
+	switch schema.Operation(operation) {
+	case schema.OP_READ, schema.OP_CREATE, schema.OP_UPDATE, schema.OP_DELETE, schema.OP_TRUNCATE:
+	default:
+		// Logical replication messages and TimescaleDB
+		// events have no representation in the target
+		return nil, nil
+	}
+
+	source, ok := payload[schema.FieldNameSource].(schema.Struct)
+	if !ok {
+		return nil, errors.Errorf("PostgreSQL sink received an event without source information")
+	}
+
+	t, present := p.targets[topicName]
+	if !present {
+		t = p.target(p.tables[topicName], source, key)
+		p.targets[topicName] = t
+	}
+
+	before, _ := payload[schema.FieldNameBefore].(schema.Struct)
+	after, _ := payload[schema.FieldNameAfter].(schema.Struct)
+
+	switch schema.Operation(operation) {
+	case schema.OP_TRUNCATE:
+		return []statement{{sql: fmt.Sprintf("TRUNCATE TABLE %s", t.identifier)}}, nil
+
+	case schema.OP_DELETE:
+		if len(t.keyColumns) == 0 && before == nil {
+			p.logger.Warnf(
+				"Cannot delete from %s without primary key or replica identity full, skipping", t.identifier,
+			)
+			return nil, nil
+		}
+		return []statement{t.delete(t.keyValues(key, before))}, nil
+
+	case schema.OP_UPDATE:
+		if len(t.keyColumns) == 0 {
+			// Without a key, the row can only be identified
+			// by the full old values (replica identity full)
+			if before == nil {
+				p.logger.Warnf(
+					"Cannot update %s without primary key or replica identity full, skipping", t.identifier,
+				)
+				return nil, nil
+			}
+			return []statement{t.delete(before), t.insert(after)}, nil
+		}
+
+		// If a key column was updated, the old row has to be removed
+		statements := make([]statement, 0, 2)
+		if before != nil && t.keyChanged(before, after) {
+			statements = append(statements, t.delete(t.keyValues(key, before)))
+		}
+		return append(statements, t.insert(after)), nil
+
+	default:
+		return []statement{t.insert(after)}, nil
+	}
+}
+
+func (p *postgresqlSink) target(
+	table schema.TableAlike, source, key schema.Struct,
+) *target {
+
+	schemaName, _ := source[schema.FieldNameSchema].(string)
+	tableName, _ := source[schema.FieldNameTable].(string)
+	if p.schemaName != "" {
+		schemaName = p.schemaName
+	}
+
+	t := &target{
+		identifier:  pgx.Identifier{schemaName, tableName}.Sanitize(),
+		keyColumns:  keyColumns(key),
+		columns:     make([]string, 0),
+		columnTypes: make(map[string]string),
+	}
+
+	// The table definition isn't available when the target table
+	// is created upfront and events don't pass through a stream
+	if table != nil {
+		for _, column := range table.TableColumns() {
+			t.columns = append(t.columns, column.Name())
+			t.columnTypes[column.Name()] = columnType(column)
+		}
+	}
+	return t
+}
+
+func (t *target) insert(
+	values schema.Struct,
+) statement {
+
+	columns := t.orderedColumns(values)
+	quotedColumns := make([]string, 0, len(columns))
+	placeholders := make([]string, 0, len(columns))
+	arguments := make([]any, 0, len(columns))
+	for i, column := range columns {
+		quotedColumns = append(quotedColumns, pgx.Identifier{column}.Sanitize())
+		placeholders = append(placeholders, t.placeholder(column, i+1))
+		arguments = append(arguments, argument(values[column]))
+	}
+
+	sql := fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (%s)",
+		t.identifier, strings.Join(quotedColumns, ", "), strings.Join(placeholders, ", "),
+	)
+
+	if len(t.keyColumns) > 0 {
+		conflictTarget := make([]string, 0, len(t.keyColumns))
+		for _, column := range t.keyColumns {
+			conflictTarget = append(conflictTarget, pgx.Identifier{column}.Sanitize())
+		}
+
+		updates := make([]string, 0, len(columns))
+		for _, column := range columns {
+			if !t.isKeyColumn(column) {
+				quotedColumn := pgx.Identifier{column}.Sanitize()
+				updates = append(updates, fmt.Sprintf("%s = EXCLUDED.%s", quotedColumn, quotedColumn))
+			}
+		}
+
+		if len(updates) == 0 {
+			sql = fmt.Sprintf("%s ON CONFLICT (%s) DO NOTHING", sql, strings.Join(conflictTarget, ", "))
+		} else {
+			sql = fmt.Sprintf(
+				"%s ON CONFLICT (%s) DO UPDATE SET %s",
+				sql, strings.Join(conflictTarget, ", "), strings.Join(updates, ", "),
+			)
+		}
+	}
+
+	return statement{sql: sql, arguments: arguments}
+}
+
+func (t *target) delete(
+	values schema.Struct,
+) statement {
+
+	columns := t.orderedColumns(values)
+	conditions := make([]string, 0, len(columns))
+	arguments := make([]any, 0, len(columns))
+	for _, column := range columns {
+		quotedColumn := pgx.Identifier{column}.Sanitize()
+		if values[column] == nil {
+			conditions = append(conditions, fmt.Sprintf("%s IS NULL", quotedColumn))
+			continue
+		}
+		arguments = append(arguments, argument(values[column]))
+		conditions = append(conditions, fmt.Sprintf(
+			"%s = %s", quotedColumn, t.placeholder(column, len(arguments)),
+		))
+	}
+
+	return statement{
+		sql:       fmt.Sprintf("DELETE FROM %s WHERE %s", t.identifier, strings.Join(conditions, " AND ")),
+		arguments: arguments,
+	}
+}
+
+// keyValues returns the key values of the event, if the table
+// has no key, the full old values are used to find the row
+func (t *target) keyValues(
+	key, before schema.Struct,
+) schema.Struct {
+
+	if len(t.keyColumns) == 0 {
+		return before
+	}
+
+	// The key is calculated from the new values, the
+	// old key values are only available from before
+	values, _ := key[schema.FieldNamePayload].(schema.Struct)
+	if before != nil {
+		values = before
+	}
+
+	keyValues := make(schema.Struct, len(t.keyColumns))
+	for _, column := range t.keyColumns {
+		keyValues[column] = values[column]
+	}
+	return keyValues
+}
+
+func (t *target) keyChanged(
+	before, after schema.Struct,
+) bool {
+
+	for _, column := range t.keyColumns {
+		if !reflect.DeepEqual(before[column], after[column]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *target) isKeyColumn(
+	column string,
+) bool {
+
+	for _, keyColumn := range t.keyColumns {
+		if keyColumn == column {
+			return true
+		}
+	}
+	return false
+}
+
+// orderedColumns returns the columns present in values, in the order
+// of the table definition, or sorted by name if it isn't available
+func (t *target) orderedColumns(
+	values schema.Struct,
+) []string {
+
+	columns := make([]string, 0, len(values))
+	if len(t.columns) > 0 {
+		for _, column := range t.columns {
+			if _, present := values[column]; present {
+				columns = append(columns, column)
+			}
+		}
+		return columns
+	}
+
+	for column := range values {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+func (t *target) placeholder(
+	column string, index int,
+) string {
+
+	// Byte arrays are transported as hex encoded strings
+	if t.columnTypes[column] == "bytea" {
+		return fmt.Sprintf("decode($%d, 'hex')", index)
+	}
+	return fmt.Sprintf("$%d", index)
+}
+
+func (p *postgresqlSink) createTable(
+	table schema.TableAlike,
+) error {
+
+	schemaName := table.SchemaName()
+	if p.schemaName != "" {
+		schemaName = p.schemaName
+	}
+	identifier := pgx.Identifier{schemaName, table.TableName()}.Sanitize()
+
+	definitions := make([]string, 0)
+	keyColumns := make([]string, 0)
+	timeDimension := ""
+	for _, column := range table.TableColumns() {
+		definition := fmt.Sprintf("%s %s", pgx.Identifier{column.Name()}.Sanitize(), columnType(column))
+		if c, ok := column.(systemcatalog.Column); ok {
+			if !c.IsNullable() {
+				definition += " NOT NULL"
+			}
+			if c.IsDimension() && c.DimensionType() != nil && *c.DimensionType() == "time" {
+				timeDimension = c.Name()
+			}
+		}
+		definitions = append(definitions, definition)
+
+		if column.IsPrimaryKey() {
+			keyColumns = append(keyColumns, pgx.Identifier{column.Name()}.Sanitize())
+		}
+	}
+	if len(keyColumns) > 0 {
+		definitions = append(definitions, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(keyColumns, ", ")))
+	}
+
+	connection, err := p.connect()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if _, err := connection.Exec(ctx, fmt.Sprintf(
+		"CREATE SCHEMA IF NOT EXISTS %s", pgx.Identifier{schemaName}.Sanitize(),
+	)); err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	if _, err := connection.Exec(ctx, fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (%s)", identifier, strings.Join(definitions, ", "),
+	)); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	p.logger.Infof("Created target table %s if not existing", identifier)
+
+	if _, ok := table.(*systemcatalog.Hypertable); !ok || !p.hypertables {
+		return nil
+	}
+
+	if timeDimension == "" {
+		p.logger.Warnf("Cannot create hypertable %s, no time dimension found", identifier)
+		return nil
+	}
+
+	var available bool
+	if err := connection.QueryRow(ctx,
+		"SELECT EXISTS(SELECT 1 FROM pg_catalog.pg_extension WHERE extname = 'timescaledb')",
+	).Scan(&available); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	if !available {
+		p.logger.Warnf("Cannot create hypertable %s, TimescaleDB isn't installed in the target", identifier)
+		return nil
+	}
+
+	if _, err := connection.Exec(ctx,
+		"SELECT create_hypertable($1::regclass, $2::name, if_not_exists => true, migrate_data => true)",
+		identifier, timeDimension,
+	); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return nil
+}
+
+// columnType returns the SQL type of the column, based on the
+// PostgreSQL type if the column definition is from the catalog
+func columnType(
+	column schema.ColumnAlike,
+) string {
+
+	if c, ok := column.(systemcatalog.Column); ok && c.PgType() != nil {
+		pgType := c.PgType()
+		elementType := pgType
+		if pgType.IsArray() {
+			elementType = pgType.ElementType()
+		}
+
+		typeName := elementType.Name()
+		if namespace := elementType.Namespace(); namespace != "" && namespace != "pg_catalog" {
+			typeName = pgx.Identifier{namespace, typeName}.Sanitize()
+		}
+
+		if length := c.MaxCharLength(); length != nil {
+			switch typeName {
+			case "varchar", "bpchar", "bit", "varbit":
+				typeName = fmt.Sprintf("%s(%d)", typeName, *length)
+			}
+		}
+
+		if pgType.IsArray() {
+			typeName += "[]"
+		}
+		return typeName
+	}
+
+	switch column.SchemaType() {
+	case schema.INT8, schema.INT16:
+		return "smallint"
+	case schema.INT32:
+		return "integer"
+	case schema.INT64:
+		return "bigint"
+	case schema.FLOAT32:
+		return "real"
+	case schema.FLOAT64:
+		return "double precision"
+	case schema.BOOLEAN:
+		return "boolean"
+	case schema.BYTES:
+		return "bytea"
+	case schema.MAP, schema.STRUCT:
+		return "jsonb"
+	default:
+		return "text"
+	}
+}
+
+// keyColumns returns the names of the key columns from
+// the key schema (see schema.KeySchema), which are used
+// as the conflict target of upserts
+func keyColumns(
+	key schema.Struct,
+) []string {
+
+	keySchema, _ := key[schema.FieldNameSchema].(schema.Struct)
+	fields, _ := keySchema[schema.FieldNameFields].([]schema.Struct)
+
+	// Fields are generated in the order of their index
+	columns := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if name, ok := field[schema.FieldNameName].(string); ok {
+			columns = append(columns, name)
+		}
+	}
+	return columns
+}
+
+func argument(
+	value any,
+) any {
+
+	// Values converted to maps (hstore, json) can't be
+	// encoded by pgx without type information
+	switch v := value.(type) {
+	case map[string]any:
+		if data, err := json.Marshal(v); err == nil {
+			return string(data)
+		}
+	}
+	return value
+}
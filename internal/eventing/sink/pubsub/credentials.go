@@ -0,0 +1,245 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pubsub
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/go-errors/errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	pubSubScope      = "https://www.googleapis.com/auth/pubsub"
+	metadataTokenUrl = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+// tokenSource provides OAuth2 access tokens for the Pub/Sub API
+type tokenSource interface {
+	token() (string, error)
+}
+
+type accessToken struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+	TokenType   string `json:"token_type"`
+}
+
+type serviceAccount struct {
+	Type         string `json:"type"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyId string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenUri     string `json:"token_uri"`
+}
+
+// cachingTokenSource caches access tokens until shortly before they expire
+type cachingTokenSource struct {
+	mutex   sync.Mutex
+	client  *http.Client
+	fetch   func(client *http.Client) (*accessToken, error)
+	current string
+	expiry  time.Time
+}
+
+func (c *cachingTokenSource) token() (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.current != "" && time.Now().Before(c.expiry) {
+		return c.current, nil
+	}
+
+	t, err := c.fetch(c.client)
+	if err != nil {
+		return "", err
+	}
+	c.current = t.AccessToken
+	c.expiry = time.Now().Add(time.Duration(t.ExpiresIn)*time.Second - time.Minute)
+	return c.current, nil
+}
+
+// newTokenSource creates a token source from a service account
+// credentials file, or, if not available, from the metadata server
+// of the compute environment (GCE, GKE, Cloud Run, ...)
+func newTokenSource(
+	client *http.Client, credentialsFile string,
+) (tokenSource, error) {
+
+	if credentialsFile == "" {
+		credentialsFile = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	}
+
+	if credentialsFile == "" {
+		return &cachingTokenSource{
+			client: client,
+			fetch:  fetchMetadataToken,
+		}, nil
+	}
+
+	data, err := os.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	account := serviceAccount{}
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil, errors.Errorf("Failed to parse credentials file '%s': %s", credentialsFile, err.Error())
+	}
+	if account.Type != "service_account" {
+		return nil, errors.Errorf("Credentials file '%s' isn't a service account key file", credentialsFile)
+	}
+
+	privateKey, err := parsePrivateKey(account.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenUri := account.TokenUri
+	if tokenUri == "" {
+		tokenUri = "https://oauth2.googleapis.com/token"
+	}
+
+	return &cachingTokenSource{
+		client: client,
+		fetch: func(client *http.Client) (*accessToken, error) {
+			assertion, err := signAssertion(account, tokenUri, privateKey)
+			if err != nil {
+				return nil, err
+			}
+			response, err := client.PostForm(tokenUri, url.Values{
+				"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+				"assertion":  {assertion},
+			})
+			if err != nil {
+				return nil, errors.Wrap(err, 0)
+			}
+			return readAccessToken(response)
+		},
+	}, nil
+}
+
+func fetchMetadataToken(
+	client *http.Client,
+) (*accessToken, error) {
+
+	request, err := http.NewRequest("GET", metadataTokenUrl, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	request.Header.Set("Metadata-Flavor", "Google")
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, errors.Errorf("Failed to request access token from metadata server: %s", err.Error())
+	}
+	return readAccessToken(response)
+}
+
+func readAccessToken(
+	response *http.Response,
+) (*accessToken, error) {
+
+	defer response.Body.Close()
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, errors.Errorf(
+			"Failed to retrieve access token with status %d: %s", response.StatusCode, strings.TrimSpace(string(data)),
+		)
+	}
+
+	t := &accessToken{}
+	if err := json.Unmarshal(data, t); err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	return t, nil
+}
+
+func signAssertion(
+	account serviceAccount, audience string, privateKey *rsa.PrivateKey,
+) (string, error) {
+
+	header, err := json.Marshal(map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+		"kid": account.PrivateKeyId,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, 0)
+	}
+
+	now := time.Now()
+	claims, err := json.Marshal(map[string]any{
+		"iss":   account.ClientEmail,
+		"scope": pubSubScope,
+		"aud":   audience,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", errors.Wrap(err, 0)
+	}
+
+	encoding := base64.RawURLEncoding
+	unsigned := encoding.EncodeToString(header) + "." + encoding.EncodeToString(claims)
+
+	hash := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", errors.Wrap(err, 0)
+	}
+	return unsigned + "." + encoding.EncodeToString(signature), nil
+}
+
+func parsePrivateKey(
+	privateKey string,
+) (*rsa.PrivateKey, error) {
+
+	block, _ := pem.Decode([]byte(privateKey))
+	if block == nil {
+		return nil, errors.Errorf("Service account private key isn't PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if rsaKey, ok := key.(*rsa.PrivateKey); ok {
+			return rsaKey, nil
+		}
+		return nil, errors.Errorf("Service account private key isn't an RSA key")
+	}
+
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Errorf("Failed to parse service account private key: %s", err.Error())
+	}
+	return key, nil
+}
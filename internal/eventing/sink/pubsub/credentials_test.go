@@ -0,0 +1,95 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pubsub
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func Test_Sign_Assertion(
+	t *testing.T,
+) {
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating key: %+v", err)
+	}
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("error encoding key: %+v", err)
+	}
+
+	parsedKey, err := parsePrivateKey(string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})))
+	if err != nil {
+		t.Fatalf("error parsing key: %+v", err)
+	}
+
+	account := serviceAccount{
+		Type:         "service_account",
+		ClientEmail:  "streamer@project.iam.gserviceaccount.com",
+		PrivateKeyId: "key-id",
+	}
+
+	assertion, err := signAssertion(account, "https://oauth2.googleapis.com/token", parsedKey)
+	if err != nil {
+		t.Fatalf("error signing assertion: %+v", err)
+	}
+
+	parts := strings.Split(assertion, ".")
+	if !assert.Len(t, parts, 3) {
+		return
+	}
+
+	claimsData, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatalf("error decoding claims: %+v", err)
+	}
+	claims := make(map[string]any)
+	if err := json.Unmarshal(claimsData, &claims); err != nil {
+		t.Fatalf("error parsing claims: %+v", err)
+	}
+	assert.Equal(t, account.ClientEmail, claims["iss"])
+	assert.Equal(t, pubSubScope, claims["scope"])
+	assert.Equal(t, "https://oauth2.googleapis.com/token", claims["aud"])
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatalf("error decoding signature: %+v", err)
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	assert.NoError(t, rsa.VerifyPKCS1v15(&privateKey.PublicKey, crypto.SHA256, hash[:], signature))
+}
+
+func Test_Parse_Private_Key_Not_PEM(
+	t *testing.T,
+) {
+
+	_, err := parsePrivateKey("not a key")
+	assert.ErrorContains(t, err, "isn't PEM encoded")
+}
@@ -0,0 +1,266 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pubsub
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"github.com/go-errors/errors"
+	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	pubSubEndpoint     = "https://pubsub.googleapis.com"
+	topicAttributeName = "topic"
+	maxOrderingKeySize = 1024
+)
+
+func init() {
+	sinkimpl.RegisterSink(config.PubSub, newPubSubSink)
+}
+
+// publishRequest and pubsubMessage follow the
+// message format of the Pub/Sub REST API
+type publishRequest struct {
+	Messages []pubsubMessage `json:"messages"`
+}
+
+type pubsubMessage struct {
+	Data        string            `json:"data"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+	OrderingKey string            `json:"orderingKey,omitempty"`
+}
+
+type pubSubSink struct {
+	mutex         sync.Mutex
+	logger        *logging.Logger
+	client        *http.Client
+	encoder       *encoding.JsonEncoder
+	tokenSource   tokenSource
+	endpoint      string
+	projectId     string
+	fixedTopic    string
+	createTopics  bool
+	createdTopics map[string]bool
+}
+
+func newPubSubSink(
+	c *config.Config,
+) (sink.Sink, error) {
+
+	logger, err := logging.NewLogger("PubSubSink")
+	if err != nil {
+		return nil, err
+	}
+
+	projectId := config.GetOrDefault(c, config.PropertyPubSubProjectId, "")
+	if projectId == "" {
+		return nil, errors.Errorf("Pub/Sub sink needs the project id to be configured")
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	// Like the official clients, the emulator is used when the
+	// environment variable PUBSUB_EMULATOR_HOST is set
+	emulatorHost := config.GetOrDefault(c, config.PropertyPubSubEmulatorHost, os.Getenv("PUBSUB_EMULATOR_HOST"))
+
+	endpoint := pubSubEndpoint
+	var source tokenSource
+	if emulatorHost != "" {
+		endpoint = "http://" + strings.TrimPrefix(emulatorHost, "http://")
+	} else {
+		source, err = newTokenSource(client, config.GetOrDefault(c, config.PropertyPubSubCredentialsFile, ""))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &pubSubSink{
+		logger:        logger,
+		client:        client,
+		encoder:       encoding.NewJsonEncoderWithConfig(c),
+		tokenSource:   source,
+		endpoint:      strings.TrimSuffix(endpoint, "/"),
+		projectId:     projectId,
+		fixedTopic:    config.GetOrDefault(c, config.PropertyPubSubTopicName, ""),
+		createTopics:  config.GetOrDefault(c, config.PropertyPubSubTopicCreate, false),
+		createdTopics: make(map[string]bool),
+	}, nil
+}
+
+func (p *pubSubSink) Start() error {
+	p.logger.Infof("Starting PubSubSink for project %s at %s", p.projectId, p.endpoint)
+	if p.fixedTopic != "" && p.createTopics {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		return p.ensureTopic(p.fixedTopic)
+	}
+	return nil
+}
+
+func (p *pubSubSink) Stop() error {
+	p.client.CloseIdleConnections()
+	return nil
+}
+
+func (p *pubSubSink) Emit(
+	_ sink.Context, _ time.Time, topicName string, key, envelope schema.Struct,
+) error {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	envelopeData, err := p.encoder.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	orderingKey, err := p.orderingKey(key)
+	if err != nil {
+		return err
+	}
+
+	targetTopic := topicName
+	if p.fixedTopic != "" {
+		targetTopic = p.fixedTopic
+	}
+
+	if p.createTopics {
+		if err := p.ensureTopic(targetTopic); err != nil {
+			return err
+		}
+	}
+
+	request := publishRequest{
+		Messages: []pubsubMessage{{
+			Data: base64.StdEncoding.EncodeToString(envelopeData),
+			Attributes: map[string]string{
+				topicAttributeName: topicName,
+			},
+			OrderingKey: orderingKey,
+		}},
+	}
+
+	body, err := p.encoder.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.execute("POST", fmt.Sprintf("%s:publish", p.topicPath(targetTopic)), body)
+	return err
+}
+
+// orderingKey derives the ordering key from the event key values, which
+// keeps the per-row ordering for subscriptions with message ordering enabled
+func (p *pubSubSink) orderingKey(
+	key schema.Struct,
+) (string, error) {
+
+	values, ok := key[schema.FieldNamePayload].(schema.Struct)
+	if !ok || len(values) == 0 {
+		return "", nil
+	}
+
+	keyData, err := p.encoder.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+
+	// Ordering keys are limited in size, larger keys are hashed
+	if len(keyData) > maxOrderingKeySize {
+		return fmt.Sprintf("%X", sha256.Sum256(keyData)), nil
+	}
+	return string(keyData), nil
+}
+
+func (p *pubSubSink) ensureTopic(
+	topicName string,
+) error {
+
+	if p.createdTopics[topicName] {
+		return nil
+	}
+
+	status, err := p.execute("PUT", p.topicPath(topicName), []byte("{}"))
+	if err != nil && status != http.StatusConflict {
+		return err
+	}
+	if status != http.StatusConflict {
+		p.logger.Infof("Created topic %s", topicName)
+	}
+	p.createdTopics[topicName] = true
+	return nil
+}
+
+func (p *pubSubSink) topicPath(
+	topicName string,
+) string {
+
+	return fmt.Sprintf(
+		"/v1/projects/%s/topics/%s", url.PathEscape(p.projectId), url.PathEscape(topicName),
+	)
+}
+
+func (p *pubSubSink) execute(
+	method, path string, body []byte,
+) (int, error) {
+
+	request, err := http.NewRequest(method, p.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, errors.Wrap(err, 0)
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	if p.tokenSource != nil {
+		token, err := p.tokenSource.token()
+		if err != nil {
+			return 0, err
+		}
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		return 0, errors.Wrap(err, 0)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		return response.StatusCode, errors.Errorf(
+			"Pub/Sub request %s %s failed with status %d: %s",
+			method, path, response.StatusCode, strings.TrimSpace(string(message)),
+		)
+	}
+	_, _ = io.Copy(io.Discard, response.Body)
+	return response.StatusCode, nil
+}
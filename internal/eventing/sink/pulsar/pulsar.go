@@ -0,0 +1,251 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pulsar
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"github.com/go-errors/errors"
+	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/internal/tlsconfig"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"golang.org/x/net/websocket"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	sinkimpl.RegisterSink(config.Pulsar, newPulsarSink)
+}
+
+// producerMessage and producerResponse follow the message
+// format of the Pulsar WebSocket producer API
+type producerMessage struct {
+	Payload    string            `json:"payload"`
+	Key        string            `json:"key,omitempty"`
+	Properties map[string]string `json:"properties,omitempty"`
+	Context    string            `json:"context"`
+}
+
+type producerResponse struct {
+	Result    string `json:"result"`
+	MessageId string `json:"messageId"`
+	ErrorMsg  string `json:"errorMsg"`
+	Context   string `json:"context"`
+}
+
+type pulsarProducer struct {
+	connection *websocket.Conn
+	sequence   uint64
+}
+
+type pulsarSink struct {
+	mutex       sync.Mutex
+	encoder     *encoding.JsonEncoder
+	url         string
+	topicDomain string
+	tenant      string
+	namespace   string
+	token       string
+	tlsConfig   *tls.Config
+	timeout     time.Duration
+	producers   map[string]*pulsarProducer
+}
+
+func newPulsarSink(
+	c *config.Config,
+) (sink.Sink, error) {
+
+	address := strings.TrimSuffix(config.GetOrDefault(c, config.PropertyPulsarUrl, "ws://localhost:8080"), "/")
+	if !strings.HasPrefix(address, "ws://") && !strings.HasPrefix(address, "wss://") {
+		return nil, errors.Errorf("Pulsar url '%s' must use the ws:// or wss:// scheme", address)
+	}
+
+	var tlsConfig *tls.Config
+	if strings.HasPrefix(address, "wss://") {
+		var err error
+		if tlsConfig, err = tlsconfig.NewTLSConfig(c, config.PropertyPulsarTls); err != nil {
+			return nil, err
+		}
+	}
+
+	topicDomain := "persistent"
+	if !config.GetOrDefault(c, config.PropertyPulsarPersistent, true) {
+		topicDomain = "non-persistent"
+	}
+
+	return &pulsarSink{
+		encoder:     encoding.NewJsonEncoderWithConfig(c),
+		url:         address,
+		topicDomain: topicDomain,
+		tenant:      config.GetOrDefault(c, config.PropertyPulsarTenant, "public"),
+		namespace:   config.GetOrDefault(c, config.PropertyPulsarNamespace, "default"),
+		token:       config.GetOrDefault(c, config.PropertyPulsarAuthenticationToken, ""),
+		tlsConfig:   tlsConfig,
+		timeout: time.Duration(
+			config.GetOrDefault(c, config.PropertyPulsarTimeout, 30),
+		) * time.Second,
+		producers: make(map[string]*pulsarProducer),
+	}, nil
+}
+
+func (p *pulsarSink) Start() error {
+	return nil
+}
+
+func (p *pulsarSink) Stop() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var lastErr error
+	for topicName, producer := range p.producers {
+		if err := producer.connection.Close(); err != nil {
+			lastErr = err
+		}
+		delete(p.producers, topicName)
+	}
+	return lastErr
+}
+
+func (p *pulsarSink) Emit(
+	_ sink.Context, _ time.Time, topicName string, key, envelope schema.Struct,
+) error {
+
+	keyData, err := p.encoder.Marshal(key)
+	if err != nil {
+		return err
+	}
+	envelopeData, err := p.encoder.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	producer, err := p.producer(topicName)
+	if err != nil {
+		return err
+	}
+
+	producer.sequence++
+	messageContext := strconv.FormatUint(producer.sequence, 10)
+
+	// The event key is used as the message key, which keeps
+	// the per-row ordering for Key_Shared subscriptions
+	message := producerMessage{
+		Payload: base64.StdEncoding.EncodeToString(envelopeData),
+		Key:     string(keyData),
+		Properties: map[string]string{
+			"content-type": "application/json",
+		},
+		Context: messageContext,
+	}
+
+	response, err := p.send(producer, message)
+	if err != nil {
+		// The connection state is unknown, force a reconnect on retry
+		p.closeProducer(topicName, producer)
+		return err
+	}
+
+	if response.Context != messageContext {
+		p.closeProducer(topicName, producer)
+		return errors.Errorf(
+			"Pulsar producer for topic '%s' received a response for an unexpected message", topicName,
+		)
+	}
+
+	if response.Result != "ok" {
+		return errors.Errorf(
+			"Pulsar rejected message for topic '%s': %s %s", topicName, response.Result, response.ErrorMsg,
+		)
+	}
+	return nil
+}
+
+func (p *pulsarSink) send(
+	producer *pulsarProducer, message producerMessage,
+) (*producerResponse, error) {
+
+	if err := producer.connection.SetDeadline(time.Now().Add(p.timeout)); err != nil {
+		return nil, err
+	}
+
+	if err := websocket.JSON.Send(producer.connection, message); err != nil {
+		return nil, err
+	}
+
+	response := &producerResponse{}
+	if err := websocket.JSON.Receive(producer.connection, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (p *pulsarSink) producer(
+	topicName string,
+) (*pulsarProducer, error) {
+
+	if producer, present := p.producers[topicName]; present {
+		return producer, nil
+	}
+
+	location := fmt.Sprintf(
+		"%s/ws/v2/producer/%s/%s/%s/%s",
+		p.url, p.topicDomain, url.PathEscape(p.tenant), url.PathEscape(p.namespace), url.PathEscape(topicName),
+	)
+
+	origin := strings.Replace(p.url, "ws", "http", 1)
+	websocketConfig, err := websocket.NewConfig(location, origin)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	websocketConfig.TlsConfig = p.tlsConfig
+	websocketConfig.Dialer = &net.Dialer{Timeout: p.timeout}
+	if p.token != "" {
+		websocketConfig.Header.Set("Authorization", fmt.Sprintf("Bearer %s", p.token))
+	}
+
+	connection, err := websocket.DialConfig(websocketConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	producer := &pulsarProducer{
+		connection: connection,
+	}
+	p.producers[topicName] = producer
+	return producer, nil
+}
+
+func (p *pulsarSink) closeProducer(
+	topicName string, producer *pulsarProducer,
+) {
+
+	producer.connection.Close()
+	delete(p.producers, topicName)
+}
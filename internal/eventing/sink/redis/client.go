@@ -0,0 +1,196 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package redis
+
+import (
+	"github.com/cenkalti/backoff/v4"
+	"github.com/go-errors/errors"
+	"github.com/go-redis/redis"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// transientErrorPrefixes are the error replies of a Redis server, which
+// is restarting, or of a former master, which was demoted in a failover
+var transientErrorPrefixes = []string{
+	"LOADING ", "READONLY ", "MASTERDOWN ", "CLUSTERDOWN ", "TRYAGAIN ",
+	"ERR max number of clients reached",
+	"redis: all sentinels are unreachable",
+	"redis: connection pool timeout",
+}
+
+// newClient creates a client for either a single node, a Sentinel
+// managed master, which is followed on failovers, or a Redis Cluster
+func newClient(
+	c *config.Config, options *redis.Options,
+) (redis.UniversalClient, error) {
+
+	masterName := config.GetOrDefault(c, config.PropertyRedisSentinelMasterName, "")
+	clusterEnabled := config.GetOrDefault(c, config.PropertyRedisClusterEnabled, false)
+
+	if masterName != "" && clusterEnabled {
+		return nil, errors.Errorf("redis sink supports either sentinel or cluster, not both")
+	}
+
+	if masterName != "" {
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName: masterName,
+			SentinelAddrs: config.GetOrDefault(
+				c, config.PropertyRedisSentinelAddresses, []string{"localhost:26379"},
+			),
+			Password:        options.Password,
+			DB:              options.DB,
+			MaxRetries:      options.MaxRetries,
+			MinRetryBackoff: options.MinRetryBackoff,
+			MaxRetryBackoff: options.MaxRetryBackoff,
+			DialTimeout:     options.DialTimeout,
+			ReadTimeout:     options.ReadTimeout,
+			WriteTimeout:    options.WriteTimeout,
+			PoolSize:        options.PoolSize,
+			PoolTimeout:     options.PoolTimeout,
+			IdleTimeout:     options.IdleTimeout,
+			TLSConfig:       options.TLSConfig,
+		}), nil
+	}
+
+	if clusterEnabled {
+		if options.DB != 0 {
+			return nil, errors.Errorf("redis cluster doesn't support selecting a database")
+		}
+
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs: config.GetOrDefault(
+				c, config.PropertyRedisClusterAddresses, []string{options.Addr},
+			),
+			MaxRedirects: config.GetOrDefault(
+				c, config.PropertyRedisClusterMaxRedirects, 8,
+			),
+			Password:        options.Password,
+			MaxRetries:      options.MaxRetries,
+			MinRetryBackoff: options.MinRetryBackoff,
+			MaxRetryBackoff: options.MaxRetryBackoff,
+			DialTimeout:     options.DialTimeout,
+			ReadTimeout:     options.ReadTimeout,
+			WriteTimeout:    options.WriteTimeout,
+			PoolSize:        options.PoolSize,
+			PoolTimeout:     options.PoolTimeout,
+			IdleTimeout:     options.IdleTimeout,
+			TLSConfig:       options.TLSConfig,
+		}), nil
+	}
+
+	return redis.NewClient(options), nil
+}
+
+// withRetry retries the operation on transient errors, like during
+// a failover, until the retry timeout elapses. The events are only
+// acknowledged after the operation succeeded, hence a failing
+// operation is handed back to the sink manager and isn't lost
+func (r *redisSink) withRetry(
+	operation func() error,
+) error {
+
+	if r.retryTimeout <= 0 {
+		return operation()
+	}
+
+	backOff := backoff.NewExponentialBackOff()
+	backOff.MaxElapsedTime = r.retryTimeout
+
+	return backoff.RetryNotify(
+		func() error {
+			if err := operation(); err != nil {
+				if isTransientError(err) {
+					return err
+				}
+				return backoff.Permanent(err)
+			}
+			return nil
+		},
+		backOff,
+		func(err error, wait time.Duration) {
+			r.logger.Warnf("Redis command failed, retrying in %s: %s", wait, err.Error())
+		},
+	)
+}
+
+// hashTag wraps the name into a hash tag, if enabled, so that all keys
+// derived from the same topic are placed in the same cluster slot
+func (r *redisSink) hashTag(
+	name string,
+) string {
+
+	if !r.hashTags || hasHashTag(name) {
+		return name
+	}
+	return "{" + name + "}"
+}
+
+func hasHashTag(
+	name string,
+) bool {
+
+	start := strings.IndexByte(name, '{')
+	if start == -1 {
+		return false
+	}
+	end := strings.IndexByte(name[start+1:], '}')
+	return end > 0
+}
+
+// slotKey returns the part of the key Redis Cluster hashes to
+// select the slot, which is the hash tag, if the key has one
+func slotKey(
+	name string,
+) string {
+
+	start := strings.IndexByte(name, '{')
+	if start == -1 {
+		return name
+	}
+	end := strings.IndexByte(name[start+1:], '}')
+	if end <= 0 {
+		return name
+	}
+	return name[start+1 : start+1+end]
+}
+
+func isTransientError(
+	err error,
+) bool {
+
+	if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	message := err.Error()
+	for _, prefix := range transientErrorPrefixes {
+		if strings.HasPrefix(message, prefix) {
+			return true
+		}
+	}
+	return false
+}
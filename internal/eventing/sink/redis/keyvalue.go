@@ -0,0 +1,235 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package redis
+
+import (
+	"encoding/json"
+	"github.com/go-errors/errors"
+	"github.com/go-redis/redis"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var keyPlaceholder = regexp.MustCompile(`\{(topic|schema|table|key(\.[^{}]+)?)}`)
+
+// materialize keeps the latest row image per primary key, either
+// as a hash or a JSON string, and deletes it on delete events
+func (r *redisSink) materialize(
+	topicName string, key, envelope schema.Struct,
+) error {
+
+	payload, _ := envelope[schema.FieldNamePayload].(schema.Struct)
+	operation, _ := payload[schema.FieldNameOperation].(string)
+	source, _ := payload[schema.FieldNameSource].(schema.Struct)
+	keyPayload, _ := key[schema.FieldNamePayload].(schema.Struct)
+
+	switch schema.Operation(operation) {
+	case schema.OP_READ, schema.OP_CREATE, schema.OP_UPDATE, schema.OP_DELETE:
+	default:
+		r.logger.Debugf("Ignoring event with operation '%s' on topic %s", operation, topicName)
+		return nil
+	}
+
+	// Rows of tables without primary key can't be identified
+	if len(keyPayload) == 0 {
+		r.logger.Debugf("Ignoring event without key on topic %s", topicName)
+		return nil
+	}
+
+	columns := keyColumns(key)
+	redisKey, err := r.renderKey(topicName, source, columns, keyPayload)
+	if err != nil {
+		return err
+	}
+
+	if schema.Operation(operation) == schema.OP_DELETE {
+		return r.client.Del(redisKey).Err()
+	}
+
+	// With a changed primary key the previous row image has to be
+	// removed, which requires the before image (replica identity full)
+	staleKey := ""
+	if before, ok := payload[schema.FieldNameBefore].(schema.Struct); ok && len(before) > 0 {
+		previousKey, err := r.renderKey(topicName, source, columns, before)
+		if err == nil && previousKey != redisKey {
+			staleKey = previousKey
+		}
+	}
+
+	after, _ := payload[schema.FieldNameAfter].(schema.Struct)
+	var fields map[string]any
+	var value string
+	if r.keyValueFormat == config.RedisHashFormat {
+		if fields, err = r.hashFields(after); err != nil {
+			return err
+		}
+	} else {
+		data, err := r.encoder.Marshal(after)
+		if err != nil {
+			return err
+		}
+		value = string(data)
+	}
+
+	// A transaction must not span multiple cluster slots, a stale key
+	// hashed to another slot is removed ahead of the transaction
+	if staleKey != "" && r.cluster && slotKey(staleKey) != slotKey(redisKey) {
+		if err := r.client.Del(staleKey).Err(); err != nil {
+			return err
+		}
+		staleKey = ""
+	}
+
+	_, err = r.client.TxPipelined(func(pipeliner redis.Pipeliner) error {
+		if staleKey != "" {
+			pipeliner.Del(staleKey)
+		}
+		if r.keyValueFormat == config.RedisJsonFormat {
+			pipeliner.Set(redisKey, value, 0)
+			return nil
+		}
+
+		// Replacing the hash removes fields of columns set to null
+		pipeliner.Del(redisKey)
+		if len(fields) > 0 {
+			pipeliner.HMSet(redisKey, fields)
+		}
+		return nil
+	})
+	return err
+}
+
+// renderKey builds the Redis key from the key template, the
+// {key} placeholder is replaced by the values of all key columns
+// separated by colons, {key.<column>} by the value of a single one
+func (r *redisSink) renderKey(
+	topicName string, source schema.Struct, columns []string, row schema.Struct,
+) (string, error) {
+
+	var err error
+	redisKey := keyPlaceholder.ReplaceAllStringFunc(r.keyTemplate, func(placeholder string) string {
+		name := placeholder[1 : len(placeholder)-1]
+		switch {
+		case name == "topic":
+			return r.hashTag(topicName)
+		case name == "schema" || name == "table":
+			value, _ := source[name].(string)
+			return value
+		case name == "key":
+			values := make([]string, 0, len(columns))
+			for _, column := range columns {
+				value, present := row[column]
+				if !present {
+					err = errors.Errorf("key column '%s' is missing in the row", column)
+					return ""
+				}
+				values = append(values, r.formatValue(value))
+			}
+			return strings.Join(values, ":")
+		default:
+			column := strings.TrimPrefix(name, "key.")
+			value, present := row[column]
+			if !present {
+				err = errors.Errorf("key column '%s' of the key template is missing in the row", column)
+				return ""
+			}
+			return r.formatValue(value)
+		}
+	})
+	if err != nil {
+		// A template referencing unknown columns won't get any better by retrying
+		return "", sink.NewPermanentError(err)
+	}
+	return redisKey, nil
+}
+
+func (r *redisSink) hashFields(
+	row schema.Struct,
+) (map[string]any, error) {
+
+	fields := make(map[string]any, len(row))
+	for column, value := range row {
+		if value == nil {
+			continue
+		}
+		if _, ok := value.(string); ok {
+			fields[column] = value
+			continue
+		}
+		data, err := r.encoder.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		fields[column] = string(data)
+	}
+	return fields, nil
+}
+
+func (r *redisSink) formatValue(
+	value any,
+) string {
+
+	if s, ok := value.(string); ok {
+		return s
+	}
+	if value == nil {
+		return ""
+	}
+
+	data, err := r.encoder.Marshal(value)
+	if err != nil {
+		return ""
+	}
+
+	// Values encoded as JSON strings, like timestamps, are used unquoted
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		return s
+	}
+	return string(data)
+}
+
+// keyColumns returns the key columns in the order of the key
+// schema, or sorted by name if the key doesn't carry a schema
+func keyColumns(
+	key schema.Struct,
+) []string {
+
+	keySchema, _ := key[schema.FieldNameSchema].(schema.Struct)
+	if fields, ok := keySchema[schema.FieldNameFields].([]schema.Struct); ok && len(fields) > 0 {
+		columns := make([]string, 0, len(fields))
+		for _, field := range fields {
+			if column, ok := field[schema.FieldNameName].(string); ok {
+				columns = append(columns, column)
+			}
+		}
+		return columns
+	}
+
+	keyPayload, _ := key[schema.FieldNamePayload].(schema.Struct)
+	columns := make([]string, 0, len(keyPayload))
+	for column := range keyPayload {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	return columns
+}
@@ -18,9 +18,12 @@
 package redis
 
 import (
-	"crypto/tls"
+	"fmt"
+	"github.com/go-errors/errors"
 	"github.com/go-redis/redis"
 	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/internal/tlsconfig"
 	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
 	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
 	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
@@ -33,14 +36,29 @@ func init() {
 }
 
 type redisSink struct {
-	client  *redis.Client
-	encoder *encoding.JsonEncoder
+	logger          *logging.Logger
+	client          redis.UniversalClient
+	encoder         *encoding.JsonEncoder
+	cluster         bool
+	hashTags        bool
+	retryTimeout    time.Duration
+	mode            config.RedisMode
+	trimMaxLen      int
+	trimMaxAge      time.Duration
+	trimApproximate bool
+	keyValueFormat  config.RedisKeyValueFormat
+	keyTemplate     string
 }
 
 func newRedisSink(
 	c *config.Config,
 ) (sink.Sink, error) {
 
+	logger, err := logging.NewLogger("RedisSink")
+	if err != nil {
+		return nil, err
+	}
+
 	options := &redis.Options{
 		Network: config.GetOrDefault(
 			c, config.PropertyRedisNetwork, "tcp",
@@ -84,19 +102,53 @@ func newRedisSink(
 	}
 
 	if c.Sink.Redis.TLS.Enabled {
-		options.TLSConfig = &tls.Config{
-			InsecureSkipVerify: config.GetOrDefault(
-				c, config.PropertyRedisTlsSkipVerify, false,
-			),
-			ClientAuth: config.GetOrDefault(
-				c, config.PropertyRedisTlsClientAuth, tls.NoClientCert,
-			),
+		tlsConfig, err := tlsconfig.NewTLSConfig(c, config.PropertyRedisTls)
+		if err != nil {
+			return nil, err
 		}
+		options.TLSConfig = tlsConfig
+	}
+
+	client, err := newClient(c, options)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := config.GetOrDefault(c, config.PropertyRedisMode, config.RedisStreamMode)
+	switch mode {
+	case config.RedisStreamMode, config.RedisPublishMode, config.RedisKeyValueMode:
+	default:
+		return nil, errors.Errorf("redis mode '%s' doesn't exist", mode)
+	}
+
+	trimMaxLen := config.GetOrDefault(c, config.PropertyRedisStreamTrimMaxLen, 0)
+	trimMaxAge := config.GetOrDefault(c, config.PropertyRedisStreamTrimMaxAge, 0)
+	if trimMaxLen > 0 && trimMaxAge > 0 {
+		return nil, errors.Errorf("redis stream trimming supports either maxlen or maxage, not both")
+	}
+
+	keyValueFormat := config.GetOrDefault(c, config.PropertyRedisKeyValueFormat, config.RedisJsonFormat)
+	switch keyValueFormat {
+	case config.RedisJsonFormat, config.RedisHashFormat:
+	default:
+		return nil, errors.Errorf("redis key-value format '%s' doesn't exist", keyValueFormat)
 	}
 
+	cluster := config.GetOrDefault(c, config.PropertyRedisClusterEnabled, false)
+
 	return &redisSink{
-		client:  redis.NewClient(options),
-		encoder: encoding.NewJsonEncoderWithConfig(c),
+		logger:          logger,
+		client:          client,
+		encoder:         encoding.NewJsonEncoderWithConfig(c),
+		cluster:         cluster,
+		hashTags:        cluster && config.GetOrDefault(c, config.PropertyRedisClusterHashTags, true),
+		retryTimeout:    time.Duration(config.GetOrDefault(c, config.PropertyRedisRetriesTimeout, 30)) * time.Second,
+		mode:            mode,
+		trimMaxLen:      trimMaxLen,
+		trimMaxAge:      time.Duration(trimMaxAge) * time.Second,
+		trimApproximate: config.GetOrDefault(c, config.PropertyRedisStreamTrimApproximate, true),
+		keyValueFormat:  keyValueFormat,
+		keyTemplate:     config.GetOrDefault(c, config.PropertyRedisKeyValueKey, "{topic}:{key}"),
 	}, nil
 }
 
@@ -112,6 +164,22 @@ func (r *redisSink) Emit(
 	_ sink.Context, _ time.Time, topicName string, key, envelope schema.Struct,
 ) error {
 
+	return r.withRetry(func() error {
+		switch r.mode {
+		case config.RedisPublishMode:
+			return r.publish(topicName, envelope)
+		case config.RedisKeyValueMode:
+			return r.materialize(topicName, key, envelope)
+		default:
+			return r.appendToStream(topicName, key, envelope)
+		}
+	})
+}
+
+func (r *redisSink) appendToStream(
+	topicName string, key, envelope schema.Struct,
+) error {
+
 	keyData, err := r.encoder.Marshal(key)
 	if err != nil {
 		return err
@@ -121,11 +189,51 @@ func (r *redisSink) Emit(
 		return err
 	}
 
-	return r.client.XAdd(&redis.XAddArgs{
-		Stream: topicName,
-		Values: map[string]any{
-			"key":      string(keyData),
-			"envelope": string(envelopeData),
-		},
-	}).Err()
+	// XAddArgs doesn't support MINID, therefore the command is built manually
+	args := []any{"XADD", r.hashTag(topicName)}
+	args = append(args, r.trimArgs(time.Now())...)
+	args = append(args, "*", "key", string(keyData), "envelope", string(envelopeData))
+
+	cmd := redis.NewCmd(args...)
+	if err := r.client.Process(cmd); err != nil {
+		return err
+	}
+	return cmd.Err()
+}
+
+// trimArgs provides the trimming strategy of XADD, streams are either
+// trimmed to a maximum number of entries, or by the minimal entry id,
+// which is derived from the maximum age of the entries
+func (r *redisSink) trimArgs(
+	now time.Time,
+) []any {
+
+	var args []any
+	var threshold any
+	switch {
+	case r.trimMaxLen > 0:
+		args = []any{"MAXLEN"}
+		threshold = r.trimMaxLen
+	case r.trimMaxAge > 0:
+		args = []any{"MINID"}
+		threshold = fmt.Sprintf("%d", now.Add(-r.trimMaxAge).UnixMilli())
+	default:
+		return nil
+	}
+
+	if r.trimApproximate {
+		args = append(args, "~")
+	}
+	return append(args, threshold)
+}
+
+func (r *redisSink) publish(
+	topicName string, envelope schema.Struct,
+) error {
+
+	envelopeData, err := r.encoder.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	return r.client.Publish(topicName, string(envelopeData)).Err()
 }
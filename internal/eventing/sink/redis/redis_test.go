@@ -0,0 +1,281 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package redis
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/go-redis/redis"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func newTestSink(
+	t *testing.T, configurator func(c *spiconfig.Config),
+) *redisSink {
+
+	config := &spiconfig.Config{
+		Sink: spiconfig.SinkConfig{
+			Type: spiconfig.Redis,
+		},
+	}
+	if configurator != nil {
+		configurator(config)
+	}
+
+	s, err := newRedisSink(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.(*redisSink)
+}
+
+func newKey(
+	columns []string, values schema.Struct,
+) schema.Struct {
+
+	// Same layout as the key schemas generated by schema.KeySchema
+	fields := make([]schema.Struct, 0, len(columns))
+	for i, column := range columns {
+		fields = append(fields, schema.Struct{
+			schema.FieldNameName:  column,
+			schema.FieldNameIndex: i,
+		})
+	}
+	return schema.Struct{
+		schema.FieldNameSchema: schema.Struct{
+			schema.FieldNameFields: fields,
+		},
+		schema.FieldNamePayload: values,
+	}
+}
+
+func Test_Redis_Sink_Trim_Args(
+	t *testing.T,
+) {
+
+	now := time.UnixMilli(1700000000000)
+
+	s := newTestSink(t, nil)
+	assert.Nil(t, s.trimArgs(now))
+
+	s = newTestSink(t, func(c *spiconfig.Config) {
+		c.Sink.Redis.Stream.Trim.MaxLen = lo.ToPtr(1000)
+	})
+	assert.Equal(t, []any{"MAXLEN", "~", 1000}, s.trimArgs(now))
+
+	s = newTestSink(t, func(c *spiconfig.Config) {
+		c.Sink.Redis.Stream.Trim.MaxAge = lo.ToPtr(60)
+		c.Sink.Redis.Stream.Trim.Approximate = lo.ToPtr(false)
+	})
+	assert.Equal(t, []any{"MINID", "1699999940000"}, s.trimArgs(now))
+}
+
+func Test_Redis_Sink_Trim_Exclusive(
+	t *testing.T,
+) {
+
+	config := &spiconfig.Config{}
+	config.Sink.Redis.Stream.Trim.MaxLen = lo.ToPtr(1000)
+	config.Sink.Redis.Stream.Trim.MaxAge = lo.ToPtr(60)
+
+	_, err := newRedisSink(config)
+	assert.Error(t, err)
+}
+
+func Test_Redis_Sink_Key_Columns(
+	t *testing.T,
+) {
+
+	key := newKey([]string{"ts", "device"}, schema.Struct{"device": "a", "ts": 1})
+	assert.Equal(t, []string{"ts", "device"}, keyColumns(key))
+
+	// Without key schema the columns are sorted by name
+	key = schema.Struct{
+		schema.FieldNamePayload: schema.Struct{"ts": 1, "device": "a"},
+	}
+	assert.Equal(t, []string{"device", "ts"}, keyColumns(key))
+}
+
+func Test_Redis_Sink_Render_Key(
+	t *testing.T,
+) {
+
+	source := schema.Struct{
+		schema.FieldNameSchema: "public",
+		schema.FieldNameTable:  "metrics",
+	}
+	row := schema.Struct{"ts": 1, "device": "a", "value": 1.5}
+	columns := []string{"ts", "device"}
+
+	s := newTestSink(t, nil)
+	key, err := s.renderKey("ts.public.metrics", source, columns, row)
+	assert.NoError(t, err)
+	assert.Equal(t, "ts.public.metrics:1:a", key)
+
+	s = newTestSink(t, func(c *spiconfig.Config) {
+		c.Sink.Redis.KeyValue.Key = "{schema}.{table}:{key.device}"
+	})
+	key, err = s.renderKey("ts.public.metrics", source, columns, row)
+	assert.NoError(t, err)
+	assert.Equal(t, "public.metrics:a", key)
+
+	s = newTestSink(t, func(c *spiconfig.Config) {
+		c.Sink.Redis.KeyValue.Key = "{table}:{key.unknown}"
+	})
+	_, err = s.renderKey("ts.public.metrics", source, columns, row)
+	assert.Error(t, err)
+	assert.True(t, sink.IsPermanentError(err))
+}
+
+func Test_Redis_Sink_Hash_Fields(
+	t *testing.T,
+) {
+
+	s := newTestSink(t, func(c *spiconfig.Config) {
+		c.Sink.Redis.KeyValue.Format = spiconfig.RedisHashFormat
+	})
+
+	fields, err := s.hashFields(schema.Struct{
+		"device": "a",
+		"value":  1.5,
+		"tags":   []string{"x", "y"},
+		"unset":  nil,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"device": "a",
+		"value":  "1.5",
+		"tags":   `["x","y"]`,
+	}, fields)
+}
+
+func Test_Redis_Sink_Client_Types(
+	t *testing.T,
+) {
+
+	s := newTestSink(t, nil)
+	assert.IsType(t, &redis.Client{}, s.client)
+
+	s = newTestSink(t, func(c *spiconfig.Config) {
+		c.Sink.Redis.Cluster.Enabled = true
+		c.Sink.Redis.Cluster.Addresses = []string{"localhost:7000", "localhost:7001"}
+	})
+	assert.IsType(t, &redis.ClusterClient{}, s.client)
+
+	s = newTestSink(t, func(c *spiconfig.Config) {
+		c.Sink.Redis.Sentinel.MasterName = "mymaster"
+		c.Sink.Redis.Sentinel.Addresses = []string{"localhost:26379"}
+	})
+	assert.IsType(t, &redis.Client{}, s.client)
+
+	config := &spiconfig.Config{}
+	config.Sink.Redis.Cluster.Enabled = true
+	config.Sink.Redis.Sentinel.MasterName = "mymaster"
+	_, err := newRedisSink(config)
+	assert.Error(t, err)
+
+	config = &spiconfig.Config{}
+	config.Sink.Redis.Cluster.Enabled = true
+	config.Sink.Redis.Database = 1
+	_, err = newRedisSink(config)
+	assert.Error(t, err)
+}
+
+func Test_Redis_Sink_Hash_Tags(
+	t *testing.T,
+) {
+
+	s := newTestSink(t, nil)
+	assert.Equal(t, "ts.public.metrics", s.hashTag("ts.public.metrics"))
+
+	s = newTestSink(t, func(c *spiconfig.Config) {
+		c.Sink.Redis.Cluster.Enabled = true
+	})
+	assert.Equal(t, "{ts.public.metrics}", s.hashTag("ts.public.metrics"))
+	assert.Equal(t, "{ts}.public.metrics", s.hashTag("{ts}.public.metrics"))
+
+	source := schema.Struct{
+		schema.FieldNameSchema: "public",
+		schema.FieldNameTable:  "metrics",
+	}
+	key, err := s.renderKey("ts.public.metrics", source, []string{"ts"}, schema.Struct{"ts": 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "{ts.public.metrics}:1", key)
+
+	s = newTestSink(t, func(c *spiconfig.Config) {
+		c.Sink.Redis.Cluster.Enabled = true
+		c.Sink.Redis.Cluster.HashTags = lo.ToPtr(false)
+	})
+	assert.Equal(t, "ts.public.metrics", s.hashTag("ts.public.metrics"))
+}
+
+func Test_Redis_Sink_Slot_Key(
+	t *testing.T,
+) {
+
+	assert.Equal(t, "ts.public.metrics", slotKey("{ts.public.metrics}:1"))
+	assert.Equal(t, "ts", slotKey("public:{ts}:1"))
+	assert.Equal(t, "public:metrics:1", slotKey("public:metrics:1"))
+	assert.Equal(t, "{}:1", slotKey("{}:1"))
+	assert.Equal(t, "{ts:1", slotKey("{ts:1"))
+}
+
+func Test_Redis_Sink_Transient_Errors(
+	t *testing.T,
+) {
+
+	assert.True(t, isTransientError(io.EOF))
+	assert.True(t, isTransientError(&net.OpError{Op: "dial", Err: errors.New("connection refused")}))
+	assert.True(t, isTransientError(errors.New("READONLY You can't write against a read only replica.")))
+	assert.True(t, isTransientError(errors.New("LOADING Redis is loading the dataset in memory")))
+	assert.True(t, isTransientError(errors.New("redis: all sentinels are unreachable")))
+	assert.False(t, isTransientError(errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")))
+}
+
+func Test_Redis_Sink_Retries_Transient_Errors(
+	t *testing.T,
+) {
+
+	s := newTestSink(t, nil)
+
+	attempts := 0
+	err := s.withRetry(func() error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("READONLY You can't write against a read only replica.")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+
+	attempts = 0
+	err = s.withRetry(func() error {
+		attempts++
+		return errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+}
@@ -0,0 +1,463 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sink
+
+import (
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/eventfiltering"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/topicfiltering"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/noctarius/timescaledb-event-streamer/spi/statestorage"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// namedSink is a named sink, wrapped in its own sink manager, which
+// pipelines or buffers the events depending on the sink's capabilities
+type namedSink struct {
+	name    string
+	manager sink.Manager
+}
+
+type route struct {
+	name        string
+	sinks       []*namedSink
+	topicFilter *topicfiltering.TopicFilter
+	filter      eventfiltering.EventFilter
+}
+
+// pendingEvent remembers the sinks which already accepted an event,
+// when the event is retried it's only emitted to the remaining sinks
+type pendingEvent struct {
+	envelope schema.Struct
+	accepted map[string]bool
+}
+
+// routingSinkManager dispatches events to multiple named sinks, selected
+// by the configured routes. An event is only reported as emitted after all
+// selected sinks accepted it, which keeps the LSN from being acknowledged
+// before that. Acknowledgements are passed on to all sinks and only
+// acknowledged after the last sink wrote its preceding events. Without
+// routes, all events are dispatched to all sinks.
+type routingSinkManager struct {
+	mutex   sync.Mutex
+	logger  *logging.Logger
+	sinks   []*namedSink
+	routes  []*route
+	tables  map[string]schema.TableAlike
+	pending *pendingEvent
+}
+
+// NewSinkManagerFromConfig creates the sink manager for the configured
+// sink (pipelining events for async sinks, buffering events for batch
+// sinks), or, if named sinks are configured, a sink manager which routes
+// the events to the named sinks, each wrapped in its own sink manager.
+func NewSinkManagerFromConfig(
+	c *config.Config, stateStorageManager statestorage.Manager,
+) (sink.Manager, error) {
+
+	if len(c.Sink.Sinks) == 0 {
+		s, err := NewSink(config.GetOrDefault(c, config.PropertySink, config.Stdout), c)
+		if err != nil {
+			return nil, err
+		}
+		return newManager(c, stateStorageManager, sinkContextStateName, s)
+	}
+
+	logger, err := logging.NewLogger("RoutingSinkManager")
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(c.Sink.Sinks))
+	for name := range c.Sink.Sinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sinks := make(map[string]*namedSink, len(names))
+	orderedSinks := make([]*namedSink, 0, len(names))
+	for _, name := range names {
+		sinkConfig := c.Sink.Sinks[name]
+		if sinkConfig.Type == "" {
+			return nil, errors.Errorf("Sink '%s' has no type configured", name)
+		}
+
+		// Named sinks read their settings from a copy of the
+		// configuration, with the sink section replaced by their own
+		namedConfig := *c
+		namedConfig.Sink = sinkConfig
+		s, err := NewSink(sinkConfig.Type, &namedConfig)
+		if err != nil {
+			return nil, errors.Errorf("Failed to create sink '%s': %s", name, err.Error())
+		}
+
+		manager, err := newManager(&namedConfig, stateStorageManager, namedStateName(name), s)
+		if err != nil {
+			return nil, errors.Errorf("Failed to create sink manager of sink '%s': %s", name, err.Error())
+		}
+
+		ns := &namedSink{
+			name:    name,
+			manager: manager,
+		}
+		sinks[name] = ns
+		orderedSinks = append(orderedSinks, ns)
+	}
+
+	routes, err := newRoutes(c.Sink.Routes, sinks)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(routes) > 0 {
+		for _, ns := range orderedSinks {
+			if !isRouted(routes, ns) {
+				logger.Warnf("Sink '%s' isn't referenced by any route and won't receive events", ns.name)
+			}
+		}
+	}
+
+	return &routingSinkManager{
+		logger: logger,
+		sinks:  orderedSinks,
+		routes: routes,
+		tables: make(map[string]schema.TableAlike),
+	}, nil
+}
+
+func newManager(
+	c *config.Config, stateStorageManager statestorage.Manager, stateName string, s sink.Sink,
+) (sink.Manager, error) {
+
+	if asyncSink, ok := s.(sink.AsyncSink); ok {
+		return newAsyncSinkManager(stateStorageManager, stateName, s, asyncSink)
+	}
+	if batchSink, ok := s.(sink.BatchSink); ok {
+		return newBatchingSinkManager(c, stateStorageManager, stateName, s, batchSink)
+	}
+	return newSinkManager(stateStorageManager, stateName, s), nil
+}
+
+func newRoutes(
+	routeConfigs map[string]config.SinkRouteConfig, sinks map[string]*namedSink,
+) ([]*route, error) {
+
+	names := make([]string, 0, len(routeConfigs))
+	for name := range routeConfigs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	routes := make([]*route, 0, len(names))
+	for _, name := range names {
+		routeConfig := routeConfigs[name]
+
+		if len(routeConfig.Sinks) == 0 {
+			return nil, errors.Errorf("Route '%s' has no sinks configured", name)
+		}
+
+		routeSinks := make([]*namedSink, 0, len(routeConfig.Sinks))
+		for _, sinkName := range routeConfig.Sinks {
+			ns, present := sinks[sinkName]
+			if !present {
+				return nil, errors.Errorf("Route '%s' references the unknown sink '%s'", name, sinkName)
+			}
+			routeSinks = append(routeSinks, ns)
+		}
+
+		var topicFilter *topicfiltering.TopicFilter
+		if routeConfig.Topics != nil {
+			tf, err := topicfiltering.NewTopicFilter(routeConfig.Topics.Excludes, routeConfig.Topics.Includes, false)
+			if err != nil {
+				return nil, errors.Errorf("Failed to parse topic patterns of route '%s': %s", name, err.Error())
+			}
+			topicFilter = tf
+		}
+
+		filter, err := eventfiltering.NewEventFilter(routeConfig.Filters)
+		if err != nil {
+			return nil, errors.Errorf("Failed to parse filters of route '%s': %s", name, err.Error())
+		}
+
+		routes = append(routes, &route{
+			name:        name,
+			sinks:       routeSinks,
+			topicFilter: topicFilter,
+			filter:      filter,
+		})
+	}
+	return routes, nil
+}
+
+func (rsm *routingSinkManager) Start() error {
+	for _, ns := range rsm.sinks {
+		if err := ns.manager.Start(); err != nil {
+			return errors.WrapPrefix(err, fmt.Sprintf("Failed to start sink '%s'", ns.name), 0)
+		}
+	}
+	return nil
+}
+
+func (rsm *routingSinkManager) Stop() error {
+	var lastErr error
+	for _, ns := range rsm.sinks {
+		if err := ns.manager.Stop(); err != nil {
+			rsm.logger.Warnf("Failed to stop sink '%s': %+v", ns.name, err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func (rsm *routingSinkManager) Emit(
+	timestamp time.Time, topicName string, key, envelope schema.Struct,
+) error {
+
+	rsm.mutex.Lock()
+	defer rsm.mutex.Unlock()
+
+	targets, err := rsm.targets(topicName, key, envelope)
+	if err != nil {
+		return err
+	}
+
+	// The event emitter retries failed events with the same envelope,
+	// sinks which already accepted the event must not receive it again
+	if rsm.pending == nil || !sameStruct(rsm.pending.envelope, envelope) {
+		rsm.pending = &pendingEvent{
+			envelope: envelope,
+			accepted: make(map[string]bool, len(targets)),
+		}
+	}
+
+	for _, ns := range targets {
+		if rsm.pending.accepted[ns.name] {
+			continue
+		}
+		if err := ns.manager.Emit(timestamp, topicName, key, envelope); err != nil {
+			return errors.WrapPrefix(err, fmt.Sprintf("Sink '%s' failed to emit event", ns.name), 0)
+		}
+		rsm.pending.accepted[ns.name] = true
+	}
+	rsm.pending = nil
+	return nil
+}
+
+func (rsm *routingSinkManager) RegisterTable(
+	topicName string, table schema.TableAlike,
+) error {
+
+	rsm.mutex.Lock()
+	defer rsm.mutex.Unlock()
+
+	rsm.tables[topicName] = table
+
+	// Filter expressions are evaluated per event, therefore the table is
+	// registered with all sinks of the routes matching the topic name
+	for _, ns := range rsm.sinks {
+		if !rsm.mayReceive(ns, topicName) {
+			continue
+		}
+		if err := ns.manager.RegisterTable(topicName, table); err != nil {
+			return errors.WrapPrefix(err, fmt.Sprintf("Sink '%s' failed to register table", ns.name), 0)
+		}
+	}
+	return nil
+}
+
+func (rsm *routingSinkManager) EagerTableRegistration() bool {
+	for _, ns := range rsm.sinks {
+		if ns.manager.EagerTableRegistration() {
+			return true
+		}
+	}
+	return false
+}
+
+func (rsm *routingSinkManager) TransactionAware() bool {
+	for _, ns := range rsm.sinks {
+		if ns.manager.TransactionAware() {
+			return true
+		}
+	}
+	return false
+}
+
+func (rsm *routingSinkManager) BeginTransaction(
+	xid uint32, commitTime time.Time,
+) error {
+
+	for _, ns := range rsm.sinks {
+		if !ns.manager.TransactionAware() {
+			continue
+		}
+		if err := ns.manager.BeginTransaction(xid, commitTime); err != nil {
+			return errors.WrapPrefix(err, fmt.Sprintf("Sink '%s' failed to begin transaction", ns.name), 0)
+		}
+	}
+	return nil
+}
+
+func (rsm *routingSinkManager) CommitTransaction(
+	xid uint32, transactionEndLSN pgtypes.LSN,
+) error {
+
+	for _, ns := range rsm.sinks {
+		if !ns.manager.TransactionAware() {
+			continue
+		}
+		if err := ns.manager.CommitTransaction(xid, transactionEndLSN); err != nil {
+			return errors.WrapPrefix(err, fmt.Sprintf("Sink '%s' failed to commit transaction", ns.name), 0)
+		}
+	}
+	return nil
+}
+
+func (rsm *routingSinkManager) targets(
+	topicName string, key, envelope schema.Struct,
+) ([]*namedSink, error) {
+
+	if len(rsm.routes) == 0 {
+		return rsm.sinks, nil
+	}
+
+	selected := make(map[string]bool, len(rsm.sinks))
+	for _, r := range rsm.routes {
+		if r.topicFilter != nil && !r.topicFilter.Matches(topicName) {
+			continue
+		}
+		success, err := r.filter.Evaluate(rsm.tables[topicName], key, envelope)
+		if err != nil {
+			return nil, errors.WrapPrefix(err, fmt.Sprintf("Failed to evaluate route '%s'", r.name), 0)
+		}
+		if !success {
+			continue
+		}
+		for _, ns := range r.sinks {
+			selected[ns.name] = true
+		}
+	}
+
+	// Sinks are always called in the same order
+	targets := make([]*namedSink, 0, len(selected))
+	for _, ns := range rsm.sinks {
+		if selected[ns.name] {
+			targets = append(targets, ns)
+		}
+	}
+	return targets, nil
+}
+
+func (rsm *routingSinkManager) mayReceive(
+	ns *namedSink, topicName string,
+) bool {
+
+	if len(rsm.routes) == 0 {
+		return true
+	}
+	for _, r := range rsm.routes {
+		if r.topicFilter != nil && !r.topicFilter.Matches(topicName) {
+			continue
+		}
+		for _, candidate := range r.sinks {
+			if candidate == ns {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CommittedLSN isn't supported with multiple sinks, since every
+// sink may have committed a different transaction last
+func (rsm *routingSinkManager) CommittedLSN() (pgtypes.LSN, bool, error) {
+	return 0, false, nil
+}
+
+// SetDeadLetterHandler hands the dead-letter handler to the
+// sink managers, which park failed events by themselves
+func (rsm *routingSinkManager) SetDeadLetterHandler(
+	deadLetterHandler *DeadLetterHandler,
+) {
+
+	for _, ns := range rsm.sinks {
+		if deadLetterAware, ok := ns.manager.(DeadLetterAware); ok {
+			deadLetterAware.SetDeadLetterHandler(deadLetterHandler)
+		}
+	}
+}
+
+// Acknowledge passes the acknowledgement on to all sink managers, which
+// may defer it until their buffered or in-flight events are written. It's
+// acknowledged after the last sink manager called it.
+func (rsm *routingSinkManager) Acknowledge(
+	acknowledge func() error,
+) error {
+
+	// Sink managers call the acknowledgement from their own goroutines
+	var mutex sync.Mutex
+	sharedAcknowledge := SharedAcknowledgement(len(rsm.sinks), acknowledge)
+	synchronizedAcknowledge := func() error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return sharedAcknowledge()
+	}
+
+	for _, ns := range rsm.sinks {
+		if err := ns.manager.Acknowledge(synchronizedAcknowledge); err != nil {
+			return errors.WrapPrefix(err, fmt.Sprintf("Sink '%s' failed to acknowledge", ns.name), 0)
+		}
+	}
+	return nil
+}
+
+func namedStateName(
+	name string,
+) string {
+
+	return fmt.Sprintf("%s:%s", sinkContextStateName, name)
+}
+
+func isRouted(
+	routes []*route, ns *namedSink,
+) bool {
+
+	for _, r := range routes {
+		for _, candidate := range r.sinks {
+			if candidate == ns {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func sameStruct(
+	s1, s2 schema.Struct,
+) bool {
+
+	return reflect.ValueOf(s1).UnsafePointer() == reflect.ValueOf(s2).UnsafePointer()
+}
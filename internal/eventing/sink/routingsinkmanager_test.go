@@ -0,0 +1,233 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sink
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type recordingSink struct {
+	topics   []string
+	failures int
+}
+
+func (r *recordingSink) Start() error {
+	return nil
+}
+
+func (r *recordingSink) Stop() error {
+	return nil
+}
+
+func (r *recordingSink) Emit(
+	_ sink.Context, _ time.Time, topicName string, _, _ schema.Struct,
+) error {
+
+	if r.failures > 0 {
+		r.failures--
+		return errors.Errorf("failed to emit")
+	}
+	r.topics = append(r.topics, topicName)
+	return nil
+}
+
+func Test_Routing_By_Topic_Patterns(
+	t *testing.T,
+) {
+
+	audit := &recordingSink{}
+	telemetry := &recordingSink{}
+	manager := newTestRoutingSinkManager(t, map[string]*recordingSink{
+		"audit":     audit,
+		"telemetry": telemetry,
+	}, map[string]config.SinkRouteConfig{
+		"audit": {
+			Sinks: []string{"audit"},
+			Topics: &config.IncludedTablesConfig{
+				Includes: []string{"timescaledb.audit.*"},
+			},
+		},
+		"telemetry": {
+			Sinks: []string{"telemetry"},
+			Topics: &config.IncludedTablesConfig{
+				Includes: []string{"timescaledb.public.*"},
+				Excludes: []string{"timescaledb.public.internal"},
+			},
+		},
+	})
+
+	for _, topicName := range []string{
+		"timescaledb.audit.logins", "timescaledb.public.metrics", "timescaledb.public.internal",
+	} {
+		assert.NoError(t, manager.Emit(time.Now(), topicName, testKey(), testEnvelope("c")))
+	}
+
+	assert.Equal(t, []string{"timescaledb.audit.logins"}, audit.topics)
+	assert.Equal(t, []string{"timescaledb.public.metrics"}, telemetry.topics)
+}
+
+func Test_Routing_By_Filter_Expressions(
+	t *testing.T,
+) {
+
+	all := &recordingSink{}
+	deletes := &recordingSink{}
+	manager := newTestRoutingSinkManager(t, map[string]*recordingSink{
+		"all":     all,
+		"deletes": deletes,
+	}, map[string]config.SinkRouteConfig{
+		"all": {
+			Sinks: []string{"all"},
+		},
+		"deletes": {
+			Sinks: []string{"deletes"},
+			Filters: map[string]config.EventFilterConfig{
+				"deletes": {
+					Condition: "value.op == \"d\"",
+				},
+			},
+		},
+	})
+
+	assert.NoError(t, manager.Emit(time.Now(), "timescaledb.public.metrics", testKey(), testEnvelope("c")))
+	assert.NoError(t, manager.Emit(time.Now(), "timescaledb.public.metrics", testKey(), testEnvelope("d")))
+
+	assert.Len(t, all.topics, 2)
+	assert.Len(t, deletes.topics, 1)
+}
+
+func Test_Routing_Retry_Skips_Accepting_Sinks(
+	t *testing.T,
+) {
+
+	first := &recordingSink{}
+	second := &recordingSink{failures: 1}
+	manager := newTestRoutingSinkManager(t, map[string]*recordingSink{
+		"first":  first,
+		"second": second,
+	}, nil)
+
+	key := testKey()
+	envelope := testEnvelope("c")
+	assert.Error(t, manager.Emit(time.Now(), "timescaledb.public.metrics", key, envelope))
+	assert.NoError(t, manager.Emit(time.Now(), "timescaledb.public.metrics", key, envelope))
+
+	assert.Len(t, first.topics, 1)
+	assert.Len(t, second.topics, 1)
+
+	// A different event is emitted to all sinks again
+	assert.NoError(t, manager.Emit(time.Now(), "timescaledb.public.metrics", key, testEnvelope("c")))
+	assert.Len(t, first.topics, 2)
+	assert.Len(t, second.topics, 2)
+}
+
+func Test_Routing_Acknowledge_Waits_For_All_Sinks(
+	t *testing.T,
+) {
+
+	first := &recordingSink{}
+	batchSink := &recordingBatchSink{}
+	manager := newTestRoutingSinkManager(t, map[string]*recordingSink{
+		"first": first,
+	}, nil)
+	manager.sinks = append(manager.sinks, &namedSink{
+		name:    "second",
+		manager: newTestBatchingSinkManager(t, batchSink, 2, 1048576),
+	})
+
+	acknowledged := 0
+	acknowledge := func() error {
+		acknowledged++
+		return nil
+	}
+
+	// The batching sink still buffers the event, the acknowledgement
+	// is deferred until the batch is flushed
+	assert.NoError(t, manager.Emit(time.Now(), "timescaledb.public.metrics", testKey(), testEnvelope("c")))
+	assert.NoError(t, manager.Acknowledge(acknowledge))
+	assert.Len(t, first.topics, 1)
+	assert.Equal(t, 0, acknowledged)
+
+	assert.NoError(t, manager.Emit(time.Now(), "timescaledb.public.metrics", testKey(), testEnvelope("c")))
+	assert.Len(t, batchSink.batches, 1)
+	assert.Equal(t, 1, acknowledged)
+}
+
+func Test_Routing_Unknown_Sink(
+	t *testing.T,
+) {
+
+	_, err := newRoutes(map[string]config.SinkRouteConfig{
+		"route": {
+			Sinks: []string{"unknown"},
+		},
+	}, map[string]*namedSink{})
+
+	assert.ErrorContains(t, err, "unknown sink 'unknown'")
+}
+
+func newTestRoutingSinkManager(
+	t *testing.T, sinks map[string]*recordingSink, routeConfigs map[string]config.SinkRouteConfig,
+) *routingSinkManager {
+
+	namedSinks := make(map[string]*namedSink)
+	orderedSinks := make([]*namedSink, 0)
+	for _, name := range []string{"all", "audit", "deletes", "first", "second", "telemetry"} {
+		if s, present := sinks[name]; present {
+			ns := &namedSink{name: name, manager: NewSinkManager(nil, s)}
+			namedSinks[name] = ns
+			orderedSinks = append(orderedSinks, ns)
+		}
+	}
+
+	routes, err := newRoutes(routeConfigs, namedSinks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &routingSinkManager{
+		sinks:  orderedSinks,
+		routes: routes,
+		tables: make(map[string]schema.TableAlike),
+	}
+}
+
+func testKey() schema.Struct {
+	return schema.Struct{
+		schema.FieldNameSchema:  schema.Struct{},
+		schema.FieldNamePayload: schema.Struct{"id": 1},
+	}
+}
+
+func testEnvelope(
+	operation string,
+) schema.Struct {
+
+	return schema.Struct{
+		schema.FieldNameSchema: schema.Struct{},
+		schema.FieldNamePayload: schema.Struct{
+			schema.FieldNameOperation: operation,
+		},
+	}
+}
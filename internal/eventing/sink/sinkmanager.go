@@ -19,6 +19,7 @@ package sink
 
 import (
 	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
 	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
 	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
 	"github.com/noctarius/timescaledb-event-streamer/spi/statestorage"
@@ -31,6 +32,7 @@ const (
 
 type sinkManager struct {
 	stateStorageManager statestorage.Manager
+	stateName           string
 	sinkContext         *sinkContext
 	sink                sink.Sink
 }
@@ -39,23 +41,33 @@ func NewSinkManager(
 	stateStorageManager statestorage.Manager, sink sink.Sink,
 ) sink.Manager {
 
+	return newSinkManager(stateStorageManager, sinkContextStateName, sink)
+}
+
+func newSinkManager(
+	stateStorageManager statestorage.Manager, stateName string, sink sink.Sink,
+) *sinkManager {
+
 	return &sinkManager{
 		stateStorageManager: stateStorageManager,
+		stateName:           stateName,
 		sinkContext:         newSinkContext(),
 		sink:                sink,
 	}
 }
 
 func (sm *sinkManager) Start() error {
-	if encodedSinkContextState, present := sm.stateStorageManager.EncodedState(sinkContextStateName); present {
-		return sm.sinkContext.UnmarshalBinary(encodedSinkContextState)
+	if encodedSinkContextState, present := sm.stateStorageManager.EncodedState(sm.stateName); present {
+		if err := sm.sinkContext.UnmarshalBinary(encodedSinkContextState); err != nil {
+			return err
+		}
 	}
 	return sm.sink.Start()
 }
 
 func (sm *sinkManager) Stop() error {
 	if err := sm.stateStorageManager.StateEncoder(
-		sinkContextStateName, statestorage.StateEncoderFunc(sm.sinkContext.MarshalBinary),
+		sm.stateName, statestorage.StateEncoderFunc(sm.sinkContext.MarshalBinary),
 	); err != nil {
 		return errors.Wrap(err, 0)
 	}
@@ -66,5 +78,91 @@ func (sm *sinkManager) Emit(
 	timestamp time.Time, topicName string, key, envelope schema.Struct,
 ) error {
 
-	return sm.sink.Emit(sm.sinkContext, timestamp, topicName, key, envelope)
+	if err := sm.sink.Emit(sm.sinkContext, timestamp, topicName, key, envelope); err != nil {
+		return classifyError(sm.sink, err)
+	}
+	return nil
+}
+
+func (sm *sinkManager) RegisterTable(
+	topicName string, table schema.TableAlike,
+) error {
+
+	if tableAwareSink, ok := sm.sink.(sink.TableAwareSink); ok {
+		return tableAwareSink.RegisterTable(sm.sinkContext, topicName, table)
+	}
+	return nil
+}
+
+func (sm *sinkManager) EagerTableRegistration() bool {
+	eagerTableAwareSink, ok := sm.sink.(sink.EagerTableAwareSink)
+	return ok && eagerTableAwareSink.EagerTableRegistration()
+}
+
+func (sm *sinkManager) TransactionAware() bool {
+	_, ok := sm.sink.(sink.TransactionAwareSink)
+	return ok
+}
+
+func (sm *sinkManager) BeginTransaction(
+	xid uint32, commitTime time.Time,
+) error {
+
+	if transactionAwareSink, ok := sm.sink.(sink.TransactionAwareSink); ok {
+		return transactionAwareSink.BeginTransaction(sm.sinkContext, xid, commitTime)
+	}
+	return nil
+}
+
+func (sm *sinkManager) CommitTransaction(
+	xid uint32, transactionEndLSN pgtypes.LSN,
+) error {
+
+	if transactionAwareSink, ok := sm.sink.(sink.TransactionAwareSink); ok {
+		return transactionAwareSink.CommitTransaction(sm.sinkContext, xid, transactionEndLSN)
+	}
+	return nil
+}
+
+func (sm *sinkManager) CommittedLSN() (pgtypes.LSN, bool, error) {
+	if offsetStoringSink, ok := sm.sink.(sink.OffsetStoringSink); ok {
+		return offsetStoringSink.CommittedLSN(sm.sinkContext)
+	}
+	return 0, false, nil
+}
+
+// SetDeadLetterHandler hands the dead-letter handler to the
+// sink, if it parks failed events by itself
+func (sm *sinkManager) SetDeadLetterHandler(
+	deadLetterHandler *DeadLetterHandler,
+) {
+
+	if deadLetterAware, ok := sm.sink.(DeadLetterAware); ok {
+		deadLetterAware.SetDeadLetterHandler(deadLetterHandler)
+	}
+}
+
+func (sm *sinkManager) Acknowledge(
+	acknowledge func() error,
+) error {
+
+	if acknowledgingSink, ok := sm.sink.(sink.AcknowledgingSink); ok {
+		return acknowledgingSink.Acknowledge(sm.sinkContext, acknowledge)
+	}
+	return acknowledge()
+}
+
+// classifyError marks the error as permanent, if the sink
+// classifies it as such and it isn't marked already
+func classifyError(
+	s sink.Sink, err error,
+) error {
+
+	if sink.IsPermanentError(err) {
+		return err
+	}
+	if errorClassifyingSink, ok := s.(sink.ErrorClassifyingSink); ok && errorClassifyingSink.IsPermanentError(err) {
+		return sink.NewPermanentError(err)
+	}
+	return err
 }
@@ -0,0 +1,107 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sink
+
+import (
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type offsetStoringSink struct {
+	recordingSink
+	lsn pgtypes.LSN
+}
+
+func (o *offsetStoringSink) CommittedLSN(
+	_ sink.Context,
+) (pgtypes.LSN, bool, error) {
+
+	return o.lsn, o.lsn > 0, nil
+}
+
+func Test_Committed_LSN_Of_Offset_Storing_Sink(
+	t *testing.T,
+) {
+
+	manager := &sinkManager{sinkContext: newSinkContext(), sink: &offsetStoringSink{lsn: 0x16B3748}}
+
+	lsn, found, err := manager.CommittedLSN()
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, pgtypes.LSN(0x16B3748), lsn)
+}
+
+func Test_Committed_LSN_Not_Provided(
+	t *testing.T,
+) {
+
+	manager := &sinkManager{sinkContext: newSinkContext(), sink: &recordingSink{}}
+
+	_, found, err := manager.CommittedLSN()
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
+
+type acknowledgingSink struct {
+	recordingSink
+	acknowledges []func() error
+}
+
+func (a *acknowledgingSink) Acknowledge(
+	_ sink.Context, acknowledge func() error,
+) error {
+
+	a.acknowledges = append(a.acknowledges, acknowledge)
+	return nil
+}
+
+func Test_Acknowledge_Deferred_By_Acknowledging_Sink(
+	t *testing.T,
+) {
+
+	s := &acknowledgingSink{}
+	manager := NewSinkManager(nil, s)
+
+	acknowledged := false
+	assert.NoError(t, manager.Acknowledge(func() error {
+		acknowledged = true
+		return nil
+	}))
+	assert.False(t, acknowledged)
+
+	assert.Len(t, s.acknowledges, 1)
+	assert.NoError(t, s.acknowledges[0]())
+	assert.True(t, acknowledged)
+}
+
+func Test_Shared_Acknowledgement(
+	t *testing.T,
+) {
+
+	acknowledged := 0
+	shared := SharedAcknowledgement(2, func() error {
+		acknowledged++
+		return nil
+	})
+
+	assert.NoError(t, shared())
+	assert.Equal(t, 0, acknowledged)
+	assert.NoError(t, shared())
+	assert.Equal(t, 1, acknowledged)
+}
@@ -0,0 +1,320 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-errors/errors"
+	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/topicfiltering"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"golang.org/x/net/websocket"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	sinkimpl.RegisterSink(config.WebSocket, newWebSocketSink)
+}
+
+type message struct {
+	Topic string        `json:"topic"`
+	Key   schema.Struct `json:"key"`
+	Value schema.Struct `json:"value"`
+}
+
+type client struct {
+	id        uint64
+	filter    *topicfiltering.TopicFilter
+	messages  chan []byte
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (c *client) close() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+}
+
+type webSocketSink struct {
+	mutex        sync.Mutex
+	logger       *logging.Logger
+	encoder      *encoding.JsonEncoder
+	address      string
+	bufferSize   int
+	writeTimeout time.Duration
+	server       *http.Server
+	clients      map[uint64]*client
+	nextClientId uint64
+}
+
+func newWebSocketSink(
+	c *config.Config,
+) (sink.Sink, error) {
+
+	logger, err := logging.NewLogger("WebSocketSink")
+	if err != nil {
+		return nil, err
+	}
+
+	bufferSize := config.GetOrDefault(c, config.PropertyWebSocketBufferSize, 1000)
+	if bufferSize < 1 {
+		return nil, errors.Errorf("WebSocket sink buffer size must be at least 1, but was %d", bufferSize)
+	}
+
+	s := &webSocketSink{
+		logger:     logger,
+		encoder:    encoding.NewJsonEncoderWithConfig(c),
+		address:    config.GetOrDefault(c, config.PropertyWebSocketAddress, ":8090"),
+		bufferSize: bufferSize,
+		writeTimeout: time.Duration(
+			config.GetOrDefault(c, config.PropertyWebSocketWriteTimeout, 10),
+		) * time.Second,
+		clients: make(map[uint64]*client),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", s.handleWebSocket)
+	mux.HandleFunc("/sse", s.handleServerSentEvents)
+	s.server = &http.Server{
+		Addr:    s.address,
+		Handler: mux,
+	}
+	return s, nil
+}
+
+func (s *webSocketSink) Start() error {
+	listener, err := net.Listen("tcp", s.address)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	s.logger.Infof("Starting WebSocket and SSE server at %s", listener.Addr().String())
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Errorf("WebSocket and SSE server failed: %+v", err)
+		}
+	}()
+	return nil
+}
+
+func (s *webSocketSink) Stop() error {
+	s.logger.Infof("Stopping WebSocket and SSE server at %s", s.address)
+
+	// Hijacked WebSocket connections aren't tracked by the http
+	// server, closing the clients terminates their handlers
+	s.mutex.Lock()
+	for _, c := range s.clients {
+		c.close()
+	}
+	s.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.writeTimeout)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
+
+func (s *webSocketSink) Emit(
+	_ sink.Context, _ time.Time, topicName string, key, envelope schema.Struct,
+) error {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.clients) == 0 {
+		return nil
+	}
+
+	data, err := s.encoder.Marshal(message{
+		Topic: topicName,
+		Key:   key,
+		Value: envelope,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, c := range s.clients {
+		if !c.filter.Matches(topicName) {
+			continue
+		}
+
+		// Never block the replication on a client, a client with
+		// a full buffer is considered a slow consumer and disconnected
+		select {
+		case c.messages <- data:
+		default:
+			s.logger.Warnf("Disconnecting slow consumer %d, buffer of %d messages is full", c.id, s.bufferSize)
+			c.close()
+		}
+	}
+	return nil
+}
+
+func (s *webSocketSink) handleWebSocket(
+	writer http.ResponseWriter, request *http.Request,
+) {
+
+	c, err := s.newClient(request)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	websocket.Handler(func(connection *websocket.Conn) {
+		s.registerClient(c)
+		defer s.unregisterClient(c)
+		defer connection.Close()
+
+		// Clients aren't expected to send anything, reading is only
+		// used to detect the client closing the connection
+		go func() {
+			buffer := make([]byte, 512)
+			for {
+				if _, err := connection.Read(buffer); err != nil {
+					c.close()
+					return
+				}
+			}
+		}()
+
+		for {
+			select {
+			case <-c.closed:
+				return
+			case data := <-c.messages:
+				if err := connection.SetWriteDeadline(time.Now().Add(s.writeTimeout)); err != nil {
+					return
+				}
+				if err := websocket.Message.Send(connection, string(data)); err != nil {
+					s.logger.Debugf("Failed to send message to client %d: %+v", c.id, err)
+					return
+				}
+			}
+		}
+	}).ServeHTTP(writer, request)
+}
+
+func (s *webSocketSink) handleServerSentEvents(
+	writer http.ResponseWriter, request *http.Request,
+) {
+
+	c, err := s.newClient(request)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	controller := http.NewResponseController(writer)
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Header().Set("Connection", "keep-alive")
+	writer.WriteHeader(http.StatusOK)
+	if err := controller.Flush(); err != nil {
+		return
+	}
+
+	s.registerClient(c)
+	defer s.unregisterClient(c)
+
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-request.Context().Done():
+			return
+		case data := <-c.messages:
+			if err := controller.SetWriteDeadline(time.Now().Add(s.writeTimeout)); err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(writer, "data: %s\n\n", data); err != nil {
+				s.logger.Debugf("Failed to send event to client %d: %+v", c.id, err)
+				return
+			}
+			if err := controller.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *webSocketSink) newClient(
+	request *http.Request,
+) (*client, error) {
+
+	// Topics can be passed as multiple topic parameters
+	// or as a comma separated list, or a mix of both
+	topics := make([]string, 0)
+	for _, topic := range request.URL.Query()["topic"] {
+		for _, t := range strings.Split(topic, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				topics = append(topics, t)
+			}
+		}
+	}
+	if len(topics) == 0 {
+		return nil, errors.Errorf("at least one topic parameter is required")
+	}
+
+	filter, err := topicfiltering.NewTopicFilter(nil, topics, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &client{
+		filter:   filter,
+		messages: make(chan []byte, s.bufferSize),
+		closed:   make(chan struct{}),
+	}, nil
+}
+
+func (s *webSocketSink) registerClient(
+	c *client,
+) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.nextClientId++
+	c.id = s.nextClientId
+	s.clients[c.id] = c
+	s.logger.Debugf("Client %d connected", c.id)
+}
+
+func (s *webSocketSink) unregisterClient(
+	c *client,
+) {
+
+	c.close()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.clients, c.id)
+	s.logger.Debugf("Client %d disconnected", c.id)
+}
@@ -0,0 +1,139 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package topicfiltering
+
+import (
+	"github.com/go-errors/errors"
+	"regexp"
+	"strings"
+)
+
+// TopicFilter matches topic names against include and exclude
+// patterns. Patterns use the same wildcards as the table filters
+// (* for any number of characters, ? for exactly one character,
+// + for at least one character), but are matched per dot-separated
+// segment of the topic name, e.g. `timescaledb.public.*`.
+//
+// TopicFilter is not safe for concurrent use.
+type TopicFilter struct {
+	includes          []*regexp.Regexp
+	excludes          []*regexp.Regexp
+	filterCache       map[string]bool
+	acceptedByDefault bool
+}
+
+func NewTopicFilter(
+	excludes, includes []string, acceptedByDefault bool,
+) (*TopicFilter, error) {
+
+	excludeFilters, err := parsePatterns(excludes)
+	if err != nil {
+		return nil, err
+	}
+
+	includeFilters, err := parsePatterns(includes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TopicFilter{
+		includes:          includeFilters,
+		excludes:          excludeFilters,
+		filterCache:       make(map[string]bool, 0),
+		acceptedByDefault: acceptedByDefault,
+	}, nil
+}
+
+func (tf *TopicFilter) Matches(
+	topicName string,
+) bool {
+
+	// already tested?
+	if v, present := tf.filterCache[topicName]; present {
+		return v
+	}
+
+	// excluded has priority
+	for _, exclude := range tf.excludes {
+		if exclude.MatchString(topicName) {
+			tf.filterCache[topicName] = false
+			return false
+		}
+	}
+
+	// is explicitly included?
+	for _, include := range tf.includes {
+		if include.MatchString(topicName) {
+			tf.filterCache[topicName] = true
+			return true
+		}
+	}
+
+	// otherwise use acceptedByDefault
+	tf.filterCache[topicName] = tf.acceptedByDefault
+	return tf.acceptedByDefault
+}
+
+func parsePatterns(
+	patterns []string,
+) ([]*regexp.Regexp, error) {
+
+	filters := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		filter, err := parsePattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+func parsePattern(
+	pattern string,
+) (*regexp.Regexp, error) {
+
+	if pattern == "" {
+		return nil, errors.Errorf("a topic pattern cannot be empty")
+	}
+
+	segments := strings.Split(pattern, ".")
+	expressions := make([]string, 0, len(segments))
+	for index, segment := range segments {
+		if segment == "" {
+			return nil, errors.Errorf("empty segment in topic pattern '%s' at position %d", pattern, index)
+		}
+
+		builder := strings.Builder{}
+		for _, char := range segment {
+			switch char {
+			case '*':
+				builder.WriteString("[^.]*")
+			case '?':
+				builder.WriteString("[^.]")
+			case '+':
+				builder.WriteString("[^.]+")
+			default:
+				builder.WriteString(regexp.QuoteMeta(string(char)))
+			}
+		}
+		expressions = append(expressions, builder.String())
+	}
+
+	return regexp.Compile("^" + strings.Join(expressions, "\\.") + "$")
+}
@@ -0,0 +1,138 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package topicfiltering
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var emptyList []string
+
+func asList(
+	v ...string,
+) []string {
+
+	return v
+}
+
+func Test_Topic_Default_Excluded(
+	t *testing.T,
+) {
+
+	topicFilter, err := NewTopicFilter(emptyList, emptyList, false)
+	if err != nil {
+		t.Fatalf("error parsing: %+v", err)
+	}
+
+	assert.False(t, topicFilter.Matches("timescaledb.public.metrics"))
+}
+
+func Test_Topic_Default_Included(
+	t *testing.T,
+) {
+
+	topicFilter, err := NewTopicFilter(emptyList, emptyList, true)
+	if err != nil {
+		t.Fatalf("error parsing: %+v", err)
+	}
+
+	assert.True(t, topicFilter.Matches("timescaledb.public.metrics"))
+}
+
+func Test_Topic_Parse_Error_Empty_Segment(
+	t *testing.T,
+) {
+
+	_, err := NewTopicFilter(emptyList, asList("timescaledb..metrics"), false)
+	if err == nil {
+		t.FailNow()
+	}
+	assert.ErrorContains(t, err, "empty segment in topic pattern 'timescaledb..metrics' at position 1")
+}
+
+func Test_Topic_Exact_Match(
+	t *testing.T,
+) {
+
+	topicFilter, err := NewTopicFilter(emptyList, asList("timescaledb.public.metrics"), false)
+	if err != nil {
+		t.Fatalf("error parsing: %+v", err)
+	}
+
+	assert.True(t, topicFilter.Matches("timescaledb.public.metrics"))
+	assert.False(t, topicFilter.Matches("timescaledb.public.metrics2"))
+	assert.False(t, topicFilter.Matches("timescaledb.public"))
+}
+
+func Test_Topic_Wildcards(
+	t *testing.T,
+) {
+
+	topicFilter, err := NewTopicFilter(emptyList, asList("timescaledb.*.metric?", "timescaledb.stats.+_daily"), false)
+	if err != nil {
+		t.Fatalf("error parsing: %+v", err)
+	}
+
+	assert.True(t, topicFilter.Matches("timescaledb.public.metrics"))
+	assert.True(t, topicFilter.Matches("timescaledb.other.metricz"))
+	assert.False(t, topicFilter.Matches("timescaledb.public.metric"))
+	assert.True(t, topicFilter.Matches("timescaledb.stats.cpu_daily"))
+	assert.False(t, topicFilter.Matches("timescaledb.stats._daily"))
+}
+
+func Test_Topic_Wildcard_Does_Not_Span_Segments(
+	t *testing.T,
+) {
+
+	topicFilter, err := NewTopicFilter(emptyList, asList("timescaledb.*"), false)
+	if err != nil {
+		t.Fatalf("error parsing: %+v", err)
+	}
+
+	assert.True(t, topicFilter.Matches("timescaledb.message"))
+	assert.False(t, topicFilter.Matches("timescaledb.public.metrics"))
+}
+
+func Test_Topic_Exclude_Has_Priority(
+	t *testing.T,
+) {
+
+	topicFilter, err := NewTopicFilter(
+		asList("timescaledb.public.secret_*"), asList("timescaledb.public.*"), false,
+	)
+	if err != nil {
+		t.Fatalf("error parsing: %+v", err)
+	}
+
+	assert.True(t, topicFilter.Matches("timescaledb.public.metrics"))
+	assert.False(t, topicFilter.Matches("timescaledb.public.secret_tokens"))
+}
+
+func Test_Topic_Special_Characters_Are_Literal(
+	t *testing.T,
+) {
+
+	topicFilter, err := NewTopicFilter(emptyList, asList("timescaledb.public.a(b)"), false)
+	if err != nil {
+		t.Fatalf("error parsing: %+v", err)
+	}
+
+	assert.True(t, topicFilter.Matches("timescaledb.public.a(b)"))
+	assert.False(t, topicFilter.Matches("timescaledb.public.ab"))
+}
@@ -134,6 +134,15 @@ func (tt *transactionTracker) OnBeginEvent(
 	if tt.supportsDecompressionMarkers {
 		return tt.resolver.OnBeginEvent(xld, msg)
 	}
+
+	// Without decompression markers the transaction's events are held
+	// back until the commit is seen. The begin is queued as the first
+	// entry (not counting towards the maximum size) to be replayed in
+	// front of the events when the transaction gets drained.
+	tt.activeTransaction.queue.Push(&transactionEntry{
+		xld: xld,
+		msg: msg,
+	})
 	return nil
 }
 
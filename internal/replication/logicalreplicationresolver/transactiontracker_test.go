@@ -0,0 +1,198 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logicalreplicationresolver
+
+import (
+	"github.com/jackc/pglogrepl"
+	"github.com/noctarius/timescaledb-event-streamer/internal/containers"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/spi/eventhandlers"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/replicationcontext"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+	"github.com/noctarius/timescaledb-event-streamer/spi/task"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_Transaction_Tracker_Replays_Begin_Without_Decompression_Markers(
+	t *testing.T,
+) {
+
+	logger, err := logging.NewLogger("TestLogger")
+	if err != nil {
+		t.Error(err)
+	}
+
+	handler := &recordingEventHandler{}
+	taskManager := &testTaskManager{handler: handler}
+	replicationContext := &testReplicationContext{}
+	systemCatalog := &testSystemCatalog{
+		table: systemcatalog.NewPgTable(1000, "public", "metrics", pgtypes.DEFAULT),
+	}
+
+	resolver := &logicalReplicationResolver{
+		replicationContext:       replicationContext,
+		systemCatalog:            systemCatalog,
+		taskManager:              taskManager,
+		logger:                   logger,
+		relations:                containers.NewRelationCache[*pgtypes.RelationMessage](),
+		chunkIdLookup:            containers.NewRelationCache[int32](),
+		eventQueues:              make(map[string]*containers.Queue[snapshotCallback]),
+		genHypertableInsertEvent: true,
+		genHypertableUpdateEvent: true,
+		genPostgresqlInsertEvent: true,
+		genPostgresqlUpdateEvent: true,
+	}
+
+	handlerTracker, err := newTransactionTracker(
+		time.Minute, 100, replicationContext, systemCatalog, resolver, taskManager,
+	)
+	if err != nil {
+		t.Error(err)
+	}
+	tracker := handlerTracker.(*transactionTracker)
+
+	relation := &pgtypes.RelationMessage{
+		RelationID:   1000,
+		Namespace:    "public",
+		RelationName: "metrics",
+	}
+	tracker.relations.Set(relation.RelationID, relation)
+	resolver.relations.Set(relation.RelationID, relation)
+
+	xld := pgtypes.XLogData{XLogData: pglogrepl.XLogData{WALStart: 100}}
+
+	assert.NoError(t, tracker.OnBeginEvent(xld, &pgtypes.BeginMessage{Xid: 42}))
+	assert.NoError(t, tracker.OnInsertEvent(xld, &pgtypes.InsertMessage{
+		InsertMessage: &pglogrepl.InsertMessage{RelationID: 1000},
+		NewValues:     map[string]any{"id": int32(1)},
+	}))
+	assert.NoError(t, tracker.OnUpdateEvent(xld, &pgtypes.UpdateMessage{
+		UpdateMessage: &pglogrepl.UpdateMessage{RelationID: 1000},
+		NewValues:     map[string]any{"id": int32(1)},
+	}))
+
+	// Nothing is handed out before the transaction is committed
+	assert.Empty(t, handler.events)
+
+	assert.NoError(t, tracker.OnCommitEvent(xld, &pgtypes.CommitMessage{TransactionEndLSN: 200}))
+	assert.Equal(t, []string{"begin", "insert", "update", "commit"}, handler.events)
+}
+
+type recordingEventHandler struct {
+	eventhandlers.RecordReplicationEventHandler
+	events []string
+}
+
+func (r *recordingEventHandler) OnBeginEvent(
+	_ pgtypes.XLogData, _ *pgtypes.BeginMessage,
+) error {
+
+	r.events = append(r.events, "begin")
+	return nil
+}
+
+func (r *recordingEventHandler) OnInsertEvent(
+	_ pgtypes.XLogData, _ schema.TableAlike, _ *systemcatalog.Chunk, _ map[string]any,
+) error {
+
+	r.events = append(r.events, "insert")
+	return nil
+}
+
+func (r *recordingEventHandler) OnUpdateEvent(
+	_ pgtypes.XLogData, _ schema.TableAlike, _ *systemcatalog.Chunk, _, _ map[string]any,
+) error {
+
+	r.events = append(r.events, "update")
+	return nil
+}
+
+func (r *recordingEventHandler) OnTransactionFinishedEvent(
+	_ pgtypes.XLogData, _ *pgtypes.CommitMessage,
+) error {
+
+	r.events = append(r.events, "commit")
+	return nil
+}
+
+type testTaskManager struct {
+	task.TaskManager
+	handler eventhandlers.RecordReplicationEventHandler
+}
+
+func (t *testTaskManager) EnqueueTask(
+	fn task.Task,
+) error {
+
+	fn(&testNotificator{handler: t.handler})
+	return nil
+}
+
+type testNotificator struct {
+	task.Notificator
+	handler eventhandlers.RecordReplicationEventHandler
+}
+
+func (t *testNotificator) NotifyRecordReplicationEventHandler(
+	fn func(handler eventhandlers.RecordReplicationEventHandler) error,
+) {
+
+	_ = fn(t.handler)
+}
+
+type testReplicationContext struct {
+	replicationcontext.ReplicationContext
+}
+
+func (t *testReplicationContext) IsDecompressionMarkingEnabled() bool {
+	return false
+}
+
+func (t *testReplicationContext) SetLastBeginLSN(
+	_ pgtypes.LSN,
+) {
+}
+
+func (t *testReplicationContext) SetLastCommitLSN(
+	_ pgtypes.LSN,
+) {
+}
+
+func (t *testReplicationContext) SetLastTransactionId(
+	_ uint32,
+) {
+}
+
+type testSystemCatalog struct {
+	systemcatalog.SystemCatalog
+	table *systemcatalog.PgTable
+}
+
+func (t *testSystemCatalog) FindVanillaTableById(
+	relId uint32,
+) (*systemcatalog.PgTable, bool) {
+
+	if t.table.RelId() == relId {
+		return t.table, true
+	}
+	return nil, false
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
 	"github.com/noctarius/timescaledb-event-streamer/spi/config"
 	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/replicationcontext"
 	"github.com/noctarius/timescaledb-event-streamer/spi/statestorage"
 	"github.com/noctarius/timescaledb-event-streamer/spi/version"
 	"github.com/stretchr/testify/assert"
@@ -400,6 +401,15 @@ func (t testReplicationContext) AcknowledgeProcessed(
 	return nil
 }
 
+func (t testReplicationContext) TrackInFlight(
+	xld pgtypes.XLogData, processedLSN *pgtypes.LSN,
+) replicationcontext.Acknowledgement {
+
+	return func() error {
+		return nil
+	}
+}
+
 func (t testReplicationContext) LastProcessedLSN() pgtypes.LSN {
 	return 0
 }
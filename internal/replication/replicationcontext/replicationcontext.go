@@ -32,8 +32,17 @@ import (
 	"github.com/samber/lo"
 	"github.com/urfave/cli"
 	"sync"
+	"time"
 )
 
+// inFlightEvent is an event tracked by the replication context,
+// which is handed to the sink, but not yet acknowledged
+type inFlightEvent struct {
+	lsn          pgtypes.LSN
+	timestamp    time.Time
+	acknowledged bool
+}
+
 type replicationContext struct {
 	pgxConfig *pgx.ConnConfig
 	logger    *logging.Logger
@@ -57,6 +66,7 @@ type replicationContext struct {
 	lastReceivedLSN   pgtypes.LSN
 	lastProcessedLSN  pgtypes.LSN
 	lastTransactionId uint32
+	inFlight          []*inFlightEvent
 
 	pgVersion   version.PostgresVersion
 	tsdbVersion version.TimescaleVersion
@@ -261,6 +271,64 @@ func (rc *replicationContext) AcknowledgeProcessed(
 		newLastProcessedLSN = *processedLSN
 	}
 
+	return rc.advanceProcessedLSN(newLastProcessedLSN, xld.ServerTime)
+}
+
+func (rc *replicationContext) TrackInFlight(
+	xld pgtypes.XLogData, processedLSN *pgtypes.LSN,
+) replicationcontext.Acknowledgement {
+
+	rc.lsnMutex.Lock()
+	defer rc.lsnMutex.Unlock()
+
+	event := &inFlightEvent{
+		lsn:       pgtypes.LSN(xld.WALStart + pglogrepl.LSN(len(xld.WALData))),
+		timestamp: xld.ServerTime,
+	}
+	if processedLSN != nil {
+		event.lsn = *processedLSN
+	}
+	rc.inFlight = append(rc.inFlight, event)
+
+	return func() error {
+		return rc.acknowledgeInFlight(event)
+	}
+}
+
+func (rc *replicationContext) acknowledgeInFlight(
+	event *inFlightEvent,
+) error {
+
+	rc.lsnMutex.Lock()
+	defer rc.lsnMutex.Unlock()
+
+	if event.acknowledged {
+		return nil
+	}
+	event.acknowledged = true
+
+	// The watermark advances over all acknowledged events at the head
+	// of the in-flight events, and stops at the first one still in flight
+	var watermark *inFlightEvent
+	for len(rc.inFlight) > 0 && rc.inFlight[0].acknowledged {
+		if watermark == nil || rc.inFlight[0].lsn >= watermark.lsn {
+			watermark = rc.inFlight[0]
+		}
+		rc.inFlight[0] = nil
+		rc.inFlight = rc.inFlight[1:]
+	}
+
+	if watermark == nil {
+		return nil
+	}
+	return rc.advanceProcessedLSN(watermark.lsn, watermark.timestamp)
+}
+
+// advanceProcessedLSN requires the lsnMutex to be held
+func (rc *replicationContext) advanceProcessedLSN(
+	newLastProcessedLSN pgtypes.LSN, timestamp time.Time,
+) error {
+
 	if newLastProcessedLSN > rc.lastProcessedLSN {
 		rc.lastProcessedLSN = newLastProcessedLSN
 	}
@@ -275,7 +343,7 @@ func (rc *replicationContext) AcknowledgeProcessed(
 	}
 
 	o.LSN = rc.lastProcessedLSN
-	o.Timestamp = xld.ServerTime
+	o.Timestamp = timestamp
 
 	return rc.stateStorageManager.Set(rc.replicationSlotName, o)
 }
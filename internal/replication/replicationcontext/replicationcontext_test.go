@@ -0,0 +1,100 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package replicationcontext
+
+import (
+	"github.com/jackc/pglogrepl"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/statestorage"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_In_Flight_Events_Advance_Contiguous_Watermark(
+	t *testing.T,
+) {
+
+	rc := newTestReplicationContext(t)
+
+	transactionEndLSN := pgtypes.LSN(350)
+	acknowledge1 := rc.TrackInFlight(testXLogData(100), nil)
+	acknowledge2 := rc.TrackInFlight(testXLogData(200), nil)
+	acknowledge3 := rc.TrackInFlight(testXLogData(300), &transactionEndLSN)
+
+	// Acknowledged out of order, the watermark must not pass
+	// the first event, which is still in flight
+	assert.NoError(t, acknowledge3())
+	assert.NoError(t, acknowledge2())
+	assert.Equal(t, pgtypes.LSN(0), rc.LastProcessedLSN())
+
+	assert.NoError(t, acknowledge1())
+	assert.Equal(t, pgtypes.LSN(350), rc.LastProcessedLSN())
+
+	offset, err := rc.Offset()
+	assert.NoError(t, err)
+	assert.Equal(t, pgtypes.LSN(350), offset.LSN)
+	assert.Len(t, rc.inFlight, 0)
+}
+
+func Test_In_Flight_Events_Acknowledged_Twice(
+	t *testing.T,
+) {
+
+	rc := newTestReplicationContext(t)
+
+	acknowledge1 := rc.TrackInFlight(testXLogData(100), nil)
+	acknowledge2 := rc.TrackInFlight(testXLogData(200), nil)
+
+	assert.NoError(t, acknowledge1())
+	assert.NoError(t, acknowledge1())
+	assert.Equal(t, pgtypes.LSN(100), rc.LastProcessedLSN())
+
+	assert.NoError(t, acknowledge2())
+	assert.Equal(t, pgtypes.LSN(200), rc.LastProcessedLSN())
+}
+
+func newTestReplicationContext(
+	t *testing.T,
+) *replicationContext {
+
+	logger, err := logging.NewLogger("ReplicationContextTest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &replicationContext{
+		logger:              logger,
+		stateStorageManager: statestorage.NewStateStorageManager(statestorage.NewDummyStateStorage()),
+		replicationSlotName: "test",
+	}
+}
+
+func testXLogData(
+	lsn uint64,
+) pgtypes.XLogData {
+
+	return pgtypes.XLogData{
+		XLogData: pglogrepl.XLogData{
+			WALStart:   pglogrepl.LSN(lsn),
+			WALData:    []byte{},
+			ServerTime: time.Now(),
+		},
+	}
+}
@@ -35,6 +35,7 @@ import (
 	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
 	"github.com/noctarius/timescaledb-event-streamer/spi/publication"
 	"github.com/noctarius/timescaledb-event-streamer/spi/replicationcontext"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
 	"github.com/noctarius/timescaledb-event-streamer/spi/statestorage"
 	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
 	"github.com/noctarius/timescaledb-event-streamer/spi/task"
@@ -168,6 +169,10 @@ func (r *Replicator) StartReplication() *cli.ExitError {
 		return cli.NewExitError("stopped", 1)
 	}
 
+	if err := eventEmitter.RegisterTables(r.selectedHypertables(systemCatalog)); err != nil {
+		return erroring.AdaptErrorWithMessage(err, "failed to register tables with the sink", 24)
+	}
+
 	var stateStorageManager statestorage.Manager
 	if err := container.Service(&stateStorageManager); err != nil {
 		return erroring.AdaptError(err, 1)
@@ -240,6 +245,20 @@ func (r *Replicator) StopReplication() *cli.ExitError {
 	return nil
 }
 
+func (r *Replicator) selectedHypertables(
+	systemCatalog systemcatalog.SystemCatalog,
+) []schema.TableAlike {
+
+	tables := make([]schema.TableAlike, 0)
+	for _, hypertable := range systemCatalog.GetAllHypertables() {
+		table := hypertable.(*systemcatalog.Hypertable)
+		if !table.IsCompressedTable() && systemCatalog.IsHypertableSelectedForReplication(table.Id()) {
+			tables = append(tables, table)
+		}
+	}
+	return tables
+}
+
 func (r *Replicator) checkReplicaIdentities(
 	systemCatalog systemcatalog.SystemCatalog,
 ) []string {
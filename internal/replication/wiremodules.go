@@ -50,7 +50,7 @@ var StaticModule = wiring.DefineModule(
 		module.Provide(logicalreplicationresolver.NewResolver, wiring.ForceInitialization())
 		module.Provide(schema.NewNameGeneratorFromConfig)
 		module.Provide(replicationchannel.NewReplicationChannel)
-		module.Provide(sinkimpl.NewSinkManager)
+		module.Provide(sinkimpl.NewSinkManagerFromConfig)
 		module.Provide(stream.NewStreamManager)
 		module.Provide(snapshotting.NewSnapshotterFromConfig)
 		module.Provide(taskmanagerimpl.NewTaskManager)
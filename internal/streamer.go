@@ -23,6 +23,7 @@ import (
 	"github.com/noctarius/timescaledb-event-streamer/internal/erroring"
 	"github.com/noctarius/timescaledb-event-streamer/internal/replication"
 	"github.com/noctarius/timescaledb-event-streamer/internal/sysconfig"
+	"github.com/noctarius/timescaledb-event-streamer/internal/tlsconfig"
 	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
 	"github.com/noctarius/timescaledb-event-streamer/spi/plugins"
 	"github.com/samber/lo"
@@ -35,13 +36,25 @@ import (
 	_ "github.com/noctarius/timescaledb-event-streamer/spi/statestorage"
 
 	// Register built-in sinks
+	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/amqp"
 	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/awskinesis"
+	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/awss3"
+	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/awssns"
 	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/awssqs"
+	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/clickhouse"
+	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/elasticsearch"
+	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/file"
 	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/http"
 	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/kafka"
+	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/lineprotocol"
+	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/mqtt"
 	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/nats"
+	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/postgresql"
+	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/pubsub"
+	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/pulsar"
 	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/redis"
 	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/stdout"
+	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/websocket"
 )
 
 const publicationName = "pg_ts_streamer"
@@ -70,6 +83,13 @@ func NewStreamer(
 			connConfig.Password = pgPassword
 		}
 
+		if spiconfig.GetOrDefault(config.Config, spiconfig.PropertyPostgresqlTlsEnabled, false) {
+			if err := tlsconfig.ConfigurePgx(config.Config, spiconfig.PropertyPostgresqlTls, connConfig); err != nil {
+				return nil, cli.NewExitError(
+					fmt.Sprintf("PostgreSQL TLS configuration failed: %s", err.Error()), 6)
+			}
+		}
+
 		config.PgxConfig = connConfig
 	}
 
@@ -120,6 +120,6 @@ type SystemCatalogProvider = func(
 ) (systemcatalog.SystemCatalog, error)
 
 type EventEmitterProvider = func(
-	*config.Config, replicationcontext.ReplicationContext, stream.Manager,
-	pgtypes.TypeManager, task.TaskManager, *stats.Service,
+	*config.Config, replicationcontext.ReplicationContext, stream.Manager, sink.Manager,
+	pgtypes.TypeManager, task.TaskManager, *stats.Service, statestorage.Manager,
 ) (*eventemitting.EventEmitter, error)
@@ -0,0 +1,80 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+)
+
+// ConfigurePgx replaces the TLS configuration pgx derived from the
+// sslmode of the connection string with the TLS properties under the
+// given prefix (e.g. `postgresql.tls`). TLS is required for every host,
+// plaintext fallbacks (sslmode=prefer or allow) are removed. Unix
+// domain sockets are left without TLS, same as libpq does.
+func ConfigurePgx(
+	c *config.Config, prefix string, connConfig *pgx.ConnConfig,
+) error {
+
+	tlsConfig, err := NewTLSConfig(c, prefix)
+	if err != nil {
+		return err
+	}
+
+	hostTLSConfig := func(
+		host string, port uint16,
+	) *tls.Config {
+
+		if network, _ := pgconn.NetworkAddress(host, port); network == "unix" {
+			return nil
+		}
+		hostTLSConfig := tlsConfig.Clone()
+		if hostTLSConfig.ServerName == "" {
+			hostTLSConfig.ServerName = host
+		}
+		return hostTLSConfig
+	}
+
+	address := func(
+		host string, port uint16,
+	) string {
+
+		return fmt.Sprintf("%s:%d", host, port)
+	}
+
+	connConfig.TLSConfig = hostTLSConfig(connConfig.Host, connConfig.Port)
+
+	seen := map[string]bool{address(connConfig.Host, connConfig.Port): true}
+	fallbacks := make([]*pgconn.FallbackConfig, 0, len(connConfig.Fallbacks))
+	for _, fallback := range connConfig.Fallbacks {
+		// Fallbacks of the same host only differ in their TLS settings
+		if seen[address(fallback.Host, fallback.Port)] {
+			continue
+		}
+		seen[address(fallback.Host, fallback.Port)] = true
+		fallbacks = append(fallbacks, &pgconn.FallbackConfig{
+			Host:      fallback.Host,
+			Port:      fallback.Port,
+			TLSConfig: hostTLSConfig(fallback.Host, fallback.Port),
+		})
+	}
+	connConfig.Fallbacks = fallbacks
+	return nil
+}
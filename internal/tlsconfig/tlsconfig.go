@@ -0,0 +1,258 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	propertySkipVerify = "skipverify"
+	propertyClientAuth = "clientauth"
+	propertyServerName = "servername"
+	propertyMinVersion = "minversion"
+	propertyCaFile     = "cafile"
+	propertyCa         = "ca"
+	propertyCertFile   = "certfile"
+	propertyCert       = "cert"
+	propertyKeyFile    = "keyfile"
+	propertyKey        = "key"
+)
+
+var versions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// NewTLSConfig creates the TLS client configuration from the TLS
+// properties under the given prefix (e.g. `sink.kafka.tls`). The CA
+// bundle, client certificate and key are provided as file paths or
+// inline PEM values. Files are re-read when they changed, so rotated
+// certificates are picked up with the next connection.
+func NewTLSConfig(
+	c *config.Config, prefix string,
+) (*tls.Config, error) {
+
+	property := func(name string) string {
+		return prefix + "." + name
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: config.GetOrDefault(c, property(propertySkipVerify), false),
+		ClientAuth:         config.GetOrDefault(c, property(propertyClientAuth), tls.NoClientCert),
+		ServerName:         config.GetOrDefault(c, property(propertyServerName), ""),
+	}
+
+	if minVersion := config.GetOrDefault(c, property(propertyMinVersion), ""); minVersion != "" {
+		version, present := versions[minVersion]
+		if !present {
+			return nil, errors.Errorf("TLS minimum version '%s' doesn't exist", minVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	caFile := config.GetOrDefault(c, property(propertyCaFile), "")
+	ca := config.GetOrDefault(c, property(propertyCa), "")
+	certFile := config.GetOrDefault(c, property(propertyCertFile), "")
+	cert := config.GetOrDefault(c, property(propertyCert), "")
+	keyFile := config.GetOrDefault(c, property(propertyKeyFile), "")
+	key := config.GetOrDefault(c, property(propertyKey), "")
+
+	if caFile != "" && ca != "" {
+		return nil, errors.Errorf("TLS CA of %s must be either a file or inline PEM, not both", prefix)
+	}
+	if (certFile != "" || keyFile != "") && (cert != "" || key != "") {
+		return nil, errors.Errorf(
+			"TLS client certificate of %s must be either files or inline PEM, not both", prefix,
+		)
+	}
+	if (certFile == "") != (keyFile == "") || (cert == "") != (key == "") {
+		return nil, errors.Errorf("TLS client certificate of %s requires both, certificate and key", prefix)
+	}
+
+	if ca != "" {
+		rootCAs := x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM([]byte(ca)) {
+			return nil, errors.Errorf("TLS CA of %s contains no valid certificate", prefix)
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	if cert != "" {
+		certificate, err := tls.X509KeyPair([]byte(cert), []byte(key))
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	if caFile == "" && certFile == "" {
+		return tlsConfig, nil
+	}
+
+	logger, err := logging.NewLogger("TLS")
+	if err != nil {
+		return nil, err
+	}
+
+	m := &material{
+		logger:   logger,
+		caFile:   caFile,
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	// Invalid material is reported at startup, later
+	// failures keep the previously loaded material
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+
+	if certFile != "" {
+		tlsConfig.GetClientCertificate = m.clientCertificate
+	}
+
+	// The standard verification can't pick up a reloaded CA
+	// bundle, the server is verified by VerifyConnection instead
+	if caFile != "" && !tlsConfig.InsecureSkipVerify {
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = m.verifyConnection
+	}
+	return tlsConfig, nil
+}
+
+// material holds the CA bundle and client certificate loaded
+// from files, which are reloaded when their modification time
+// changed
+type material struct {
+	mutex       sync.Mutex
+	logger      *logging.Logger
+	caFile      string
+	certFile    string
+	keyFile     string
+	loaded      bool
+	modTimes    [3]time.Time
+	rootCAs     *x509.CertPool
+	certificate *tls.Certificate
+}
+
+func (m *material) clientCertificate(
+	_ *tls.CertificateRequestInfo,
+) (*tls.Certificate, error) {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.reload()
+	return m.certificate, nil
+}
+
+func (m *material) verifyConnection(
+	state tls.ConnectionState,
+) error {
+
+	m.mutex.Lock()
+	m.reload()
+	rootCAs := m.rootCAs
+	m.mutex.Unlock()
+
+	if len(state.PeerCertificates) == 0 {
+		return errors.Errorf("TLS server didn't present a certificate")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, certificate := range state.PeerCertificates[1:] {
+		intermediates.AddCert(certificate)
+	}
+
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         rootCAs,
+		Intermediates: intermediates,
+		DNSName:       state.ServerName,
+	})
+	return err
+}
+
+func (m *material) reload() {
+	if err := m.load(); err != nil {
+		m.logger.Warnf("Failed to reload TLS material, keeping the previous one: %+v", err)
+	}
+}
+
+func (m *material) load() error {
+	modTimes, err := m.readModTimes()
+	if err != nil {
+		return err
+	}
+	if modTimes == m.modTimes {
+		return nil
+	}
+
+	var rootCAs *x509.CertPool
+	if m.caFile != "" {
+		ca, err := os.ReadFile(m.caFile)
+		if err != nil {
+			return errors.Wrap(err, 0)
+		}
+		rootCAs = x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(ca) {
+			return errors.Errorf("TLS CA file %s contains no valid certificate", m.caFile)
+		}
+	}
+
+	var certificate *tls.Certificate
+	if m.certFile != "" {
+		c, err := tls.LoadX509KeyPair(m.certFile, m.keyFile)
+		if err != nil {
+			return errors.Wrap(err, 0)
+		}
+		certificate = &c
+	}
+
+	if m.loaded {
+		m.logger.Infoln("Reloaded changed TLS material")
+	}
+	m.loaded = true
+	m.modTimes = modTimes
+	m.rootCAs = rootCAs
+	m.certificate = certificate
+	return nil
+}
+
+func (m *material) readModTimes() ([3]time.Time, error) {
+	modTimes := [3]time.Time{}
+	for i, file := range []string{m.caFile, m.certFile, m.keyFile} {
+		if file == "" {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return modTimes, errors.Wrap(err, 0)
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
@@ -0,0 +1,209 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/jackc/pgx/v5"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_TLS_Config_Inline_Material(
+	t *testing.T,
+) {
+
+	cert, key := testCertificate(t, "inline")
+
+	tlsConfig, err := NewTLSConfig(&config.Config{
+		Sink: config.SinkConfig{
+			Kafka: config.KafkaConfig{
+				TLS: config.TLSConfig{
+					ServerName: "kafka.local",
+					MinVersion: "1.3",
+					Ca:         string(cert),
+					Cert:       string(cert),
+					Key:        string(key),
+				},
+			},
+		},
+	}, config.PropertyKafkaTls)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "kafka.local", tlsConfig.ServerName)
+	assert.Equal(t, uint16(tls.VersionTLS13), tlsConfig.MinVersion)
+	assert.NotNil(t, tlsConfig.RootCAs)
+	assert.Len(t, tlsConfig.Certificates, 1)
+	assert.False(t, tlsConfig.InsecureSkipVerify)
+}
+
+func Test_TLS_Config_Reloads_Changed_Files(
+	t *testing.T,
+) {
+
+	directory := t.TempDir()
+	certFile := filepath.Join(directory, "client.crt")
+	keyFile := filepath.Join(directory, "client.key")
+
+	cert, key := testCertificate(t, "first")
+	writeFile(t, certFile, cert, time.Now().Add(-time.Minute))
+	writeFile(t, keyFile, key, time.Now().Add(-time.Minute))
+
+	tlsConfig, err := NewTLSConfig(&config.Config{
+		Sink: config.SinkConfig{
+			Redis: config.RedisConfig{
+				TLS: config.TLSConfig{
+					CaFile:   certFile,
+					CertFile: certFile,
+					KeyFile:  keyFile,
+				},
+			},
+		},
+	}, config.PropertyRedisTls)
+	assert.NoError(t, err)
+
+	// The CA bundle is verified by VerifyConnection
+	assert.True(t, tlsConfig.InsecureSkipVerify)
+	assert.NotNil(t, tlsConfig.VerifyConnection)
+
+	first, err := tlsConfig.GetClientCertificate(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "first", commonName(t, first))
+
+	cert, key = testCertificate(t, "second")
+	writeFile(t, certFile, cert, time.Now())
+	writeFile(t, keyFile, key, time.Now())
+
+	second, err := tlsConfig.GetClientCertificate(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "second", commonName(t, second))
+}
+
+func Test_TLS_Config_Requires_Certificate_And_Key(
+	t *testing.T,
+) {
+
+	cert, _ := testCertificate(t, "incomplete")
+
+	_, err := NewTLSConfig(&config.Config{
+		Sink: config.SinkConfig{
+			Http: config.HttpConfig{
+				TLS: config.TLSConfig{
+					Cert: string(cert),
+				},
+			},
+		},
+	}, config.PropertyHttpTls)
+
+	assert.ErrorContains(t, err, "requires both, certificate and key")
+}
+
+func Test_TLS_Config_Pgx_Requires_TLS(
+	t *testing.T,
+) {
+
+	cert, _ := testCertificate(t, "postgresql")
+
+	connConfig, err := pgx.ParseConfig("host=pg1,pg2,/tmp port=5432 sslmode=prefer")
+	assert.NoError(t, err)
+
+	err = ConfigurePgx(&config.Config{
+		PostgreSQL: config.PostgreSQLConfig{
+			TLS: config.TLSConfig{
+				Ca: string(cert),
+			},
+		},
+	}, config.PropertyPostgresqlTls, connConfig)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "pg1", connConfig.TLSConfig.ServerName)
+	assert.False(t, connConfig.TLSConfig.InsecureSkipVerify)
+	assert.NotNil(t, connConfig.TLSConfig.RootCAs)
+
+	// The plaintext fallbacks of sslmode=prefer are gone
+	assert.Len(t, connConfig.Fallbacks, 2)
+	assert.Equal(t, "pg2", connConfig.Fallbacks[0].Host)
+	assert.Equal(t, "pg2", connConfig.Fallbacks[0].TLSConfig.ServerName)
+	assert.Equal(t, "/tmp", connConfig.Fallbacks[1].Host)
+	assert.Nil(t, connConfig.Fallbacks[1].TLSConfig)
+}
+
+func testCertificate(
+	t *testing.T, commonName string,
+) (cert []byte, key []byte) {
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+func writeFile(
+	t *testing.T, path string, data []byte, modTime time.Time,
+) {
+
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func commonName(
+	t *testing.T, certificate *tls.Certificate,
+) string {
+
+	parsed, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Subject.CommonName
+}
@@ -35,13 +35,25 @@ const (
 type SinkType string
 
 const (
-	Stdout     SinkType = "stdout"
-	NATS       SinkType = "nats"
-	Kafka      SinkType = "kafka"
-	Redis      SinkType = "redis"
-	AwsKinesis SinkType = "kinesis"
-	AwsSQS     SinkType = "sqs"
-	Http       SinkType = "http"
+	Stdout        SinkType = "stdout"
+	NATS          SinkType = "nats"
+	Kafka         SinkType = "kafka"
+	Redis         SinkType = "redis"
+	AwsKinesis    SinkType = "kinesis"
+	AwsSQS        SinkType = "sqs"
+	Http          SinkType = "http"
+	Amqp          SinkType = "amqp"
+	Mqtt          SinkType = "mqtt"
+	File          SinkType = "file"
+	Pulsar        SinkType = "pulsar"
+	WebSocket     SinkType = "websocket"
+	PostgreSQL    SinkType = "postgresql"
+	ClickHouse    SinkType = "clickhouse"
+	Elasticsearch SinkType = "elasticsearch"
+	AwsS3         SinkType = "s3"
+	PubSub        SinkType = "pubsub"
+	AwsSNS        SinkType = "sns"
+	LineProtocol  SinkType = "lineprotocol"
 )
 
 type NamingStrategyType string
@@ -75,6 +87,7 @@ type PostgreSQLConfig struct {
 	Snapshot        SnapshotConfig         `toml:"snapshot" yaml:"snapshot"`
 	Tables          IncludedTablesConfig   `toml:"tables" yaml:"tables"`
 	Events          PostgresqlEventsConfig `toml:"events" yaml:"events"`
+	TLS             TLSConfig              `toml:"tls" yaml:"tls"`
 }
 
 type InternalConfig struct {
@@ -133,15 +146,49 @@ type TransactionWindowConfig struct {
 }
 
 type SinkConfig struct {
-	Type       SinkType                     `toml:"type" yaml:"type"`
-	Tombstone  *bool                        `toml:"tombstone" yaml:"tombstone"`
-	Filters    map[string]EventFilterConfig `toml:"filters" yaml:"filters"`
-	Nats       NatsConfig                   `toml:"nats" yaml:"nats"`
-	Kafka      KafkaConfig                  `toml:"kafka" yaml:"kafka"`
-	Redis      RedisConfig                  `toml:"redis" yaml:"redis"`
-	AwsKinesis AwsKinesisConfig             `toml:"kinesis" yaml:"kinesis"`
-	AwsSqs     AwsSqsConfig                 `toml:"sqs" yaml:"sqs"`
-	Http       HttpConfig                   `toml:"http" yaml:"http"`
+	Type          SinkType                     `toml:"type" yaml:"type"`
+	Tombstone     *bool                        `toml:"tombstone" yaml:"tombstone"`
+	Filters       map[string]EventFilterConfig `toml:"filters" yaml:"filters"`
+	Nats          NatsConfig                   `toml:"nats" yaml:"nats"`
+	Kafka         KafkaConfig                  `toml:"kafka" yaml:"kafka"`
+	Redis         RedisConfig                  `toml:"redis" yaml:"redis"`
+	AwsKinesis    AwsKinesisConfig             `toml:"kinesis" yaml:"kinesis"`
+	AwsSqs        AwsSqsConfig                 `toml:"sqs" yaml:"sqs"`
+	Http          HttpConfig                   `toml:"http" yaml:"http"`
+	Amqp          AmqpConfig                   `toml:"amqp" yaml:"amqp"`
+	Mqtt          MqttConfig                   `toml:"mqtt" yaml:"mqtt"`
+	File          FileConfig                   `toml:"file" yaml:"file"`
+	Pulsar        PulsarConfig                 `toml:"pulsar" yaml:"pulsar"`
+	WebSocket     WebSocketConfig              `toml:"websocket" yaml:"websocket"`
+	PostgreSQL    PostgreSQLSinkConfig         `toml:"postgresql" yaml:"postgresql"`
+	ClickHouse    ClickHouseConfig             `toml:"clickhouse" yaml:"clickhouse"`
+	Elasticsearch ElasticsearchConfig          `toml:"elasticsearch" yaml:"elasticsearch"`
+	AwsS3         AwsS3Config                  `toml:"s3" yaml:"s3"`
+	PubSub        PubSubConfig                 `toml:"pubsub" yaml:"pubsub"`
+	AwsSns        AwsSnsConfig                 `toml:"sns" yaml:"sns"`
+	LineProtocol  LineProtocolConfig           `toml:"lineprotocol" yaml:"lineProtocol"`
+	Sinks         map[string]SinkConfig        `toml:"sinks" yaml:"sinks"`
+	Routes        map[string]SinkRouteConfig   `toml:"routes" yaml:"routes"`
+	DeadLetter    DeadLetterConfig             `toml:"deadletter" yaml:"deadLetter"`
+	Batch         SinkBatchConfig              `toml:"batch" yaml:"batch"`
+}
+
+type SinkBatchConfig struct {
+	Size   *int `toml:"size" yaml:"size"`
+	Bytes  *int `toml:"bytes" yaml:"bytes"`
+	Linger *int `toml:"linger" yaml:"linger"`
+}
+
+type DeadLetterConfig struct {
+	Sink          *SinkConfig `toml:"sink" yaml:"sink"`
+	Topic         string      `toml:"topic" yaml:"topic"`
+	PermanentOnly *bool       `toml:"permanentonly" yaml:"permanentOnly"`
+}
+
+type SinkRouteConfig struct {
+	Sinks   []string                     `toml:"sinks" yaml:"sinks"`
+	Topics  *IncludedTablesConfig        `toml:"topics" yaml:"topics"`
+	Filters map[string]EventFilterConfig `toml:"filters" yaml:"filters"`
 }
 
 type EventFilterConfig struct {
@@ -181,6 +228,43 @@ type NatsConfig struct {
 	UserInfo      NatsUserInfoConfig    `toml:"userinfo" yaml:"userInfo"`
 	Credentials   NatsCredentialsConfig `toml:"credentials" yaml:"credentials"`
 	JWT           NatsJWTConfig         `toml:"jwt" yaml:"jwt"`
+	Async         NatsAsyncConfig       `toml:"async" yaml:"async"`
+	TLS           TLSConfig             `toml:"tls" yaml:"tls"`
+	Mode          NatsMode              `toml:"mode" yaml:"mode"`
+	JetStream     NatsJetStreamConfig   `toml:"jetstream" yaml:"jetStream"`
+}
+
+type NatsMode string
+
+const (
+	NatsJetStreamMode NatsMode = "jetstream"
+	NatsCoreMode      NatsMode = "core"
+)
+
+type NatsJetStreamConfig struct {
+	Stream NatsStreamConfig `toml:"stream" yaml:"stream"`
+}
+
+type NatsStreamConfig struct {
+	Create     bool                `toml:"create" yaml:"create"`
+	Name       string              `toml:"name" yaml:"name"`
+	Subjects   []string            `toml:"subjects" yaml:"subjects"`
+	Retention  NatsRetentionPolicy `toml:"retention" yaml:"retention"`
+	Replicas   *int                `toml:"replicas" yaml:"replicas"`
+	MaxAge     *int                `toml:"maxage" yaml:"maxAge"`
+	Duplicates *int                `toml:"duplicates" yaml:"duplicates"`
+}
+
+type NatsRetentionPolicy string
+
+const (
+	NatsLimitsRetention    NatsRetentionPolicy = "limits"
+	NatsInterestRetention  NatsRetentionPolicy = "interest"
+	NatsWorkQueueRetention NatsRetentionPolicy = "workqueue"
+)
+
+type NatsAsyncConfig struct {
+	MaxPending *int `toml:"maxpending" yaml:"maxPending"`
 }
 
 type KafkaSaslConfig struct {
@@ -190,26 +274,116 @@ type KafkaSaslConfig struct {
 	Mechanism sarama.SASLMechanism `toml:"mechanism" yaml:"mechanism"`
 }
 
+type KafkaTransactionalConfig struct {
+	Id           string `toml:"id" yaml:"id"`
+	OffsetsTopic string `toml:"offsetstopic" yaml:"offsetsTopic"`
+}
+
+type KafkaPartitionerConfig struct {
+	Type       KafkaPartitionerType `toml:"type" yaml:"type"`
+	Column     string               `toml:"column" yaml:"column"`
+	Partitions map[string]int32     `toml:"partitions" yaml:"partitions"`
+}
+
+type KafkaPartitionerType string
+
+const (
+	KafkaHashPartitioner       KafkaPartitionerType = "hash"
+	KafkaColumnPartitioner     KafkaPartitionerType = "column"
+	KafkaDimensionPartitioner  KafkaPartitionerType = "dimension"
+	KafkaRoundRobinPartitioner KafkaPartitionerType = "roundrobin"
+	KafkaExplicitPartitioner   KafkaPartitionerType = "explicit"
+)
+
+type KafkaProvisioningConfig struct {
+	Enabled           *bool                                   `toml:"enabled" yaml:"enabled"`
+	Eager             *bool                                   `toml:"eager" yaml:"eager"`
+	Partitions        *int                                    `toml:"partitions" yaml:"partitions"`
+	ReplicationFactor *int                                    `toml:"replicationfactor" yaml:"replicationFactor"`
+	Retention         *int                                    `toml:"retention" yaml:"retention"`
+	Compact           *bool                                   `toml:"compact" yaml:"compact"`
+	Settings          map[string]KafkaTopicProvisioningConfig `toml:"settings" yaml:"settings"`
+}
+
+type KafkaTopicProvisioningConfig struct {
+	Topics            *IncludedTablesConfig `toml:"topics" yaml:"topics"`
+	Partitions        *int                  `toml:"partitions" yaml:"partitions"`
+	ReplicationFactor *int                  `toml:"replicationfactor" yaml:"replicationFactor"`
+	Retention         *int                  `toml:"retention" yaml:"retention"`
+	Compact           *bool                 `toml:"compact" yaml:"compact"`
+}
+
 type KafkaConfig struct {
-	Brokers    []string        `toml:"brokers" yaml:"brokers"`
-	Idempotent *bool           `toml:"idempotent" yaml:"idempotent"`
-	Sasl       KafkaSaslConfig `toml:"sasl" yaml:"sasl"`
-	TLS        TLSConfig       `toml:"tls" yaml:"tls"`
+	Brokers       []string                 `toml:"brokers" yaml:"brokers"`
+	Idempotent    *bool                    `toml:"idempotent" yaml:"idempotent"`
+	Sasl          KafkaSaslConfig          `toml:"sasl" yaml:"sasl"`
+	Partitioner   KafkaPartitionerConfig   `toml:"partitioner" yaml:"partitioner"`
+	Provisioning  KafkaProvisioningConfig  `toml:"provisioning" yaml:"provisioning"`
+	Transactional KafkaTransactionalConfig `toml:"transactional" yaml:"transactional"`
+	TLS           TLSConfig                `toml:"tls" yaml:"tls"`
 }
 
 type RedisConfig struct {
-	Network  string             `toml:"network" yaml:"network"`
-	Address  string             `toml:"address" yaml:"address"`
-	Password string             `toml:"password" yaml:"password"`
-	Database int                `toml:"database" yaml:"database"`
-	Retries  RedisRetryConfig   `toml:"retries" yaml:"retries"`
-	Timeouts RedisTimeoutConfig `toml:"timeouts" yaml:"timeouts"`
-	PoolSize int                `toml:"poolsize" yaml:"poolSize"`
-	TLS      TLSConfig          `toml:"tls" yaml:"tls"`
+	Network  string              `toml:"network" yaml:"network"`
+	Address  string              `toml:"address" yaml:"address"`
+	Password string              `toml:"password" yaml:"password"`
+	Database int                 `toml:"database" yaml:"database"`
+	Retries  RedisRetryConfig    `toml:"retries" yaml:"retries"`
+	Timeouts RedisTimeoutConfig  `toml:"timeouts" yaml:"timeouts"`
+	PoolSize int                 `toml:"poolsize" yaml:"poolSize"`
+	TLS      TLSConfig           `toml:"tls" yaml:"tls"`
+	Mode     RedisMode           `toml:"mode" yaml:"mode"`
+	Stream   RedisStreamConfig   `toml:"stream" yaml:"stream"`
+	KeyValue RedisKeyValueConfig `toml:"keyvalue" yaml:"keyValue"`
+	Cluster  RedisClusterConfig  `toml:"cluster" yaml:"cluster"`
+	Sentinel RedisSentinelConfig `toml:"sentinel" yaml:"sentinel"`
+}
+
+type RedisClusterConfig struct {
+	Enabled      bool     `toml:"enabled" yaml:"enabled"`
+	Addresses    []string `toml:"addresses" yaml:"addresses"`
+	MaxRedirects *int     `toml:"maxredirects" yaml:"maxRedirects"`
+	HashTags     *bool    `toml:"hashtags" yaml:"hashTags"`
+}
+
+type RedisSentinelConfig struct {
+	MasterName string   `toml:"mastername" yaml:"masterName"`
+	Addresses  []string `toml:"addresses" yaml:"addresses"`
+}
+
+type RedisMode string
+
+const (
+	RedisStreamMode   RedisMode = "stream"
+	RedisPublishMode  RedisMode = "publish"
+	RedisKeyValueMode RedisMode = "keyvalue"
+)
+
+type RedisStreamConfig struct {
+	Trim RedisStreamTrimConfig `toml:"trim" yaml:"trim"`
 }
 
+type RedisStreamTrimConfig struct {
+	MaxLen      *int  `toml:"maxlen" yaml:"maxLen"`
+	MaxAge      *int  `toml:"maxage" yaml:"maxAge"`
+	Approximate *bool `toml:"approximate" yaml:"approximate"`
+}
+
+type RedisKeyValueConfig struct {
+	Format RedisKeyValueFormat `toml:"format" yaml:"format"`
+	Key    string              `toml:"key" yaml:"key"`
+}
+
+type RedisKeyValueFormat string
+
+const (
+	RedisJsonFormat RedisKeyValueFormat = "json"
+	RedisHashFormat RedisKeyValueFormat = "hash"
+)
+
 type RedisRetryConfig struct {
 	MaxAttempts int                     `toml:"maxattempts" yaml:"maxAttempts"`
+	Timeout     *int                    `toml:"timeout" yaml:"timeout"`
 	Backoff     RedisRetryBackoffConfig `toml:"backoff" yaml:"backoff"`
 }
 
@@ -234,6 +408,14 @@ type TLSConfig struct {
 	Enabled    bool               `toml:"enabled" yaml:"enabled"`
 	SkipVerify *bool              `toml:"skipverify" yaml:"skipVerify"`
 	ClientAuth tls.ClientAuthType `toml:"clientauth" yaml:"clientAuth"`
+	ServerName string             `toml:"servername" yaml:"serverName"`
+	MinVersion string             `toml:"minversion" yaml:"minVersion"`
+	CaFile     string             `toml:"cafile" yaml:"caFile"`
+	Ca         string             `toml:"ca" yaml:"ca"`
+	CertFile   string             `toml:"certfile" yaml:"certFile"`
+	Cert       string             `toml:"cert" yaml:"cert"`
+	KeyFile    string             `toml:"keyfile" yaml:"keyFile"`
+	Key        string             `toml:"key" yaml:"key"`
 }
 
 type IncludedTablesConfig struct {
@@ -282,6 +464,32 @@ type AwsSqsQueueConfig struct {
 	Url *string `toml:"url" yaml:"url"`
 }
 
+type AwsSnsConfig struct {
+	Topic AwsSnsTopicConfig   `toml:"topic" yaml:"topic"`
+	Aws   AwsConnectionConfig `toml:"aws" yaml:"aws"`
+}
+
+type AwsSnsTopicConfig struct {
+	Arn *string `toml:"arn" yaml:"arn"`
+}
+
+type AwsS3Config struct {
+	Bucket AwsS3BucketConfig   `toml:"bucket" yaml:"bucket"`
+	Object AwsS3ObjectConfig   `toml:"object" yaml:"object"`
+	Aws    AwsConnectionConfig `toml:"aws" yaml:"aws"`
+}
+
+type AwsS3BucketConfig struct {
+	Name           *string `toml:"name" yaml:"name"`
+	ForcePathStyle *bool   `toml:"forcepathstyle" yaml:"forcePathStyle"`
+}
+
+type AwsS3ObjectConfig struct {
+	KeyTemplate string `toml:"keytemplate" yaml:"keyTemplate"`
+	MaxSize     string `toml:"maxsize" yaml:"maxSize"`
+	MaxDuration int    `toml:"maxduration" yaml:"maxDuration"`
+}
+
 type AwsConnectionConfig struct {
 	Region          *string `toml:"region" yaml:"region"`
 	Endpoint        string  `toml:"endpoint" yaml:"endpoint"`
@@ -292,14 +500,36 @@ type AwsConnectionConfig struct {
 
 type HttpConfig struct {
 	Url            string                   `toml:"url" yaml:"url"`
+	Headers        map[string]string        `toml:"headers" yaml:"headers"`
+	Gzip           *bool                    `toml:"gzip" yaml:"gzip"`
+	Batch          HttpBatchConfig          `toml:"batch" yaml:"batch"`
+	Retries        HttpRetriesConfig        `toml:"retries" yaml:"retries"`
 	Authentication HttpAuthenticationConfig `toml:"authentication" yaml:"authentication"`
 	TLS            TLSConfig                `toml:"tls" yaml:"tls"`
 }
 
+type HttpBatchConfig struct {
+	Format HttpBatchFormat `toml:"format" yaml:"format"`
+}
+
+type HttpBatchFormat string
+
+const (
+	HttpBatchNone   HttpBatchFormat = "none"
+	HttpBatchNdjson HttpBatchFormat = "ndjson"
+	HttpBatchArray  HttpBatchFormat = "array"
+)
+
+type HttpRetriesConfig struct {
+	MaxWait *int `toml:"maxwait" yaml:"maxWait"`
+}
+
 type HttpAuthenticationConfig struct {
 	Type   HttpAuthenticationType         `toml:"type" yaml:"type"`
 	Basic  HttpBasicAuthenticationConfig  `toml:"basic" yaml:"basic"`
 	Header HttpHeaderAuthenticationConfig `toml:"header" yaml:"header"`
+	Hmac   HttpHmacAuthenticationConfig   `toml:"hmac" yaml:"hmac"`
+	OAuth2 HttpOAuth2AuthenticationConfig `toml:"oauth2" yaml:"oauth2"`
 }
 
 type HttpBasicAuthenticationConfig struct {
@@ -312,14 +542,181 @@ type HttpHeaderAuthenticationConfig struct {
 	Value string `toml:"value" yaml:"value"`
 }
 
+type HttpHmacAuthenticationConfig struct {
+	Secret          string `toml:"secret" yaml:"secret"`
+	Header          string `toml:"header" yaml:"header"`
+	TimestampHeader string `toml:"timestampheader" yaml:"timestampHeader"`
+}
+
+type HttpOAuth2AuthenticationConfig struct {
+	TokenUrl     string `toml:"tokenurl" yaml:"tokenUrl"`
+	ClientId     string `toml:"clientid" yaml:"clientId"`
+	ClientSecret string `toml:"clientsecret" yaml:"clientSecret"`
+	Scope        string `toml:"scope" yaml:"scope"`
+}
+
 type HttpAuthenticationType string
 
 const (
 	NoneAuthentication   HttpAuthenticationType = "none"
 	BasicAuthentication  HttpAuthenticationType = "basic"
 	HeaderAuthentication HttpAuthenticationType = "header"
+	HmacAuthentication   HttpAuthenticationType = "hmac"
+	OAuth2Authentication HttpAuthenticationType = "oauth2"
+)
+
+type AmqpConfig struct {
+	Url      string             `toml:"url" yaml:"url"`
+	Exchange AmqpExchangeConfig `toml:"exchange" yaml:"exchange"`
+	Confirms AmqpConfirmsConfig `toml:"confirms" yaml:"confirms"`
+	TLS      TLSConfig          `toml:"tls" yaml:"tls"`
+}
+
+type AmqpExchangeConfig struct {
+	Name    string `toml:"name" yaml:"name"`
+	Kind    string `toml:"kind" yaml:"kind"`
+	Declare *bool  `toml:"declare" yaml:"declare"`
+	Durable *bool  `toml:"durable" yaml:"durable"`
+}
+
+type AmqpConfirmsConfig struct {
+	Enabled *bool `toml:"enabled" yaml:"enabled"`
+	Timeout int   `toml:"timeout" yaml:"timeout"`
+}
+
+type MqttConfig struct {
+	Broker          string    `toml:"broker" yaml:"broker"`
+	ClientId        string    `toml:"clientid" yaml:"clientId"`
+	ProtocolVersion uint      `toml:"protocolversion" yaml:"protocolVersion"`
+	Username        string    `toml:"username" yaml:"username"`
+	Password        string    `toml:"password" yaml:"password"`
+	QoS             *byte     `toml:"qos" yaml:"qos"`
+	Retained        *bool     `toml:"retained" yaml:"retained"`
+	Timeout         int       `toml:"timeout" yaml:"timeout"`
+	TLS             TLSConfig `toml:"tls" yaml:"tls"`
+}
+
+type FileConfig struct {
+	Path          string  `toml:"path" yaml:"path"`
+	MaxSize       *string `toml:"maxsize" yaml:"maxSize"`
+	MaxDuration   *int    `toml:"maxduration" yaml:"maxDuration"`
+	Compress      *bool   `toml:"compress" yaml:"compress"`
+	FsyncInterval *int    `toml:"fsyncinterval" yaml:"fsyncInterval"`
+}
+
+type PulsarConfig struct {
+	Url            string                     `toml:"url" yaml:"url"`
+	Tenant         string                     `toml:"tenant" yaml:"tenant"`
+	Namespace      string                     `toml:"namespace" yaml:"namespace"`
+	Persistent     *bool                      `toml:"persistent" yaml:"persistent"`
+	Timeout        int                        `toml:"timeout" yaml:"timeout"`
+	Authentication PulsarAuthenticationConfig `toml:"authentication" yaml:"authentication"`
+	TLS            TLSConfig                  `toml:"tls" yaml:"tls"`
+}
+
+type PulsarAuthenticationConfig struct {
+	Token string `toml:"token" yaml:"token"`
+}
+
+type WebSocketConfig struct {
+	Address      string `toml:"address" yaml:"address"`
+	BufferSize   int    `toml:"buffersize" yaml:"bufferSize"`
+	WriteTimeout int    `toml:"writetimeout" yaml:"writeTimeout"`
+}
+
+type PostgreSQLSinkConfig struct {
+	Connection  string                          `toml:"connection" yaml:"connection"`
+	Password    string                          `toml:"password" yaml:"password"`
+	Schema      string                          `toml:"schema" yaml:"schema"`
+	AutoCreate  *bool                           `toml:"autocreate" yaml:"autoCreate"`
+	Hypertables *bool                           `toml:"hypertables" yaml:"hypertables"`
+	Transaction PostgreSQLSinkTransactionConfig `toml:"transaction" yaml:"transaction"`
+	TLS         TLSConfig                       `toml:"tls" yaml:"tls"`
+}
+
+type PostgreSQLSinkTransactionConfig struct {
+	MaxStatements *int `toml:"maxstatements" yaml:"maxStatements"`
+}
+
+type ClickHouseConfig struct {
+	Url            string                   `toml:"url" yaml:"url"`
+	Database       string                   `toml:"database" yaml:"database"`
+	Authentication HttpAuthenticationConfig `toml:"authentication" yaml:"authentication"`
+	TLS            TLSConfig                `toml:"tls" yaml:"tls"`
+	Batch          ClickHouseBatchConfig    `toml:"batch" yaml:"batch"`
+	Columns        ClickHouseColumnsConfig  `toml:"columns" yaml:"columns"`
+}
+
+type ClickHouseBatchConfig struct {
+	Size     int `toml:"size" yaml:"size"`
+	Interval int `toml:"interval" yaml:"interval"`
+}
+
+type ClickHouseColumnsConfig struct {
+	Sign    string `toml:"sign" yaml:"sign"`
+	Version string `toml:"version" yaml:"version"`
+	Deleted string `toml:"deleted" yaml:"deleted"`
+}
+
+type LineProtocolConfig struct {
+	Address        string                             `toml:"address" yaml:"address"`
+	Authentication HttpAuthenticationConfig           `toml:"authentication" yaml:"authentication"`
+	TLS            TLSConfig                          `toml:"tls" yaml:"tls"`
+	Precision      string                             `toml:"precision" yaml:"precision"`
+	Batch          LineProtocolBatchConfig            `toml:"batch" yaml:"batch"`
+	Tables         map[string]LineProtocolTableConfig `toml:"tables" yaml:"tables"`
+}
+
+type LineProtocolBatchConfig struct {
+	Size     int `toml:"size" yaml:"size"`
+	Interval int `toml:"interval" yaml:"interval"`
+}
+
+type LineProtocolTableConfig struct {
+	Measurement string   `toml:"measurement" yaml:"measurement"`
+	Tags        []string `toml:"tags" yaml:"tags"`
+	Fields      []string `toml:"fields" yaml:"fields"`
+}
+
+type ElasticsearchConfig struct {
+	Url            string                            `toml:"url" yaml:"url"`
+	Authentication ElasticsearchAuthenticationConfig `toml:"authentication" yaml:"authentication"`
+	TLS            TLSConfig                         `toml:"tls" yaml:"tls"`
+	Batch          ElasticsearchBatchConfig          `toml:"batch" yaml:"batch"`
+	Retries        int                               `toml:"retries" yaml:"retries"`
+}
+
+type ElasticsearchAuthenticationConfig struct {
+	Type   ElasticsearchAuthenticationType `toml:"type" yaml:"type"`
+	Basic  HttpBasicAuthenticationConfig   `toml:"basic" yaml:"basic"`
+	ApiKey string                          `toml:"apikey" yaml:"apiKey"`
+}
+
+type ElasticsearchAuthenticationType string
+
+const (
+	ElasticsearchNoneAuthentication   ElasticsearchAuthenticationType = "none"
+	ElasticsearchBasicAuthentication  ElasticsearchAuthenticationType = "basic"
+	ElasticsearchApiKeyAuthentication ElasticsearchAuthenticationType = "apikey"
 )
 
+type ElasticsearchBatchConfig struct {
+	Size     int `toml:"size" yaml:"size"`
+	Interval int `toml:"interval" yaml:"interval"`
+}
+
+type PubSubConfig struct {
+	ProjectId       string            `toml:"projectid" yaml:"projectId"`
+	Topic           PubSubTopicConfig `toml:"topic" yaml:"topic"`
+	EmulatorHost    string            `toml:"emulatorhost" yaml:"emulatorHost"`
+	CredentialsFile string            `toml:"credentialsfile" yaml:"credentialsFile"`
+}
+
+type PubSubTopicConfig struct {
+	Name   string `toml:"name" yaml:"name"`
+	Create *bool  `toml:"create" yaml:"create"`
+}
+
 type Config struct {
 	PostgreSQL   PostgreSQLConfig   `toml:"postgresql" yaml:"postgresql"`
 	Sink         SinkConfig         `toml:"sink" yaml:"sink"`
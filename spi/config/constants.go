@@ -31,10 +31,19 @@ const (
 	PropertyPostgresqlTxwindowEnabled         = "postgresql.transaction.window.enabled"
 	PropertyPostgresqlTxwindowTimeout         = "postgresql.transaction.window.timeout"
 	PropertyPostgresqlTxwindowMaxsize         = "postgresql.transaction.window.maxsize"
+	PropertyPostgresqlTls                     = "postgresql.tls"
+	PropertyPostgresqlTlsEnabled              = "postgresql.tls.enabled"
 
 	PropertySink          = "sink.type"
 	PropertySinkTombstone = "sink.tombstone"
 
+	PropertySinkDeadLetterTopic         = "sink.deadletter.topic"
+	PropertySinkDeadLetterPermanentOnly = "sink.deadletter.permanentonly"
+
+	PropertySinkBatchSize   = "sink.batch.size"
+	PropertySinkBatchBytes  = "sink.batch.bytes"
+	PropertySinkBatchLinger = "sink.batch.linger"
+
 	PropertyStatsEnabled        = "stats.enabled"
 	PropertyStatsPort           = "stats.port"
 	PropertyRuntimeStatsEnabled = "stats.runtime.enabled"
@@ -64,39 +73,75 @@ const (
 
 	PropertyNamingStrategy = "topic.namingstrategy.type"
 
-	PropertyKafkaBrokers       = "sink.kafka.brokers"
-	PropertyKafkaSaslEnabled   = "sink.kafka.sasl.enabled"
-	PropertyKafkaSaslUser      = "sink.kafka.sasl.user"
-	PropertyKafkaSaslPassword  = "sink.kafka.sasl.password"
-	PropertyKafkaSaslMechanism = "sink.kafka.sasl.mechanism"
-	PropertyKafkaTlsEnabled    = "sink.kafka.tls.enabled"
-	PropertyKafkaTlsSkipVerify = "sink.kafka.tls.skipverify"
-	PropertyKafkaTlsClientAuth = "sink.kafka.tls.clientauth"
-
-	PropertyNatsAddress                = "sink.nats.address"
-	PropertyNatsAuthorization          = "sink.nats.authorization"
-	PropertyNatsUserinfoUsername       = "sink.nats.userinfo.username"
-	PropertyNatsUserinfoPassword       = "sink.nats.userinfo.password"
-	PropertyNatsCredentialsCertificate = "sink.nats.credentials.certificate"
-	PropertyNatsCredentialsSeeds       = "sink.nats.credentials.seeds"
-	PropertyNatsJwt                    = "sink.nats.jwt.jwt"
-	PropertyNatsJwtSeed                = "sink.nats.jwt.seed"
-
-	PropertyRedisNetwork           = "sink.redis.network"
-	PropertyRedisAddress           = "sink.redis.address"
-	PropertyRedisPassword          = "sink.redis.password"
-	PropertyRedisDatabase          = "sink.redis.database"
-	PropertyRedisPoolsize          = "sink.redis.poolsize"
-	PropertyRedisRetriesMax        = "sink.redis.retries.maxattempts"
-	PropertyRedisRetriesBackoffMin = "sink.redis.retries.backoff.min"
-	PropertyRedisRetriesBackoffMax = "sink.redis.retries.backoff.max"
-	PropertyRedisTimeoutDial       = "sink.redis.timeouts.dial"
-	PropertyRedisTimeoutRead       = "sink.redis.timeouts.read"
-	PropertyRedisTimeoutWrite      = "sink.redis.timeouts.write"
-	PropertyRedisTimeoutPool       = "sink.redis.timeouts.pool"
-	PropertyRedisTimeoutIdle       = "sink.redis.timeouts.idle"
-	PropertyRedisTlsSkipVerify     = "sink.redis.tls.skipverify"
-	PropertyRedisTlsClientAuth     = "sink.redis.tls.clientauth"
+	PropertyKafkaBrokers                       = "sink.kafka.brokers"
+	PropertyKafkaSaslEnabled                   = "sink.kafka.sasl.enabled"
+	PropertyKafkaSaslUser                      = "sink.kafka.sasl.user"
+	PropertyKafkaSaslPassword                  = "sink.kafka.sasl.password"
+	PropertyKafkaSaslMechanism                 = "sink.kafka.sasl.mechanism"
+	PropertyKafkaTls                           = "sink.kafka.tls"
+	PropertyKafkaTlsEnabled                    = "sink.kafka.tls.enabled"
+	PropertyKafkaTlsSkipVerify                 = "sink.kafka.tls.skipverify"
+	PropertyKafkaTlsClientAuth                 = "sink.kafka.tls.clientauth"
+	PropertyKafkaPartitionerType               = "sink.kafka.partitioner.type"
+	PropertyKafkaPartitionerColumn             = "sink.kafka.partitioner.column"
+	PropertyKafkaProvisioningEnabled           = "sink.kafka.provisioning.enabled"
+	PropertyKafkaProvisioningEager             = "sink.kafka.provisioning.eager"
+	PropertyKafkaProvisioningPartitions        = "sink.kafka.provisioning.partitions"
+	PropertyKafkaProvisioningReplicationFactor = "sink.kafka.provisioning.replicationfactor"
+	PropertyKafkaProvisioningRetention         = "sink.kafka.provisioning.retention"
+	PropertyKafkaProvisioningCompact           = "sink.kafka.provisioning.compact"
+	PropertyKafkaTransactionalId               = "sink.kafka.transactional.id"
+	PropertyKafkaTransactionalOffsetsTopic     = "sink.kafka.transactional.offsetstopic"
+
+	PropertyNatsAddress                   = "sink.nats.address"
+	PropertyNatsAuthorization             = "sink.nats.authorization"
+	PropertyNatsUserinfoUsername          = "sink.nats.userinfo.username"
+	PropertyNatsUserinfoPassword          = "sink.nats.userinfo.password"
+	PropertyNatsCredentialsCertificate    = "sink.nats.credentials.certificate"
+	PropertyNatsCredentialsSeeds          = "sink.nats.credentials.seeds"
+	PropertyNatsJwt                       = "sink.nats.jwt.jwt"
+	PropertyNatsJwtSeed                   = "sink.nats.jwt.seed"
+	PropertyNatsTls                       = "sink.nats.tls"
+	PropertyNatsTlsEnabled                = "sink.nats.tls.enabled"
+	PropertyNatsAsyncMaxPending           = "sink.nats.async.maxpending"
+	PropertyNatsMode                      = "sink.nats.mode"
+	PropertyNatsJetStreamStreamCreate     = "sink.nats.jetstream.stream.create"
+	PropertyNatsJetStreamStreamName       = "sink.nats.jetstream.stream.name"
+	PropertyNatsJetStreamStreamSubjects   = "sink.nats.jetstream.stream.subjects"
+	PropertyNatsJetStreamStreamRetention  = "sink.nats.jetstream.stream.retention"
+	PropertyNatsJetStreamStreamReplicas   = "sink.nats.jetstream.stream.replicas"
+	PropertyNatsJetStreamStreamMaxAge     = "sink.nats.jetstream.stream.maxage"
+	PropertyNatsJetStreamStreamDuplicates = "sink.nats.jetstream.stream.duplicates"
+
+	PropertyRedisNetwork               = "sink.redis.network"
+	PropertyRedisAddress               = "sink.redis.address"
+	PropertyRedisPassword              = "sink.redis.password"
+	PropertyRedisDatabase              = "sink.redis.database"
+	PropertyRedisPoolsize              = "sink.redis.poolsize"
+	PropertyRedisRetriesMax            = "sink.redis.retries.maxattempts"
+	PropertyRedisRetriesBackoffMin     = "sink.redis.retries.backoff.min"
+	PropertyRedisRetriesBackoffMax     = "sink.redis.retries.backoff.max"
+	PropertyRedisRetriesTimeout        = "sink.redis.retries.timeout"
+	PropertyRedisTimeoutDial           = "sink.redis.timeouts.dial"
+	PropertyRedisTimeoutRead           = "sink.redis.timeouts.read"
+	PropertyRedisTimeoutWrite          = "sink.redis.timeouts.write"
+	PropertyRedisTimeoutPool           = "sink.redis.timeouts.pool"
+	PropertyRedisTimeoutIdle           = "sink.redis.timeouts.idle"
+	PropertyRedisTls                   = "sink.redis.tls"
+	PropertyRedisTlsSkipVerify         = "sink.redis.tls.skipverify"
+	PropertyRedisTlsClientAuth         = "sink.redis.tls.clientauth"
+	PropertyRedisMode                  = "sink.redis.mode"
+	PropertyRedisStreamTrimMaxLen      = "sink.redis.stream.trim.maxlen"
+	PropertyRedisStreamTrimMaxAge      = "sink.redis.stream.trim.maxage"
+	PropertyRedisStreamTrimApproximate = "sink.redis.stream.trim.approximate"
+	PropertyRedisKeyValueFormat        = "sink.redis.keyvalue.format"
+	PropertyRedisKeyValueKey           = "sink.redis.keyvalue.key"
+	PropertyRedisClusterEnabled        = "sink.redis.cluster.enabled"
+	PropertyRedisClusterAddresses      = "sink.redis.cluster.addresses"
+	PropertyRedisClusterMaxRedirects   = "sink.redis.cluster.maxredirects"
+	PropertyRedisClusterHashTags       = "sink.redis.cluster.hashtags"
+	PropertyRedisSentinelMasterName    = "sink.redis.sentinel.mastername"
+	PropertyRedisSentinelAddresses     = "sink.redis.sentinel.addresses"
 
 	PropertyKinesisStreamName         = "sink.kinesis.stream.name"
 	PropertyKinesisStreamCreate       = "sink.kinesis.stream.create"
@@ -115,12 +160,142 @@ const (
 	PropertySqsAwsSecretAccessKey = "sink.sqs.aws.secretaccesskey"
 	PropertySqsAwsSessionToken    = "sink.sqs.aws.sessiontoken"
 
-	PropertyHttpUrl                             = "sink.http.url"
-	PropertyHttpAuthenticationType              = "sink.http.authentication.type"
-	PropertyHttpBasicAuthenticationUsername     = "sink.http.authentication.basic.username"
-	PropertyHttpBasicAuthenticationPassword     = "sink.http.authentication.basic.password"
-	PropertyHttpHeaderAuthenticationHeaderName  = "sink.http.authentication.header.name"
-	PropertyHttpHeaderAuthenticationHeaderValue = "sink.http.authentication.header.value"
-	PropertyHttpTlsSkipVerify                   = "sink.http.tls.skipverify"
-	PropertyHttpTlsClientAuth                   = "sink.http.tls.clientauth"
+	PropertySnsTopicArn           = "sink.sns.topic.arn"
+	PropertySnsAwsRegion          = "sink.sns.aws.region"
+	PropertySnsAwsEndpoint        = "sink.sns.aws.endpoint"
+	PropertySnsAwsAccessKeyId     = "sink.sns.aws.accesskeyid"
+	PropertySnsAwsSecretAccessKey = "sink.sns.aws.secretaccesskey"
+	PropertySnsAwsSessionToken    = "sink.sns.aws.sessiontoken"
+
+	PropertyS3BucketName           = "sink.s3.bucket.name"
+	PropertyS3BucketForcePathStyle = "sink.s3.bucket.forcepathstyle"
+	PropertyS3ObjectKeyTemplate    = "sink.s3.object.keytemplate"
+	PropertyS3ObjectMaxSize        = "sink.s3.object.maxsize"
+	PropertyS3ObjectMaxDuration    = "sink.s3.object.maxduration"
+	PropertyS3AwsRegion            = "sink.s3.aws.region"
+	PropertyS3AwsEndpoint          = "sink.s3.aws.endpoint"
+	PropertyS3AwsAccessKeyId       = "sink.s3.aws.accesskeyid"
+	PropertyS3AwsSecretAccessKey   = "sink.s3.aws.secretaccesskey"
+	PropertyS3AwsSessionToken      = "sink.s3.aws.sessiontoken"
+
+	PropertyHttpUrl                               = "sink.http.url"
+	PropertyHttpGzip                              = "sink.http.gzip"
+	PropertyHttpBatchFormat                       = "sink.http.batch.format"
+	PropertyHttpRetriesMaxWait                    = "sink.http.retries.maxwait"
+	PropertyHttpAuthenticationType                = "sink.http.authentication.type"
+	PropertyHttpBasicAuthenticationUsername       = "sink.http.authentication.basic.username"
+	PropertyHttpBasicAuthenticationPassword       = "sink.http.authentication.basic.password"
+	PropertyHttpHeaderAuthenticationHeaderName    = "sink.http.authentication.header.name"
+	PropertyHttpHeaderAuthenticationHeaderValue   = "sink.http.authentication.header.value"
+	PropertyHttpHmacAuthenticationSecret          = "sink.http.authentication.hmac.secret"
+	PropertyHttpHmacAuthenticationHeader          = "sink.http.authentication.hmac.header"
+	PropertyHttpHmacAuthenticationTimestampHeader = "sink.http.authentication.hmac.timestampheader"
+	PropertyHttpOAuth2AuthenticationTokenUrl      = "sink.http.authentication.oauth2.tokenurl"
+	PropertyHttpOAuth2AuthenticationClientId      = "sink.http.authentication.oauth2.clientid"
+	PropertyHttpOAuth2AuthenticationClientSecret  = "sink.http.authentication.oauth2.clientsecret"
+	PropertyHttpOAuth2AuthenticationScope         = "sink.http.authentication.oauth2.scope"
+	PropertyHttpTls                               = "sink.http.tls"
+	PropertyHttpTlsSkipVerify                     = "sink.http.tls.skipverify"
+	PropertyHttpTlsClientAuth                     = "sink.http.tls.clientauth"
+
+	PropertyAmqpUrl             = "sink.amqp.url"
+	PropertyAmqpExchangeName    = "sink.amqp.exchange.name"
+	PropertyAmqpExchangeKind    = "sink.amqp.exchange.kind"
+	PropertyAmqpExchangeDeclare = "sink.amqp.exchange.declare"
+	PropertyAmqpExchangeDurable = "sink.amqp.exchange.durable"
+	PropertyAmqpConfirmsEnabled = "sink.amqp.confirms.enabled"
+	PropertyAmqpConfirmsTimeout = "sink.amqp.confirms.timeout"
+	PropertyAmqpTls             = "sink.amqp.tls"
+	PropertyAmqpTlsEnabled      = "sink.amqp.tls.enabled"
+	PropertyAmqpTlsSkipVerify   = "sink.amqp.tls.skipverify"
+	PropertyAmqpTlsClientAuth   = "sink.amqp.tls.clientauth"
+
+	PropertyMqttBroker          = "sink.mqtt.broker"
+	PropertyMqttClientId        = "sink.mqtt.clientid"
+	PropertyMqttProtocolVersion = "sink.mqtt.protocolversion"
+	PropertyMqttUsername        = "sink.mqtt.username"
+	PropertyMqttPassword        = "sink.mqtt.password"
+	PropertyMqttQoS             = "sink.mqtt.qos"
+	PropertyMqttRetained        = "sink.mqtt.retained"
+	PropertyMqttTimeout         = "sink.mqtt.timeout"
+	PropertyMqttTls             = "sink.mqtt.tls"
+	PropertyMqttTlsEnabled      = "sink.mqtt.tls.enabled"
+	PropertyMqttTlsSkipVerify   = "sink.mqtt.tls.skipverify"
+	PropertyMqttTlsClientAuth   = "sink.mqtt.tls.clientauth"
+
+	PropertyFilePath          = "sink.file.path"
+	PropertyFileMaxSize       = "sink.file.maxsize"
+	PropertyFileMaxDuration   = "sink.file.maxduration"
+	PropertyFileCompress      = "sink.file.compress"
+	PropertyFileFsyncInterval = "sink.file.fsyncinterval"
+
+	PropertyPulsarUrl                 = "sink.pulsar.url"
+	PropertyPulsarTenant              = "sink.pulsar.tenant"
+	PropertyPulsarNamespace           = "sink.pulsar.namespace"
+	PropertyPulsarPersistent          = "sink.pulsar.persistent"
+	PropertyPulsarTimeout             = "sink.pulsar.timeout"
+	PropertyPulsarAuthenticationToken = "sink.pulsar.authentication.token"
+	PropertyPulsarTls                 = "sink.pulsar.tls"
+	PropertyPulsarTlsSkipVerify       = "sink.pulsar.tls.skipverify"
+	PropertyPulsarTlsClientAuth       = "sink.pulsar.tls.clientauth"
+
+	PropertyWebSocketAddress      = "sink.websocket.address"
+	PropertyWebSocketBufferSize   = "sink.websocket.buffersize"
+	PropertyWebSocketWriteTimeout = "sink.websocket.writetimeout"
+
+	PropertyPostgresqlSinkConnection               = "sink.postgresql.connection"
+	PropertyPostgresqlSinkPassword                 = "sink.postgresql.password"
+	PropertyPostgresqlSinkSchema                   = "sink.postgresql.schema"
+	PropertyPostgresqlSinkAutoCreate               = "sink.postgresql.autocreate"
+	PropertyPostgresqlSinkHypertables              = "sink.postgresql.hypertables"
+	PropertyPostgresqlSinkTransactionMaxStatements = "sink.postgresql.transaction.maxstatements"
+	PropertyPostgresqlSinkTls                      = "sink.postgresql.tls"
+	PropertyPostgresqlSinkTlsEnabled               = "sink.postgresql.tls.enabled"
+
+	PropertyClickHouseUrl                             = "sink.clickhouse.url"
+	PropertyClickHouseDatabase                        = "sink.clickhouse.database"
+	PropertyClickHouseAuthenticationType              = "sink.clickhouse.authentication.type"
+	PropertyClickHouseBasicAuthenticationUsername     = "sink.clickhouse.authentication.basic.username"
+	PropertyClickHouseBasicAuthenticationPassword     = "sink.clickhouse.authentication.basic.password"
+	PropertyClickHouseHeaderAuthenticationHeaderName  = "sink.clickhouse.authentication.header.name"
+	PropertyClickHouseHeaderAuthenticationHeaderValue = "sink.clickhouse.authentication.header.value"
+	PropertyClickHouseTls                             = "sink.clickhouse.tls"
+	PropertyClickHouseTlsSkipVerify                   = "sink.clickhouse.tls.skipverify"
+	PropertyClickHouseTlsClientAuth                   = "sink.clickhouse.tls.clientauth"
+	PropertyClickHouseBatchSize                       = "sink.clickhouse.batch.size"
+	PropertyClickHouseBatchInterval                   = "sink.clickhouse.batch.interval"
+	PropertyClickHouseColumnsSign                     = "sink.clickhouse.columns.sign"
+	PropertyClickHouseColumnsVersion                  = "sink.clickhouse.columns.version"
+	PropertyClickHouseColumnsDeleted                  = "sink.clickhouse.columns.deleted"
+
+	PropertyElasticsearchUrl                         = "sink.elasticsearch.url"
+	PropertyElasticsearchAuthenticationType          = "sink.elasticsearch.authentication.type"
+	PropertyElasticsearchBasicAuthenticationUsername = "sink.elasticsearch.authentication.basic.username"
+	PropertyElasticsearchBasicAuthenticationPassword = "sink.elasticsearch.authentication.basic.password"
+	PropertyElasticsearchApiKeyAuthentication        = "sink.elasticsearch.authentication.apikey"
+	PropertyElasticsearchTls                         = "sink.elasticsearch.tls"
+	PropertyElasticsearchTlsSkipVerify               = "sink.elasticsearch.tls.skipverify"
+	PropertyElasticsearchTlsClientAuth               = "sink.elasticsearch.tls.clientauth"
+	PropertyElasticsearchBatchSize                   = "sink.elasticsearch.batch.size"
+	PropertyElasticsearchBatchInterval               = "sink.elasticsearch.batch.interval"
+	PropertyElasticsearchRetries                     = "sink.elasticsearch.retries"
+
+	PropertyPubSubProjectId       = "sink.pubsub.projectid"
+	PropertyPubSubTopicName       = "sink.pubsub.topic.name"
+	PropertyPubSubTopicCreate     = "sink.pubsub.topic.create"
+	PropertyPubSubEmulatorHost    = "sink.pubsub.emulatorhost"
+	PropertyPubSubCredentialsFile = "sink.pubsub.credentialsfile"
+
+	PropertyLineProtocolAddress                         = "sink.lineprotocol.address"
+	PropertyLineProtocolAuthenticationType              = "sink.lineprotocol.authentication.type"
+	PropertyLineProtocolBasicAuthenticationUsername     = "sink.lineprotocol.authentication.basic.username"
+	PropertyLineProtocolBasicAuthenticationPassword     = "sink.lineprotocol.authentication.basic.password"
+	PropertyLineProtocolHeaderAuthenticationHeaderName  = "sink.lineprotocol.authentication.header.name"
+	PropertyLineProtocolHeaderAuthenticationHeaderValue = "sink.lineprotocol.authentication.header.value"
+	PropertyLineProtocolTls                             = "sink.lineprotocol.tls"
+	PropertyLineProtocolTlsSkipVerify                   = "sink.lineprotocol.tls.skipverify"
+	PropertyLineProtocolTlsClientAuth                   = "sink.lineprotocol.tls.clientauth"
+	PropertyLineProtocolPrecision                       = "sink.lineprotocol.precision"
+	PropertyLineProtocolBatchSize                       = "sink.lineprotocol.batch.size"
+	PropertyLineProtocolBatchInterval                   = "sink.lineprotocol.batch.interval"
 )
@@ -26,6 +26,9 @@ import (
 	"github.com/noctarius/timescaledb-event-streamer/spi/version"
 )
 
+// Acknowledgement acknowledges an event tracked by TrackInFlight
+type Acknowledgement func() error
+
 type ReplicationContext interface {
 	StartReplicationContext() error
 	StopReplicationContext() error
@@ -53,6 +56,14 @@ type ReplicationContext interface {
 	AcknowledgeProcessed(
 		xld pgtypes.XLogData, processedLSN *pgtypes.LSN,
 	) error
+	// TrackInFlight registers an event which is about to be handed to the
+	// sink. Events may be acknowledged in any order, however the processed
+	// LSN only advances up to the contiguous watermark, and never passes an
+	// event which is still in flight. The returned acknowledgement can be
+	// called from any goroutine.
+	TrackInFlight(
+		xld pgtypes.XLogData, processedLSN *pgtypes.LSN,
+	) Acknowledgement
 	LastProcessedLSN() pgtypes.LSN
 	SetPositionLSNs(
 		receivedLSN, processedLSN pgtypes.LSN,
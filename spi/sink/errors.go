@@ -0,0 +1,57 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sink
+
+import (
+	"github.com/go-errors/errors"
+)
+
+// PermanentError marks an error which won't go away by retrying the
+// failed event, like a payload rejected for its size or content
+type PermanentError struct {
+	err error
+}
+
+// NewPermanentError wraps the given error as a permanent error
+func NewPermanentError(
+	err error,
+) error {
+
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{err: err}
+}
+
+func (pe *PermanentError) Error() string {
+	return pe.err.Error()
+}
+
+func (pe *PermanentError) Unwrap() error {
+	return pe.err
+}
+
+// IsPermanentError returns true if the given error, or any error
+// it wraps, is a permanent error
+func IsPermanentError(
+	err error,
+) bool {
+
+	var permanentError *PermanentError
+	return errors.As(err, &permanentError)
+}
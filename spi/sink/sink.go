@@ -19,6 +19,7 @@ package sink
 
 import (
 	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
 	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
 	"time"
 )
@@ -33,6 +34,113 @@ type Sink interface {
 	) error
 }
 
+// TableAwareSink is an optional interface which can be implemented
+// by sinks that need to know the table definition behind a topic,
+// e.g. to create a matching target table. RegisterTable is called
+// before the first event of the table is emitted.
+type TableAwareSink interface {
+	RegisterTable(
+		context Context, topicName string, table schema.TableAlike,
+	) error
+}
+
+// EagerTableAwareSink is an optional interface which can be implemented
+// by table aware sinks that need all known tables registered at startup,
+// instead of before the first event of each table, e.g. to create their
+// target topics upfront.
+type EagerTableAwareSink interface {
+	TableAwareSink
+	EagerTableRegistration() bool
+}
+
+// TransactionAwareSink is an optional interface which can be implemented
+// by sinks that need to know the boundaries of source transactions, e.g.
+// to apply all events of a source transaction atomically. Events emitted
+// outside of BeginTransaction and CommitTransaction (like snapshot reads)
+// aren't part of a source transaction. The LSN passed to CommitTransaction
+// is the end of the transaction, replicating from it resumes with the
+// next transaction.
+type TransactionAwareSink interface {
+	BeginTransaction(
+		context Context, xid uint32, commitTime time.Time,
+	) error
+	CommitTransaction(
+		context Context, xid uint32, transactionEndLSN pgtypes.LSN,
+	) error
+}
+
+// Event is a single event handed to a BatchSink. The key and envelope
+// are provided as structs and already encoded as JSON.
+type Event struct {
+	Timestamp    time.Time
+	TopicName    string
+	Key          schema.Struct
+	Envelope     schema.Struct
+	KeyData      []byte
+	EnvelopeData []byte
+}
+
+// BatchSink is an optional interface which can be implemented by sinks
+// that can emit multiple events with a single request. Events are buffered
+// and handed to EmitBatch in batches bounded by the configured count, bytes
+// and linger time. The events of a batch are only acknowledged after the
+// whole batch succeeded, a failed batch is retried as a whole.
+type BatchSink interface {
+	EmitBatch(
+		context Context, events []Event,
+	) error
+}
+
+// Completion is called by an AsyncSink when an event was confirmed by the
+// target (err is nil), or finally failed
+type Completion func(err error)
+
+// AsyncSink is an optional interface which can be implemented by sinks that
+// hand events to an asynchronous producer, pipelining many events before they
+// are confirmed. EmitAsync returns as soon as the event was handed over, the
+// completion is called exactly once, from any goroutine. Events are only
+// acknowledged after they completed successfully, which may happen out of
+// order. A failed completion stops the replication with the next event.
+type AsyncSink interface {
+	EmitAsync(
+		context Context, timestamp time.Time, topicName string, key, envelope schema.Struct,
+		completion Completion,
+	) error
+}
+
+// AcknowledgingSink is an optional interface which can be implemented by
+// sinks that buffer events internally and write them later, e.g. when an
+// object is complete. Instead of the events being acknowledged as soon as
+// Emit returns, the sink calls the given function once all events emitted
+// before were written.
+type AcknowledgingSink interface {
+	Acknowledge(
+		context Context, acknowledge func() error,
+	) error
+}
+
+// OffsetStoringSink is an optional interface which can be implemented by
+// transaction aware sinks that store the LSN passed to CommitTransaction
+// atomically with the events of the transaction. When the sink knows a
+// committed LSN at startup, the replication resumes from it instead of
+// the offset of the state storage, so no transaction is emitted twice.
+type OffsetStoringSink interface {
+	CommittedLSN(
+		context Context,
+	) (lsn pgtypes.LSN, found bool, err error)
+}
+
+// ErrorClassifyingSink is an optional interface which can be implemented
+// by sinks that can tell permanent errors (like a rejected, oversized
+// event) from transient ones. Events failing with a permanent error aren't
+// retried and are handed to the dead-letter target, if one is configured.
+// Sinks may also return errors created by NewPermanentError directly.
+type ErrorClassifyingSink interface {
+	IsPermanentError(
+		err error,
+	) bool
+}
+
 type SinkFunc func(context Context, timestamp time.Time, topicName string, key, envelope schema.Struct) error
 
 func (sf SinkFunc) Start() error {
@@ -18,6 +18,7 @@
 package sink
 
 import (
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
 	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
 	"time"
 )
@@ -28,4 +29,27 @@ type Manager interface {
 	Emit(
 		timestamp time.Time, topicName string, key, envelope schema.Struct,
 	) error
+	RegisterTable(
+		topicName string, table schema.TableAlike,
+	) error
+	// EagerTableRegistration returns true if all known tables
+	// have to be registered at startup
+	EagerTableRegistration() bool
+	TransactionAware() bool
+	BeginTransaction(
+		xid uint32, commitTime time.Time,
+	) error
+	CommitTransaction(
+		xid uint32, transactionEndLSN pgtypes.LSN,
+	) error
+	// CommittedLSN returns the LSN of the last transaction committed
+	// by an OffsetStoringSink, if the sink provides one
+	CommittedLSN() (lsn pgtypes.LSN, found bool, err error)
+	// Acknowledge calls the given function as soon as the event
+	// emitted last was accepted by the sink, e.g. after its batch was
+	// flushed, or an async sink confirmed it. For synchronous sinks
+	// that is the case immediately.
+	Acknowledge(
+		acknowledge func() error,
+	) error
 }
@@ -22,15 +22,20 @@ import (
 	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
 	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
 	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"sync/atomic"
 	"time"
 )
 
 type Stream interface {
+	TopicName() string
 	KeySchema() schema.Struct
 	Key(
 		values map[string]any,
 	) (schema.Struct, error)
 	PayloadSchema() schema.Struct
+	// Register registers the stream's table with the sink, if
+	// it isn't registered yet. Streams without a table do nothing.
+	Register() error
 	Emit(
 		key, envelope schema.Struct,
 	) error
@@ -41,6 +46,7 @@ type tableStreamImpl struct {
 	typeManager     pgtypes.TypeManager
 	tableDefinition schema.TableAlike
 	tableKeyColumns []schema.ColumnAlike
+	registered      atomic.Bool
 
 	topicName      string
 	keySchema      schema.Struct
@@ -64,6 +70,10 @@ func NewTableStream(
 	}
 }
 
+func (s *tableStreamImpl) TopicName() string {
+	return s.topicName
+}
+
 func (s *tableStreamImpl) KeySchema() schema.Struct {
 	return s.keySchema
 }
@@ -97,10 +107,25 @@ func (s *tableStreamImpl) Key(
 	return result, nil
 }
 
+func (s *tableStreamImpl) Register() error {
+	// Registration is retried with the next event if it failed,
+	// registering a table twice has to be supported by sinks anyway
+	if !s.registered.Load() {
+		if err := s.sinkManager.RegisterTable(s.topicName, s.tableDefinition); err != nil {
+			return err
+		}
+		s.registered.Store(true)
+	}
+	return nil
+}
+
 func (s *tableStreamImpl) Emit(
 	key, envelope schema.Struct,
 ) error {
 
+	if err := s.Register(); err != nil {
+		return err
+	}
 	return s.sinkManager.Emit(time.Now(), s.topicName, key, envelope)
 }
 
@@ -125,6 +150,10 @@ func NewMessageStream(
 	}
 }
 
+func (m *messageStreamImpl) TopicName() string {
+	return m.topicName
+}
+
 func (m *messageStreamImpl) KeySchema() schema.Struct {
 	return m.keySchema
 }
@@ -146,6 +175,10 @@ func (m *messageStreamImpl) Key(
 	}, nil
 }
 
+func (m *messageStreamImpl) Register() error {
+	return nil
+}
+
 func (m *messageStreamImpl) Emit(
 	key, envelope schema.Struct,
 ) error {
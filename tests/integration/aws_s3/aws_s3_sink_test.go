@@ -0,0 +1,202 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aws_s3
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/sysconfig"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport/containers"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport/testrunner"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/testcontainers/testcontainers-go"
+	"strings"
+	"testing"
+	"time"
+)
+
+type AwsS3IntegrationTestSuite struct {
+	testrunner.TestRunner
+}
+
+func TestAwsS3IntegrationTestSuite(
+	t *testing.T,
+) {
+
+	suite.Run(t, new(AwsS3IntegrationTestSuite))
+}
+
+func (asits *AwsS3IntegrationTestSuite) Test_Aws_S3_Sink() {
+	awsRegion := "us-east-1"
+	topicPrefix := lo.RandomString(10, lo.LowerCaseLettersCharset)
+	bucketName := lo.RandomString(10, lo.LowerCaseLettersCharset)
+
+	var endpoint string
+	var container testcontainers.Container
+	var awsS3 *s3.S3
+
+	asits.RunTest(
+		func(ctx testrunner.Context) error {
+			topicName := fmt.Sprintf(
+				"%s.%s.%s", topicPrefix,
+				testrunner.GetAttribute[string](ctx, "schemaName"),
+				testrunner.GetAttribute[string](ctx, "tableName"),
+			)
+
+			if _, err := ctx.Exec(context.Background(),
+				fmt.Sprintf(
+					"INSERT INTO \"%s\" SELECT ts, ROW_NUMBER() OVER (ORDER BY ts) AS val FROM GENERATE_SERIES('2023-03-25 00:00:00'::TIMESTAMPTZ, '2023-03-25 00:09:59'::TIMESTAMPTZ, INTERVAL '1 minute') t(ts)",
+					testrunner.GetAttribute[string](ctx, "tableName"),
+				),
+			); err != nil {
+				return err
+			}
+
+			var objects []*s3.Object
+			deadline := time.Now().Add(time.Minute)
+			for time.Now().Before(deadline) {
+				result, err := awsS3.ListObjectsV2(&s3.ListObjectsV2Input{
+					Bucket: aws.String(bucketName),
+					Prefix: aws.String(topicName + "/"),
+				})
+				if err != nil {
+					return errors.Wrap(err, 0)
+				}
+				if objects = result.Contents; len(objects) > 0 {
+					break
+				}
+				time.Sleep(500 * time.Millisecond)
+			}
+
+			// The whole transaction has to end up in a single object
+			if !assert.Len(asits.T(), objects, 1) {
+				return nil
+			}
+			assert.True(asits.T(), strings.HasSuffix(*objects[0].Key, ".ndjson.gz"))
+
+			object, err := awsS3.GetObject(&s3.GetObjectInput{
+				Bucket: aws.String(bucketName),
+				Key:    objects[0].Key,
+			})
+			if err != nil {
+				return errors.Wrap(err, 0)
+			}
+			defer object.Body.Close()
+
+			reader, err := gzip.NewReader(object.Body)
+			if err != nil {
+				return errors.Wrap(err, 0)
+			}
+
+			envelopes := make([]testsupport.Envelope, 0)
+			scanner := bufio.NewScanner(reader)
+			for scanner.Scan() {
+				envelope := testsupport.Envelope{}
+				if err := json.Unmarshal(scanner.Bytes(), &envelope); err != nil {
+					return errors.Wrap(err, 0)
+				}
+				envelopes = append(envelopes, envelope)
+			}
+			if err := scanner.Err(); err != nil {
+				return errors.Wrap(err, 0)
+			}
+
+			assert.Len(asits.T(), envelopes, 10)
+			for i, envelope := range envelopes {
+				assert.Equal(asits.T(), i+1, int(envelope.Payload.After["val"].(float64)))
+			}
+			return nil
+		},
+
+		testrunner.WithSetup(func(setupContext testrunner.SetupContext) error {
+			sn, tn, err := setupContext.CreateHypertable("ts", time.Hour*24,
+				testsupport.NewColumn("ts", "timestamptz", false, true, nil),
+				testsupport.NewColumn("val", "integer", false, false, nil),
+			)
+			if err != nil {
+				return err
+			}
+			testrunner.Attribute(setupContext, "schemaName", sn)
+			testrunner.Attribute(setupContext, "tableName", tn)
+
+			container, endpoint, err = containers.SetupLocalStackWithS3()
+			if err != nil {
+				return errors.Wrap(err, 0)
+			}
+
+			awsConfig := aws.NewConfig().
+				WithRegion(awsRegion).
+				WithEndpoint(endpoint).
+				WithS3ForcePathStyle(true).
+				WithCredentials(credentials.NewStaticCredentials("test", "test", ""))
+
+			awsSession, err := session.NewSession(awsConfig)
+			if err != nil {
+				return err
+			}
+
+			awsS3 = s3.New(awsSession)
+			if _, err := awsS3.CreateBucket(&s3.CreateBucketInput{
+				Bucket: aws.String(bucketName),
+			}); err != nil {
+				return errors.Wrap(err, 0)
+			}
+
+			setupContext.AddSystemConfigConfigurator(func(config *sysconfig.SystemConfig) {
+				config.Topic.Prefix = topicPrefix
+				config.Sink.Type = spiconfig.AwsS3
+				config.Sink.AwsS3 = spiconfig.AwsS3Config{
+					Bucket: spiconfig.AwsS3BucketConfig{
+						Name:           aws.String(bucketName),
+						ForcePathStyle: lo.ToPtr(true),
+					},
+					Object: spiconfig.AwsS3ObjectConfig{
+						MaxDuration: 1,
+					},
+					Aws: spiconfig.AwsConnectionConfig{
+						Region:          aws.String(awsRegion),
+						AccessKeyId:     "test",
+						SecretAccessKey: "test",
+						Endpoint:        endpoint,
+					},
+				}
+			})
+
+			return nil
+		}),
+
+		testrunner.WithTearDown(func(ctx testrunner.Context) error {
+			if container != nil {
+				container.Terminate(context.Background())
+			}
+			return nil
+		}),
+	)
+}
@@ -0,0 +1,218 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aws_sns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/sysconfig"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport/containers"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport/testrunner"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/testcontainers/testcontainers-go"
+	"testing"
+	"time"
+)
+
+type AwsSnsIntegrationTestSuite struct {
+	testrunner.TestRunner
+}
+
+func TestAwsSnsIntegrationTestSuite(
+	t *testing.T,
+) {
+
+	suite.Run(t, new(AwsSnsIntegrationTestSuite))
+}
+
+func (asits *AwsSnsIntegrationTestSuite) Test_Aws_Sns_Sink() {
+	awsRegion := "us-east-1"
+	topicPrefix := lo.RandomString(10, lo.LowerCaseLettersCharset)
+	snsTopicName := fmt.Sprintf("%s.fifo", lo.RandomString(10, lo.LowerCaseLettersCharset))
+	queueName := fmt.Sprintf("%s.fifo", lo.RandomString(10, lo.LowerCaseLettersCharset))
+
+	var endpoint, topicArn, queueUrl string
+	var container testcontainers.Container
+	var awsSqs *sqs.SQS
+
+	asits.RunTest(
+		func(ctx testrunner.Context) error {
+			if _, err := ctx.Exec(context.Background(),
+				fmt.Sprintf(
+					"INSERT INTO \"%s\" SELECT ts, ROW_NUMBER() OVER (ORDER BY ts) AS val FROM GENERATE_SERIES('2023-03-25 00:00:00'::TIMESTAMPTZ, '2023-03-25 00:09:59'::TIMESTAMPTZ, INTERVAL '1 minute') t(ts)",
+					testrunner.GetAttribute[string](ctx, "tableName"),
+				),
+			); err != nil {
+				return err
+			}
+
+			envelopes := make([]testsupport.Envelope, 0)
+			deadline := time.Now().Add(time.Minute)
+			for len(envelopes) < 10 && time.Now().Before(deadline) {
+				msgResult, err := awsSqs.ReceiveMessage(&sqs.ReceiveMessageInput{
+					MessageAttributeNames: []*string{
+						aws.String(sqs.QueueAttributeNameAll),
+					},
+					QueueUrl:            aws.String(queueUrl),
+					MaxNumberOfMessages: aws.Int64(10),
+					VisibilityTimeout:   aws.Int64(60),
+					WaitTimeSeconds:     aws.Int64(1),
+				})
+				if err != nil {
+					return errors.Wrap(err, 0)
+				}
+
+				for _, message := range msgResult.Messages {
+					envelope := testsupport.Envelope{}
+					if err := json.Unmarshal([]byte(*message.Body), &envelope); err != nil {
+						return err
+					}
+					envelopes = append(envelopes, envelope)
+
+					// Raw message delivery passes the SNS message attributes on
+					assert.Equal(asits.T(), "c", *message.MessageAttributes["op"].StringValue)
+					assert.Equal(asits.T(),
+						testrunner.GetAttribute[string](ctx, "tableName"),
+						*message.MessageAttributes["table"].StringValue,
+					)
+					assert.Equal(asits.T(),
+						testrunner.GetAttribute[string](ctx, "schemaName"),
+						*message.MessageAttributes["schema"].StringValue,
+					)
+					assert.NotEmpty(asits.T(), *message.MessageAttributes["lsn"].StringValue)
+				}
+			}
+
+			if !assert.Len(asits.T(), envelopes, 10) {
+				return nil
+			}
+			for i, envelope := range envelopes {
+				assert.Equal(asits.T(), i+1, int(envelope.Payload.After["val"].(float64)))
+			}
+			return nil
+		},
+
+		testrunner.WithSetup(func(setupContext testrunner.SetupContext) error {
+			sn, tn, err := setupContext.CreateHypertable("ts", time.Hour*24,
+				testsupport.NewColumn("ts", "timestamptz", false, true, nil),
+				testsupport.NewColumn("val", "integer", false, false, nil),
+			)
+			if err != nil {
+				return err
+			}
+			testrunner.Attribute(setupContext, "schemaName", sn)
+			testrunner.Attribute(setupContext, "tableName", tn)
+
+			container, endpoint, err = containers.SetupLocalStackWithSNS()
+			if err != nil {
+				return errors.Wrap(err, 0)
+			}
+
+			awsConfig := aws.NewConfig().
+				WithRegion(awsRegion).
+				WithEndpoint(endpoint).
+				WithCredentials(credentials.NewStaticCredentials("test", "test", "test"))
+
+			awsSession, err := session.NewSession(awsConfig)
+			if err != nil {
+				return err
+			}
+
+			awsSns := sns.New(awsSession)
+			awsSqs = sqs.New(awsSession)
+
+			topic, err := awsSns.CreateTopic(&sns.CreateTopicInput{
+				Name: aws.String(snsTopicName),
+				Attributes: map[string]*string{
+					"FifoTopic": aws.String("true"),
+				},
+			})
+			if err != nil {
+				return errors.Wrap(err, 0)
+			}
+			topicArn = *topic.TopicArn
+
+			queue, err := awsSqs.CreateQueue(&sqs.CreateQueueInput{
+				QueueName: aws.String(queueName),
+				Attributes: map[string]*string{
+					"FifoQueue": aws.String("true"),
+				},
+			})
+			if err != nil {
+				return errors.Wrap(err, 0)
+			}
+			queueUrl = *queue.QueueUrl
+
+			queueAttributes, err := awsSqs.GetQueueAttributes(&sqs.GetQueueAttributesInput{
+				QueueUrl:       queue.QueueUrl,
+				AttributeNames: []*string{aws.String(sqs.QueueAttributeNameQueueArn)},
+			})
+			if err != nil {
+				return errors.Wrap(err, 0)
+			}
+
+			if _, err := awsSns.Subscribe(&sns.SubscribeInput{
+				TopicArn: topic.TopicArn,
+				Protocol: aws.String("sqs"),
+				Endpoint: queueAttributes.Attributes[sqs.QueueAttributeNameQueueArn],
+				Attributes: map[string]*string{
+					"RawMessageDelivery": aws.String("true"),
+				},
+			}); err != nil {
+				return errors.Wrap(err, 0)
+			}
+
+			setupContext.AddSystemConfigConfigurator(func(config *sysconfig.SystemConfig) {
+				config.Topic.Prefix = topicPrefix
+				config.Sink.Type = spiconfig.AwsSNS
+				config.Sink.AwsSns = spiconfig.AwsSnsConfig{
+					Topic: spiconfig.AwsSnsTopicConfig{
+						Arn: aws.String(topicArn),
+					},
+					Aws: spiconfig.AwsConnectionConfig{
+						Region:          aws.String(awsRegion),
+						AccessKeyId:     "test",
+						SecretAccessKey: "test",
+						SessionToken:    "test",
+						Endpoint:        endpoint,
+					},
+				}
+			})
+
+			return nil
+		}),
+
+		testrunner.WithTearDown(func(ctx testrunner.Context) error {
+			if container != nil {
+				container.Terminate(context.Background())
+			}
+			return nil
+		}),
+	)
+}
@@ -0,0 +1,180 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/sysconfig"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport/containers"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport/testrunner"
+	"github.com/stretchr/testify/suite"
+	"github.com/testcontainers/testcontainers-go"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+type ClickHouseIntegrationTestSuite struct {
+	testrunner.TestRunner
+}
+
+func TestClickHouseIntegrationTestSuite(
+	t *testing.T,
+) {
+
+	suite.Run(t, new(ClickHouseIntegrationTestSuite))
+}
+
+func (chits *ClickHouseIntegrationTestSuite) Test_ClickHouse_Sink() {
+	var clickHouseUrl string
+	var container testcontainers.Container
+
+	chits.RunTest(
+		func(ctx testrunner.Context) error {
+			query := fmt.Sprintf(
+				"SELECT count(), sum(val) FROM `%s` FINAL FORMAT TSV",
+				testrunner.GetAttribute[string](ctx, "tableName"),
+			)
+
+			if _, err := ctx.Exec(context.Background(),
+				fmt.Sprintf(
+					"INSERT INTO \"%s\" SELECT ts, ROW_NUMBER() OVER (ORDER BY ts) AS val FROM GENERATE_SERIES('2023-03-25 00:00:00'::TIMESTAMPTZ, '2023-03-25 00:09:59'::TIMESTAMPTZ, INTERVAL '1 minute') t(ts)",
+					testrunner.GetAttribute[string](ctx, "tableName"),
+				),
+			); err != nil {
+				return err
+			}
+
+			if err := awaitResult(clickHouseUrl, query, "10\t55"); err != nil {
+				return err
+			}
+
+			if _, err := ctx.Exec(context.Background(),
+				fmt.Sprintf(
+					"DELETE FROM \"%s\" WHERE val = 10",
+					testrunner.GetAttribute[string](ctx, "tableName"),
+				),
+			); err != nil {
+				return err
+			}
+
+			return awaitResult(clickHouseUrl, query, "9\t45")
+		},
+
+		testrunner.WithSetup(func(setupContext testrunner.SetupContext) error {
+			sn, tn, err := setupContext.CreateHypertable("ts", time.Hour*24,
+				testsupport.NewColumn("ts", "timestamptz", false, true, nil),
+				testsupport.NewColumn("val", "integer", false, false, nil),
+			)
+			if err != nil {
+				return errors.Wrap(err, 0)
+			}
+			testrunner.Attribute(setupContext, "schemaName", sn)
+			testrunner.Attribute(setupContext, "tableName", tn)
+
+			if _, err := setupContext.Exec(context.Background(),
+				fmt.Sprintf("ALTER TABLE \"%s\".\"%s\" REPLICA IDENTITY FULL", sn, tn),
+			); err != nil {
+				return errors.Wrap(err, 0)
+			}
+
+			cC, cU, err := containers.SetupClickHouseContainer()
+			if err != nil {
+				return errors.Wrap(err, 0)
+			}
+			clickHouseUrl = cU
+			container = cC
+
+			if _, err := execute(clickHouseUrl, fmt.Sprintf(
+				"CREATE TABLE `%s` (ts DateTime64(6, 'UTC'), val Int32, sign Int8) "+
+					"ENGINE = CollapsingMergeTree(sign) ORDER BY ts", tn,
+			)); err != nil {
+				return errors.Wrap(err, 0)
+			}
+
+			setupContext.AddSystemConfigConfigurator(func(config *sysconfig.SystemConfig) {
+				config.Sink.Type = spiconfig.ClickHouse
+				config.Sink.ClickHouse = spiconfig.ClickHouseConfig{
+					Url: clickHouseUrl,
+					Batch: spiconfig.ClickHouseBatchConfig{
+						Size:     100,
+						Interval: 500,
+					},
+					Columns: spiconfig.ClickHouseColumnsConfig{
+						Sign: "sign",
+					},
+				}
+			})
+
+			return nil
+		}),
+
+		testrunner.WithTearDown(func(ctx testrunner.Context) error {
+			if container != nil {
+				container.Terminate(context.Background())
+			}
+			return nil
+		}),
+	)
+}
+
+func awaitResult(
+	clickHouseUrl, query, expected string,
+) error {
+
+	var result string
+	deadline := time.Now().Add(time.Minute)
+	for time.Now().Before(deadline) {
+		if r, err := execute(clickHouseUrl, query); err == nil {
+			if result = r; result == expected {
+				return nil
+			}
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	return errors.Errorf("expected result '%s', but found '%s'", expected, result)
+}
+
+func execute(
+	clickHouseUrl, query string,
+) (string, error) {
+
+	response, err := http.Post(
+		fmt.Sprintf("%s/?%s", clickHouseUrl, url.Values{"query": {query}}.Encode()), "text/plain", nil,
+	)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return "", err
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", errors.Errorf("query failed with status %d: %s", response.StatusCode, body)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
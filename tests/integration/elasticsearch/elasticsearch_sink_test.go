@@ -0,0 +1,177 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/sysconfig"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport/containers"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport/testrunner"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/suite"
+	"github.com/testcontainers/testcontainers-go"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type ElasticsearchIntegrationTestSuite struct {
+	testrunner.TestRunner
+}
+
+func TestElasticsearchIntegrationTestSuite(
+	t *testing.T,
+) {
+
+	suite.Run(t, new(ElasticsearchIntegrationTestSuite))
+}
+
+func (eits *ElasticsearchIntegrationTestSuite) Test_Elasticsearch_Sink() {
+	topicPrefix := lo.RandomString(10, lo.LowerCaseLettersCharset)
+
+	var elasticsearchUrl string
+	var container testcontainers.Container
+
+	eits.RunTest(
+		func(ctx testrunner.Context) error {
+			index := strings.ToLower(fmt.Sprintf(
+				"%s.%s.%s", topicPrefix,
+				testrunner.GetAttribute[string](ctx, "schemaName"),
+				testrunner.GetAttribute[string](ctx, "tableName"),
+			))
+
+			if _, err := ctx.Exec(context.Background(),
+				fmt.Sprintf(
+					"INSERT INTO \"%s\" SELECT ts, ROW_NUMBER() OVER (ORDER BY ts) AS val FROM GENERATE_SERIES('2023-03-25 00:00:00'::TIMESTAMPTZ, '2023-03-25 00:09:59'::TIMESTAMPTZ, INTERVAL '1 minute') t(ts)",
+					testrunner.GetAttribute[string](ctx, "tableName"),
+				),
+			); err != nil {
+				return err
+			}
+
+			if err := awaitCount(elasticsearchUrl, index, 10); err != nil {
+				return err
+			}
+
+			if _, err := ctx.Exec(context.Background(),
+				fmt.Sprintf(
+					"DELETE FROM \"%s\" WHERE val = 10",
+					testrunner.GetAttribute[string](ctx, "tableName"),
+				),
+			); err != nil {
+				return err
+			}
+
+			return awaitCount(elasticsearchUrl, index, 9)
+		},
+
+		testrunner.WithSetup(func(setupContext testrunner.SetupContext) error {
+			sn, tn, err := setupContext.CreateHypertable("ts", time.Hour*24,
+				testsupport.NewColumn("ts", "timestamptz", false, true, nil),
+				testsupport.NewColumn("val", "integer", false, false, nil),
+			)
+			if err != nil {
+				return errors.Wrap(err, 0)
+			}
+			testrunner.Attribute(setupContext, "schemaName", sn)
+			testrunner.Attribute(setupContext, "tableName", tn)
+
+			eC, eU, err := containers.SetupElasticsearchContainer()
+			if err != nil {
+				return errors.Wrap(err, 0)
+			}
+			elasticsearchUrl = eU
+			container = eC
+
+			setupContext.AddSystemConfigConfigurator(func(config *sysconfig.SystemConfig) {
+				config.Topic.Prefix = topicPrefix
+				config.Sink.Type = spiconfig.Elasticsearch
+				config.Sink.Elasticsearch = spiconfig.ElasticsearchConfig{
+					Url: elasticsearchUrl,
+					Batch: spiconfig.ElasticsearchBatchConfig{
+						Size:     100,
+						Interval: 500,
+					},
+				}
+			})
+
+			return nil
+		}),
+
+		testrunner.WithTearDown(func(ctx testrunner.Context) error {
+			if container != nil {
+				container.Terminate(context.Background())
+			}
+			return nil
+		}),
+	)
+}
+
+func awaitCount(
+	elasticsearchUrl, index string, expected int,
+) error {
+
+	count := -1
+	deadline := time.Now().Add(time.Minute)
+	for time.Now().Before(deadline) {
+		// The index may not exist yet
+		if c, err := documentCount(elasticsearchUrl, index); err == nil {
+			if count = c; count == expected {
+				return nil
+			}
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	return errors.Errorf("expected %d documents in index %s, but found %d", expected, index, count)
+}
+
+func documentCount(
+	elasticsearchUrl, index string,
+) (int, error) {
+
+	// Make all indexed documents visible to the count
+	refresh, err := http.Post(fmt.Sprintf("%s/%s/_refresh", elasticsearchUrl, index), "application/json", nil)
+	if err != nil {
+		return 0, err
+	}
+	refresh.Body.Close()
+
+	response, err := http.Get(fmt.Sprintf("%s/%s/_count", elasticsearchUrl, index))
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return 0, errors.Errorf("count failed with status %d", response.StatusCode)
+	}
+
+	result := struct {
+		Count int `json:"count"`
+	}{}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return 0, err
+	}
+	return result.Count, nil
+}
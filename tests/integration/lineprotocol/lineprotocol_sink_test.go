@@ -0,0 +1,131 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lineprotocol
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/sysconfig"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport/testrunner"
+	"github.com/stretchr/testify/suite"
+	"net"
+	"testing"
+	"time"
+)
+
+type LineProtocolIntegrationTestSuite struct {
+	testrunner.TestRunner
+}
+
+func TestLineProtocolIntegrationTestSuite(
+	t *testing.T,
+) {
+
+	suite.Run(t, new(LineProtocolIntegrationTestSuite))
+}
+
+func (lpits *LineProtocolIntegrationTestSuite) Test_LineProtocol_Tcp_Sink() {
+	var listener net.Listener
+	lines := make(chan string, 100)
+
+	lpits.RunTest(
+		func(ctx testrunner.Context) error {
+			if _, err := ctx.Exec(context.Background(),
+				fmt.Sprintf(
+					"INSERT INTO \"%s\" SELECT ts, 'dev 1', ROW_NUMBER() OVER (ORDER BY ts) AS val FROM GENERATE_SERIES('2023-03-25 00:00:00'::TIMESTAMPTZ, '2023-03-25 00:09:59'::TIMESTAMPTZ, INTERVAL '1 minute') t(ts)",
+					testrunner.GetAttribute[string](ctx, "tableName"),
+				),
+			); err != nil {
+				return err
+			}
+
+			tableName := testrunner.GetAttribute[string](ctx, "tableName")
+			timestamp := time.Date(2023, 3, 25, 0, 0, 0, 0, time.UTC)
+			for i := 1; i <= 10; i++ {
+				select {
+				case line := <-lines:
+					expected := fmt.Sprintf("%s,device=dev\\ 1 val=%di %d", tableName, i, timestamp.UnixNano())
+					lpits.Equal(expected, line)
+					timestamp = timestamp.Add(time.Minute)
+				case <-time.After(time.Minute):
+					return errors.Errorf("expected 10 lines, but received %d", i-1)
+				}
+			}
+			return nil
+		},
+
+		testrunner.WithSetup(func(setupContext testrunner.SetupContext) error {
+			sn, tn, err := setupContext.CreateHypertable("ts", time.Hour*24,
+				testsupport.NewColumn("ts", "timestamptz", false, true, nil),
+				testsupport.NewColumn("device", "text", false, false, nil),
+				testsupport.NewColumn("val", "integer", false, false, nil),
+			)
+			if err != nil {
+				return errors.Wrap(err, 0)
+			}
+			testrunner.Attribute(setupContext, "schemaName", sn)
+			testrunner.Attribute(setupContext, "tableName", tn)
+
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				return errors.Wrap(err, 0)
+			}
+			listener = l
+
+			go func() {
+				for {
+					connection, err := listener.Accept()
+					if err != nil {
+						return
+					}
+					go func() {
+						defer connection.Close()
+						scanner := bufio.NewScanner(connection)
+						for scanner.Scan() {
+							lines <- scanner.Text()
+						}
+					}()
+				}
+			}()
+
+			setupContext.AddSystemConfigConfigurator(func(config *sysconfig.SystemConfig) {
+				config.Sink.Type = spiconfig.LineProtocol
+				config.Sink.LineProtocol = spiconfig.LineProtocolConfig{
+					Address: fmt.Sprintf("tcp://%s", listener.Addr().String()),
+					Batch: spiconfig.LineProtocolBatchConfig{
+						Size:     100,
+						Interval: 500,
+					},
+				}
+			})
+
+			return nil
+		}),
+
+		testrunner.WithTearDown(func(ctx testrunner.Context) error {
+			if listener != nil {
+				listener.Close()
+			}
+			return nil
+		}),
+	)
+}
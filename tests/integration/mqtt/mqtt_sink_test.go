@@ -0,0 +1,506 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/internal/sysconfig"
+	"github.com/noctarius/timescaledb-event-streamer/internal/waiting"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport/containers"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport/testrunner"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/testcontainers/testcontainers-go"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+type MqttIntegrationTestSuite struct {
+	testrunner.TestRunner
+}
+
+func TestMqttIntegrationTestSuite(
+	t *testing.T,
+) {
+
+	suite.Run(t, new(MqttIntegrationTestSuite))
+}
+
+func (mits *MqttIntegrationTestSuite) Test_Mqtt_Sink() {
+	topicPrefix := lo.RandomString(10, lo.LowerCaseLettersCharset)
+
+	mqttLogger, err := logging.NewLogger("Test_Mqtt_Sink")
+	if err != nil {
+		mits.T().Error(err)
+	}
+
+	var brokerUrl string
+	var container testcontainers.Container
+
+	mits.RunTest(
+		func(ctx testrunner.Context) error {
+			topic := fmt.Sprintf(
+				"%s/%s/%s", topicPrefix,
+				testrunner.GetAttribute[string](ctx, "schemaName"),
+				testrunner.GetAttribute[string](ctx, "tableName"),
+			)
+
+			waiter := waiting.NewWaiterWithTimeout(time.Minute)
+			envelopes := make([]testsupport.Envelope, 0)
+			client, err := subscribe(brokerUrl, "subscriber", topic, func(message mqtt.Message) {
+				envelope := testsupport.Envelope{}
+				if err := json.Unmarshal(message.Payload(), &envelope); err != nil {
+					mits.T().Error(err)
+				}
+				mqttLogger.Debugf("EVENT: %+v", envelope)
+				envelopes = append(envelopes, envelope)
+				if len(envelopes) >= 10 {
+					waiter.Signal()
+				}
+			})
+			if err != nil {
+				return err
+			}
+			defer client.Disconnect(100)
+
+			if _, err := ctx.Exec(context.Background(),
+				fmt.Sprintf(
+					"INSERT INTO \"%s\" SELECT ts, ROW_NUMBER() OVER (ORDER BY ts) AS val FROM GENERATE_SERIES('2023-03-25 00:00:00'::TIMESTAMPTZ, '2023-03-25 00:09:59'::TIMESTAMPTZ, INTERVAL '1 minute') t(ts)",
+					testrunner.GetAttribute[string](ctx, "tableName"),
+				),
+			); err != nil {
+				return err
+			}
+
+			if err := waiter.Await(); err != nil {
+				return err
+			}
+
+			for i, envelope := range envelopes {
+				assert.Equal(mits.T(), i+1, int(envelope.Payload.After["val"].(float64)))
+			}
+			return nil
+		},
+
+		testrunner.WithSetup(func(setupContext testrunner.SetupContext) error {
+			sn, tn, err := setupContext.CreateHypertable("ts", time.Hour*24,
+				testsupport.NewColumn("ts", "timestamptz", false, false, nil),
+				testsupport.NewColumn("val", "integer", false, false, nil),
+			)
+			if err != nil {
+				return err
+			}
+			testrunner.Attribute(setupContext, "schemaName", sn)
+			testrunner.Attribute(setupContext, "tableName", tn)
+
+			mC, mU, err := containers.SetupMosquittoContainer()
+			if err != nil {
+				return errors.Wrap(err, 0)
+			}
+			brokerUrl = mU
+			container = mC
+
+			setupContext.AddSystemConfigConfigurator(func(config *sysconfig.SystemConfig) {
+				config.Topic.Prefix = topicPrefix
+				config.Sink.Type = spiconfig.Mqtt
+				config.Sink.Mqtt = spiconfig.MqttConfig{
+					Broker:   brokerUrl,
+					ClientId: lo.RandomString(10, lo.LowerCaseLettersCharset),
+					QoS:      lo.ToPtr(byte(1)),
+				}
+			})
+
+			return nil
+		}),
+
+		testrunner.WithTearDown(func(ctx testrunner.Context) error {
+			if container != nil {
+				container.Terminate(context.Background())
+			}
+			return nil
+		}),
+	)
+}
+
+func (mits *MqttIntegrationTestSuite) Test_Mqtt_Sink_Protocol_Version_5() {
+	topicPrefix := lo.RandomString(10, lo.LowerCaseLettersCharset)
+
+	mqttLogger, err := logging.NewLogger("Test_Mqtt_Sink_Protocol_Version_5")
+	if err != nil {
+		mits.T().Error(err)
+	}
+
+	var brokerUrl string
+	var container testcontainers.Container
+
+	mits.RunTest(
+		func(ctx testrunner.Context) error {
+			topic := fmt.Sprintf(
+				"%s/%s/%s", topicPrefix,
+				testrunner.GetAttribute[string](ctx, "schemaName"),
+				testrunner.GetAttribute[string](ctx, "tableName"),
+			)
+
+			waiter := waiting.NewWaiterWithTimeout(time.Minute)
+			envelopes := make([]testsupport.Envelope, 0)
+			client, err := subscribe(brokerUrl, "subscriber", topic, func(message mqtt.Message) {
+				envelope := testsupport.Envelope{}
+				if err := json.Unmarshal(message.Payload(), &envelope); err != nil {
+					mits.T().Error(err)
+				}
+				mqttLogger.Debugf("EVENT: %+v", envelope)
+				envelopes = append(envelopes, envelope)
+				if len(envelopes) >= 10 {
+					waiter.Signal()
+				}
+			})
+			if err != nil {
+				return err
+			}
+			defer client.Disconnect(100)
+
+			if _, err := ctx.Exec(context.Background(),
+				fmt.Sprintf(
+					"INSERT INTO \"%s\" SELECT ts, ROW_NUMBER() OVER (ORDER BY ts) AS val FROM GENERATE_SERIES('2023-03-25 00:00:00'::TIMESTAMPTZ, '2023-03-25 00:09:59'::TIMESTAMPTZ, INTERVAL '1 minute') t(ts)",
+					testrunner.GetAttribute[string](ctx, "tableName"),
+				),
+			); err != nil {
+				return err
+			}
+
+			if err := waiter.Await(); err != nil {
+				return err
+			}
+
+			for i, envelope := range envelopes {
+				assert.Equal(mits.T(), i+1, int(envelope.Payload.After["val"].(float64)))
+			}
+			return nil
+		},
+
+		testrunner.WithSetup(func(setupContext testrunner.SetupContext) error {
+			sn, tn, err := setupContext.CreateHypertable("ts", time.Hour*24,
+				testsupport.NewColumn("ts", "timestamptz", false, false, nil),
+				testsupport.NewColumn("val", "integer", false, false, nil),
+			)
+			if err != nil {
+				return err
+			}
+			testrunner.Attribute(setupContext, "schemaName", sn)
+			testrunner.Attribute(setupContext, "tableName", tn)
+
+			mC, mU, err := containers.SetupMosquittoContainer()
+			if err != nil {
+				return errors.Wrap(err, 0)
+			}
+			brokerUrl = mU
+			container = mC
+
+			setupContext.AddSystemConfigConfigurator(func(config *sysconfig.SystemConfig) {
+				config.Topic.Prefix = topicPrefix
+				config.Sink.Type = spiconfig.Mqtt
+				config.Sink.Mqtt = spiconfig.MqttConfig{
+					Broker:          brokerUrl,
+					ClientId:        lo.RandomString(10, lo.LowerCaseLettersCharset),
+					ProtocolVersion: 5,
+					QoS:             lo.ToPtr(byte(1)),
+				}
+			})
+
+			return nil
+		}),
+
+		testrunner.WithTearDown(func(ctx testrunner.Context) error {
+			if container != nil {
+				container.Terminate(context.Background())
+			}
+			return nil
+		}),
+	)
+}
+
+func (mits *MqttIntegrationTestSuite) Test_Mqtt_Sink_Retained() {
+	topicPrefix := lo.RandomString(10, lo.LowerCaseLettersCharset)
+
+	var brokerUrl string
+	var container testcontainers.Container
+
+	mits.RunTest(
+		func(ctx testrunner.Context) error {
+			topic := fmt.Sprintf(
+				"%s/%s/%s/#", topicPrefix,
+				testrunner.GetAttribute[string](ctx, "schemaName"),
+				testrunner.GetAttribute[string](ctx, "tableName"),
+			)
+
+			liveWaiter := waiting.NewWaiterWithTimeout(time.Minute)
+			liveCount := 0
+			liveClient, err := subscribe(brokerUrl, "live", topic, func(_ mqtt.Message) {
+				liveCount++
+				if liveCount >= 10 {
+					liveWaiter.Signal()
+				}
+			})
+			if err != nil {
+				return err
+			}
+			defer liveClient.Disconnect(100)
+
+			if _, err := ctx.Exec(context.Background(),
+				fmt.Sprintf(
+					"INSERT INTO \"%s\" SELECT ts, ROW_NUMBER() OVER (ORDER BY ts) AS val FROM GENERATE_SERIES('2023-03-25 00:00:00'::TIMESTAMPTZ, '2023-03-25 00:09:59'::TIMESTAMPTZ, INTERVAL '1 minute') t(ts)",
+					testrunner.GetAttribute[string](ctx, "tableName"),
+				),
+			); err != nil {
+				return err
+			}
+
+			if err := liveWaiter.Await(); err != nil {
+				return err
+			}
+
+			// A late subscriber receives the latest row per key as retained messages
+			retainedWaiter := waiting.NewWaiterWithTimeout(time.Minute)
+			lock := sync.Mutex{}
+			values := make([]int, 0)
+			retainedClient, err := subscribe(brokerUrl, "retained", topic, func(message mqtt.Message) {
+				assert.True(mits.T(), message.Retained())
+				envelope := testsupport.Envelope{}
+				if err := json.Unmarshal(message.Payload(), &envelope); err != nil {
+					mits.T().Error(err)
+				}
+				lock.Lock()
+				defer lock.Unlock()
+				values = append(values, int(envelope.Payload.After["val"].(float64)))
+				if len(values) >= 10 {
+					retainedWaiter.Signal()
+				}
+			})
+			if err != nil {
+				return err
+			}
+			defer retainedClient.Disconnect(100)
+
+			if err := retainedWaiter.Await(); err != nil {
+				return err
+			}
+
+			sort.Ints(values)
+			for i, value := range values {
+				assert.Equal(mits.T(), i+1, value)
+			}
+			return nil
+		},
+
+		testrunner.WithSetup(func(setupContext testrunner.SetupContext) error {
+			sn, tn, err := setupContext.CreateHypertable("ts", time.Hour*24,
+				testsupport.NewColumn("ts", "timestamptz", false, true, nil),
+				testsupport.NewColumn("val", "integer", false, false, nil),
+			)
+			if err != nil {
+				return err
+			}
+			testrunner.Attribute(setupContext, "schemaName", sn)
+			testrunner.Attribute(setupContext, "tableName", tn)
+
+			mC, mU, err := containers.SetupMosquittoContainer()
+			if err != nil {
+				return errors.Wrap(err, 0)
+			}
+			brokerUrl = mU
+			container = mC
+
+			setupContext.AddSystemConfigConfigurator(func(config *sysconfig.SystemConfig) {
+				config.Topic.Prefix = topicPrefix
+				config.Sink.Type = spiconfig.Mqtt
+				config.Sink.Mqtt = spiconfig.MqttConfig{
+					Broker:   brokerUrl,
+					ClientId: lo.RandomString(10, lo.LowerCaseLettersCharset),
+					QoS:      lo.ToPtr(byte(2)),
+					Retained: lo.ToPtr(true),
+				}
+			})
+
+			return nil
+		}),
+
+		testrunner.WithTearDown(func(ctx testrunner.Context) error {
+			if container != nil {
+				container.Terminate(context.Background())
+			}
+			return nil
+		}),
+	)
+}
+
+func (mits *MqttIntegrationTestSuite) Test_Mqtt_Sink_Retained_Delete() {
+	topicPrefix := lo.RandomString(10, lo.LowerCaseLettersCharset)
+
+	var brokerUrl string
+	var container testcontainers.Container
+
+	mits.RunTest(
+		func(ctx testrunner.Context) error {
+			topic := fmt.Sprintf(
+				"%s/%s/%s/#", topicPrefix,
+				testrunner.GetAttribute[string](ctx, "schemaName"),
+				testrunner.GetAttribute[string](ctx, "tableName"),
+			)
+
+			// 10 inserts and the empty retained message of the delete
+			liveWaiter := waiting.NewWaiterWithTimeout(time.Minute)
+			liveCount := 0
+			liveClient, err := subscribe(brokerUrl, "live", topic, func(_ mqtt.Message) {
+				liveCount++
+				if liveCount >= 11 {
+					liveWaiter.Signal()
+				}
+			})
+			if err != nil {
+				return err
+			}
+			defer liveClient.Disconnect(100)
+
+			if _, err := ctx.Exec(context.Background(),
+				fmt.Sprintf(
+					"INSERT INTO \"%s\" SELECT ts, ROW_NUMBER() OVER (ORDER BY ts) AS val FROM GENERATE_SERIES('2023-03-25 00:00:00'::TIMESTAMPTZ, '2023-03-25 00:09:59'::TIMESTAMPTZ, INTERVAL '1 minute') t(ts)",
+					testrunner.GetAttribute[string](ctx, "tableName"),
+				),
+			); err != nil {
+				return err
+			}
+
+			if _, err := ctx.Exec(context.Background(),
+				fmt.Sprintf(
+					"DELETE FROM \"%s\" WHERE val = 1",
+					testrunner.GetAttribute[string](ctx, "tableName"),
+				),
+			); err != nil {
+				return err
+			}
+
+			if err := liveWaiter.Await(); err != nil {
+				return err
+			}
+
+			// The deleted row isn't retained anymore
+			retainedWaiter := waiting.NewWaiterWithTimeout(time.Minute)
+			lock := sync.Mutex{}
+			values := make([]int, 0)
+			retainedClient, err := subscribe(brokerUrl, "retained", topic, func(message mqtt.Message) {
+				envelope := testsupport.Envelope{}
+				if err := json.Unmarshal(message.Payload(), &envelope); err != nil {
+					mits.T().Error(err)
+				}
+				lock.Lock()
+				defer lock.Unlock()
+				values = append(values, int(envelope.Payload.After["val"].(float64)))
+				if len(values) >= 9 {
+					retainedWaiter.Signal()
+				}
+			})
+			if err != nil {
+				return err
+			}
+			defer retainedClient.Disconnect(100)
+
+			if err := retainedWaiter.Await(); err != nil {
+				return err
+			}
+
+			lock.Lock()
+			defer lock.Unlock()
+			sort.Ints(values)
+			assert.Equal(mits.T(), []int{2, 3, 4, 5, 6, 7, 8, 9, 10}, values)
+			return nil
+		},
+
+		testrunner.WithSetup(func(setupContext testrunner.SetupContext) error {
+			sn, tn, err := setupContext.CreateHypertable("ts", time.Hour*24,
+				testsupport.NewColumn("ts", "timestamptz", false, true, nil),
+				testsupport.NewColumn("val", "integer", false, false, nil),
+			)
+			if err != nil {
+				return err
+			}
+			testrunner.Attribute(setupContext, "schemaName", sn)
+			testrunner.Attribute(setupContext, "tableName", tn)
+
+			mC, mU, err := containers.SetupMosquittoContainer()
+			if err != nil {
+				return errors.Wrap(err, 0)
+			}
+			brokerUrl = mU
+			container = mC
+
+			setupContext.AddSystemConfigConfigurator(func(config *sysconfig.SystemConfig) {
+				config.Topic.Prefix = topicPrefix
+				config.Sink.Type = spiconfig.Mqtt
+				config.Sink.Mqtt = spiconfig.MqttConfig{
+					Broker:   brokerUrl,
+					ClientId: lo.RandomString(10, lo.LowerCaseLettersCharset),
+					QoS:      lo.ToPtr(byte(1)),
+					Retained: lo.ToPtr(true),
+				}
+			})
+
+			return nil
+		}),
+
+		testrunner.WithTearDown(func(ctx testrunner.Context) error {
+			if container != nil {
+				container.Terminate(context.Background())
+			}
+			return nil
+		}),
+	)
+}
+
+func subscribe(
+	brokerUrl, clientId, topic string, handler func(message mqtt.Message),
+) (mqtt.Client, error) {
+
+	options := mqtt.NewClientOptions().
+		AddBroker(brokerUrl).
+		SetClientID(clientId).
+		SetOrderMatters(true)
+
+	client := mqtt.NewClient(options)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		return nil, token.Error()
+	}
+
+	token := client.Subscribe(topic, 1, func(_ mqtt.Client, message mqtt.Message) {
+		handler(message)
+	})
+	if token.Wait() && token.Error() != nil {
+		client.Disconnect(100)
+		return nil, token.Error()
+	}
+	return client, nil
+}
@@ -174,3 +174,117 @@ func (nits *NatsIntegrationTestSuite) Test_Nats_Sink() {
 		}),
 	)
 }
+
+func (nits *NatsIntegrationTestSuite) Test_Nats_Sink_Stream_Provisioning() {
+	topicPrefix := lo.RandomString(10, lo.LowerCaseLettersCharset)
+	streamName := lo.RandomString(10, lo.LowerCaseLettersCharset)
+
+	var natsUrl string
+	var natsContainer testcontainers.Container
+
+	nits.RunTest(
+		func(ctx testrunner.Context) error {
+			conn, err := nats.Connect(natsUrl, nats.DontRandomize(), nats.RetryOnFailedConnect(true), nats.MaxReconnects(-1))
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+
+			js, err := conn.JetStream()
+			if err != nil {
+				return err
+			}
+
+			// The stream is provisioned by the sink on start
+			info, err := js.StreamInfo(streamName)
+			if err != nil {
+				return err
+			}
+			assert.Equal(nits.T(), []string{topicPrefix + ".>"}, info.Config.Subjects)
+			assert.Equal(nits.T(), time.Hour, info.Config.MaxAge)
+
+			subjectName := fmt.Sprintf(
+				"%s.%s.%s", topicPrefix,
+				testrunner.GetAttribute[string](ctx, "schemaName"),
+				testrunner.GetAttribute[string](ctx, "tableName"),
+			)
+
+			waiter := waiting.NewWaiterWithTimeout(time.Minute)
+			msgIds := make([]string, 0)
+			_, err = js.Subscribe(subjectName, func(msg *nats.Msg) {
+				msgIds = append(msgIds, msg.Header.Get(nats.MsgIdHdr))
+				if len(msgIds) >= 10 {
+					waiter.Signal()
+				}
+				msg.Ack()
+			}, nats.ManualAck())
+			if err != nil {
+				return err
+			}
+
+			if _, err := ctx.Exec(context.Background(),
+				fmt.Sprintf(
+					"INSERT INTO \"%s\" SELECT ts, ROW_NUMBER() OVER (ORDER BY ts) AS val FROM GENERATE_SERIES('2023-03-25 00:00:00'::TIMESTAMPTZ, '2023-03-25 00:09:59'::TIMESTAMPTZ, INTERVAL '1 minute') t(ts)",
+					testrunner.GetAttribute[string](ctx, "tableName"),
+				),
+			); err != nil {
+				return err
+			}
+
+			if err := waiter.Await(); err != nil {
+				return err
+			}
+
+			// Every event carries a distinct id for the deduplication
+			assert.Len(nits.T(), lo.Uniq(msgIds), 10)
+			for _, msgId := range msgIds {
+				assert.NotEmpty(nits.T(), msgId)
+			}
+			return nil
+		},
+
+		testrunner.WithSetup(func(setupContext testrunner.SetupContext) error {
+			sn, tn, err := setupContext.CreateHypertable("ts", time.Hour*24,
+				testsupport.NewColumn("ts", "timestamptz", false, true, nil),
+				testsupport.NewColumn("val", "integer", false, false, nil),
+			)
+			if err != nil {
+				return err
+			}
+			testrunner.Attribute(setupContext, "schemaName", sn)
+			testrunner.Attribute(setupContext, "tableName", tn)
+
+			nC, nU, err := containers.SetupNatsContainer()
+			if err != nil {
+				return errors.Wrap(err, 0)
+			}
+			natsUrl = nU
+			natsContainer = nC
+
+			setupContext.AddSystemConfigConfigurator(func(config *sysconfig.SystemConfig) {
+				config.Topic.Prefix = topicPrefix
+				config.Sink.Type = spiconfig.NATS
+				config.Sink.Nats = spiconfig.NatsConfig{
+					Address:       natsUrl,
+					Authorization: spiconfig.UserInfo,
+					JetStream: spiconfig.NatsJetStreamConfig{
+						Stream: spiconfig.NatsStreamConfig{
+							Create: true,
+							Name:   streamName,
+							MaxAge: lo.ToPtr(3600),
+						},
+					},
+				}
+			})
+
+			return nil
+		}),
+
+		testrunner.WithTearDown(func(ctx testrunner.Context) error {
+			if natsContainer != nil {
+				natsContainer.Terminate(context.Background())
+			}
+			return nil
+		}),
+	)
+}
@@ -0,0 +1,165 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/noctarius/timescaledb-event-streamer/internal/sysconfig"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport/testrunner"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"testing"
+	"time"
+)
+
+type PostgreSQLIntegrationTestSuite struct {
+	testrunner.TestRunner
+}
+
+func TestPostgreSQLIntegrationTestSuite(
+	t *testing.T,
+) {
+
+	suite.Run(t, new(PostgreSQLIntegrationTestSuite))
+}
+
+func (pits *PostgreSQLIntegrationTestSuite) Test_PostgreSQL_Sink() {
+	targetSchema := lo.RandomString(10, lo.LowerCaseLettersCharset)
+
+	pits.RunTest(
+		func(ctx testrunner.Context) error {
+			query := fmt.Sprintf(
+				"SELECT count(*), sum(val) FROM %s",
+				pgx.Identifier{targetSchema, testrunner.GetAttribute[string](ctx, "tableName")}.Sanitize(),
+			)
+
+			if _, err := ctx.Exec(context.Background(),
+				fmt.Sprintf(
+					"INSERT INTO \"%s\" SELECT ts, ROW_NUMBER() OVER (ORDER BY ts) AS val FROM GENERATE_SERIES('2023-03-25 00:00:00'::TIMESTAMPTZ, '2023-03-25 00:09:59'::TIMESTAMPTZ, INTERVAL '1 minute') t(ts)",
+					testrunner.GetAttribute[string](ctx, "tableName"),
+				),
+			); err != nil {
+				return err
+			}
+
+			if err := awaitResult(ctx, query, 10, 55); err != nil {
+				return err
+			}
+
+			// The target table should've been created as a hypertable
+			if err := ctx.PrivilegedContext(func(privilegedContext testrunner.PrivilegedContext) error {
+				var hypertable bool
+				if err := privilegedContext.QueryRow(context.Background(),
+					"SELECT EXISTS(SELECT 1 FROM timescaledb_information.hypertables WHERE hypertable_schema = $1)",
+					targetSchema,
+				).Scan(&hypertable); err != nil {
+					return err
+				}
+				assert.True(pits.T(), hypertable)
+				return nil
+			}); err != nil {
+				return err
+			}
+
+			// Update and delete in a single transaction
+			tx, err := ctx.Begin(context.Background())
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(context.Background(),
+				fmt.Sprintf(
+					"UPDATE \"%s\" SET val = 100 WHERE val = 5",
+					testrunner.GetAttribute[string](ctx, "tableName"),
+				),
+			); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(context.Background(),
+				fmt.Sprintf(
+					"DELETE FROM \"%s\" WHERE val = 10",
+					testrunner.GetAttribute[string](ctx, "tableName"),
+				),
+			); err != nil {
+				return err
+			}
+			if err := tx.Commit(context.Background()); err != nil {
+				return err
+			}
+
+			return awaitResult(ctx, query, 9, 140)
+		},
+
+		testrunner.WithSetup(func(setupContext testrunner.SetupContext) error {
+			sn, tn, err := setupContext.CreateHypertable("ts", time.Hour*24,
+				testsupport.NewColumn("ts", "timestamptz", false, true, nil),
+				testsupport.NewColumn("val", "integer", false, false, nil),
+			)
+			if err != nil {
+				return errors.Wrap(err, 0)
+			}
+			testrunner.Attribute(setupContext, "schemaName", sn)
+			testrunner.Attribute(setupContext, "tableName", tn)
+
+			setupContext.AddSystemConfigConfigurator(func(config *sysconfig.SystemConfig) {
+				// The source database doubles as the target, the target schema
+				// isn't part of the publication and doesn't loop back
+				config.Sink.Type = spiconfig.PostgreSQL
+				config.Sink.PostgreSQL = spiconfig.PostgreSQLSinkConfig{
+					Connection: fmt.Sprintf(
+						"postgres://postgres:postgres@%s:%d/%s",
+						config.PgxConfig.Host, config.PgxConfig.Port, config.PgxConfig.Database,
+					),
+					Schema:      targetSchema,
+					AutoCreate:  lo.ToPtr(true),
+					Hypertables: lo.ToPtr(true),
+				}
+			})
+
+			return nil
+		}),
+	)
+}
+
+func awaitResult(
+	ctx testrunner.Context, query string, expectedCount, expectedSum int64,
+) error {
+
+	return ctx.PrivilegedContext(func(privilegedContext testrunner.PrivilegedContext) error {
+		var count, sum int64
+		deadline := time.Now().Add(time.Minute)
+		for time.Now().Before(deadline) {
+			// The target table may not exist yet
+			if err := privilegedContext.QueryRow(context.Background(), query).Scan(&count, &sum); err == nil {
+				if count == expectedCount && sum == expectedSum {
+					return nil
+				}
+			}
+			time.Sleep(500 * time.Millisecond)
+		}
+		return errors.Errorf(
+			"expected %d rows with a sum of %d, but found %d rows with a sum of %d",
+			expectedCount, expectedSum, count, sum,
+		)
+	})
+}
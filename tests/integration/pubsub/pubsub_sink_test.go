@@ -0,0 +1,212 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pubsub
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/sysconfig"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport/containers"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport/testrunner"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/testcontainers/testcontainers-go"
+	"net/http"
+	"sort"
+	"testing"
+	"time"
+)
+
+const projectId = "test-project"
+
+type pullResponse struct {
+	ReceivedMessages []struct {
+		Message struct {
+			Data        string            `json:"data"`
+			Attributes  map[string]string `json:"attributes"`
+			OrderingKey string            `json:"orderingKey"`
+		} `json:"message"`
+	} `json:"receivedMessages"`
+}
+
+type PubSubIntegrationTestSuite struct {
+	testrunner.TestRunner
+}
+
+func TestPubSubIntegrationTestSuite(
+	t *testing.T,
+) {
+
+	suite.Run(t, new(PubSubIntegrationTestSuite))
+}
+
+func (psits *PubSubIntegrationTestSuite) Test_PubSub_Sink() {
+	topicPrefix := lo.RandomString(10, lo.LowerCaseLettersCharset)
+
+	var emulatorHost string
+	var container testcontainers.Container
+
+	psits.RunTest(
+		func(ctx testrunner.Context) error {
+			topicName := fmt.Sprintf(
+				"%s.%s.%s", topicPrefix,
+				testrunner.GetAttribute[string](ctx, "schemaName"),
+				testrunner.GetAttribute[string](ctx, "tableName"),
+			)
+
+			// The topic is created by the sink with the first event, but the
+			// subscription has to exist before the events are published
+			baseUrl := fmt.Sprintf("http://%s/v1/projects/%s", emulatorHost, projectId)
+			if err := request("PUT", fmt.Sprintf("%s/topics/%s", baseUrl, topicName), nil, nil); err != nil {
+				return err
+			}
+			if err := request("PUT", fmt.Sprintf("%s/subscriptions/test-subscription", baseUrl), map[string]any{
+				"topic":                 fmt.Sprintf("projects/%s/topics/%s", projectId, topicName),
+				"enableMessageOrdering": true,
+			}, nil); err != nil {
+				return err
+			}
+
+			if _, err := ctx.Exec(context.Background(),
+				fmt.Sprintf(
+					"INSERT INTO \"%s\" SELECT ts, ROW_NUMBER() OVER (ORDER BY ts) AS val FROM GENERATE_SERIES('2023-03-25 00:00:00'::TIMESTAMPTZ, '2023-03-25 00:09:59'::TIMESTAMPTZ, INTERVAL '1 minute') t(ts)",
+					testrunner.GetAttribute[string](ctx, "tableName"),
+				),
+			); err != nil {
+				return err
+			}
+
+			envelopes := make([]testsupport.Envelope, 0)
+			deadline := time.Now().Add(time.Minute)
+			for len(envelopes) < 10 && time.Now().Before(deadline) {
+				response := pullResponse{}
+				if err := request("POST", fmt.Sprintf("%s/subscriptions/test-subscription:pull", baseUrl),
+					map[string]any{"maxMessages": 10}, &response,
+				); err != nil {
+					return err
+				}
+
+				for _, received := range response.ReceivedMessages {
+					assert.Equal(psits.T(), topicName, received.Message.Attributes["topic"])
+					assert.NotEmpty(psits.T(), received.Message.OrderingKey)
+
+					data, err := base64.StdEncoding.DecodeString(received.Message.Data)
+					if err != nil {
+						return err
+					}
+					envelope := testsupport.Envelope{}
+					if err := json.Unmarshal(data, &envelope); err != nil {
+						return err
+					}
+					envelopes = append(envelopes, envelope)
+				}
+			}
+
+			if !assert.Len(psits.T(), envelopes, 10) {
+				return nil
+			}
+
+			// Messages with different ordering keys may be delivered out of order
+			sort.Slice(envelopes, func(i, j int) bool {
+				return envelopes[i].Payload.After["val"].(float64) < envelopes[j].Payload.After["val"].(float64)
+			})
+			for i, envelope := range envelopes {
+				assert.Equal(psits.T(), i+1, int(envelope.Payload.After["val"].(float64)))
+			}
+			return nil
+		},
+
+		testrunner.WithSetup(func(setupContext testrunner.SetupContext) error {
+			sn, tn, err := setupContext.CreateHypertable("ts", time.Hour*24,
+				testsupport.NewColumn("ts", "timestamptz", false, true, nil),
+				testsupport.NewColumn("val", "integer", false, false, nil),
+			)
+			if err != nil {
+				return err
+			}
+			testrunner.Attribute(setupContext, "schemaName", sn)
+			testrunner.Attribute(setupContext, "tableName", tn)
+
+			container, emulatorHost, err = containers.SetupPubSubEmulatorContainer()
+			if err != nil {
+				return errors.Wrap(err, 0)
+			}
+
+			setupContext.AddSystemConfigConfigurator(func(config *sysconfig.SystemConfig) {
+				config.Topic.Prefix = topicPrefix
+				config.Sink.Type = spiconfig.PubSub
+				config.Sink.PubSub = spiconfig.PubSubConfig{
+					ProjectId:    projectId,
+					EmulatorHost: emulatorHost,
+					Topic: spiconfig.PubSubTopicConfig{
+						Create: lo.ToPtr(true),
+					},
+				}
+			})
+
+			return nil
+		}),
+
+		testrunner.WithTearDown(func(ctx testrunner.Context) error {
+			if container != nil {
+				container.Terminate(context.Background())
+			}
+			return nil
+		}),
+	)
+}
+
+func request(
+	method, url string, body, result any,
+) error {
+
+	if body == nil {
+		body = map[string]any{}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	response, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return errors.Errorf("%s %s failed with status %d", method, url, response.StatusCode)
+	}
+	if result != nil {
+		return json.NewDecoder(response.Body).Decode(result)
+	}
+	return nil
+}
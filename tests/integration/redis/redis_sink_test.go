@@ -168,3 +168,120 @@ func (rits *RedisIntegrationTestSuite) Test_Redis_Sink() {
 		}),
 	)
 }
+
+func (rits *RedisIntegrationTestSuite) Test_Redis_KeyValue_Sink() {
+	topicPrefix := lo.RandomString(10, lo.LowerCaseLettersCharset)
+
+	var address string
+	var container testcontainers.Container
+
+	rits.RunTest(
+		func(ctx testrunner.Context) error {
+			client := redis.NewClient(&redis.Options{
+				Addr: address,
+			})
+			defer client.Close()
+
+			pattern := fmt.Sprintf("%s:*", testrunner.GetAttribute[string](ctx, "tableName"))
+
+			if _, err := ctx.Exec(context.Background(),
+				fmt.Sprintf(
+					"INSERT INTO \"%s\" SELECT ts, ROW_NUMBER() OVER (ORDER BY ts) AS val FROM GENERATE_SERIES('2023-03-25 00:00:00'::TIMESTAMPTZ, '2023-03-25 00:09:59'::TIMESTAMPTZ, INTERVAL '1 minute') t(ts)",
+					testrunner.GetAttribute[string](ctx, "tableName"),
+				),
+			); err != nil {
+				return err
+			}
+
+			if err := awaitKeys(client, pattern, 10); err != nil {
+				return err
+			}
+
+			keys, err := client.Keys(pattern).Result()
+			if err != nil {
+				return err
+			}
+			sum := 0
+			for _, key := range keys {
+				value, err := client.HGet(key, "val").Int()
+				if err != nil {
+					return err
+				}
+				sum += value
+			}
+			assert.Equal(rits.T(), 55, sum)
+
+			if _, err := ctx.Exec(context.Background(),
+				fmt.Sprintf(
+					"DELETE FROM \"%s\" WHERE val = 10",
+					testrunner.GetAttribute[string](ctx, "tableName"),
+				),
+			); err != nil {
+				return err
+			}
+
+			return awaitKeys(client, pattern, 9)
+		},
+
+		testrunner.WithSetup(func(setupContext testrunner.SetupContext) error {
+			sn, tn, err := setupContext.CreateHypertable("ts", time.Hour*24,
+				testsupport.NewColumn("ts", "timestamptz", false, true, nil),
+				testsupport.NewColumn("val", "integer", false, false, nil),
+			)
+			if err != nil {
+				return err
+			}
+			testrunner.Attribute(setupContext, "schemaName", sn)
+			testrunner.Attribute(setupContext, "tableName", tn)
+
+			rC, rA, err := containers.SetupRedisContainer()
+			if err != nil {
+				return errors.Wrap(err, 0)
+			}
+			address = rA
+			container = rC
+
+			setupContext.AddSystemConfigConfigurator(func(config *sysconfig.SystemConfig) {
+				config.Topic.Prefix = topicPrefix
+				config.Sink.Type = spiconfig.Redis
+				config.Sink.Redis = spiconfig.RedisConfig{
+					Address: address,
+					Mode:    spiconfig.RedisKeyValueMode,
+					KeyValue: spiconfig.RedisKeyValueConfig{
+						Format: spiconfig.RedisHashFormat,
+						Key:    "{table}:{key}",
+					},
+				}
+			})
+
+			return nil
+		}),
+
+		testrunner.WithTearDown(func(ctx testrunner.Context) error {
+			if container != nil {
+				container.Terminate(context.Background())
+			}
+			return nil
+		}),
+	)
+}
+
+func awaitKeys(
+	client *redis.Client, pattern string, expected int,
+) error {
+
+	deadline := time.Now().Add(time.Minute)
+	for {
+		keys, err := client.Keys(pattern).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) == expected {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errors.Errorf("expected %d keys matching '%s', found %d", expected, pattern, len(keys))
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
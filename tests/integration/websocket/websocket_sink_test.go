@@ -0,0 +1,192 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/internal/sysconfig"
+	"github.com/noctarius/timescaledb-event-streamer/internal/waiting"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport/testrunner"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/websocket"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type pushedMessage struct {
+	Topic string               `json:"topic"`
+	Value testsupport.Envelope `json:"value"`
+}
+
+type WebSocketIntegrationTestSuite struct {
+	testrunner.TestRunner
+}
+
+func TestWebSocketIntegrationTestSuite(
+	t *testing.T,
+) {
+
+	suite.Run(t, new(WebSocketIntegrationTestSuite))
+}
+
+func (wits *WebSocketIntegrationTestSuite) Test_WebSocket_Sink() {
+	topicPrefix := lo.RandomString(10, lo.LowerCaseLettersCharset)
+
+	webSocketLogger, err := logging.NewLogger("Test_WebSocket_Sink")
+	if err != nil {
+		wits.T().Error(err)
+	}
+
+	var address string
+
+	wits.RunTest(
+		func(ctx testrunner.Context) error {
+			topicPattern := fmt.Sprintf("%s.%s.*", topicPrefix, testrunner.GetAttribute[string](ctx, "schemaName"))
+
+			connection, err := websocket.Dial(
+				fmt.Sprintf("ws://%s/ws?topic=%s", address, topicPattern), "", "http://localhost",
+			)
+			if err != nil {
+				return err
+			}
+			defer connection.Close()
+
+			response, err := http.Get(fmt.Sprintf("http://%s/sse?topic=%s", address, topicPattern))
+			if err != nil {
+				return err
+			}
+			defer response.Body.Close()
+
+			webSocketWaiter := waiting.NewWaiterWithTimeout(time.Minute)
+			webSocketMessages := make([]pushedMessage, 0)
+			go func() {
+				for {
+					var data string
+					if err := websocket.Message.Receive(connection, &data); err != nil {
+						return
+					}
+					message := pushedMessage{}
+					if err := json.Unmarshal([]byte(data), &message); err != nil {
+						wits.T().Error(err)
+					}
+					webSocketLogger.Debugf("EVENT: %+v", message)
+					webSocketMessages = append(webSocketMessages, message)
+					if len(webSocketMessages) >= 10 {
+						webSocketWaiter.Signal()
+					}
+				}
+			}()
+
+			sseWaiter := waiting.NewWaiterWithTimeout(time.Minute)
+			sseMessages := make([]pushedMessage, 0)
+			go func() {
+				reader := bufio.NewReader(response.Body)
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if !strings.HasPrefix(line, "data: ") {
+						continue
+					}
+					message := pushedMessage{}
+					if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &message); err != nil {
+						wits.T().Error(err)
+					}
+					sseMessages = append(sseMessages, message)
+					if len(sseMessages) >= 10 {
+						sseWaiter.Signal()
+					}
+				}
+			}()
+
+			if _, err := ctx.Exec(context.Background(),
+				fmt.Sprintf(
+					"INSERT INTO \"%s\" SELECT ts, ROW_NUMBER() OVER (ORDER BY ts) AS val FROM GENERATE_SERIES('2023-03-25 00:00:00'::TIMESTAMPTZ, '2023-03-25 00:09:59'::TIMESTAMPTZ, INTERVAL '1 minute') t(ts)",
+					testrunner.GetAttribute[string](ctx, "tableName"),
+				),
+			); err != nil {
+				return err
+			}
+
+			if err := webSocketWaiter.Await(); err != nil {
+				return err
+			}
+			if err := sseWaiter.Await(); err != nil {
+				return err
+			}
+
+			expectedTopic := fmt.Sprintf(
+				"%s.%s.%s", topicPrefix,
+				testrunner.GetAttribute[string](ctx, "schemaName"),
+				testrunner.GetAttribute[string](ctx, "tableName"),
+			)
+			for _, messages := range [][]pushedMessage{webSocketMessages, sseMessages} {
+				for i, message := range messages {
+					assert.Equal(wits.T(), expectedTopic, message.Topic)
+					assert.Equal(wits.T(), i+1, int(message.Value.Payload.After["val"].(float64)))
+				}
+			}
+			return nil
+		},
+
+		testrunner.WithSetup(func(setupContext testrunner.SetupContext) error {
+			sn, tn, err := setupContext.CreateHypertable("ts", time.Hour*24,
+				testsupport.NewColumn("ts", "timestamptz", false, true, nil),
+				testsupport.NewColumn("val", "integer", false, false, nil),
+			)
+			if err != nil {
+				return err
+			}
+			testrunner.Attribute(setupContext, "schemaName", sn)
+			testrunner.Attribute(setupContext, "tableName", tn)
+
+			// Find a free port for the embedded server
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				return err
+			}
+			address = listener.Addr().String()
+			if err := listener.Close(); err != nil {
+				return err
+			}
+
+			setupContext.AddSystemConfigConfigurator(func(config *sysconfig.SystemConfig) {
+				config.Topic.Prefix = topicPrefix
+				config.Sink.Type = spiconfig.WebSocket
+				config.Sink.WebSocket = spiconfig.WebSocketConfig{
+					Address:    address,
+					BufferSize: 100,
+				}
+			})
+
+			return nil
+		}),
+	)
+}
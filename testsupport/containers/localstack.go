@@ -98,3 +98,54 @@ func SetupLocalStackWithKinesis() (testcontainers.Container, string, error) {
 		fmt.Sprintf("http://%s:%d", host, port.Int()),
 		nil
 }
+
+func SetupLocalStackWithS3() (testcontainers.Container, string, error) {
+	customizer := testcontainers.CustomizeRequestOption(func(req *testcontainers.GenericContainerRequest) {
+		req.Env["SERVICES"] = "s3"
+	})
+
+	container, err := setupLocalStack(customizer)
+	if err != nil {
+		return nil, "", err
+	}
+
+	host, err := container.Host(context.Background())
+	if err != nil {
+		return nil, "", err
+	}
+
+	port, err := container.MappedPort(context.Background(), "4566/tcp")
+	if err != nil {
+		return nil, "", err
+	}
+
+	return container,
+		fmt.Sprintf("http://%s:%d", host, port.Int()),
+		nil
+}
+
+func SetupLocalStackWithSNS() (testcontainers.Container, string, error) {
+	customizer := testcontainers.CustomizeRequestOption(func(req *testcontainers.GenericContainerRequest) {
+		req.Env["SQS_ENDPOINT_STRATEGY"] = "path"
+		req.Env["SERVICES"] = "sns,sqs"
+	})
+
+	container, err := setupLocalStack(customizer)
+	if err != nil {
+		return nil, "", err
+	}
+
+	host, err := container.Host(context.Background())
+	if err != nil {
+		return nil, "", err
+	}
+
+	port, err := container.MappedPort(context.Background(), "4566/tcp")
+	if err != nil {
+		return nil, "", err
+	}
+
+	return container,
+		fmt.Sprintf("http://%s:%d", host, port.Int()),
+		nil
+}
@@ -0,0 +1,86 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package containers
+
+import (
+	"context"
+	"fmt"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+	"io"
+	"time"
+)
+
+const pulsarWebSocketProtocol = "ws"
+
+func SetupPulsarContainer() (testcontainers.Container, string, error) {
+	containerRequest := testcontainers.ContainerRequest{
+		Image:        "apachepulsar/pulsar:3.1.2",
+		ExposedPorts: []string{"6650/tcp", "8080/tcp"},
+		Cmd:          []string{"bin/pulsar", "standalone"},
+		WaitingFor: wait.ForAll(
+			wait.ForHTTP("/admin/v2/clusters").
+				WithPort("8080/tcp").
+				WithResponseMatcher(func(body io.Reader) bool {
+					data, err := io.ReadAll(body)
+					return err == nil && string(data) == `["standalone"]`
+				}),
+			wait.ForLog("Successfully updated the policies on namespace public/default"),
+		).WithDeadline(time.Minute * 3),
+	}
+
+	logger, err := logging.NewLogger("testcontainers")
+	if err != nil {
+		return nil, "", err
+	}
+	pulsarLogger, err := logging.NewLogger("testcontainers-pulsar")
+	if err != nil {
+		return nil, "", err
+	}
+
+	container, err := testcontainers.GenericContainer(
+		context.Background(),
+		testcontainers.GenericContainerRequest{
+			ContainerRequest: containerRequest,
+			Started:          true,
+			Logger:           logger,
+		},
+	)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Collect logs
+	container.FollowOutput(newLogConsumer(pulsarLogger))
+	container.StartLogProducer(context.Background())
+
+	host, err := container.Host(context.Background())
+	if err != nil {
+		container.Terminate(context.Background())
+		return nil, "", err
+	}
+
+	port, err := container.MappedPort(context.Background(), "8080/tcp")
+	if err != nil {
+		container.Terminate(context.Background())
+		return nil, "", err
+	}
+
+	return container, fmt.Sprintf("%s://%s:%d", pulsarWebSocketProtocol, host, port.Int()), nil
+}